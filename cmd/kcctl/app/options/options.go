@@ -216,6 +216,7 @@ type OpLog struct {
 
 type ImageProxy struct {
 	KcImageRepoMirror string `json:"kcImageRepoMirror" yaml:"kcImageRepoMirror,omitempty"`
+	KcPackageMirror   string `json:"kcPackageMirror" yaml:"kcPackageMirror,omitempty"`
 }
 
 type Agents map[string]Metadata // key:ip
@@ -489,6 +490,7 @@ func (c *DeployConfig) AddFlags(flags *pflag.FlagSet) {
 	flags.StringVar(&c.OpLog.Dir, "oplog-dir", c.OpLog.Dir, "kc agent operation log dir")
 	flags.IntVar(&c.OpLog.Threshold, "oplog-threshold", c.OpLog.Threshold, "kc agent operation log single threshold")
 	flags.StringVar(&c.ImageProxy.KcImageRepoMirror, "kc-image-repo-mirror", c.ImageProxy.KcImageRepoMirror, "K8s image repository mirror")
+	flags.StringVar(&c.ImageProxy.KcPackageMirror, "kc-package-mirror", c.ImageProxy.KcPackageMirror, "Online package download mirror base url")
 	flags.DurationVar(&c.KCServerHealthCheckTimeout, "kc-server-health-check-timeout", c.KCServerHealthCheckTimeout, "kc server health check timeout, default is 30s")
 
 	AddFlagsToSSH(c.SSHConfig, flags)
@@ -613,6 +615,7 @@ func (c *DeployConfig) GetKcAgentConfigTemplateContent(metadata Metadata) (strin
 	data["OpLogDir"] = c.OpLog.Dir
 	data["OpLogThreshold"] = c.OpLog.Threshold
 	data["KcImageRepoMirror"] = c.ImageProxy.KcImageRepoMirror
+	data["KcPackageMirror"] = c.ImageProxy.KcPackageMirror
 	var buffer bytes.Buffer
 	if err = tmpl.Execute(&buffer, data); err != nil {
 		return "", fmt.Errorf("template execute failed: %s", err.Error())
@@ -24,6 +24,7 @@ import (
 
 	"github.com/kubeclipper/kubeclipper/cmd/kcctl/app/options"
 	"github.com/kubeclipper/kubeclipper/pkg/agent/config"
+	"github.com/kubeclipper/kubeclipper/pkg/component"
 	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	"github.com/kubeclipper/kubeclipper/pkg/oplog"
 	"github.com/kubeclipper/kubeclipper/pkg/service"
@@ -36,6 +37,9 @@ type Server struct {
 }
 
 func (s *Server) PrepareRun(stopCh <-chan struct{}) error {
+	if err := component.ValidateRegistrations(); err != nil {
+		return errors.WithMessage(err, "validate component registrations")
+	}
 	opLog, err := oplog.NewOperationLog(s.Config.OpLogOptions)
 	if err != nil {
 		return err
@@ -49,6 +53,8 @@ func (s *Server) PrepareRun(stopCh <-chan struct{}) error {
 		task.WithLeaseDurationSeconds(240),
 		task.WithOplog(opLog),
 		task.WithRepoMirror(s.Config.ImageProxyOptions.KcImageRepoMirror),
+		task.WithPackageMirror(s.Config.ImageProxyOptions.KcPackageMirror),
+		task.WithImagePullJitter(s.Config.ImagePullJitter),
 	)
 	return s.taskService.PrepareRun(stopCh)
 }
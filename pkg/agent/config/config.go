@@ -50,17 +50,20 @@ const (
 
 // Config defines everything needed for apiserver to deal with external services
 type Config struct {
-	AgentID                   string              `json:"agentID,omitempty" yaml:"agentID"`
-	Metadata                  options.Metadata    `json:"metadata,omitempty" yaml:"metadata"`
-	IPDetect                  string              `json:"ipDetect,omitempty" yaml:"ipDetect"`
-	NodeIPDetect              string              `json:"nodeIPDetect,omitempty" yaml:"nodeIPDetect"`
-	RegisterNode              bool                `json:"registerNode,omitempty" yaml:"registerNode"`
-	NodeStatusUpdateFrequency time.Duration       `json:"nodeStatusUpdateFrequency,omitempty" yaml:"nodeStatusUpdateFrequency"`
-	DownloaderOptions         *downloader.Options `json:"downloader" yaml:"downloader" mapstructure:"downloader"`
-	LogOptions                *logger.Options     `json:"log,omitempty" yaml:"log,omitempty" mapstructure:"log"`
-	MQOptions                 *natsio.NatsOptions `json:"mq,omitempty" yaml:"mq,omitempty"  mapstructure:"mq"`
-	OpLogOptions              *oplog.Options      `json:"oplog,omitempty" yaml:"oplog,omitempty" mapstructure:"oplog"`
-	ImageProxyOptions         *imageproxy.Options `json:"imageProxy,omitempty" yaml:"imageProxy,omitempty" mapstructure:"imageProxy"`
+	AgentID                   string           `json:"agentID,omitempty" yaml:"agentID"`
+	Metadata                  options.Metadata `json:"metadata,omitempty" yaml:"metadata"`
+	IPDetect                  string           `json:"ipDetect,omitempty" yaml:"ipDetect"`
+	NodeIPDetect              string           `json:"nodeIPDetect,omitempty" yaml:"nodeIPDetect"`
+	RegisterNode              bool             `json:"registerNode,omitempty" yaml:"registerNode"`
+	NodeStatusUpdateFrequency time.Duration    `json:"nodeStatusUpdateFrequency,omitempty" yaml:"nodeStatusUpdateFrequency"`
+	// ImagePullJitter the max delay before a node pulls images, the delay is derived from agent id,
+	// staggers the image pulls across cluster nodes. Zero means no delay.
+	ImagePullJitter   time.Duration       `json:"imagePullJitter,omitempty" yaml:"imagePullJitter"`
+	DownloaderOptions *downloader.Options `json:"downloader" yaml:"downloader" mapstructure:"downloader"`
+	LogOptions        *logger.Options     `json:"log,omitempty" yaml:"log,omitempty" mapstructure:"log"`
+	MQOptions         *natsio.NatsOptions `json:"mq,omitempty" yaml:"mq,omitempty"  mapstructure:"mq"`
+	OpLogOptions      *oplog.Options      `json:"oplog,omitempty" yaml:"oplog,omitempty" mapstructure:"oplog"`
+	ImageProxyOptions *imageproxy.Options `json:"imageProxy,omitempty" yaml:"imageProxy,omitempty" mapstructure:"imageProxy"`
 }
 
 var (
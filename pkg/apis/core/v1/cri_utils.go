@@ -9,12 +9,12 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-	"time"
 
+	"github.com/google/uuid"
 	apimachineryErrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
-	"github.com/kubeclipper/kubeclipper/pkg/component"
 	"github.com/kubeclipper/kubeclipper/pkg/query"
 	"github.com/kubeclipper/kubeclipper/pkg/scheme/common"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
@@ -26,46 +26,32 @@ func (h *handler) getClusterCRIRegistries(ctx context.Context, c *v1.Cluster) ([
 	type mirror struct {
 		ImageRepoMirror string `json:"imageRepoMirror"`
 	}
-	insecureRegistry := append([]string{}, c.ContainerRuntime.InsecureRegistry...)
-	sort.Strings(insecureRegistry)
-	// add addons mirror registry
+	// the insecure registries and the addons mirror registries, deduplicated and sorted
+	insecure := sets.NewString(c.ContainerRuntime.InsecureRegistry...)
 	for _, a := range c.Addons {
 		var m mirror
-		err := json.Unmarshal(a.Config.Raw, &m)
-		if err != nil {
+		if err := json.Unmarshal(a.Config.Raw, &m); err != nil {
 			continue
 		}
 		if m.ImageRepoMirror != "" {
-			idx, ok := sort.Find(len(insecureRegistry), func(i int) int {
-				return strings.Compare(m.ImageRepoMirror, insecureRegistry[i])
-			})
-			if !ok {
-				if idx == len(insecureRegistry) {
-					insecureRegistry = append(insecureRegistry, m.ImageRepoMirror)
-				} else {
-					insecureRegistry = append(insecureRegistry[:idx+1], insecureRegistry[idx:]...)
-					insecureRegistry[idx] = m.ImageRepoMirror
-				}
-			}
+			insecure.Insert(m.ImageRepoMirror)
 		}
 	}
+	insecureRegistry := insecure.List()
 
 	registries := make([]v1.RegistrySpec, 0, len(insecureRegistry)*2+len(c.ContainerRuntime.Registries))
 	// insecure registry
 	for _, host := range insecureRegistry {
-		registries = appendUniqueRegistry(registries,
-			v1.RegistrySpec{Scheme: "http", Host: host},
-			v1.RegistrySpec{Scheme: "https", Host: host, SkipVerify: true})
+		registries = appendUniqueRegistry(registries, v1.InsecureRegistrySpecs(host, false)...)
 	}
 
-	validRegistries := c.ContainerRuntime.Registries[:0]
+	// a fresh slice, the registries may be shared with the cached cluster
+	validRegistries := make([]v1.CRIRegistry, 0, len(c.ContainerRuntime.Registries))
 	for _, reg := range c.ContainerRuntime.Registries {
 		if reg.RegistryRef == nil || *reg.RegistryRef == "" {
 			// fix reg.RegistryRef=""
 			reg.RegistryRef = nil
-			registries = appendUniqueRegistry(registries,
-				v1.RegistrySpec{Scheme: "http", Host: reg.InsecureRegistry},
-				v1.RegistrySpec{Scheme: "https", Host: reg.InsecureRegistry, SkipVerify: true})
+			registries = appendUniqueRegistry(registries, v1.InsecureRegistrySpecs(reg.InsecureRegistry, reg.HTTPOnly)...)
 			validRegistries = append(validRegistries, reg)
 			continue
 		}
@@ -80,15 +66,27 @@ func (h *handler) getClusterCRIRegistries(ctx context.Context, c *v1.Cluster) ([
 		validRegistries = append(validRegistries, reg)
 	}
 	c.ContainerRuntime.Registries = validRegistries
+	// the catch-all mirror of the registries without their own hosts dir
+	if c.ContainerRuntime.DefaultMirror != "" {
+		registries = appendUniqueRegistry(registries, v1.DefaultMirrorSpec(registries, c.ContainerRuntime.DefaultMirror))
+	}
 	return registries, nil
 }
 
+// validateRegistries reject the registries of unsupported scheme before they are rendered to hosts.toml
+func validateRegistries(registries []v1.RegistrySpec) error {
+	return v1.ValidateRegistrySpecs(registries, field.NewPath("registries")).ToAggregate()
+}
+
 // TODO: copy from ClusterController, Remove after refactoring
 func appendUniqueRegistry(s []v1.RegistrySpec, items ...v1.RegistrySpec) []v1.RegistrySpec {
 	for _, r := range items {
-		key := r.Scheme + r.Host
+		// registry host is case-insensitive
+		r.Host = strings.ToLower(r.Host)
+		// the canonical order of the registries, so the status comparison is stable
+		key := registryKey(r)
 		idx, ok := sort.Find(len(s), func(i int) int {
-			return strings.Compare(key, s[i].Scheme+s[i].Host)
+			return strings.Compare(key, registryKey(s[i]))
 		})
 		if !ok {
 			if idx == len(s) {
@@ -102,57 +100,58 @@ func appendUniqueRegistry(s []v1.RegistrySpec, items ...v1.RegistrySpec) []v1.Re
 	return s
 }
 
-func registriesEqual(a, b []v1.RegistrySpec) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
+// registryKey the scheme and host are separated, so http+"sa.io" and https+"a.io" are distinct,
+// and the same host mirroring another server is distinct from the host itself.
+func registryKey(r v1.RegistrySpec) string {
+	return r.Scheme + "://" + r.Host + " " + strings.ToLower(r.MirrorFor)
+}
+
+// localRegistrySpec the registry spec of the local registry host, the registry referenced by the cluster
+// is preferred to the insecure one. The local registry is treated as insecure if it is not in the registries.
+func localRegistrySpec(registries []v1.RegistrySpec, localRegistry string) v1.RegistrySpec {
+	host := strings.ToLower(strings.SplitN(localRegistry, "/", 2)[0])
+	spec := v1.RegistrySpec{Scheme: "http", Host: host}
+	for _, r := range registries {
+		if r.Host != host {
+			continue
+		}
+		// the insecure registry is appended as both http and https with skip verify
+		if r.Scheme == "https" && !r.SkipVerify {
+			return r
 		}
 	}
-	return true
+	return spec
+}
+
+// registriesEqual compares the registries by host regardless of order
+func registriesEqual(a, b []v1.RegistrySpec) bool {
+	changed, removed := cri.DiffRegistries(a, b)
+	return len(changed) == 0 && len(removed) == 0
 }
 
 func (h *handler) getCRIRegistriesStep(ctx context.Context, cluster *v1.Cluster, registries []v1.RegistrySpec) (*v1.Step, error) {
+	if err := validateRegistries(registries); err != nil {
+		return nil, err
+	}
 	if !registriesEqual(cluster.Status.Registries, registries) {
 		q := query.New()
 		q.LabelSelector = fmt.Sprintf("%s=%s", common.LabelClusterName, cluster.Name)
 
 		nodeList, err := h.clusterOperator.ListNodes(ctx, q)
 		if err != nil {
-			return nil, fmt.Errorf("list")
+			return nil, fmt.Errorf("list nodes of cluster %s for cri registry update:%w", cluster.Name, err)
 		}
-		return criRegistryUpdateStep(cluster, registries, nodeList.Items)
+		// no node to configure
+		if len(nodeList.Items) == 0 {
+			return nil, nil
+		}
+		return criRegistryUpdateStep(cluster, cluster.Status.Registries, registries, nodeList.Items)
 	}
 	return nil, nil
 }
 
-func criRegistryUpdateStep(cluster *v1.Cluster, registries []v1.RegistrySpec, nodes []v1.Node) (*v1.Step, error) {
-	var (
-		step     component.StepRunnable
-		identity string
-	)
-	switch cluster.ContainerRuntime.Type {
-	case v1.CRIDocker:
-		identity = cri.DockerInsecureRegistryConfigureIdentity
-		step = &cri.DockerInsecureRegistryConfigure{
-			InsecureRegistry: cri.ToDockerInsecureRegistry(registries),
-		}
-	case v1.CRIContainerd:
-		identity = cri.ContainerdRegistryConfigureIdentity
-		step = &cri.ContainerdRegistryConfigure{
-			Registries: cri.ToContainerdRegistryConfig(registries),
-			// TODO: get from config
-			ConfigDir: cri.ContainerdDefaultRegistryConfigDir,
-		}
-	default:
-		return nil, fmt.Errorf("unknown CRI type:%s", cluster.ContainerRuntime.Type)
-	}
-	stepData, err := json.Marshal(step)
-	if err != nil {
-		return nil, fmt.Errorf("step marshal:%w", err)
-	}
+// criRegistryUpdateStep the step of updating the cri registries from old on nodes, only the changed hosts are touched
+func criRegistryUpdateStep(cluster *v1.Cluster, old, registries []v1.RegistrySpec, nodes []v1.Node) (*v1.Step, error) {
 	var allNodes []v1.StepNode
 	for _, node := range nodes {
 		allNodes = append(allNodes, v1.StepNode{
@@ -162,19 +161,57 @@ func criRegistryUpdateStep(cluster *v1.Cluster, registries []v1.RegistrySpec, no
 			Hostname: node.Labels[common.LabelHostname],
 		})
 	}
-	return &v1.Step{
-		Name:   "update-cri-registry-config",
-		Nodes:  allNodes,
-		Action: v1.ActionInstall,
-		Timeout: metav1.Duration{
-			Duration: time.Second * 30,
-		},
-		Commands: []v1.Command{
-			{
-				Type:          v1.CommandCustom,
-				Identity:      identity,
-				CustomCommand: stepData,
-			},
-		},
-	}, nil
+	steps, err := cri.UpdateRegistriesSteps(cluster, old, registries, allNodes)
+	if err != nil || len(steps) == 0 {
+		return nil, err
+	}
+	return &steps[0], nil
+}
+
+// clusterReferencesRegistry whether the cluster references the registry by name
+func clusterReferencesRegistry(c *v1.Cluster, name string) bool {
+	for _, reg := range c.ContainerRuntime.Registries {
+		if reg.RegistryRef != nil && *reg.RegistryRef == name {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceRegistrySpec a copy of the registries with the spec of old replaced by new,
+// the specs are matched by scheme, host and mirrored server, which the credentials are not part of.
+func replaceRegistrySpec(registries []v1.RegistrySpec, old, new v1.RegistrySpec) []v1.RegistrySpec {
+	old.Host = strings.ToLower(old.Host)
+	new.Host = strings.ToLower(new.Host)
+	key := registryKey(old)
+	replaced := make([]v1.RegistrySpec, len(registries))
+	for i, r := range registries {
+		if registryKey(r) == key {
+			r = new
+		}
+		replaced[i] = r
+	}
+	return replaced
+}
+
+// rotateRegistryCredentialsOperation the operation of pushing the new credentials of the registry to the nodes
+// of the cluster, only the hosts.toml of the registry is rendered. It returns the registries of the cluster status
+// after rotated, and a nil operation if the cluster has no node to configure.
+func (h *handler) rotateRegistryCredentialsOperation(ctx context.Context, c *v1.Cluster, old, new v1.RegistrySpec) (*v1.Operation, []v1.RegistrySpec, error) {
+	registries := replaceRegistrySpec(c.Status.Registries, old, new)
+	step, err := h.getCRIRegistriesStep(ctx, c, registries)
+	if err != nil || step == nil {
+		return nil, registries, err
+	}
+	op := &v1.Operation{}
+	op.Name = uuid.New().String()
+	op.Labels = map[string]string{
+		common.LabelClusterName:      c.Name,
+		common.LabelTimeoutSeconds:   v1.DefaultOperationTimeoutSecs,
+		common.LabelOperationAction:  v1.OperationRotateRegistryCredentials,
+		common.LabelOperationSponsor: buildOperationSponsor(h.genericConfig),
+	}
+	op.Steps = []v1.Step{*step}
+	op.Status.Status = v1.OperationStatusRunning
+	return op, registries, nil
 }
@@ -0,0 +1,441 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	apimachineryErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	mock_cluster "github.com/kubeclipper/kubeclipper/pkg/models/cluster/mock"
+	mock_operation "github.com/kubeclipper/kubeclipper/pkg/models/operation/mock"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/common"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
+	"github.com/kubeclipper/kubeclipper/pkg/simple/generic"
+)
+
+func Test_validateRegistries(t *testing.T) {
+	tests := []struct {
+		name       string
+		registries []v1.RegistrySpec
+		wantErr    string
+	}{
+		{
+			name: "http and https",
+			registries: []v1.RegistrySpec{
+				{Scheme: "http", Host: "docker.io"},
+				{Scheme: "https", Host: "docker.io", SkipVerify: true},
+			},
+		},
+		{
+			name:       "unsupported scheme",
+			registries: []v1.RegistrySpec{{Scheme: "https", Host: "a.io"}, {Scheme: "foo", Host: "docker.io"}},
+			wantErr:    `registries[1].scheme: Unsupported value: "foo"`,
+		},
+		{
+			name:       "empty scheme",
+			registries: []v1.RegistrySpec{{Host: "docker.io"}},
+			wantErr:    "registries[0].scheme: Required value",
+		},
+		{
+			name:       "empty host",
+			registries: []v1.RegistrySpec{{Scheme: "https"}},
+			wantErr:    "registries[0].host: Required value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegistries(tt.registries)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateRegistries() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateRegistries() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_appendUniqueRegistry_caseInsensitive(t *testing.T) {
+	got := appendUniqueRegistry(nil,
+		v1.RegistrySpec{Scheme: "https", Host: "Docker.io"},
+		v1.RegistrySpec{Scheme: "https", Host: "docker.io"},
+		v1.RegistrySpec{Scheme: "https", Host: "DOCKER.IO"},
+	)
+	if len(got) != 1 {
+		t.Fatalf("appendUniqueRegistry() got %d registries, want 1: %v", len(got), got)
+	}
+	if got[0].Host != "docker.io" {
+		t.Errorf("appendUniqueRegistry() host = %s, want docker.io", got[0].Host)
+	}
+}
+
+func Test_appendUniqueRegistry_schemeHostKey(t *testing.T) {
+	got := appendUniqueRegistry(nil,
+		v1.RegistrySpec{Scheme: "https", Host: "a.io"},
+		v1.RegistrySpec{Scheme: "http", Host: "sa.io"},
+	)
+	if len(got) != 2 {
+		t.Fatalf("appendUniqueRegistry() got %d registries, want 2: %v", len(got), got)
+	}
+	// the same registries appended in another order are in the same canonical order
+	reversed := appendUniqueRegistry(nil, got[1], got[0])
+	for i := range got {
+		if got[i] != reversed[i] {
+			t.Errorf("appendUniqueRegistry() got %v, reversed %v", got, reversed)
+		}
+	}
+}
+
+func Test_registriesEqual(t *testing.T) {
+	a := []v1.RegistrySpec{
+		{Scheme: "http", Host: "10.0.0.1:5000"},
+		{Scheme: "https", Host: "10.0.0.1:5000", SkipVerify: true},
+		{Scheme: "https", Host: "mirror.io", CA: "ca data"},
+	}
+	reordered := []v1.RegistrySpec{a[2], a[1], a[0]}
+	if !registriesEqual(a, reordered) {
+		t.Errorf("registriesEqual() want the reordered registries equal")
+	}
+	changed := []v1.RegistrySpec{a[0], a[1], {Scheme: "https", Host: "mirror.io"}}
+	if registriesEqual(a, changed) {
+		t.Errorf("registriesEqual() want the registries of changed ca unequal")
+	}
+	if registriesEqual(a, a[:2]) {
+		t.Errorf("registriesEqual() want the registries of removed host unequal")
+	}
+}
+
+func Test_localRegistrySpec(t *testing.T) {
+	registries := []v1.RegistrySpec{
+		{Scheme: "http", Host: "10.0.0.1:5000"},
+		{Scheme: "https", Host: "10.0.0.1:5000", SkipVerify: true},
+		{Scheme: "https", Host: "harbor.example.com", CA: "ca"},
+	}
+	tests := []struct {
+		localRegistry string
+		want          v1.RegistrySpec
+	}{
+		{localRegistry: "10.0.0.1:5000", want: v1.RegistrySpec{Scheme: "http", Host: "10.0.0.1:5000"}},
+		{localRegistry: "Harbor.example.com/kc", want: v1.RegistrySpec{Scheme: "https", Host: "harbor.example.com", CA: "ca"}},
+		{localRegistry: "10.0.0.2:5000", want: v1.RegistrySpec{Scheme: "http", Host: "10.0.0.2:5000"}},
+	}
+	for _, tt := range tests {
+		if got := localRegistrySpec(registries, tt.localRegistry); got != tt.want {
+			t.Errorf("localRegistrySpec(%s) = %+v, want %+v", tt.localRegistry, got, tt.want)
+		}
+	}
+}
+
+func Test_getClusterCRIRegistries_httpOnly(t *testing.T) {
+	c := &v1.Cluster{}
+	c.ContainerRuntime.Registries = []v1.CRIRegistry{
+		{InsecureRegistry: "10.0.0.1:5000"},
+		{InsecureRegistry: "10.0.0.2:5000", HTTPOnly: true},
+	}
+	got, err := (&handler{}).getClusterCRIRegistries(context.TODO(), c)
+	if err != nil {
+		t.Fatalf("getClusterCRIRegistries() error = %v", err)
+	}
+	want := []v1.RegistrySpec{
+		{Scheme: "http", Host: "10.0.0.1:5000"},
+		{Scheme: "http", Host: "10.0.0.2:5000"},
+		{Scheme: "https", Host: "10.0.0.1:5000", SkipVerify: true},
+	}
+	if !registriesEqual(got, want) {
+		t.Errorf("getClusterCRIRegistries() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_getClusterCRIRegistries_addonMirrors(t *testing.T) {
+	addon := func(mirror string) v1.Addon {
+		return v1.Addon{Config: runtime.RawExtension{Raw: []byte(`{"imageRepoMirror":"` + mirror + `"}`)}}
+	}
+	c := &v1.Cluster{}
+	c.ContainerRuntime.InsecureRegistry = []string{"c.io", "a.io", "c.io"}
+	c.Addons = []v1.Addon{
+		addon("b.io"), addon("a.io"), addon("d.io"), addon("b.io"), addon(""), addon("0.io"),
+		{Config: runtime.RawExtension{Raw: []byte(`invalid`)}},
+	}
+	got, err := (&handler{}).getClusterCRIRegistries(context.TODO(), c)
+	if err != nil {
+		t.Fatalf("getClusterCRIRegistries() error = %v", err)
+	}
+	var hosts []string
+	for _, r := range got {
+		if r.Scheme == "http" {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	if want := []string{"0.io", "a.io", "b.io", "c.io", "d.io"}; strings.Join(hosts, ",") != strings.Join(want, ",") {
+		t.Errorf("getClusterCRIRegistries() http hosts = %v, want %v", hosts, want)
+	}
+	if len(got) != 10 {
+		t.Errorf("getClusterCRIRegistries() want an http and an https registry of each host, got %+v", got)
+	}
+}
+
+func Test_getClusterCRIRegistries_defaultMirror(t *testing.T) {
+	c := &v1.Cluster{}
+	c.ContainerRuntime.Registries = []v1.CRIRegistry{{InsecureRegistry: "10.0.0.1:5000", HTTPOnly: true}}
+	c.ContainerRuntime.DefaultMirror = "10.0.0.1:5000"
+	got, err := (&handler{}).getClusterCRIRegistries(context.TODO(), c)
+	if err != nil {
+		t.Fatalf("getClusterCRIRegistries() error = %v", err)
+	}
+	want := []v1.RegistrySpec{
+		{Scheme: "http", Host: "10.0.0.1:5000"},
+		{Scheme: "http", Host: "10.0.0.1:5000", MirrorFor: v1.DefaultMirrorServer},
+	}
+	if !registriesEqual(got, want) {
+		t.Errorf("getClusterCRIRegistries() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_getCRIRegistriesStep(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nodes := &v1.NodeList{Items: []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{common.LabelHostname: "host1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{common.LabelHostname: "host2"}}},
+	}}
+	nodes.Items[0].Status.Ipv4DefaultIP = "10.0.0.1"
+	nodes.Items[1].Status.Ipv4DefaultIP = "10.0.0.2"
+	clusterMockOperator := mock_cluster.NewMockOperator(ctrl)
+	clusterMockOperator.EXPECT().ListNodes(gomock.Any(), gomock.Any()).Return(nodes, nil).Times(1)
+	h := &handler{clusterOperator: clusterMockOperator}
+
+	c := &v1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	c.ContainerRuntime.Type = v1.CRIContainerd
+	c.Status.Registries = []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}}
+	registries := []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}, {Scheme: "http", Host: "10.0.0.2:5000"}}
+
+	step, err := h.getCRIRegistriesStep(context.TODO(), c, registries)
+	if err != nil {
+		t.Fatalf("getCRIRegistriesStep() error = %v", err)
+	}
+	if step == nil || len(step.Nodes) != 2 {
+		t.Fatalf("getCRIRegistriesStep() want a step on all nodes, got %+v", step)
+	}
+	if step.Nodes[1].ID != "node2" || step.Nodes[1].IPv4 != "10.0.0.2" || step.Nodes[1].Hostname != "host2" {
+		t.Errorf("getCRIRegistriesStep() node = %+v", step.Nodes[1])
+	}
+	// only the added host is rendered
+	cfg := cri.ContainerdRegistryConfigure{}
+	if err = json.Unmarshal(step.Commands[0].CustomCommand, &cfg); err != nil {
+		t.Fatalf("unmarshal registry configure error = %v", err)
+	}
+	if _, ok := cfg.Registries["10.0.0.2:5000"]; !cfg.Incremental || len(cfg.Registries) != 1 || !ok {
+		t.Errorf("getCRIRegistriesStep() want an incremental step of 10.0.0.2:5000, got %+v", cfg)
+	}
+
+	// the registries are reordered only, no step and no node listed
+	c.Status.Registries = []v1.RegistrySpec{registries[1], registries[0]}
+	if step, err = h.getCRIRegistriesStep(context.TODO(), c, registries); err != nil || step != nil {
+		t.Errorf("getCRIRegistriesStep() want no step for the reordered registries, got %+v, %v", step, err)
+	}
+
+	// the registries are not changed, no step and no node listed
+	c.Status.Registries = registries
+	if step, err = h.getCRIRegistriesStep(context.TODO(), c, registries); err != nil || step != nil {
+		t.Errorf("getCRIRegistriesStep() want no step for the unchanged registries, got %+v, %v", step, err)
+	}
+}
+
+func Test_getClusterCRIRegistries_refs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clusterMockOperator := mock_cluster.NewMockOperator(ctrl)
+	clusterMockOperator.EXPECT().GetRegistry(gomock.Any(), "harbor").Return(&v1.Registry{
+		RegistrySpec: v1.RegistrySpec{Scheme: "https", Host: "harbor.example.com", CA: "ca"},
+	}, nil)
+	clusterMockOperator.EXPECT().GetRegistry(gomock.Any(), "deleted").Return(nil,
+		apimachineryErrors.NewNotFound(v1.Resource("registries"), "deleted"))
+	h := &handler{clusterOperator: clusterMockOperator}
+
+	ref := func(name string) *string { return &name }
+	empty := ""
+	origin := []v1.CRIRegistry{
+		{RegistryRef: ref("deleted")},
+		{InsecureRegistry: "10.0.0.1:5000"},
+		{RegistryRef: ref("harbor")},
+		{InsecureRegistry: "10.0.0.2:5000", RegistryRef: &empty},
+	}
+	c := &v1.Cluster{}
+	c.ContainerRuntime.Registries = origin
+	got, err := h.getClusterCRIRegistries(context.TODO(), c)
+	if err != nil {
+		t.Fatalf("getClusterCRIRegistries() error = %v", err)
+	}
+	want := []v1.RegistrySpec{
+		{Scheme: "http", Host: "10.0.0.1:5000"},
+		{Scheme: "http", Host: "10.0.0.2:5000"},
+		{Scheme: "https", Host: "10.0.0.1:5000", SkipVerify: true},
+		{Scheme: "https", Host: "10.0.0.2:5000", SkipVerify: true},
+		{Scheme: "https", Host: "harbor.example.com", CA: "ca"},
+	}
+	if !registriesEqual(got, want) {
+		t.Errorf("getClusterCRIRegistries() = %+v, want %+v", got, want)
+	}
+
+	valid := c.ContainerRuntime.Registries
+	if len(valid) != 3 || valid[0].InsecureRegistry != "10.0.0.1:5000" || *valid[1].RegistryRef != "harbor" ||
+		valid[2].InsecureRegistry != "10.0.0.2:5000" || valid[2].RegistryRef != nil {
+		t.Errorf("getClusterCRIRegistries() want the not found ref filtered in order, got %+v", valid)
+	}
+	// the registries of the caller are not mutated
+	if origin[0].RegistryRef == nil || *origin[0].RegistryRef != "deleted" || origin[3].RegistryRef != &empty {
+		t.Errorf("getClusterCRIRegistries() mutated the origin registries: %+v", origin)
+	}
+}
+
+func Test_getCRIRegistriesStep_noNodes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clusterMockOperator := mock_cluster.NewMockOperator(ctrl)
+	clusterMockOperator.EXPECT().ListNodes(gomock.Any(), gomock.Any()).Return(&v1.NodeList{}, nil)
+	clusterMockOperator.EXPECT().ListNodes(gomock.Any(), gomock.Any()).Return(nil, errors.New("etcd unavailable"))
+	h := &handler{clusterOperator: clusterMockOperator}
+
+	c := &v1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	c.ContainerRuntime.Type = v1.CRIContainerd
+	registries := []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}}
+	step, err := h.getCRIRegistriesStep(context.TODO(), c, registries)
+	if err != nil || step != nil {
+		t.Errorf("getCRIRegistriesStep() want no step without nodes, got %+v, %v", step, err)
+	}
+	_, err = h.getCRIRegistriesStep(context.TODO(), c, registries)
+	if err == nil || !strings.Contains(err.Error(), "test") || !strings.Contains(err.Error(), "etcd unavailable") {
+		t.Errorf("getCRIRegistriesStep() want the list error with the cluster name, got %v", err)
+	}
+}
+
+func Test_replaceRegistrySpec(t *testing.T) {
+	old := v1.RegistrySpec{Scheme: "https", Host: "Harbor.example.com", Username: "admin", Password: "old"}
+	registries := []v1.RegistrySpec{
+		{Scheme: "http", Host: "harbor.example.com"},
+		{Scheme: "https", Host: "harbor.example.com", Username: "admin", Password: "old"},
+		{Scheme: "https", Host: "harbor.example.com", MirrorFor: "docker.io"},
+	}
+	rotated := old
+	rotated.Password = "new"
+	got := replaceRegistrySpec(registries, old, rotated)
+	if got[1].Password != "new" || got[1].Host != "harbor.example.com" {
+		t.Errorf("replaceRegistrySpec() want the https registry rotated, got %+v", got[1])
+	}
+	if got[0] != registries[0] || got[2] != registries[2] {
+		t.Errorf("replaceRegistrySpec() want the other scheme and the mirror untouched, got %+v", got)
+	}
+	if registries[1].Password != "old" {
+		t.Errorf("replaceRegistrySpec() mutated the origin registries: %+v", registries)
+	}
+}
+
+func Test_clusterReferencesRegistry(t *testing.T) {
+	ref := func(name string) *string { return &name }
+	c := &v1.Cluster{}
+	c.ContainerRuntime.Registries = []v1.CRIRegistry{{InsecureRegistry: "harbor"}, {RegistryRef: ref("other")}}
+	if clusterReferencesRegistry(c, "harbor") {
+		t.Errorf("clusterReferencesRegistry() want the insecure registry of the same name not a reference")
+	}
+	c.ContainerRuntime.Registries = append(c.ContainerRuntime.Registries, v1.CRIRegistry{RegistryRef: ref("harbor")})
+	if !clusterReferencesRegistry(c, "harbor") {
+		t.Errorf("clusterReferencesRegistry() want the referenced registry found")
+	}
+}
+
+func Test_rotateRegistryCredentialsOperation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nodes := &v1.NodeList{Items: []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}}
+	clusterMockOperator := mock_cluster.NewMockOperator(ctrl)
+	clusterMockOperator.EXPECT().ListNodes(gomock.Any(), gomock.Any()).Return(nodes, nil).Times(1)
+	h := &handler{clusterOperator: clusterMockOperator, genericConfig: &generic.ServerRunOptions{}}
+
+	old := v1.RegistrySpec{Scheme: "https", Host: "harbor.example.com", Username: "admin", Password: "old"}
+	rotated := old
+	rotated.Password = "new"
+	c := &v1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	c.ContainerRuntime.Type = v1.CRIContainerd
+	c.Status.Registries = []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}, old}
+
+	op, registries, err := h.rotateRegistryCredentialsOperation(context.TODO(), c, old, rotated)
+	if err != nil {
+		t.Fatalf("rotateRegistryCredentialsOperation() error = %v", err)
+	}
+	if op == nil || len(op.Steps) != 1 || len(op.Steps[0].Nodes) != 1 {
+		t.Fatalf("rotateRegistryCredentialsOperation() want a step on the node, got %+v", op)
+	}
+	if op.Labels[common.LabelClusterName] != "test" || op.Labels[common.LabelOperationAction] != v1.OperationRotateRegistryCredentials {
+		t.Errorf("rotateRegistryCredentialsOperation() labels = %v", op.Labels)
+	}
+	if registries[1].Password != "new" {
+		t.Errorf("rotateRegistryCredentialsOperation() want the status registries rotated, got %+v", registries)
+	}
+	// only the rotated host is rendered
+	cfg := cri.ContainerdRegistryConfigure{}
+	if err = json.Unmarshal(op.Steps[0].Commands[0].CustomCommand, &cfg); err != nil {
+		t.Fatalf("unmarshal registry configure error = %v", err)
+	}
+	if _, ok := cfg.Registries["harbor.example.com"]; !cfg.Incremental || len(cfg.Registries) != 1 || !ok {
+		t.Errorf("rotateRegistryCredentialsOperation() want an incremental step of harbor.example.com, got %+v", cfg)
+	}
+
+	// the credentials are not changed, no operation and no node listed
+	if op, _, err = h.rotateRegistryCredentialsOperation(context.TODO(), c, old, old); err != nil || op != nil {
+		t.Errorf("rotateRegistryCredentialsOperation() want no operation for the unchanged credentials, got %+v, %v", op, err)
+	}
+}
+
+func Test_startRegistryRotation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clusterMockOperator := mock_cluster.NewMockOperator(ctrl)
+	opMockOperator := mock_operation.NewMockOperator(ctrl)
+	h := &handler{clusterOperator: clusterMockOperator, opOperator: opMockOperator}
+	old := []v1.RegistrySpec{{Scheme: "https", Host: "harbor.example.com", Username: "admin", Password: "old"}}
+	rotated := []v1.RegistrySpec{{Scheme: "https", Host: "harbor.example.com", Username: "admin", Password: "new"}}
+	newCluster := func() *v1.Cluster {
+		c := &v1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+		c.Status.Phase = v1.ClusterRunning
+		c.Status.Registries = old
+		return c
+	}
+
+	// the cluster is rolled back if the operation is not created
+	var phases []v1.ClusterPhase
+	clusterMockOperator.EXPECT().UpdateCluster(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, c *v1.Cluster) (*v1.Cluster, error) {
+			phases = append(phases, c.Status.Phase)
+			return c.DeepCopy(), nil
+		}).Times(2)
+	opMockOperator.EXPECT().CreateOperation(gomock.Any(), gomock.Any()).Return(nil, errors.New("etcd down")).Times(1)
+	op, err := h.startRegistryRotation(context.TODO(), newCluster(), &v1.Operation{}, rotated)
+	if err == nil || op != nil {
+		t.Fatalf("startRegistryRotation() want the error of creating operation, got %+v, %v", op, err)
+	}
+	if want := []v1.ClusterPhase{v1.ClusterUpdating, v1.ClusterRunning}; len(phases) != 2 || phases[0] != want[0] || phases[1] != want[1] {
+		t.Errorf("startRegistryRotation() cluster phases = %v, want %v", phases, want)
+	}
+
+	// the cluster changed since listed is left to the cluster controller
+	clusterMockOperator.EXPECT().UpdateCluster(gomock.Any(), gomock.Any()).Return(nil,
+		apimachineryErrors.NewConflict(v1.Resource("clusters"), "test", errors.New("changed"))).Times(1)
+	if op, err = h.startRegistryRotation(context.TODO(), newCluster(), &v1.Operation{}, rotated); err != nil || op != nil {
+		t.Errorf("startRegistryRotation() want the conflicted cluster skipped, got %+v, %v", op, err)
+	}
+}
@@ -48,6 +48,7 @@ import (
 	"go.uber.org/zap"
 	apimachineryErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/json"
 	r "k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -151,6 +152,11 @@ func (h *handler) ListClusters(request *restful.Request, response *restful.Respo
 			restplus.HandleInternalError(response, request, err)
 			return
 		}
+		for i := range result.Items {
+			if c, ok := result.Items[i].(*v1.Cluster); ok {
+				result.Items[i] = withoutRegistryPasswords(c)
+			}
+		}
 		_ = response.WriteHeaderAndEntity(http.StatusOK, result)
 	}
 }
@@ -168,7 +174,7 @@ func (h *handler) DescribeCluster(request *restful.Request, response *restful.Re
 		return
 	}
 
-	_ = response.WriteHeaderAndEntity(http.StatusOK, c)
+	_ = response.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPasswords(c))
 }
 
 func (h *handler) AddOrRemoveNodes(request *restful.Request, response *restful.Response) {
@@ -284,7 +290,7 @@ func (h *handler) AddOrRemoveNodes(request *restful.Request, response *restful.R
 		}
 	}
 
-	_ = response.WriteHeaderAndEntity(http.StatusOK, c)
+	_ = response.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPasswords(c))
 }
 
 func (h *handler) watchCluster(req *restful.Request, resp *restful.Response, q *query.Query) {
@@ -314,6 +320,7 @@ func (h *handler) DeleteCluster(request *restful.Request, response *restful.Resp
 	}
 	dryRun := query.GetBoolValueWithDefault(request, query.ParamDryRun, false)
 	force := query.GetBoolValueWithDefault(request, query.ParameterForce, false)
+	preserveData := query.GetBoolValueWithDefault(request, query.ParameterPreserveData, false)
 	c, err := h.clusterOperator.GetClusterEx(request.Request.Context(), name, "0")
 	if err != nil {
 		if apimachineryErrors.IsNotFound(err) {
@@ -369,6 +376,7 @@ func (h *handler) DeleteCluster(request *restful.Request, response *restful.Resp
 	}
 
 	extraMeta.OperationType = v1.OperationDeleteCluster
+	extraMeta.PreserveRuntimeData = preserveData
 	op, err := h.parseOperationFromCluster(extraMeta, c, v1.ActionUninstall)
 	if err != nil {
 		restplus.HandleInternalError(response, request, err)
@@ -439,12 +447,17 @@ func (h *handler) CreateClusters(request *restful.Request, response *restful.Res
 		restplus.HandleBadRequest(response, request, err)
 		return
 	}
+	if err := c.Networking.ValidateCIDROverlap(extraMeta.GetAllNodes().GetNodeIPs()...); err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
 	// TODO: This logic has been implemented in the clusterController
 	c.Status.Registries, err = h.getClusterCRIRegistries(request.Request.Context(), &c)
 	if err != nil {
 		restplus.HandleInternalError(response, request, err)
 		return
 	}
+	extraMeta.Registries = c.Status.Registries
 
 	extraMeta.OperationType = v1.OperationCreateCluster
 	op, err := h.parseOperationFromCluster(extraMeta, &c, v1.ActionInstall)
@@ -452,6 +465,19 @@ func (h *handler) CreateClusters(request *restful.Request, response *restful.Res
 		restplus.HandleInternalError(response, request, err)
 		return
 	}
+	// run the smoke test after the cluster is bootstrapped, the failure of the smoke test is recorded
+	// in the operation but does not fail the installed cluster, it can be verified again by VerifyCluster.
+	if query.GetBoolValueWithDefault(request, query.ParameterVerify, false) && !extraMeta.OnlyInstallKubernetesComp {
+		verifySteps, err := k8s.VerifyClusterSteps(extraMeta)
+		if err != nil {
+			restplus.HandleInternalError(response, request, err)
+			return
+		}
+		for i := range verifySteps {
+			verifySteps[i].ErrIgnore = true
+		}
+		op.Steps = append(op.Steps, verifySteps...)
+	}
 
 	// TODO: make dry run path to etcd
 	if !dryRun {
@@ -476,7 +502,7 @@ func (h *handler) CreateClusters(request *restful.Request, response *restful.Res
 	}
 
 	go h.doOperation(context.TODO(), op, &service.Options{DryRun: dryRun})
-	_ = response.WriteHeaderAndEntity(http.StatusOK, c)
+	_ = response.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPasswords(&c))
 }
 
 func (h *handler) UpdateClusters(request *restful.Request, response *restful.Response) {
@@ -565,7 +591,7 @@ func (h *handler) UpdateClusterCertification(request *restful.Request, response
 	}
 
 	go h.doOperation(context.TODO(), op, &service.Options{DryRun: dryRun})
-	_ = response.WriteHeaderAndEntity(http.StatusOK, c)
+	_ = response.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPasswords(c))
 }
 
 func (h *handler) GetKubeConfig(request *restful.Request, response *restful.Response) {
@@ -951,6 +977,7 @@ func (h *handler) getClusterMetadata(ctx context.Context, c *v1.Cluster, skipNod
 		ControlPlaneStatus: c.Status.ControlPlaneHealth,
 		CNI:                c.CNI.Type,
 		CNINamespace:       c.CNI.Namespace,
+		Registries:         c.Status.Registries,
 	}
 
 	if c.Annotations != nil {
@@ -1160,6 +1187,9 @@ func (h *handler) doOperation(ctx context.Context, op *v1.Operation, opts *servi
 }
 
 func (h *handler) createClusterCheck(ctx context.Context, c *v1.Cluster) error {
+	if err := c.Networking.ValidateIPFamily(); err != nil {
+		return err
+	}
 	if c.Networking.IPFamily == v1.IPFamilyDualStack {
 		if len(c.Networking.Pods.CIDRBlocks) < 2 {
 			return fmt.Errorf("the cluster is enabled in dual-stack mode, requiring both ipv4 and ipv6")
@@ -1312,6 +1342,10 @@ func (h *handler) CreateBackup(request *restful.Request, response *restful.Respo
 			c.Name, c.Status.Phase))
 		return
 	}
+	if c.Etcd.IsExternal() {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("cluster %s uses an external etcd cluster, dose not support backup", c.Name))
+		return
+	}
 
 	b, err := h.clusterOperator.GetBackup(ctx, clusterName, fmt.Sprintf("%s-%s", backup.Name, clusterName))
 	if err != nil && !apimachineryErrors.IsNotFound(err) {
@@ -1677,6 +1711,10 @@ func (h *handler) CreateRecovery(request *restful.Request, response *restful.Res
 		restplus.HandleInternalError(response, request, err)
 		return
 	}
+	if c.Etcd.IsExternal() {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("cluster %s uses an external etcd cluster, dose not support recovery", c.Name))
+		return
+	}
 
 	q := query.New()
 	q.LabelSelector = fmt.Sprintf("%s=%s", common.LabelClusterName, c.Name)
@@ -1895,7 +1933,7 @@ func (h *handler) InstallOrUninstallPlugins(request *restful.Request, response *
 		}
 	}(op, &service.Options{DryRun: dryRun}, pcs)
 
-	_ = response.WriteHeaderAndEntity(http.StatusOK, clu)
+	_ = response.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPasswords(clu))
 }
 
 func (h *handler) UpgradeCluster(request *restful.Request, response *restful.Response) {
@@ -1979,6 +2017,239 @@ func (h *handler) UpgradeCluster(request *restful.Request, response *restful.Res
 	response.WriteHeader(http.StatusOK)
 }
 
+func (h *handler) SwitchClusterCNI(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(query.ParameterName)
+	body := &ClusterSwitchCNI{}
+	if err := request.ReadEntity(body); err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
+	clu, err := h.clusterOperator.GetClusterEx(request.Request.Context(), name, "0")
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) {
+			restplus.HandleNotFound(response, request, err)
+			return
+		}
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	if clu.Status.Phase != v1.ClusterRunning {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("cluster %s is %s, only running cluster can switch cni", clu.Name, clu.Status.Phase))
+		return
+	}
+	if !v1.AllowedCNI.Has(body.CNI.Type) {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("unsupported cni type %s", body.CNI.Type))
+		return
+	}
+	if body.CNI.Type == "calico" && body.CNI.Calico == nil {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("calico config is required"))
+		return
+	}
+	if body.CNI.Type == "custom" && (body.CNI.Custom == nil || body.CNI.Custom.Manifest == "") {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("custom cni manifest is required"))
+		return
+	}
+
+	dryRun := query.GetBoolValueWithDefault(request, query.ParamDryRun, false)
+	timeoutSecs := v1.DefaultOperationTimeoutSecs
+	if v := request.QueryParameter("timeout"); v != "" {
+		timeoutSecs = v
+	}
+	extraMeta, err := h.getClusterMetadata(request.Request.Context(), clu, false)
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) || err == ErrNodesRegionDifferent {
+			restplus.HandleBadRequest(response, request, err)
+			return
+		}
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	// complete and validate the target cni with the cluster config
+	target := clu.DeepCopy()
+	target.CNI = body.CNI
+	target.Complete()
+	if err = (*k8s.Runnable)(target).Validate(); err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
+	steps, err := k8s.SwitchCNISteps(extraMeta, clu, &target.CNI)
+	if err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
+	targetCNI, err := json.Marshal(target.CNI)
+	if err != nil {
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+
+	op := &v1.Operation{}
+	op.Name = uuid.New().String()
+	op.Labels = map[string]string{
+		common.LabelClusterName:    clu.Name,
+		common.LabelTopologyRegion: extraMeta.Masters[0].Region,
+	}
+	op.Annotations = map[string]string{
+		common.AnnotationSwitchCNI: string(targetCNI),
+	}
+	op.Steps = steps
+
+	if !dryRun {
+		clu.Status.Phase = v1.ClusterUpdating
+		_, err = h.clusterOperator.UpdateCluster(request.Request.Context(), clu)
+		if err != nil {
+			restplus.HandleInternalError(response, request, err)
+			return
+		}
+	}
+
+	op.Labels[common.LabelTimeoutSeconds] = timeoutSecs
+	op.Labels[common.LabelOperationAction] = v1.OperationSwitchCNI
+	op.Labels[common.LabelOperationSponsor] = buildOperationSponsor(h.genericConfig)
+	op.Status.Status = v1.OperationStatusRunning
+	if !dryRun {
+		op, err = h.opOperator.CreateOperation(context.TODO(), op)
+		if err != nil {
+			restplus.HandleInternalError(response, request, err)
+			return
+		}
+	}
+	go h.doOperation(context.TODO(), op, &service.Options{DryRun: dryRun})
+	response.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) VerifyCluster(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(query.ParameterName)
+	clu, err := h.clusterOperator.GetClusterEx(request.Request.Context(), name, "0")
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) {
+			restplus.HandleNotFound(response, request, err)
+			return
+		}
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	if clu.Status.Phase != v1.ClusterRunning {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("cluster %s is %s, only running cluster can be verified", clu.Name, clu.Status.Phase))
+		return
+	}
+
+	dryRun := query.GetBoolValueWithDefault(request, query.ParamDryRun, false)
+	timeoutSecs := v1.DefaultOperationTimeoutSecs
+	if v := request.QueryParameter("timeout"); v != "" {
+		timeoutSecs = v
+	}
+	extraMeta, err := h.getClusterMetadata(request.Request.Context(), clu, false)
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) || err == ErrNodesRegionDifferent {
+			restplus.HandleBadRequest(response, request, err)
+			return
+		}
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	steps, err := k8s.VerifyClusterSteps(extraMeta)
+	if err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
+
+	op := &v1.Operation{}
+	op.Name = uuid.New().String()
+	op.Labels = map[string]string{
+		common.LabelClusterName:    clu.Name,
+		common.LabelTopologyRegion: extraMeta.Masters[0].Region,
+	}
+	op.Steps = steps
+	op.Labels[common.LabelTimeoutSeconds] = timeoutSecs
+	op.Labels[common.LabelOperationAction] = v1.OperationVerifyCluster
+	op.Labels[common.LabelOperationSponsor] = buildOperationSponsor(h.genericConfig)
+	op.Status.Status = v1.OperationStatusRunning
+	if !dryRun {
+		op, err = h.opOperator.CreateOperation(context.TODO(), op)
+		if err != nil {
+			restplus.HandleInternalError(response, request, err)
+			return
+		}
+	}
+	go h.doOperation(context.TODO(), op, &service.Options{DryRun: dryRun})
+	_ = response.WriteHeaderAndEntity(http.StatusOK, op)
+}
+
+func (h *handler) SyncClusterImages(request *restful.Request, response *restful.Response) {
+	body := &ClusterImageSync{}
+	if err := request.ReadEntity(body); err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
+	if body.Source.Host != "" {
+		if err := validateRegistries([]v1.RegistrySpec{body.Source}); err != nil {
+			restplus.HandleBadRequest(response, request, err)
+			return
+		}
+	}
+	name := request.PathParameter(query.ParameterName)
+	clu, err := h.clusterOperator.GetClusterEx(request.Request.Context(), name, "0")
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) {
+			restplus.HandleNotFound(response, request, err)
+			return
+		}
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	if clu.Status.Phase != v1.ClusterRunning {
+		restplus.HandleBadRequest(response, request, fmt.Errorf("cluster %s is %s, only running cluster can sync images", clu.Name, clu.Status.Phase))
+		return
+	}
+
+	dryRun := query.GetBoolValueWithDefault(request, query.ParamDryRun, false)
+	timeoutSecs := v1.DefaultOperationTimeoutSecs
+	if v := request.QueryParameter("timeout"); v != "" {
+		timeoutSecs = v
+	}
+	extraMeta, err := h.getClusterMetadata(request.Request.Context(), clu, false)
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) || err == ErrNodesRegionDifferent {
+			restplus.HandleBadRequest(response, request, err)
+			return
+		}
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	registries, err := h.getClusterCRIRegistries(request.Request.Context(), clu)
+	if err != nil {
+		restplus.HandleInternalError(response, request, err)
+		return
+	}
+	steps, err := k8s.SyncImagesSteps(extraMeta, clu, body.Source, localRegistrySpec(registries, clu.LocalRegistry), body.Tarball)
+	if err != nil {
+		restplus.HandleBadRequest(response, request, err)
+		return
+	}
+
+	op := &v1.Operation{}
+	op.Name = uuid.New().String()
+	op.Labels = map[string]string{
+		common.LabelClusterName:    clu.Name,
+		common.LabelTopologyRegion: extraMeta.Masters[0].Region,
+	}
+	op.Steps = steps
+	op.Labels[common.LabelTimeoutSeconds] = timeoutSecs
+	op.Labels[common.LabelOperationAction] = v1.OperationSyncImages
+	op.Labels[common.LabelOperationSponsor] = buildOperationSponsor(h.genericConfig)
+	op.Status.Status = v1.OperationStatusRunning
+	if !dryRun {
+		op, err = h.opOperator.CreateOperation(context.TODO(), op)
+		if err != nil {
+			restplus.HandleInternalError(response, request, err)
+			return
+		}
+	}
+	go h.doOperation(context.TODO(), op, &service.Options{DryRun: dryRun})
+	_ = response.WriteHeaderAndEntity(http.StatusOK, op)
+}
+
 func (h *handler) ResetClusterStatus(request *restful.Request, response *restful.Response) {
 	dryRun := query.GetBoolValueWithDefault(request, query.ParamDryRun, false)
 	cluName := request.PathParameter(query.ParameterName)
@@ -3642,7 +3913,7 @@ func (h *handler) CreateRegistry(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	_ = resp.WriteHeaderAndEntity(http.StatusCreated, reg)
+	_ = resp.WriteHeaderAndEntity(http.StatusCreated, withoutRegistryPassword(reg))
 }
 
 func (h *handler) UpdateRegistry(req *restful.Request, resp *restful.Response) {
@@ -3665,7 +3936,7 @@ func (h *handler) UpdateRegistry(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	_, err := h.clusterOperator.GetRegistryEx(req.Request.Context(), name, "0")
+	old, err := h.clusterOperator.GetRegistryEx(req.Request.Context(), name, "0")
 	if err != nil {
 		if apimachineryErrors.IsNotFound(err) {
 			restplus.HandleBadRequest(resp, req, err)
@@ -3674,6 +3945,10 @@ func (h *handler) UpdateRegistry(req *restful.Request, resp *restful.Response) {
 		restplus.HandleInternalError(resp, req, err)
 		return
 	}
+	// the password is not returned by the api, the empty one keeps the stored password of the same username
+	if reg.Password == "" && reg.Username != "" && reg.Username == old.Username {
+		reg.Password = old.Password
+	}
 
 	if !dryRun {
 		reg, err = h.clusterOperator.UpdateRegistry(req.Request.Context(), reg)
@@ -3682,7 +3957,126 @@ func (h *handler) UpdateRegistry(req *restful.Request, resp *restful.Response) {
 			return
 		}
 	}
-	_ = resp.WriteHeaderAndEntity(http.StatusOK, reg)
+	_ = resp.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPassword(reg))
+}
+
+// RotateRegistryCredentials update the credentials of the registry and push them to the nodes of the running
+// clusters referencing it, the other clusters are reconciled by the cluster controller once they are running.
+func (h *handler) RotateRegistryCredentials(req *restful.Request, resp *restful.Response) {
+	name := req.PathParameter(query.ParameterName)
+	ctx := req.Request.Context()
+	dryRun := query.GetBoolValueWithDefault(req, query.ParamDryRun, false)
+	body := &RegistryCredentials{}
+	if err := req.ReadEntity(body); err != nil {
+		restplus.HandleBadRequest(resp, req, err)
+		return
+	}
+
+	reg, err := h.clusterOperator.GetRegistryEx(ctx, name, "0")
+	if err != nil {
+		if apimachineryErrors.IsNotFound(err) {
+			restplus.HandleBadRequest(resp, req, err)
+			return
+		}
+		restplus.HandleInternalError(resp, req, err)
+		return
+	}
+	old := reg.RegistrySpec
+	reg = reg.DeepCopy()
+	reg.Username, reg.Password = body.Username, body.Password
+	if err = h.registryValidate(ctx, reg); err != nil {
+		restplus.HandleBadRequest(resp, req, err)
+		return
+	}
+
+	clusters, err := h.clusterOperator.ListClusters(ctx, &query.Query{
+		Pagination:      query.NoPagination(),
+		ResourceVersion: "0",
+	})
+	if err != nil {
+		restplus.HandleInternalError(resp, req, err)
+		return
+	}
+	type rotation struct {
+		cluster    *v1.Cluster
+		op         *v1.Operation
+		registries []v1.RegistrySpec
+	}
+	var rotations []rotation
+	for i := range clusters.Items {
+		clu := &clusters.Items[i]
+		if clu.Status.Phase != v1.ClusterRunning || !clusterReferencesRegistry(clu, name) {
+			continue
+		}
+		op, registries, err := h.rotateRegistryCredentialsOperation(ctx, clu, old, reg.RegistrySpec)
+		if err != nil {
+			restplus.HandleInternalError(resp, req, err)
+			return
+		}
+		if op == nil {
+			continue
+		}
+		rotations = append(rotations, rotation{cluster: clu, op: op, registries: registries})
+	}
+
+	if !dryRun {
+		// the registry is updated first, no cluster is left updating if it fails
+		reg, err = h.clusterOperator.UpdateRegistry(ctx, reg)
+		if err != nil {
+			restplus.HandleInternalError(resp, req, err)
+			return
+		}
+	}
+	var (
+		ops  []*v1.Operation
+		errs []error
+	)
+	for _, r := range rotations {
+		op := r.op
+		if !dryRun {
+			if op, err = h.startRegistryRotation(ctx, r.cluster, r.op, r.registries); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if op == nil {
+				continue
+			}
+		}
+		ops = append(ops, op)
+	}
+	for _, op := range ops {
+		go h.doOperation(context.TODO(), op, &service.Options{DryRun: dryRun})
+	}
+	if len(errs) > 0 {
+		restplus.HandleInternalError(resp, req, utilerrors.NewAggregate(errs))
+		return
+	}
+	_ = resp.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPassword(reg))
+}
+
+// startRegistryRotation mark the cluster updating with the rotated registries and create the operation of pushing them.
+// The cluster is rolled back if the operation is not created, the cluster controller delivers the rotated registries then.
+// It returns nil if the cluster is changed since listed, e.g. the cluster controller is delivering the rotated registries.
+func (h *handler) startRegistryRotation(ctx context.Context, c *v1.Cluster, op *v1.Operation, registries []v1.RegistrySpec) (*v1.Operation, error) {
+	oldRegistries, oldPhase := c.Status.Registries, c.Status.Phase
+	c.Status.Registries = registries
+	c.Status.Phase = v1.ClusterUpdating
+	updated, err := h.clusterOperator.UpdateCluster(ctx, c)
+	if err != nil {
+		if apimachineryErrors.IsConflict(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("update registries of cluster %s failed:%w", c.Name, err)
+	}
+	created, err := h.opOperator.CreateOperation(ctx, op)
+	if err == nil {
+		return created, nil
+	}
+	updated.Status.Registries, updated.Status.Phase = oldRegistries, oldPhase
+	if _, rollbackErr := h.clusterOperator.UpdateCluster(ctx, updated); rollbackErr != nil {
+		logger.Error("roll back cluster phase failed", zap.String("cluster", c.Name), zap.Error(rollbackErr))
+	}
+	return nil, fmt.Errorf("create operation of rotating registry credentials of cluster %s failed:%w", c.Name, err)
 }
 
 func (h *handler) DescribeRegistry(req *restful.Request, resp *restful.Response) {
@@ -3697,7 +4091,7 @@ func (h *handler) DescribeRegistry(req *restful.Request, resp *restful.Response)
 		restplus.HandleInternalError(resp, req, err)
 		return
 	}
-	_ = resp.WriteHeaderAndEntity(http.StatusOK, reg)
+	_ = resp.WriteHeaderAndEntity(http.StatusOK, withoutRegistryPassword(reg))
 }
 
 func (h *handler) ListRegistry(req *restful.Request, resp *restful.Response) {
@@ -3721,6 +4115,11 @@ func (h *handler) ListRegistry(req *restful.Request, resp *restful.Response) {
 			restplus.HandleInternalError(resp, req, err)
 			return
 		}
+		for i := range result.Items {
+			if reg, ok := result.Items[i].(*v1.Registry); ok {
+				result.Items[i] = withoutRegistryPassword(reg)
+			}
+		}
 		_ = resp.WriteHeaderAndEntity(http.StatusOK, result)
 	}
 }
@@ -3764,15 +4163,34 @@ func (h *handler) DeleteRegistry(req *restful.Request, resp *restful.Response) {
 	resp.WriteHeader(http.StatusOK)
 }
 
-func (h *handler) registryValidate(_ context.Context, cp *v1.Registry) error {
-	if cp.Scheme == "" {
-		return fmt.Errorf("scheme cannot be empty")
+// withoutRegistryPassword a copy of the registry without the password for the api responses
+func withoutRegistryPassword(reg *v1.Registry) *v1.Registry {
+	if reg.Password == "" {
+		return reg
 	}
-	if cp.Scheme != "http" && cp.Scheme != "https" {
-		return fmt.Errorf("scheme must be http or https")
+	reg = reg.DeepCopy()
+	reg.Password = ""
+	return reg
+}
+
+// withoutRegistryPasswords a copy of the cluster without the passwords of the status registries
+// for the api responses, the raw informer queries keep them for the cluster controller.
+func withoutRegistryPasswords(c *v1.Cluster) *v1.Cluster {
+	for _, r := range c.Status.Registries {
+		if r.Password != "" {
+			c = c.DeepCopy()
+			for i := range c.Status.Registries {
+				c.Status.Registries[i].Password = ""
+			}
+			return c
+		}
 	}
-	if cp.Host == "" {
-		return fmt.Errorf("scheme must be http or https")
+	return c
+}
+
+func (h *handler) registryValidate(_ context.Context, cp *v1.Registry) error {
+	if err := v1.ValidateRegistrySpec(&cp.RegistrySpec, nil).ToAggregate(); err != nil {
+		return err
 	}
 	if cp.CA != "" {
 		p, _ := pem.Decode([]byte(cp.CA))
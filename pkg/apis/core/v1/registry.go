@@ -131,6 +131,8 @@ func SetupWebService(h *handler) *restful.WebService {
 		Reads(corev1.Cluster{}).
 		Param(webservice.QueryParameter(query.ParamDryRun, "dry run create clusters").
 			Required(false).DataType("boolean")).
+		Param(webservice.QueryParameter(query.ParameterVerify, "run the networking smoke test after the cluster is created").
+			Required(false).DataType("boolean").DefaultValue("false")).
 		Returns(http.StatusOK, http.StatusText(http.StatusOK), corev1.Cluster{}))
 
 	webservice.Route(webservice.PUT("/clusters/{name}").
@@ -151,6 +153,8 @@ func SetupWebService(h *handler) *restful.WebService {
 		Param(webservice.PathParameter("name", "cluster name")).
 		Param(webservice.QueryParameter(query.ParameterForce, "force delete cluster, will ignore operation error").
 			Required(false).DataType("boolean").DefaultValue("false")).
+		Param(webservice.QueryParameter(query.ParameterPreserveData, "keep the container runtime data(images) on the nodes").
+			Required(false).DataType("boolean").DefaultValue("false")).
 		Param(webservice.QueryParameter(query.ParamDryRun, "dry run delete clusters").
 			Required(false).DataType("boolean")).
 		Returns(http.StatusOK, http.StatusText(http.StatusOK), nil))
@@ -462,6 +466,41 @@ func SetupWebService(h *handler) *restful.WebService {
 			DataType("string")).
 		Returns(http.StatusOK, http.StatusText(http.StatusOK), nil))
 
+	webservice.Route(webservice.POST("/clusters/{name}/cni").
+		To(h.SwitchClusterCNI).
+		Metadata(restfulspec.KeyOpenAPITags, []string{CoreClusterTag}).
+		Doc("switch cluster cni.").
+		Reads(ClusterSwitchCNI{}).
+		Param(webservice.QueryParameter(query.ParamDryRun, "dry run switch cluster cni.").
+			Required(false).DataType("boolean")).
+		Param(webservice.PathParameter(query.ParameterName, "cluster name").
+			Required(true).
+			DataType("string")).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), nil))
+
+	webservice.Route(webservice.POST("/clusters/{name}/verify").
+		To(h.VerifyCluster).
+		Metadata(restfulspec.KeyOpenAPITags, []string{CoreClusterTag}).
+		Doc("run the networking smoke test of cluster, the test resources are deleted after it.").
+		Param(webservice.QueryParameter(query.ParamDryRun, "dry run verify cluster.").
+			Required(false).DataType("boolean")).
+		Param(webservice.PathParameter(query.ParameterName, "cluster name").
+			Required(true).
+			DataType("string")).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), corev1.Operation{}))
+
+	webservice.Route(webservice.POST("/clusters/{name}/images/sync").
+		To(h.SyncClusterImages).
+		Metadata(restfulspec.KeyOpenAPITags, []string{CoreClusterTag}).
+		Doc("sync the images required by cluster into its local registry.").
+		Reads(ClusterImageSync{}).
+		Param(webservice.QueryParameter(query.ParamDryRun, "dry run sync cluster images.").
+			Required(false).DataType("boolean")).
+		Param(webservice.PathParameter(query.ParameterName, "cluster name").
+			Required(true).
+			DataType("string")).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), corev1.Operation{}))
+
 	webservice.Route(webservice.PATCH("/clusters/{name}/status").
 		To(h.ResetClusterStatus).
 		Metadata(restfulspec.KeyOpenAPITags, []string{CoreClusterTag}).
@@ -1153,6 +1192,16 @@ func SetupWebService(h *handler) *restful.WebService {
 			Required(false).DataType("boolean")).
 		Returns(http.StatusOK, http.StatusText(http.StatusOK), nil))
 
+	webservice.Route(webservice.PUT("/registries/{name}/credentials").
+		To(h.RotateRegistryCredentials).
+		Metadata(restfulspec.KeyOpenAPITags, []string{CoreClusterTag}).
+		Doc("Rotate registry credentials on the clusters referencing it.").
+		Reads(RegistryCredentials{}).
+		Param(webservice.PathParameter(query.ParameterName, "registry name")).
+		Param(webservice.QueryParameter(query.ParamDryRun, "dry run rotate registry credentials").
+			Required(false).DataType("boolean")).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), corev1.Registry{}))
+
 	webservice.Route(webservice.DELETE("/registries/{name}").
 		To(h.DeleteRegistry).
 		Metadata(restfulspec.KeyOpenAPITags, []string{CoreClusterTag}).
@@ -132,3 +132,20 @@ type ClusterUpgrade struct {
 	Offline       bool   `json:"offline"`
 	LocalRegistry string `json:"localRegistry"`
 }
+
+type ClusterSwitchCNI struct {
+	CNI corev1.CNI `json:"cni"`
+}
+
+type ClusterImageSync struct {
+	// Source the registry the images are pulled from, each image is pulled from its own registry if the host is empty
+	Source corev1.RegistrySpec `json:"source,omitempty"`
+	// Tarball the image tarball on the master, the images are imported from it instead of pulled
+	Tarball string `json:"tarball,omitempty"`
+}
+
+// RegistryCredentials the new basic auth credentials of a registry, empty to remove the credentials
+type RegistryCredentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
@@ -240,6 +240,7 @@ func getRecoveryStep(c *v1.Cluster, bp *v1.BackupPoint, b *v1.Backup, restoreDir
 		NodeIPList:     nodeIPs,
 		BackupFileSize: b.Status.BackupFileSize,
 		BackupFileMD5:  b.Status.BackupFileMD5,
+		SkipKubeProxy:  c.Networking.SkipKubeProxy,
 		FileDir:        f,
 	}
 
@@ -350,7 +351,11 @@ func (h *handler) parseUpdateCertOperation(clu *v1.Cluster, extraMetadata *compo
 	cert := &k8s.Certification{}
 	op := &v1.Operation{}
 	nodes := utils.UnwrapNodeList(extraMetadata.Masters)
-	op.Steps, _ = cert.InstallSteps(clu, nodes)
+	steps, err := cert.InstallSteps(clu, nodes)
+	if err != nil {
+		return nil, err
+	}
+	op.Steps = steps
 	return op, nil
 }
 
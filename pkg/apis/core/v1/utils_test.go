@@ -468,3 +468,20 @@ const (
 func IgnoreError(err error) bool {
 	return strings.Contains(err.Error(), availableMasterError) || strings.Contains(err.Error(), allAvailableMasterError)
 }
+
+func Test_withoutRegistryPasswords(t *testing.T) {
+	c := &v1.Cluster{}
+	c.Status.Registries = []v1.RegistrySpec{{Host: "10.0.0.1:5000"}, {Host: "10.0.0.2:5000", Username: "admin", Password: "passw0rd"}}
+	got := withoutRegistryPasswords(c)
+	if got.Status.Registries[1].Password != "" || got.Status.Registries[1].Username != "admin" {
+		t.Errorf("withoutRegistryPasswords() = %+v", got.Status.Registries)
+	}
+	if c.Status.Registries[1].Password != "passw0rd" {
+		t.Errorf("withoutRegistryPasswords() mutated the origin cluster")
+	}
+
+	reg := &v1.Registry{RegistrySpec: v1.RegistrySpec{Host: "10.0.0.2:5000", Username: "admin", Password: "passw0rd"}}
+	if got := withoutRegistryPassword(reg); got.Password != "" || reg.Password != "passw0rd" {
+		t.Errorf("withoutRegistryPassword() = %+v, origin %+v", got.RegistrySpec, reg.RegistrySpec)
+	}
+}
@@ -351,6 +351,7 @@ backupStore:
     rootdir: /opt/kc/backups
 imageProxy:
   kcImageRepoMirror: {{.KcImageRepoMirror}}
+  kcPackageMirror: {{.KcPackageMirror}}
 `
 
 const DockerDaemonTmpl = `
@@ -82,9 +82,9 @@ certSans: []
 #  xxx: true
 cni:
   calico:
-    IPManger: true
     IPv4AutoDetection: first-found
     IPv6AutoDetection: first-found
+    ipam: calico-ipam
     mode: Overlay-Vxlan-All
     mtu: 1440
   criType: containerd
@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -68,6 +69,9 @@ const (
   # Create cluster with worker.
   kcctl create cluster --name demo --master 192.168.10.123 --worker 192.168.10.124
 
+  # Create cluster and run the networking smoke test after it is created.
+  kcctl create cluster --name demo --master 192.168.10.123 --worker 192.168.10.124 --verify
+
   Please read 'kcctl create cluster -h' get more create cluster flags.`
 )
 
@@ -148,6 +152,7 @@ type CreateClusterOptions struct {
 	K8sVersion                       string
 	CNI                              string
 	CNIVersion                       string
+	CNIManifest                      string
 	Name                             string
 	createdByIP                      bool
 	CertSans                         []string
@@ -155,6 +160,7 @@ type CreateClusterOptions struct {
 	CaKeyFile                        string
 	DNSDomain                        string
 	CalicoNetMode                    string
+	FlannelBackend                   string
 	IPv4AutoDetection                string
 	ServiceSubnet                    string
 	PodSubnet                        string
@@ -162,11 +168,13 @@ type CreateClusterOptions struct {
 	OnlyInstallKubernetesComp        bool
 	FeatureGatesString               []string
 	FeatureGates                     map[string]bool
+	// Verify run the networking smoke test after the cluster is created
+	Verify bool
 }
 
 var (
 	allowedCRI = sets.NewString("containerd", "docker")
-	allowedCNI = sets.NewString("calico")
+	allowedCNI = sets.NewString("calico", "flannel", "custom")
 )
 
 func NewCreateClusterOptions(streams options.IOStreams) *CreateClusterOptions {
@@ -183,6 +191,7 @@ func NewCreateClusterOptions(streams options.IOStreams) *CreateClusterOptions {
 		createdByIP:       false,
 		DNSDomain:         "cluster.local",
 		CalicoNetMode:     "Overlay-Vxlan-All",
+		FlannelBackend:    "vxlan",
 		IPv4AutoDetection: autodetection.MethodFirst,
 		ServiceSubnet:     "10.96.0.0/12",
 		PodSubnet:         "172.25.0.0/16",
@@ -218,16 +227,19 @@ func NewCmdCreateCluster(streams options.IOStreams) *cobra.Command {
 	cmd.Flags().StringVar(&o.K8sVersion, "k8s-version", o.K8sVersion, "k8s version")
 	cmd.Flags().StringVar(&o.CNI, "cni", o.CNI, "k8s cni type, calico or others")
 	cmd.Flags().StringVar(&o.CNIVersion, "cni-version", o.CNIVersion, "k8s cni version")
+	cmd.Flags().StringVar(&o.CNIManifest, "cni-manifest", o.CNIManifest, "the http(s) url or the file path on the first master node of the custom cni manifest, required when cni is custom")
 	cmd.Flags().StringSliceVar(&o.CertSans, "cert-sans", o.CertSans, "k8s cluster certificate signing ipList or domainList")
 	cmd.Flags().StringVar(&o.CaCertFile, "ca-cert", o.CaCertFile, "k8s external root-ca cert file")
 	cmd.Flags().StringVar(&o.CaKeyFile, "ca-key", o.CaKeyFile, "k8s external root-ca key file")
 	cmd.Flags().StringVar(&o.DNSDomain, "cluster-dns-domain", o.DNSDomain, "k8s cluster domain")
 	cmd.Flags().StringVar(&o.IPv4AutoDetection, "calico.ipv4-auto-detection", o.IPv4AutoDetection, fmt.Sprintf("node ipv4 auto detection. \n%s", IPDetectDescription))
 	cmd.Flags().StringVar(&o.CalicoNetMode, "calico.net-mode", o.CalicoNetMode, "calico network mode, support [BGP|Overlay-IPIP-All|Overlay-IPIP-Cross-Subnet|Overlay-Vxlan-All|Overlay-Vxlan-Cross-Subnet] now. \n"+CalicoNetModeDescription)
+	cmd.Flags().StringVar(&o.FlannelBackend, "flannel.backend", o.FlannelBackend, "flannel backend type, support [vxlan|host-gw] now")
 	cmd.Flags().StringVar(&o.ServiceSubnet, "service-subnet", o.ServiceSubnet, "serviceSubnet is the subnet used by Kubernetes Services. Defaults to '10.96.0.0/12'")
 	cmd.Flags().StringVar(&o.PodSubnet, "pod-subnet", o.PodSubnet, "podSubnet is the subnet used by Pods. Defaults to '172.25.0.0/16'")
 	cmd.Flags().StringVar(&o.KubeadmInitIgnorePreflightErrors, "kubeadm-init-ignore-preflight-errors", o.KubeadmInitIgnorePreflightErrors, "A list of checks whose errors will be shown as warnings. Example: 'IsPrivilegedUser,Swap'. Value 'all' ignores errors from all checks.,kubeadm init --ignore-preflight-errors=xxx")
 	cmd.Flags().BoolVar(&o.OnlyInstallKubernetesComp, "only-install-kubernetes-component", o.OnlyInstallKubernetesComp, "only install kubernetes component, not install cni")
+	cmd.Flags().BoolVar(&o.Verify, "verify", o.Verify, "run the networking smoke test after the cluster is created, the test pods and service are deleted after it")
 	cmd.Flags().StringSliceVar(&o.FeatureGatesString, "feature-gates", o.FeatureGatesString, "k8s feature gates, format as: --feature-gates=xxx=true|false")
 	o.CliOpts.AddFlags(cmd.Flags())
 	o.PrintFlags.AddFlags(cmd)
@@ -286,7 +298,8 @@ func (l *CreateClusterOptions) PreRun() error {
 		l.CRIVersion = cri[0]
 		logger.Infof("use default %s version %s", l.CRI, l.CRIVersion)
 	}
-	if l.CNIVersion == "" {
+	// the custom cni is installed from the manifest, not the cni packages
+	if l.CNIVersion == "" && l.CNI != "custom" {
 		cni := l.listCNI("")
 		if len(cni) == 0 {
 			return errors.New("no valid cni-version")
@@ -320,8 +333,11 @@ func (l *CreateClusterOptions) ValidateArgs(cmd *cobra.Command) error {
 	}, l.CalicoNetMode) {
 		return utils.UsageErrorf(cmd, "unsupported calico net mode, support [BGP|Overlay-IPIP-All|Overlay-IPIP-Cross-Subnet|Overlay-Vxlan-All|Overlay-Vxlan-Cross-Subnet] now")
 	}
+	if l.FlannelBackend != "" && !sliceutil.HasString([]string{"vxlan", "host-gw"}, l.FlannelBackend) {
+		return utils.UsageErrorf(cmd, "unsupported flannel backend, support [vxlan|host-gw] now")
+	}
 	if l.IPv4AutoDetection != "" && !autodetection.CheckCalicoMethod(l.IPv4AutoDetection) {
-		return utils.UsageErrorf(cmd, "unsupported ip detect method, support [first-found,interface=xxx,can-reach=xxx] now")
+		return utils.UsageErrorf(cmd, "unsupported ip detect method, support [first-found,kubernetes-internal-ip,interface=xxx,skip-interface=xxx,can-reach=xxx,cidr=xxx] now")
 	}
 	if l.Name == "" {
 		return utils.UsageErrorf(cmd, "cluster name must be specified")
@@ -334,9 +350,15 @@ func (l *CreateClusterOptions) ValidateArgs(cmd *cobra.Command) error {
 	if !sliceutil.HasString(criVersions, l.CRIVersion) {
 		return utils.UsageErrorf(cmd, "unsupported cri version,support %v now", criVersions)
 	}
-	cniVersions := l.listCNI("")
-	if !sliceutil.HasString(cniVersions, l.CNIVersion) {
-		return utils.UsageErrorf(cmd, "unsupported cni version,support %v now", cniVersions)
+	if l.CNI == "custom" {
+		if l.CNIManifest == "" {
+			return utils.UsageErrorf(cmd, "cni manifest must be specified for custom cni")
+		}
+	} else {
+		cniVersions := l.listCNI("")
+		if !sliceutil.HasString(cniVersions, l.CNIVersion) {
+			return utils.UsageErrorf(cmd, "unsupported cni version,support %v now", cniVersions)
+		}
 	}
 
 	nodes := make([]string, 0)
@@ -393,7 +415,11 @@ func (l *CreateClusterOptions) RunCreate() error {
 	}
 	c := l.newCluster()
 	// TODO: check node exist
-	resp, err := l.Client.CreateCluster(context.TODO(), c)
+	queryString := url.Values{}
+	if l.Verify {
+		queryString.Set(query.ParameterVerify, "true")
+	}
+	resp, err := l.Client.CreateClusterWithQuery(context.TODO(), c, queryString)
 	if err != nil {
 		return err
 	}
@@ -492,9 +518,12 @@ func (l *CreateClusterOptions) newCluster() *v1.Cluster {
 				IPv4AutoDetection: l.IPv4AutoDetection,
 				IPv6AutoDetection: "first-found",
 				Mode:              l.CalicoNetMode,
-				IPManger:          true,
+				IPAM:              v1.CalicoIPAMCalico,
 				MTU:               1440,
 			},
+			Flannel: &v1.Flannel{
+				Backend: l.FlannelBackend,
+			},
 		},
 		FeatureGates: l.FeatureGates,
 
@@ -533,6 +562,9 @@ func (l *CreateClusterOptions) newCluster() *v1.Cluster {
 	}
 	c.Masters = masters
 	c.Workers = workers
+	if l.CNI == "custom" {
+		c.CNI.Custom = &v1.CustomCNI{Manifest: l.CNIManifest}
+	}
 	var insecureRegistry []string
 	if l.LocalRegistry != "" {
 		insecureRegistry = []string{l.LocalRegistry}
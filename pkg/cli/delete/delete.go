@@ -65,6 +65,8 @@ type DeleteOptions struct {
 	resource string
 	name     string
 	force    bool
+	// preserveData keep the container runtime data of the cluster nodes
+	preserveData bool
 }
 
 var (
@@ -91,6 +93,7 @@ func NewCmdDelete(streams options.IOStreams) *cobra.Command {
 	}
 	o.CliOpts.AddFlags(cmd.Flags())
 	cmd.Flags().BoolVarP(&o.force, "force", "F", o.force, "Force delete resource. Now is only support cluster.")
+	cmd.Flags().BoolVar(&o.preserveData, "preserve-data", o.preserveData, "Keep the container runtime data(images) on the nodes. Now is only support cluster.")
 	return cmd
 }
 
@@ -152,6 +155,9 @@ func (l *DeleteOptions) RunDelete() error {
 		if l.force {
 			queryString.Set(query.ParameterForce, "true")
 		}
+		if l.preserveData {
+			queryString.Set(query.ParameterPreserveData, "true")
+		}
 		err = l.Client.DeleteClusterWithQuery(context.TODO(), l.name, queryString)
 		if err != nil {
 			return err
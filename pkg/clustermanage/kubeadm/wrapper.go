@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
@@ -127,11 +128,13 @@ func (w *Wrapper) completeKubeadm(kubeadmConf *corev1.ConfigMap, c *v1.Cluster)
 
 	proxyConf, err := w.KubeCli.CoreV1().ConfigMaps("kube-system").
 		Get(context.TODO(), "kube-proxy", metav1.GetOptions{})
-	if err != nil {
+	// the cluster deployed without kube-proxy has no kube-proxy config
+	skipKubeProxy := apierrors.IsNotFound(err)
+	if err != nil && !skipKubeProxy {
 		return err
 	}
 	proxyMode := "iptables"
-	if strings.Contains(proxyConf.Data["config.conf"], "mode: ipvs") {
+	if !skipKubeProxy && strings.Contains(proxyConf.Data["config.conf"], "mode: ipvs") {
 		proxyMode = "ipvs"
 	}
 	serviceSubnet := strings.Split(clusterConf.Networking.ServiceSubnet, ",")
@@ -146,9 +149,17 @@ func (w *Wrapper) completeKubeadm(kubeadmConf *corev1.ConfigMap, c *v1.Cluster)
 	c.KubernetesVersion = clusterConf.KubernetesVersion
 	c.CertSANs = clusterConf.APIServer.CertSANs
 	c.KubeProxy = v1.KubeProxy{}
-	if clusterConf.Etcd.Local == nil {
+	switch {
+	case clusterConf.Etcd.External != nil:
+		c.Etcd.External = &v1.ExternalEtcd{
+			Endpoints: clusterConf.Etcd.External.Endpoints,
+			CAFile:    clusterConf.Etcd.External.CAFile,
+			CertFile:  clusterConf.Etcd.External.CertFile,
+			KeyFile:   clusterConf.Etcd.External.KeyFile,
+		}
+	case clusterConf.Etcd.Local == nil:
 		c.Etcd.DataDir = "External"
-	} else {
+	default:
 		c.Etcd.DataDir = clusterConf.Etcd.Local.DataDir
 	}
 	c.Kubelet.RootDir = ""
@@ -157,6 +168,7 @@ func (w *Wrapper) completeKubeadm(kubeadmConf *corev1.ConfigMap, c *v1.Cluster)
 	c.Networking.Pods = v1.NetworkRanges{CIDRBlocks: podSubnet}
 	c.Networking.DNSDomain = clusterConf.Networking.DNSDomain
 	c.Networking.ProxyMode = proxyMode
+	c.Networking.SkipKubeProxy = skipKubeProxy
 	c.Networking.WorkerNodeVip = ""
 	c.CNI = v1.CNI{}
 	c.Addons = []v1.Addon{}
@@ -237,6 +249,15 @@ type KubeEtcd struct {
 	// Local provides configuration knobs for configuring the local etcd instance
 	// Local and External are mutually exclusive
 	Local *LocalEtcd `yaml:"local,omitempty"`
+	// External describes how to connect to an external etcd cluster
+	External *ExternalEtcd `yaml:"external,omitempty"`
+}
+
+type ExternalEtcd struct {
+	Endpoints []string `yaml:"endpoints"`
+	CAFile    string   `yaml:"caFile"`
+	CertFile  string   `yaml:"certFile"`
+	KeyFile   string   `yaml:"keyFile"`
 }
 
 type LocalEtcd struct {
@@ -31,6 +31,8 @@ type PatchNodes struct {
 	Nodes        corev1.WorkerNodeList `json:"nodes"`
 	ConvertNodes []component.Node      `json:"convertNodes"`
 	Role         common.NodeRole       `json:"role"`
+	// PreserveData keep the container runtime data of the removed nodes
+	PreserveData bool `json:"preserveData,omitempty"`
 }
 
 var _ Interface = (*NodeOperation)(nil)
@@ -141,6 +143,7 @@ func (p *PatchNodes) makeWorkerOperation(extra component.ExtraMetadata, cluster
 	op.Labels = map[string]string{
 		common.LabelClusterName: cluster.Name,
 	}
+	extra.PreserveRuntimeData = p.PreserveData
 	// pass extra metadata in context
 	ctx := component.WithExtraMetadata(context.TODO(), extra)
 	// nodes to be added or removed
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -43,9 +45,17 @@ func (i *Chart) Install(ctx context.Context, opts component.Options) ([]byte, er
 		return nil, err
 	}
 
-	if _, err = instance.DownloadCharts(); err != nil {
+	chartPath, err := instance.DownloadCharts()
+	if err != nil {
 		return nil, fmt.Errorf("download %s-%s chart packages failed: %v", i.PkgName, i.Version, err)
 	}
+	// the offline chart is installed from the local bundle without any chart repo, so it must exist
+	if i.Offline && !opts.DryRun {
+		if _, err = os.Stat(chartPath); err != nil {
+			return nil, fmt.Errorf("%s-%s offline chart bundle %s is missing, make sure the offline package contains %s: %v",
+				i.PkgName, i.Version, chartPath, downloader.ChartFilename, err)
+		}
+	}
 
 	logger.Infof("%s-%s chart packages offline install successfully", i.PkgName, i.Version)
 	return nil, err
@@ -64,6 +74,12 @@ func (i *Chart) Uninstall(ctx context.Context, opts component.Options) ([]byte,
 	return nil, nil
 }
 
+// ChartPath the local path of the chart bundle loaded by the chart step, the chart is installed from it
+// instead of an online chart repo.
+func (i *Chart) ChartPath() string {
+	return filepath.Join(downloader.BaseDstDir, "."+i.PkgName, i.Version, downloader.ChartFilename)
+}
+
 func (i *Chart) NewInstance() component.ObjectMeta {
 	return &Chart{}
 }
@@ -46,6 +46,9 @@ func (i *Imager) Install(ctx context.Context, opts component.Options) ([]byte, e
 
 	var dstFiles []string
 
+	if err = utils.WaitImagePullJitter(ctx, opts.DryRun); err != nil {
+		return nil, err
+	}
 	if len(i.CustomImageList) > 0 {
 		dstFiles, err = instance.DownloadCustomImages(i.CustomImageList...)
 		if err != nil {
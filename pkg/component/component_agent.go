@@ -45,9 +45,12 @@ func defaultAgentStepHandler() agentStep {
 // RegisterAgentStep KV must format at componentName/version/stepName
 func RegisterAgentStep(kv string, p StepRunnable) error {
 	if !checkAgentStepKey(kv) {
-		return ErrStepKeyFormat
+		return &RegistrationError{Kind: TypeStep, Key: kv, Err: ErrStepKeyFormat}
 	}
-	return _agentSteps.registerAgentStep(kv, p)
+	if err := _agentSteps.registerAgentStep(kv, p); err != nil {
+		return &RegistrationError{Kind: TypeStep, Key: kv, Err: err}
+	}
+	return nil
 }
 
 func LoadAgentStep(kv string) (StepRunnable, bool) {
@@ -25,19 +25,25 @@ import (
 	"sync"
 	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/netutil"
 
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 )
 
 type (
-	extraKey     struct{}
-	metaKey      struct{}
-	operationKey struct{}
-	stepKey      struct{}
-	oplogKey     struct{}
-	retryKey     struct{}
-	repoMirror   struct{}
+	extraKey      struct{}
+	metaKey       struct{}
+	operationKey  struct{}
+	stepKey       struct{}
+	nodeKey       struct{}
+	oplogKey      struct{}
+	retryKey      struct{}
+	repoMirror    struct{}
+	packageMirror struct{}
+	pullJitter    struct{}
 )
 
 type ExtraMetadata struct {
@@ -57,6 +63,10 @@ type ExtraMetadata struct {
 	CNI                       string
 	CNINamespace              string
 	OnlyInstallKubernetesComp bool
+	// PreserveRuntimeData keep the container runtime data(images, snapshots) on uninstall
+	PreserveRuntimeData bool
+	// Registries the cri registries of the cluster
+	Registries []v1.RegistrySpec
 }
 
 type Node struct {
@@ -123,6 +133,22 @@ func (e ExtraMetadata) GetAllNodes() (nodes NodeList) {
 	return nodes
 }
 
+// GetNodeIPs returns the unique ips and cluster ips of the nodes
+func (l NodeList) GetNodeIPs() []string {
+	seen := make(map[string]struct{}, len(l))
+	var ips []string
+	for _, node := range l {
+		for _, ip := range []string{node.IPv4, node.NodeIPv4} {
+			if _, ok := seen[ip]; ip == "" || ok {
+				continue
+			}
+			seen[ip] = struct{}{}
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
 func (e ExtraMetadata) GetMasterHostname(id string) string {
 	for _, node := range e.Masters {
 		if node.ID == id {
@@ -254,6 +280,39 @@ func GetStepID(ctx context.Context) string {
 	return ""
 }
 
+func WithNodeID(ctx context.Context, nodeID string) context.Context {
+	return context.WithValue(ctx, nodeKey{}, nodeID)
+}
+
+func GetNodeID(ctx context.Context) string {
+	if v := ctx.Value(nodeKey{}); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
+// StepLogger the logger of the component steps, the log lines carry the cluster, node and operation,
+// which are taken from the extra metadata when they are not in the context, e.g. on the server side.
+func StepLogger(ctx context.Context, name, cluster string) logger.Logging {
+	return logger.WithName(name).WithFields(stepLogFields(ctx, cluster)...)
+}
+
+func stepLogFields(ctx context.Context, cluster string) []zap.Field {
+	metadata := GetExtraMetadata(ctx)
+	if cluster == "" {
+		cluster = metadata.ClusterName
+	}
+	operation := GetOperationID(ctx)
+	if operation == "" {
+		operation = metadata.OperationID
+	}
+	return []zap.Field{
+		zap.String("cluster", cluster),
+		zap.String("node", GetNodeID(ctx)),
+		zap.String("operation", operation),
+	}
+}
+
 func WithOplog(ctx context.Context, ol OperationLogFile) context.Context {
 	return context.WithValue(ctx, oplogKey{}, ol)
 }
@@ -286,3 +345,27 @@ func GetRepoMirror(ctx context.Context) string {
 	}
 	return ""
 }
+
+func WithPackageMirror(ctx context.Context, mirror string) context.Context {
+	return context.WithValue(ctx, packageMirror{}, mirror)
+}
+
+// GetPackageMirror returns the base url which the online packages are downloaded from instead of the cloud static server.
+func GetPackageMirror(ctx context.Context) string {
+	if v := ctx.Value(packageMirror{}); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
+func WithImagePullJitter(ctx context.Context, delay time.Duration) context.Context {
+	return context.WithValue(ctx, pullJitter{}, delay)
+}
+
+// GetImagePullJitter returns the delay that current node should wait before pulling images.
+func GetImagePullJitter(ctx context.Context) time.Duration {
+	if v := ctx.Value(pullJitter{}); v != nil {
+		return v.(time.Duration)
+	}
+	return 0
+}
@@ -1,9 +1,12 @@
 package component
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
+	"go.uber.org/zap"
+
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 )
 
@@ -832,3 +835,39 @@ func TestExtraMetadata_IsAllMasterAvailable(t *testing.T) {
 		})
 	}
 }
+
+func Test_stepLogFields(t *testing.T) {
+	agentCtx := WithNodeID(WithOperationID(context.TODO(), "op-1"), "node-1")
+	serverCtx := WithExtraMetadata(context.TODO(), ExtraMetadata{ClusterName: "meta-cluster", OperationID: "meta-op"})
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		cluster string
+		want    []zap.Field
+	}{
+		{
+			name:    "agent",
+			ctx:     agentCtx,
+			cluster: "cluster-1",
+			want:    []zap.Field{zap.String("cluster", "cluster-1"), zap.String("node", "node-1"), zap.String("operation", "op-1")},
+		},
+		{
+			name: "server",
+			ctx:  serverCtx,
+			want: []zap.Field{zap.String("cluster", "meta-cluster"), zap.String("node", ""), zap.String("operation", "meta-op")},
+		},
+		{
+			name:    "cluster wins over metadata",
+			ctx:     serverCtx,
+			cluster: "cluster-1",
+			want:    []zap.Field{zap.String("cluster", "cluster-1"), zap.String("node", ""), zap.String("operation", "meta-op")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stepLogFields(tt.ctx, tt.cluster); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stepLogFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
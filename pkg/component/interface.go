@@ -123,6 +123,18 @@ type OfflinePackages map[string][]string
 
 type Options struct {
 	DryRun bool
+	// Progress receives the phases of the running step, it may be nil
+	Progress ProgressFunc
+}
+
+// ProgressFunc reports a finished phase of the running step, e.g. "containerd config rendered"
+type ProgressFunc func(phase string)
+
+// ReportProgress report the phase to opts.Progress if it is set
+func (opts Options) ReportProgress(phase string) {
+	if opts.Progress != nil {
+		opts.Progress(phase)
+	}
 }
 
 type StepRunnable interface {
@@ -140,6 +152,11 @@ type Runnable interface {
 	Uninstall(ctx context.Context, opts Options) ([]byte, error)
 }
 
+// Upgradable is implemented by the StepRunnable which supports the upgrade action
+type Upgradable interface {
+	Upgrade(ctx context.Context, opts Options) ([]byte, error)
+}
+
 type FuncIndex func() (key, value []byte, err error)
 
 type OperationLogFile interface {
@@ -0,0 +1,74 @@
+package component
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+)
+
+// RegistrationError the error of registering an agent step or template, errors.Is matches the cause,
+// e.g. ErrStepExist when the key is already registered.
+type RegistrationError struct {
+	// Kind the kind of the registration, step or template
+	Kind string
+	Key  string
+	Err  error
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("register %s %s failed: %v", e.Kind, e.Key, e.Err)
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// registrationErrs the errors of the registrations added in init, they are reported by ValidateRegistrations
+var registrationErrs []error
+
+// AddAgentStep register the agent step in init, the conflicting key does not panic but is reported
+// by ValidateRegistrations at startup.
+func AddAgentStep(kv string, p StepRunnable) {
+	if err := RegisterAgentStep(kv, p); err != nil {
+		registrationErrs = append(registrationErrs, err)
+	}
+}
+
+// AddTemplate register the template in init, the conflicting key does not panic but is reported
+// by ValidateRegistrations at startup.
+func AddTemplate(kv string, t TemplateRender) {
+	if err := RegisterTemplate(kv, t); err != nil {
+		registrationErrs = append(registrationErrs, err)
+	}
+}
+
+// AgentStepKeys returns the sorted keys of the registered agent steps
+func AgentStepKeys() []string {
+	keys := make([]string, 0, len(_agentSteps.steps))
+	for key := range _agentSteps.steps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TemplateKeys returns the sorted keys of the registered templates
+func TemplateKeys() []string {
+	keys := make([]string, 0, len(_tmpl.template))
+	for key := range _tmpl.template {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateRegistrations log the keys of the registered agent steps and templates, and returns the
+// errors of the registrations added in init, e.g. the duplicate keys.
+func ValidateRegistrations() error {
+	logger.Info("component registrations", zap.Strings("steps", AgentStepKeys()), zap.Strings("templates", TemplateKeys()))
+	return errors.Join(registrationErrs...)
+}
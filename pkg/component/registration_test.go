@@ -0,0 +1,38 @@
+package component
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddAgentStep_duplicate(t *testing.T) {
+	const key = "registration-test/v1/step"
+	defer func() {
+		delete(_agentSteps.steps, key)
+		registrationErrs = nil
+	}()
+	AddAgentStep(key, nil)
+	if err := ValidateRegistrations(); err != nil {
+		t.Fatalf("ValidateRegistrations() error = %v", err)
+	}
+	AddAgentStep(key, nil)
+	err := ValidateRegistrations()
+	if !errors.Is(err, ErrStepExist) {
+		t.Fatalf("ValidateRegistrations() error = %v, want %v", err, ErrStepExist)
+	}
+	var regErr *RegistrationError
+	if !errors.As(err, &regErr) || regErr.Key != key || regErr.Kind != TypeStep {
+		t.Errorf("ValidateRegistrations() error = %#v, want the registration error of %s", err, key)
+	}
+}
+
+func TestRegisterTemplate_keyFormat(t *testing.T) {
+	err := RegisterTemplate("registration-test/v1", nil)
+	if !errors.Is(err, ErrTemplateKeyFormat) {
+		t.Fatalf("RegisterTemplate() error = %v, want %v", err, ErrTemplateKeyFormat)
+	}
+	var regErr *RegistrationError
+	if !errors.As(err, &regErr) || regErr.Kind != TypeTemplate {
+		t.Errorf("RegisterTemplate() error = %#v, want the registration error of template", err)
+	}
+}
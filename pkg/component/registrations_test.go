@@ -0,0 +1,30 @@
+package component_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	_ "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cni"
+	_ "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
+	_ "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/k8s"
+)
+
+func TestRegistrations(t *testing.T) {
+	// the duplicate keys of the steps and templates registered in init are reported here
+	if err := component.ValidateRegistrations(); err != nil {
+		t.Fatalf("ValidateRegistrations() error = %v", err)
+	}
+	for _, key := range component.AgentStepKeys() {
+		step, _ := component.LoadAgentStep(key)
+		if instance := step.NewInstance(); reflect.TypeOf(instance) != reflect.TypeOf(step) {
+			t.Errorf("step %s instance is %T, want %T", key, instance, step)
+		}
+	}
+	for _, key := range component.TemplateKeys() {
+		tmpl, _ := component.LoadTemplate(key)
+		if instance := tmpl.NewInstance(); reflect.TypeOf(instance) != reflect.TypeOf(tmpl) {
+			t.Errorf("template %s instance is %T, want %T", key, instance, tmpl)
+		}
+	}
+}
@@ -45,9 +45,12 @@ func defaultTmpl() tmpl {
 
 func RegisterTemplate(kv string, t TemplateRender) error {
 	if !checkTemplateKey(kv) {
-		return ErrTemplateKeyFormat
+		return &RegistrationError{Kind: TypeTemplate, Key: kv, Err: ErrTemplateKeyFormat}
 	}
-	return _tmpl.registerTemplate(kv, t)
+	if err := _tmpl.registerTemplate(kv, t); err != nil {
+		return &RegistrationError{Kind: TypeTemplate, Key: kv, Err: err}
+	}
+	return nil
 }
 
 func LoadTemplate(kv string) (TemplateRender, bool) {
@@ -20,6 +20,8 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
 	"time"
 
 	"github.com/kubeclipper/kubeclipper/pkg/component"
@@ -60,6 +62,57 @@ func LoadImage(ctx context.Context, dryRun bool, file, criType string) error {
 	return err
 }
 
+// PullImage pull the image by the container runtime and tag it as target,
+// so the workloads reference the target image can use it without pulling.
+func PullImage(ctx context.Context, dryRun bool, image, target, criType string) error {
+	var cli []string
+	switch criType {
+	case "containerd":
+		cli = []string{"nerdctl", "-n", "k8s.io"}
+	case "docker":
+		cli = []string{"docker"}
+	default:
+		return fmt.Errorf("container runtime %s dose not support pull image", criType)
+	}
+	if _, err := cmdutil.RunCmdWithContext(ctx, dryRun, cli[0], append(cli[1:], "pull", image)...); err != nil {
+		return fmt.Errorf("pull image %s failed:%w", image, err)
+	}
+	if image == target {
+		return nil
+	}
+	if _, err := cmdutil.RunCmdWithContext(ctx, dryRun, cli[0], append(cli[1:], "tag", image, target)...); err != nil {
+		return fmt.Errorf("tag image %s as %s failed:%w", image, target, err)
+	}
+	return nil
+}
+
+// NodeJitter returns a delay in [0, max) derived from the node name, so the same node
+// always gets the same delay while different nodes are spread across the range.
+func NodeJitter(nodeName string, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(nodeName))
+	return time.Duration(h.Sum64() % uint64(max))
+}
+
+// WaitImagePullJitter waits the node image pull jitter put in context before pulling images,
+// staggers the pulls of nodes to avoid overwhelming the registry.
+func WaitImagePullJitter(ctx context.Context, dryRun bool) error {
+	delay := component.GetImagePullJitter(ctx)
+	if dryRun || delay <= 0 {
+		return nil
+	}
+	logger.Infof("wait %s before pulling images", delay)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
 func RetryFunc(ctx context.Context, opts component.Options, intervalTime time.Duration, funcName string, fn func(ctx context.Context, opts component.Options) error) error {
 	for {
 		select {
@@ -3,6 +3,9 @@ package utils
 import (
 	"context"
 	"testing"
+	"time"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
 )
 
 func TestLoadImage(t *testing.T) {
@@ -44,3 +47,36 @@ func TestLoadImage(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeJitter(t *testing.T) {
+	max := 30 * time.Second
+	nodes := []string{"node-1", "node-2", "node-3", "node-4", "node-5"}
+	delays := make(map[time.Duration]struct{})
+	for _, node := range nodes {
+		delay := NodeJitter(node, max)
+		if delay < 0 || delay >= max {
+			t.Errorf("NodeJitter(%s) = %s, out of range [0, %s)", node, delay, max)
+		}
+		if again := NodeJitter(node, max); again != delay {
+			t.Errorf("NodeJitter(%s) is not deterministic, got %s and %s", node, delay, again)
+		}
+		delays[delay] = struct{}{}
+	}
+	if len(delays) != len(nodes) {
+		t.Errorf("NodeJitter() want different delays for different nodes, got %v", delays)
+	}
+	if delay := NodeJitter("node-1", 0); delay != 0 {
+		t.Errorf("NodeJitter() with zero max = %s, want 0", delay)
+	}
+}
+
+func TestWaitImagePullJitter(t *testing.T) {
+	ctx, cancel := context.WithCancel(component.WithImagePullJitter(context.TODO(), time.Hour))
+	cancel()
+	if err := WaitImagePullJitter(ctx, false); err == nil {
+		t.Errorf("WaitImagePullJitter() want context error when canceled")
+	}
+	if err := WaitImagePullJitter(ctx, true); err != nil {
+		t.Errorf("WaitImagePullJitter() dry run error = %v", err)
+	}
+}
@@ -22,10 +22,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/kubeclipper/kubeclipper/pkg/clustermanage/kubeadm"
@@ -201,7 +199,7 @@ func (s *ClusterStatusMon) updateClusterCertification(clusterName string) error
 		}
 	}
 
-	clu.Status.Certifications = certifications
+	clu.Status.SetCertifications(certifications)
 	if _, err = s.ClusterWriter.UpdateCluster(context.TODO(), clu); err != nil {
 		s.log.Warn("update cluster certification status failed", zap.String("cluster", clu.Name), zap.Error(err))
 	}
@@ -222,51 +220,17 @@ func (s *ClusterStatusMon) getCertificationFromProvider(clu *v1.Cluster) ([]v1.C
 }
 
 func (s *ClusterStatusMon) GetCertificationFromKC(clu *v1.Cluster) ([]v1.Certification, error) {
-	var cmd []string
-	if clu.KubernetesVersion[1:] < k8s.KubeCertsCluVersion {
-		cmd = []string{"kubeadm", "alpha", "certs", "check-expiration"}
-	} else {
-		cmd = []string{"kubeadm", "certs", "check-expiration"}
-	}
+	cmd := k8s.CertsCmd(clu.KubernetesVersion, "check-expiration")
 	res, err := s.CmdDelivery.DeliverCmd(context.TODO(), clu.Masters[0].ID, cmd, 3*time.Minute)
 	if err != nil {
 		s.log.Warn("get cluster failed when get cluster certification status, skip it", zap.String("cluster", clu.Name))
 		return nil, err
 	}
-	splitRes := strings.Split(string(res), "\n\n")
-	if len(splitRes) != 3 {
-		logger.Errorf("read cluster certs error")
+	certification, err := k8s.ParseCertsExpiration(string(res))
+	if err != nil {
+		s.log.Warn("parse cluster certification expiration failed", zap.String("cluster", clu.Name), zap.Error(err))
 		return nil, err
 	}
-	crts := strings.Split(splitRes[1], "\n")
-	cas := strings.Split(splitRes[2], "\n")
-	certification := make([]v1.Certification, 0)
-	for _, ca := range cas[1:4] {
-		crt := strings.Fields(ca)
-		expire, parErr := time.Parse("Jan 02, 2006 15:04 MST", strings.Join(crt[1:6], " "))
-		if parErr != nil {
-			s.log.Warn("get cluster failed when get cluster ca expiration time", zap.String("cluster", clu.Name))
-			return nil, err
-		}
-		certification = append(certification, v1.Certification{
-			Name:           crt[0],
-			CAName:         "",
-			ExpirationTime: metav1.Time{Time: expire},
-		})
-	}
-	for _, cert := range crts[1:] {
-		crt := strings.Fields(cert)
-		expire, parErr := time.Parse("Jan 02, 2006 15:04 MST", strings.Join(crt[1:6], " "))
-		if parErr != nil {
-			s.log.Warn("get cluster failed when get cluster cert expiration time", zap.String("cluster", clu.Name))
-			return nil, err
-		}
-		certification = append(certification, v1.Certification{
-			Name:           crt[0],
-			CAName:         crt[7],
-			ExpirationTime: metav1.Time{Time: expire},
-		})
-	}
 	return certification, nil
 }
 
@@ -557,6 +557,7 @@ func (r *ClusterReconciler) updateCRIRegistries(ctx context.Context, c *v1.Clust
 	}
 
 	if !registriesEqual(c.Status.Registries, registries) {
+		old := c.Status.Registries
 		c.Status.Registries = registries
 
 		clusterSelector, err := labels.NewRequirement(common.LabelClusterName, selection.Equals, []string{c.Name})
@@ -565,16 +566,21 @@ func (r *ClusterReconciler) updateCRIRegistries(ctx context.Context, c *v1.Clust
 		}
 		nodes, err := r.NodeLister.List(labels.NewSelector().Add(*clusterSelector))
 		if err != nil {
-			return fmt.Errorf("list")
+			return fmt.Errorf("list nodes of cluster %s for cri registry update:%w", c.Name, err)
 		}
 
-		step, err := criRegistryUpdateStep(c, registries, nodes)
-		if err != nil {
-			return fmt.Errorf("criRegistryUpdateOperation:%w", err)
-		}
-		err = r.CmdDelivery.DeliverStep(ctx, step, &service.Options{DryRun: false})
-		if err != nil {
-			return fmt.Errorf("DeliverTaskOperation:%w", err)
+		// no node to configure, only the status is updated
+		if len(nodes) > 0 {
+			step, err := criRegistryUpdateStep(c, old, registries, nodes)
+			if err != nil {
+				return fmt.Errorf("criRegistryUpdateOperation:%w", err)
+			}
+			if step != nil {
+				err = r.CmdDelivery.DeliverStep(ctx, step, &service.Options{DryRun: false})
+				if err != nil {
+					return fmt.Errorf("DeliverTaskOperation:%w", err)
+				}
+			}
 		}
 		newSpec, err := r.ClusterWriter.UpdateCluster(ctx, c)
 		if err != nil {
@@ -589,46 +595,32 @@ func (r *ClusterReconciler) getClusterCRIRegistries(c *v1.Cluster) ([]v1.Registr
 	type mirror struct {
 		ImageRepoMirror string `json:"imageRepoMirror"`
 	}
-	insecureRegistry := append([]string{}, c.ContainerRuntime.InsecureRegistry...)
-	sort.Strings(insecureRegistry)
-	// add addons mirror registry
+	// the insecure registries and the addons mirror registries, deduplicated and sorted
+	insecure := sets.NewString(c.ContainerRuntime.InsecureRegistry...)
 	for _, a := range c.Addons {
 		var m mirror
-		err := json.Unmarshal(a.Config.Raw, &m)
-		if err != nil {
+		if err := json.Unmarshal(a.Config.Raw, &m); err != nil {
 			continue
 		}
 		if m.ImageRepoMirror != "" {
-			idx, ok := sort.Find(len(insecureRegistry), func(i int) int {
-				return strings.Compare(m.ImageRepoMirror, insecureRegistry[i])
-			})
-			if !ok {
-				if idx == len(insecureRegistry) {
-					insecureRegistry = append(insecureRegistry, m.ImageRepoMirror)
-				} else {
-					insecureRegistry = append(insecureRegistry[:idx+1], insecureRegistry[idx:]...)
-					insecureRegistry[idx] = m.ImageRepoMirror
-				}
-			}
+			insecure.Insert(m.ImageRepoMirror)
 		}
 	}
+	insecureRegistry := insecure.List()
 
 	registries := make([]v1.RegistrySpec, 0, len(insecureRegistry)*2+len(c.ContainerRuntime.Registries))
 	// insecure registry
 	for _, host := range insecureRegistry {
-		registries = appendUniqueRegistry(registries,
-			v1.RegistrySpec{Scheme: "http", Host: host},
-			v1.RegistrySpec{Scheme: "https", Host: host, SkipVerify: true})
+		registries = appendUniqueRegistry(registries, v1.InsecureRegistrySpecs(host, false)...)
 	}
 
-	validRegistries := c.ContainerRuntime.Registries[:0]
+	// a fresh slice, the registries may be shared with the cached cluster
+	validRegistries := make([]v1.CRIRegistry, 0, len(c.ContainerRuntime.Registries))
 	for _, reg := range c.ContainerRuntime.Registries {
 		if reg.RegistryRef == nil || *reg.RegistryRef == "" {
 			// fix reg.RegistryRef=""
 			reg.RegistryRef = nil
-			registries = appendUniqueRegistry(registries,
-				v1.RegistrySpec{Scheme: "http", Host: reg.InsecureRegistry},
-				v1.RegistrySpec{Scheme: "https", Host: reg.InsecureRegistry, SkipVerify: true})
+			registries = appendUniqueRegistry(registries, v1.InsecureRegistrySpecs(reg.InsecureRegistry, reg.HTTPOnly)...)
 			validRegistries = append(validRegistries, reg)
 			continue
 		}
@@ -643,34 +635,15 @@ func (r *ClusterReconciler) getClusterCRIRegistries(c *v1.Cluster) ([]v1.Registr
 		validRegistries = append(validRegistries, reg)
 	}
 	c.ContainerRuntime.Registries = validRegistries
+	// the catch-all mirror of the registries without their own hosts dir
+	if c.ContainerRuntime.DefaultMirror != "" {
+		registries = appendUniqueRegistry(registries, v1.DefaultMirrorSpec(registries, c.ContainerRuntime.DefaultMirror))
+	}
 	return registries, nil
 }
 
-func criRegistryUpdateStep(cluster *v1.Cluster, registries []v1.RegistrySpec, nodes []*v1.Node) (*v1.Step, error) {
-	var (
-		step     component.StepRunnable
-		identity string
-	)
-	switch cluster.ContainerRuntime.Type {
-	case v1.CRIDocker:
-		identity = cri.DockerInsecureRegistryConfigureIdentity
-		step = &cri.DockerInsecureRegistryConfigure{
-			InsecureRegistry: cri.ToDockerInsecureRegistry(registries),
-		}
-	case v1.CRIContainerd:
-		identity = cri.ContainerdRegistryConfigureIdentity
-		step = &cri.ContainerdRegistryConfigure{
-			Registries: cri.ToContainerdRegistryConfig(registries),
-			// TODO: get from config
-			ConfigDir: cri.ContainerdDefaultRegistryConfigDir,
-		}
-	default:
-		return nil, fmt.Errorf("unknown CRI type:%s", cluster.ContainerRuntime.Type)
-	}
-	stepData, err := json.Marshal(step)
-	if err != nil {
-		return nil, fmt.Errorf("step marshal:%w", err)
-	}
+// criRegistryUpdateStep the step of updating the cri registries from old on nodes, only the changed hosts are touched
+func criRegistryUpdateStep(cluster *v1.Cluster, old, registries []v1.RegistrySpec, nodes []*v1.Node) (*v1.Step, error) {
 	var allNodes []v1.StepNode
 	for _, node := range nodes {
 		allNodes = append(allNodes, v1.StepNode{
@@ -680,30 +653,23 @@ func criRegistryUpdateStep(cluster *v1.Cluster, registries []v1.RegistrySpec, no
 			Hostname: node.Labels[common.LabelHostname],
 		})
 	}
-	return &v1.Step{
-		Name:   "update-cri-registry-config",
-		Nodes:  allNodes,
-		Action: v1.ActionInstall,
-		Timeout: metav1.Duration{
-			Duration: time.Second * 30,
-		},
-		Commands: []v1.Command{
-			{
-				Type:          v1.CommandCustom,
-				Identity:      identity,
-				CustomCommand: stepData,
-			},
-		},
-	}, nil
+	steps, err := cri.UpdateRegistriesSteps(cluster, old, registries, allNodes)
+	if err != nil || len(steps) == 0 {
+		return nil, err
+	}
+	return &steps[0], nil
 }
 
 // Use scheme and host as unique key
 
 func appendUniqueRegistry(s []v1.RegistrySpec, items ...v1.RegistrySpec) []v1.RegistrySpec {
 	for _, r := range items {
-		key := r.Scheme + r.Host
+		// registry host is case-insensitive
+		r.Host = strings.ToLower(r.Host)
+		// the canonical order of the registries, so the status comparison is stable
+		key := registryKey(r)
 		idx, ok := sort.Find(len(s), func(i int) int {
-			return strings.Compare(key, s[i].Scheme+s[i].Host)
+			return strings.Compare(key, registryKey(s[i]))
 		})
 		if !ok {
 			if idx == len(s) {
@@ -717,16 +683,16 @@ func appendUniqueRegistry(s []v1.RegistrySpec, items ...v1.RegistrySpec) []v1.Re
 	return s
 }
 
+// registryKey the scheme and host are separated, so http+"sa.io" and https+"a.io" are distinct,
+// and the same host mirroring another server is distinct from the host itself.
+func registryKey(r v1.RegistrySpec) string {
+	return r.Scheme + "://" + r.Host + " " + strings.ToLower(r.MirrorFor)
+}
+
+// registriesEqual compares the registries by host regardless of order
 func registriesEqual(a, b []v1.RegistrySpec) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
-	}
-	return true
+	changed, removed := cri.DiffRegistries(a, b)
+	return len(changed) == 0 && len(removed) == 0
 }
 
 var kubeconfigFormat = `
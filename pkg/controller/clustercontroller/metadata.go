@@ -21,6 +21,7 @@ func (r *ClusterReconciler) assembleClusterExtraMetadata(ctx context.Context, c
 		ControlPlaneStatus: c.Status.ControlPlaneHealth,
 		CNI:                c.CNI.Type,
 		CNINamespace:       c.CNI.Namespace,
+		Registries:         c.Status.Registries,
 	}
 	meta.Addons = append(meta.Addons, c.Addons...)
 
@@ -253,6 +253,10 @@ func (r *CronBackupReconciler) createBackup(log logger.Logging, cronBackup *v1.C
 		log.Warnf("the cluster is %v, create backup in next reconcile", c.Status.Phase)
 		return err
 	}
+	if c.Etcd.IsExternal() {
+		log.Warnf("the cluster %s uses an external etcd cluster, skip the cron backup", c.Name)
+		return nil
+	}
 
 	randNum := rand.String(6)
 	backup.Name = fmt.Sprintf("%s-%s-%s", c.Name, cronBackup.Name, randNum)
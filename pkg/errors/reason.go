@@ -34,6 +34,7 @@ const (
 	Unmarshal          CauseType = "unmarshal error"
 	AgentStepInstall   CauseType = "agent install step command "
 	AgentStepUninstall CauseType = "agent uninstall step command"
+	AgentStepUpgrade   CauseType = "agent upgrade step command"
 	ShellCommand       CauseType = "shell command step error"
 	StepLog            CauseType = "step log error"
 )
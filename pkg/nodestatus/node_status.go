@@ -19,6 +19,7 @@
 package nodestatus
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"runtime"
@@ -42,9 +43,18 @@ import (
 	"k8s.io/apimachinery/pkg/util/errors"
 
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/netutil"
 )
 
+// containerRuntimeInfoTimeout the timeout of querying the container runtime, so a hung runtime
+// does not block the node status update.
+const containerRuntimeInfoTimeout = 5 * time.Second
+
+// containerRuntimeInfoRefreshInterval the interval of querying the container runtime, the info is
+// cached between the node status updates since crictl is expensive to run.
+const containerRuntimeInfoRefreshInterval = time.Minute
+
 // Setter modifies the node in-place, and returns an error if the modification failed.
 // Setters may partially mutate the node before returning an error.
 type Setter func(node *v1.Node) error
@@ -163,6 +173,47 @@ func MachineInfo() Setter {
 	}
 }
 
+// ContainerRuntimeInfo returns a Setter that reports the container runtime actually running on the node,
+// the info is cleared if no container runtime is running. The runtime is queried at most once per
+// containerRuntimeInfoRefreshInterval, and the query error is logged only when it changes.
+func ContainerRuntimeInfo() Setter {
+	return containerRuntimeInfo(time.Now, cri.RuntimeInfo)
+}
+
+func containerRuntimeInfo(nowFunc func() time.Time, runtimeInfoFunc func(ctx context.Context) (*v1.ContainerRuntimeInfo, error)) Setter {
+	var (
+		info      v1.ContainerRuntimeInfo
+		refreshed time.Time
+		lastErr   string
+	)
+	return func(node *v1.Node) error {
+		if now := nowFunc(); refreshed.IsZero() || now.Sub(refreshed) >= containerRuntimeInfoRefreshInterval {
+			refreshed = now
+			ctx, cancel := context.WithTimeout(context.Background(), containerRuntimeInfoTimeout)
+			got, err := runtimeInfoFunc(ctx)
+			cancel()
+			info = v1.ContainerRuntimeInfo{}
+			if got != nil {
+				info = *got
+			}
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != lastErr {
+				if err != nil {
+					logger.Warn("Failed to get container runtime info", zap.Error(err))
+				} else {
+					logger.Info("Container runtime info is available again", zap.String("type", info.Type))
+				}
+				lastErr = errMsg
+			}
+		}
+		node.Status.ContainerRuntimeInfo = *info.DeepCopy()
+		return nil
+	}
+}
+
 // ReadyCondition returns a Setter that updates the v1.NodeReady condition on the node.
 func ReadyCondition(
 	nowFunc func() time.Time, // typically Kubelet.clock.Now
@@ -1,8 +1,11 @@
 package nodestatus
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/sysutil"
@@ -109,3 +112,31 @@ func Test_toNodeAddress(t *testing.T) {
 		})
 	}
 }
+
+func Test_containerRuntimeInfo(t *testing.T) {
+	now := time.Now()
+	calls := 0
+	var err error
+	setter := containerRuntimeInfo(func() time.Time { return now }, func(ctx context.Context) (*v1.ContainerRuntimeInfo, error) {
+		calls++
+		return &v1.ContainerRuntimeInfo{Type: v1.CRIContainerd, Version: fmt.Sprintf("1.6.%d", calls)}, err
+	})
+	node := &v1.Node{}
+	for i := 0; i < 3; i++ {
+		if err := setter(node); err != nil {
+			t.Fatalf("setter() error = %v", err)
+		}
+	}
+	if calls != 1 || node.Status.ContainerRuntimeInfo.Version != "1.6.1" {
+		t.Errorf("setter() queried the runtime %d times, version %s, want the cached 1.6.1", calls, node.Status.ContainerRuntimeInfo.Version)
+	}
+
+	// the error is not returned to avoid logging it on every update
+	now, err = now.Add(containerRuntimeInfoRefreshInterval), fmt.Errorf("crictl info failed")
+	if err := setter(node); err != nil {
+		t.Fatalf("setter() error = %v", err)
+	}
+	if calls != 2 || node.Status.ContainerRuntimeInfo.Version != "1.6.2" {
+		t.Errorf("setter() queried the runtime %d times, version %s, want the refreshed 1.6.2", calls, node.Status.ContainerRuntimeInfo.Version)
+	}
+}
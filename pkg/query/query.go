@@ -56,6 +56,8 @@ const (
 	ParameterSubDomain            = "subdomain"
 	ParameterFuzzySearch          = "fuzzy"
 	ParameterForce                = "force"
+	ParameterPreserveData         = "preserveData"
+	ParameterVerify               = "verify"
 )
 
 const (
@@ -48,6 +48,8 @@ const (
 	LabelBackupPoint        = "kubeclipper.io/backupPoint"
 	LabelCronBackupDisable  = "kubeclipper.io/cronBackupDisable"
 	LabelCronBackupEnable   = "kubeclipper.io/cronBackupEnable"
+	LabelCRIVersion         = "kubeclipper.io/cri-version"
+	LabelCNIVersion         = "kubeclipper.io/cni-version"
 
 	LabelClusterProviderType = "kubeclipper.io/clusterProviderType"
 	LabelClusterProviderName = "kubeclipper.io/clusterProviderName"
@@ -73,6 +75,8 @@ const (
 	AnnotationOnlyInstallKubernetesComp = "kubeclipper.io/only-install-kubernetes-component"
 	// AnnotationOnlyIgnorePreflightErrors specify kubeadm init --ignore-preflight-errors
 	AnnotationOnlyIgnorePreflightErrors = "kubeclipper.io/ignore-preflight-errors"
+	// AnnotationSwitchCNI the target cni of switch cni operation
+	AnnotationSwitchCNI = "kubeclipper.io/switch-cni"
 )
 
 type NodeRole string // master/worker/ingress(worker)
@@ -19,9 +19,15 @@
 package v1
 
 import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/kubeclipper/kubeclipper/pkg/scheme/common"
 )
@@ -58,6 +64,75 @@ type Cluster struct {
 	Status            ClusterStatus      `json:"status,omitempty" optional:"true"`
 	PendingOperations []PendingOperation `json:"pendingOperations,omitempty" optional:"true"`
 	FeatureGates      map[string]bool    `json:"featureGates,omitempty"`
+	// ServiceAccountKubeConfig generate a least-privilege kubeconfig of the service account on the first master,
+	// besides the admin kubeconfig.
+	ServiceAccountKubeConfig *ServiceAccountKubeConfig `json:"serviceAccountKubeConfig,omitempty" optional:"true"`
+	// IgnorePreflightErrors the kubeadm preflight checks whose errors are shown as warnings on kubeadm init and join,
+	// e.g. Swap or SystemVerification. The value all ignores errors from all checks.
+	IgnorePreflightErrors []string `json:"ignorePreflightErrors,omitempty" optional:"true"`
+	// CgroupDriver the cgroup driver of both kubelet and the container runtime, defaults to auto.
+	// Auto follows the containerd systemd cgroup setting, or detects the cgroup version of the nodes.
+	CgroupDriver string `json:"cgroupDriver,omitempty" optional:"true" enum:"auto|systemd|cgroupfs"`
+}
+
+const (
+	// CgroupDriverAuto use the systemd cgroup driver when the node uses cgroup v2, otherwise cgroupfs
+	CgroupDriverAuto     = "auto"
+	CgroupDriverSystemd  = "systemd"
+	CgroupDriverCgroupfs = "cgroupfs"
+)
+
+// ResolveCgroupDriver returns the cgroup driver shared by kubelet and the container runtime.
+// The explicit cgroup driver wins, otherwise it follows the explicit containerd systemd cgroup setting,
+// docker always uses the systemd cgroup driver.
+func (c *Cluster) ResolveCgroupDriver() string {
+	switch c.CgroupDriver {
+	case CgroupDriverSystemd, CgroupDriverCgroupfs:
+		return c.CgroupDriver
+	}
+	if c.ContainerRuntime.Type == CRIDocker {
+		return CgroupDriverSystemd
+	}
+	switch c.ContainerRuntime.SystemdCgroup {
+	case SystemdCgroupTrue:
+		return CgroupDriverSystemd
+	case SystemdCgroupFalse:
+		return CgroupDriverCgroupfs
+	}
+	return CgroupDriverAuto
+}
+
+// ValidateCgroupDriver check the cgroup driver is supported and consistent with the container runtime setting,
+// kubelet fails to start when its cgroup driver differs from the container runtime one.
+func (c *Cluster) ValidateCgroupDriver() error {
+	switch c.CgroupDriver {
+	case "", CgroupDriverAuto:
+		return nil
+	case CgroupDriverSystemd, CgroupDriverCgroupfs:
+	default:
+		return fmt.Errorf("unsupported cgroup driver: %s", c.CgroupDriver)
+	}
+	if c.ContainerRuntime.Type == CRIDocker && c.CgroupDriver != CgroupDriverSystemd {
+		return fmt.Errorf("docker only supports the %s cgroup driver", CgroupDriverSystemd)
+	}
+	if (c.ContainerRuntime.SystemdCgroup == SystemdCgroupTrue && c.CgroupDriver != CgroupDriverSystemd) ||
+		(c.ContainerRuntime.SystemdCgroup == SystemdCgroupFalse && c.CgroupDriver != CgroupDriverCgroupfs) {
+		return fmt.Errorf("containerd systemd cgroup %s is inconsistent with the %s cgroup driver",
+			c.ContainerRuntime.SystemdCgroup, c.CgroupDriver)
+	}
+	return nil
+}
+
+// ServiceAccountKubeConfig the kubeconfig of a namespaced service account bound to a cluster role.
+type ServiceAccountKubeConfig struct {
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	ClusterRole string `json:"clusterRole"`
+	// Path the kubeconfig file path on the first master
+	Path string `json:"path"`
+	// SkipAdminCopy do not copy the admin kubeconfig to /root/.kube/config on the first master,
+	// only the service account kubeconfig is generated then.
+	SkipAdminCopy bool `json:"skipAdminCopy,omitempty" optional:"true"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -130,6 +205,8 @@ type ClusterStatus struct {
 	ComponentConditions []ComponentConditions `json:"componentConditions,omitempty"`
 
 	Certifications []Certification `json:"certifications,omitempty"`
+	// CertificationExpiration the earliest expiration time of the certifications
+	CertificationExpiration *metav1.Time `json:"certificationExpiration,omitempty"`
 	// Registries all CRI registry
 	Registries []RegistrySpec `json:"registries,omitempty"`
 	// ControlPlane Health
@@ -177,9 +254,14 @@ func (c *Cluster) Complete() {
 	c.CNI.LocalRegistry = c.LocalRegistry
 	c.CNI.CriType = c.ContainerRuntime.Type
 	c.CNI.Offline = c.Offline()
-	if common.IsKubeVersionGreater(c.KubernetesVersion, 126) {
+	// the explicit namespace is honored, only the empty one is defaulted
+	switch {
+	case c.CNI.Namespace != "":
+	case c.CNI.Type == "flannel":
+		c.CNI.Namespace = "kube-flannel"
+	case common.IsKubeVersionGreater(c.KubernetesVersion, 126):
 		c.CNI.Namespace = "calico-system"
-	} else {
+	default:
 		c.CNI.Namespace = "kube-system"
 	}
 }
@@ -190,6 +272,17 @@ type Certification struct {
 	ExpirationTime metav1.Time `json:"expirationTime,omitempty"`
 }
 
+// SetCertifications set the certifications and the earliest expiration time of them
+func (s *ClusterStatus) SetCertifications(certs []Certification) {
+	s.Certifications = certs
+	s.CertificationExpiration = nil
+	for i := range certs {
+		if s.CertificationExpiration == nil || certs[i].ExpirationTime.Before(s.CertificationExpiration) {
+			s.CertificationExpiration = certs[i].ExpirationTime.DeepCopy()
+		}
+	}
+}
+
 type ComponentStatus string
 
 const (
@@ -216,17 +309,99 @@ type IPFamily string
 const (
 	// IPFamilyIPv4 represents IPv4-only address family.
 	IPFamilyIPv4 IPFamily = "IPv4"
+	// IPFamilyIPv6 represents IPv6-only address family.
+	IPFamilyIPv6 IPFamily = "IPv6"
 	// IPFamilyDualStack represents dual-stack address family with IPv4 as the primary address family.
 	IPFamilyDualStack IPFamily = "IPv4+IPv6"
 )
 
+// ValidateIPFamily check the address families of the pod and service cidrs match the IPFamily,
+// the cidrs are IPv4 for IPv4, IPv6 for IPv6, and IPv4 followed by IPv6 for IPv4+IPv6.
+func (n *Networking) ValidateIPFamily() error {
+	switch n.IPFamily {
+	case "":
+		return nil
+	case IPFamilyIPv4, IPFamilyIPv6, IPFamilyDualStack:
+	default:
+		return fmt.Errorf("unsupported ip family: %s", n.IPFamily)
+	}
+	if err := validateCIDRFamilies(n.IPFamily, n.Pods.CIDRBlocks); err != nil {
+		return fmt.Errorf("invalid pod cidr:%w", err)
+	}
+	if err := validateCIDRFamilies(n.IPFamily, n.Services.CIDRBlocks); err != nil {
+		return fmt.Errorf("invalid service cidr:%w", err)
+	}
+	return nil
+}
+
+// ValidateCIDROverlap check the pod cidrs and service cidrs do not overlap each other,
+// and none of them contains the node ips, the conflict is named in the error.
+func (n *Networking) ValidateCIDROverlap(nodeIPs ...string) error {
+	type namedCIDR struct {
+		name  string
+		ipNet *net.IPNet
+	}
+	var cidrs []namedCIDR
+	for _, r := range []struct {
+		name   string
+		blocks []string
+	}{{"pod", n.Pods.CIDRBlocks}, {"service", n.Services.CIDRBlocks}} {
+		for _, block := range r.blocks {
+			_, ipNet, err := net.ParseCIDR(block)
+			if err != nil {
+				return fmt.Errorf("invalid %s cidr %s:%w", r.name, block, err)
+			}
+			cidrs = append(cidrs, namedCIDR{name: fmt.Sprintf("%s cidr %s", r.name, block), ipNet: ipNet})
+		}
+	}
+	for i := range cidrs {
+		for j := i + 1; j < len(cidrs); j++ {
+			if cidrs[i].ipNet.Contains(cidrs[j].ipNet.IP) || cidrs[j].ipNet.Contains(cidrs[i].ipNet.IP) {
+				return fmt.Errorf("%s overlaps with %s", cidrs[i].name, cidrs[j].name)
+			}
+		}
+	}
+	for _, nodeIP := range nodeIPs {
+		ip := net.ParseIP(nodeIP)
+		if ip == nil {
+			return fmt.Errorf("invalid node ip %s", nodeIP)
+		}
+		for _, c := range cidrs {
+			if c.ipNet.Contains(ip) {
+				return fmt.Errorf("%s overlaps with node ip %s", c.name, nodeIP)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCIDRFamilies(family IPFamily, cidrs []string) error {
+	expected := []bool{family == IPFamilyIPv6}
+	if family == IPFamilyDualStack {
+		expected = append(expected, true)
+	}
+	if len(cidrs) > len(expected) {
+		return fmt.Errorf("%s allows at most %d cidr, got %v", family, len(expected), cidrs)
+	}
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		if isIPv6 := ipNet.IP.To4() == nil; isIPv6 != expected[i] {
+			return fmt.Errorf("cidr %s dose not match the ip family %s", cidr, family)
+		}
+	}
+	return nil
+}
+
 // NetworkRanges represents ranges of network addresses.
 type NetworkRanges struct {
 	CIDRBlocks []string `json:"cidrBlocks"`
 }
 
 type Networking struct {
-	// Optional: IP family used for cluster networking. Supported values are "IPv4" or "IPv4+IPv6".
+	// Optional: IP family used for cluster networking. Supported values are "IPv4", "IPv6" or "IPv4+IPv6".
 	// Can be omitted / empty if pods and services network ranges are specified.
 	// In that case it defaults according to the IP families of the provided network ranges.
 	// If neither ipFamily nor pods & services network ranges are specified, defaults to "IPv4".
@@ -247,33 +422,126 @@ type Networking struct {
 	// Defaults to "ipvs". "ebpf" disables kube-proxy and requires CNI support.
 	ProxyMode     string `json:"proxyMode"`
 	WorkerNodeVip string `json:"workerNodeVip" optional:"true"`
+	// SkipKubeProxy do not deploy kube-proxy, the service load balancing is taken over by the cni,
+	// e.g. the kube-proxy replacement of cilium.
+	SkipKubeProxy bool `json:"skipKubeProxy,omitempty" optional:"true"`
 }
 
 var (
-	AllowedCNI = sets.NewString("calico")
+	AllowedCNI = sets.NewString("calico", "flannel", "custom")
 )
 
 type CNI struct {
 	LocalRegistry string `json:"localRegistry" optional:"true"`
 	// TODO: Cluster multiple cni plugins are not supported at this time
-	Type      string  `json:"type" enum:"calico"`
-	Version   string  `json:"version"`
-	CriType   string  `json:"criType"`
-	Offline   bool    `json:"offline"`
-	Namespace string  `json:"namespace"`
-	Calico    *Calico `json:"calico" optional:"true"`
+	Type      string   `json:"type" enum:"calico|flannel|custom"`
+	Version   string   `json:"version"`
+	CriType   string   `json:"criType"`
+	Offline   bool     `json:"offline"`
+	Namespace string   `json:"namespace"`
+	Calico    *Calico  `json:"calico" optional:"true"`
+	Flannel   *Flannel `json:"flannel,omitempty" optional:"true"`
+	// Custom the user supplied cni manifest, used when type is custom.
+	Custom *CustomCNI `json:"custom,omitempty" optional:"true"`
+	// ImageLoadConcurrency the max number of nodes load the offline cni images at the same time, 0 means no limit.
+	ImageLoadConcurrency int `json:"imageLoadConcurrency,omitempty" optional:"true"`
+	// ImageSource the central source of the offline cni images, used instead of copying the image tarball to each node.
+	// It is either the http(s) url of the image tarball, or the address of an image registry populated with the cni images.
+	ImageSource string `json:"imageSource,omitempty" optional:"true"`
 }
 
 type Calico struct {
-	IPv4AutoDetection string `json:"IPv4AutoDetection" enum:"first-found|can-reach=DESTINATION|interface=INTERFACE-REGEX|skip-interface=INTERFACE-REGEX"`
-	IPv6AutoDetection string `json:"IPv6AutoDetection" enum:"first-found|can-reach=DESTINATION|interface=INTERFACE-REGEX|skip-interface=INTERFACE-REGEX"`
+	IPv4AutoDetection string `json:"IPv4AutoDetection" enum:"first-found|kubernetes-internal-ip|can-reach=DESTINATION|interface=INTERFACE-REGEX|skip-interface=INTERFACE-REGEX|cidr=CIDR"`
+	IPv6AutoDetection string `json:"IPv6AutoDetection" enum:"first-found|kubernetes-internal-ip|can-reach=DESTINATION|interface=INTERFACE-REGEX|skip-interface=INTERFACE-REGEX|cidr=CIDR"`
 	Mode              string `json:"mode" enum:"BGP|Overlay-IPIP-All|Overlay-IPIP-Cross-Subnet|Overlay-Vxlan-All|Overlay-Vxlan-Cross-Subnet|overlay"`
-	IPManger          bool   `json:"IPManger" optional:"true"`
-	MTU               int    `json:"mtu"`
+	// IPManger use calico-ipam to assign the pod ips.
+	// Deprecated: use IPAM instead, IPManger true is the same as IPAM calico-ipam.
+	IPManger bool `json:"IPManger" optional:"true"`
+	// IPAM the cni ipam plugin, calico-ipam or host-local which assigns the pod ips from the pod cidr of the node.
+	// The BGP and IPIP modes require calico-ipam since the routes are advertised per calico ipam block.
+	IPAM string `json:"ipam,omitempty" optional:"true" enum:"calico-ipam|host-local"`
+	MTU  int    `json:"mtu"`
+	// AutoMTU let calico auto-detect the MTU, MTU is ignored when it is true.
+	AutoMTU bool `json:"autoMTU,omitempty" optional:"true"`
+	// ASNumber the default AS number of cluster nodes, only used in BGP mode.
+	// Calico uses 64512 when it is empty.
+	ASNumber uint32 `json:"asNumber,omitempty" optional:"true"`
+	// BGPPeers the global BGP peers of cluster nodes, e.g. the ToR switches, only used in BGP mode.
+	BGPPeers []BGPPeer `json:"bgpPeers,omitempty" optional:"true"`
+	// IgnoreLooseRPF let felix start on hosts with loose reverse path filtering (rp_filter=2),
+	// which is not secure as workloads may spoof their source address.
+	IgnoreLooseRPF bool `json:"ignoreLooseRPF,omitempty" optional:"true"`
+	// TyphaReplicas the replicas of calico-typha, which fans out the datastore updates to felix.
+	// When it is 0, typha is enabled automatically for large clusters only.
+	TyphaReplicas int `json:"typhaReplicas,omitempty" optional:"true"`
+	// DisableBirdReadyCheck exclude the bird readiness check of calico-node, which always fails when
+	// bird has no BGP peers, it is disabled automatically in vxlan mode.
+	DisableBirdReadyCheck bool `json:"disableBirdReadyCheck,omitempty" optional:"true"`
+	// EnabledControllers the controllers run by calico-kube-controllers, defaults to node.
+	// Valid controllers are node, policy, namespace, serviceaccount and workloadendpoint.
+	EnabledControllers []string `json:"enabledControllers,omitempty" optional:"true"`
+	// EncryptTraffic encrypt the pod-to-pod traffic with wireguard, disabled by default.
+	// The wireguard kernel module must be available on every node.
+	EncryptTraffic bool `json:"encryptTraffic,omitempty" optional:"true"`
+	// BlockSize the prefix length of the ipv4 address blocks allocated to nodes, must be in range 20-32
+	// and not less than the prefix length of the pod cidr, defaults to 26.
+	BlockSize int `json:"blockSize,omitempty" optional:"true"`
+}
+
+const (
+	CalicoIPAMCalico    = "calico-ipam"
+	CalicoIPAMHostLocal = "host-local"
+)
+
+// IPAMType the cni ipam plugin of calico, the explicit IPAM wins, otherwise IPManger true means calico-ipam.
+// It is empty when neither is set, and the calico-config has no ipam block.
+func (c *Calico) IPAMType() string {
+	if c.IPAM != "" {
+		return c.IPAM
+	}
+	if c.IPManger {
+		return CalicoIPAMCalico
+	}
+	return ""
+}
+
+type BGPPeer struct {
+	PeerIP   string `json:"peerIP"`
+	ASNumber uint32 `json:"asNumber"`
+}
+
+type Flannel struct {
+	// Backend the flannel backend type, defaults to "vxlan".
+	Backend string `json:"backend,omitempty" enum:"vxlan|host-gw"`
+}
+
+type CustomCNI struct {
+	// Manifest the http(s) url or the file path on the first master node of the cni manifest.
+	// The manifest is rendered as go template, e.g. {{.PodIPv4CIDR}} is replaced by the pod cidr
+	// and {{.KubeletDataDir}} is replaced by the kubelet root dir.
+	Manifest string `json:"manifest"`
+	// ConfigPrefixes the name prefixes of the cni config files the cni writes to /etc/cni/net.d,
+	// the files are removed from the nodes when the cni is uninstalled, e.g. switched to another cni.
+	ConfigPrefixes []string `json:"configPrefixes,omitempty" optional:"true"`
 }
 
 type Etcd struct {
 	DataDir string `json:"dataDir,omitempty" optional:"true"`
+	// External the external etcd cluster used by kubernetes, the stacked etcd is not deployed when it is set.
+	External *ExternalEtcd `json:"external,omitempty" optional:"true"`
+}
+
+// IsExternal whether kubernetes uses an external etcd cluster instead of the stacked one
+func (e *Etcd) IsExternal() bool {
+	return e.External != nil
+}
+
+// ExternalEtcd the external etcd cluster, the certificate files must exist on all the master nodes.
+type ExternalEtcd struct {
+	Endpoints []string `json:"endpoints"`
+	CAFile    string   `json:"caFile,omitempty" optional:"true"`
+	CertFile  string   `json:"certFile,omitempty" optional:"true"`
+	KeyFile   string   `json:"keyFile,omitempty" optional:"true"`
 }
 
 type Kubelet struct {
@@ -281,6 +549,42 @@ type Kubelet struct {
 	NodeIP     string `json:"nodeIP" yaml:"nodeIP"`
 	IPAsName   bool   `json:"ipAsName" yaml:"ipAsName"`
 	ResolvConf string `json:"resolvConf" yaml:"resolvConf"`
+	// ImageGCHighThreshold and ImageGCLowThreshold the disk usage percent the image garbage collection
+	// is always run and never run, defaults to 85 and 80 when they are not set.
+	ImageGCHighThreshold int `json:"imageGCHighThreshold,omitempty" yaml:"imageGCHighThreshold,omitempty" optional:"true"`
+	ImageGCLowThreshold  int `json:"imageGCLowThreshold,omitempty" yaml:"imageGCLowThreshold,omitempty" optional:"true"`
+}
+
+const (
+	// DefaultImageGCHighThreshold and DefaultImageGCLowThreshold the image garbage collection thresholds of kubelet
+	DefaultImageGCHighThreshold = 85
+	DefaultImageGCLowThreshold  = 80
+)
+
+// ImageGCThresholds returns the image garbage collection thresholds, the unset ones are defaulted.
+func (k *Kubelet) ImageGCThresholds() (high, low int) {
+	high, low = k.ImageGCHighThreshold, k.ImageGCLowThreshold
+	if high == 0 {
+		high = DefaultImageGCHighThreshold
+	}
+	if low == 0 {
+		low = DefaultImageGCLowThreshold
+	}
+	return high, low
+}
+
+// ValidateImageGCThresholds check the image garbage collection thresholds are percents and the high one is greater.
+func (k *Kubelet) ValidateImageGCThresholds() error {
+	if k.ImageGCHighThreshold < 0 || k.ImageGCHighThreshold > 100 {
+		return fmt.Errorf("invalid kubelet image gc high threshold %d, must be in 0-100", k.ImageGCHighThreshold)
+	}
+	if k.ImageGCLowThreshold < 0 || k.ImageGCLowThreshold > 100 {
+		return fmt.Errorf("invalid kubelet image gc low threshold %d, must be in 0-100", k.ImageGCLowThreshold)
+	}
+	if high, low := k.ImageGCThresholds(); high <= low {
+		return fmt.Errorf("kubelet image gc high threshold %d must be greater than the low threshold %d", high, low)
+	}
+	return nil
 }
 
 type KubeProxy struct {
@@ -299,6 +603,22 @@ const (
 	CRIContainerd = "containerd"
 )
 
+const (
+	// SystemdCgroupAuto enable the containerd systemd cgroup when the node uses cgroup v2
+	SystemdCgroupAuto  = "auto"
+	SystemdCgroupTrue  = "true"
+	SystemdCgroupFalse = "false"
+)
+
+const (
+	ContainerdLogLevelInfo  = "info"
+	ContainerdLogLevelDebug = "debug"
+	ContainerdLogLevelWarn  = "warn"
+
+	ContainerdLogFormatText = "text"
+	ContainerdLogFormatJSON = "json"
+)
+
 type ContainerRuntime struct {
 	Type        string `json:"type" enum:"docker|containerd"`
 	Version     string `json:"version,omitempty" enum:"1.4.4"`
@@ -307,11 +627,163 @@ type ContainerRuntime struct {
 	InsecureRegistry []string `json:"insecureRegistry,omitempty"`
 	// When updating
 	Registries []CRIRegistry `json:"registries,omitempty"`
+	// MaxConcurrentDownloads the max number of layers downloaded in parallel by containerd,
+	// 0 means the containerd default. Only supported by containerd.
+	MaxConcurrentDownloads int `json:"maxConcurrentDownloads,omitempty" optional:"true"`
+	// EnableTLSStreaming serve the containerd cri stream server(exec/attach/portforward) over tls,
+	// the cert and key files must exist on every node.
+	EnableTLSStreaming   bool   `json:"enableTLSStreaming,omitempty" optional:"true"`
+	TLSStreamingCertFile string `json:"tlsStreamingCertFile,omitempty" optional:"true"`
+	TLSStreamingKeyFile  string `json:"tlsStreamingKeyFile,omitempty" optional:"true"`
+	// SystemdCgroup whether containerd uses the systemd cgroup driver, defaults to auto.
+	// Set it explicitly when the auto detection is wrong on the node.
+	SystemdCgroup string `json:"systemdCgroup,omitempty" optional:"true" enum:"auto|true|false"`
+	// PreloadImageDir the directory of image tarballs(*.tar) on every node, which are imported
+	// into containerd after it is installed. Only supported by containerd.
+	PreloadImageDir string `json:"preloadImageDir,omitempty" optional:"true"`
+	// BundleSHA256 the expected sha256 digest of the containerd bundle(configs.tar.gz),
+	// the install fails if the downloaded bundle does not match. Only supported by containerd.
+	BundleSHA256 string `json:"bundleSHA256,omitempty" optional:"true"`
+	// EnableNRI enable the containerd node resource interface(NRI) plugin, disabled by default.
+	// NRISocketPath the socket of NRI, defaults to /var/run/nri/nri.sock. Only supported by containerd.
+	EnableNRI     bool   `json:"enableNRI,omitempty" optional:"true"`
+	NRISocketPath string `json:"nriSocketPath,omitempty" optional:"true"`
+	// DownloadRetries the times of retrying the failed containerd package download, 0 means no retry.
+	// DownloadRetryBackoff the wait before the first retry, doubled after each retry, defaults to 1s.
+	// Only supported by containerd.
+	DownloadRetries      int             `json:"downloadRetries,omitempty" optional:"true"`
+	DownloadRetryBackoff metav1.Duration `json:"downloadRetryBackoff,omitempty" optional:"true"`
+	// Proxy the outbound proxy used by containerd to pull images, the pod and service cidrs
+	// and the node ips are always appended to the no proxy list. Only supported by containerd.
+	Proxy *CRIProxy `json:"proxy,omitempty" optional:"true"`
+	// RuntimeGroups the additional runtime handlers of containerd on groups of nodes, e.g. the nvidia
+	// runtime on the gpu nodes. A node belongs to one group at most. Only supported by containerd.
+	RuntimeGroups []CRIRuntimeGroup `json:"runtimeGroups,omitempty" optional:"true"`
+	// DiscardUnpackedLayers let containerd discard the compressed layers after they are unpacked to save disk,
+	// the images can not be exported or pushed from the node then. Disabled by default, only supported by containerd.
+	DiscardUnpackedLayers bool `json:"discardUnpackedLayers,omitempty" optional:"true"`
+	// LogLevel and LogFormat the log level and format of containerd, empty means the containerd default
+	// info and text. Only supported by containerd.
+	LogLevel  string `json:"logLevel,omitempty" optional:"true" enum:"info|debug|warn"`
+	LogFormat string `json:"logFormat,omitempty" optional:"true" enum:"text|json"`
+	// DefaultMirror the registry host(host[:port]) all the image pulls are routed through, e.g. the local registry
+	// of an air-gapped cluster. It applies to the registries without their own configuration, and the registry
+	// of the host in Registries is used for its scheme, CA and credentials, the host not in Registries is
+	// pulled by verified https. Only supported by containerd.
+	DefaultMirror string `json:"defaultMirror,omitempty" optional:"true"`
+}
+
+type CRIProxy struct {
+	HTTPProxy  string   `json:"httpProxy,omitempty" optional:"true"`
+	HTTPSProxy string   `json:"httpsProxy,omitempty" optional:"true"`
+	NoProxy    []string `json:"noProxy,omitempty" optional:"true"`
+}
+
+// CRIRuntimeGroup the runtime handlers configured on the nodes of the group besides the default runc.
+type CRIRuntimeGroup struct {
+	// Nodes the ids of the nodes in the group
+	Nodes    []string            `json:"nodes"`
+	Runtimes []CRIRuntimeHandler `json:"runtimes,omitempty" optional:"true"`
+	// GPU configure the nvidia runtime handler on the nodes and create the nvidia RuntimeClass,
+	// the nvidia driver and container toolkit must be installed on the nodes.
+	GPU bool `json:"gpu,omitempty" optional:"true"`
+}
+
+// CRIRuntimeHandler a containerd runtime handler, which a RuntimeClass selects by the handler name.
+type CRIRuntimeHandler struct {
+	// Name the handler name, e.g. nvidia
+	Name string `json:"name"`
+	// RuntimeType the containerd shim of the handler, defaults to io.containerd.runc.v2
+	RuntimeType string `json:"runtimeType,omitempty" optional:"true"`
+	// BinaryName the oci runtime binary run by the runc shim, e.g. /usr/bin/nvidia-container-runtime
+	BinaryName string `json:"binaryName,omitempty" optional:"true"`
+}
+
+// ValidateRuntimeGroups check the runtime handler names are valid and unique in a group,
+// and every node belongs to one group at most.
+func (r *ContainerRuntime) ValidateRuntimeGroups() error {
+	if len(r.RuntimeGroups) == 0 {
+		return nil
+	}
+	if r.Type != CRIContainerd {
+		return fmt.Errorf("%s dose not support runtime groups", r.Type)
+	}
+	grouped := sets.NewString()
+	for _, group := range r.RuntimeGroups {
+		if len(group.Nodes) == 0 || (len(group.Runtimes) == 0 && !group.GPU) {
+			return fmt.Errorf("runtime group requires at least one node and one runtime")
+		}
+		for _, id := range group.Nodes {
+			if grouped.Has(id) {
+				return fmt.Errorf("node %s belongs to more than one runtime group", id)
+			}
+			grouped.Insert(id)
+		}
+		names := sets.NewString()
+		if group.GPU {
+			// the nvidia runtime handler of the gpu runtime
+			names.Insert("nvidia")
+		}
+		for _, handler := range group.Runtimes {
+			if errs := validation.IsDNS1123Label(handler.Name); len(errs) > 0 {
+				return fmt.Errorf("invalid runtime handler name %q: %s", handler.Name, strings.Join(errs, "; "))
+			}
+			if handler.Name == "runc" || names.Has(handler.Name) {
+				return fmt.Errorf("runtime handler %s is duplicated", handler.Name)
+			}
+			names.Insert(handler.Name)
+			if handler.BinaryName != "" && !filepath.IsAbs(handler.BinaryName) {
+				return fmt.Errorf("runtime handler %s binary %s must be absolute", handler.Name, handler.BinaryName)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateLog check the log level and format of containerd are supported
+func (r *ContainerRuntime) ValidateLog() error {
+	if r.LogLevel == "" && r.LogFormat == "" {
+		return nil
+	}
+	if r.Type != CRIContainerd {
+		return fmt.Errorf("%s dose not support log configuration", r.Type)
+	}
+	switch r.LogLevel {
+	case "", ContainerdLogLevelInfo, ContainerdLogLevelDebug, ContainerdLogLevelWarn:
+	default:
+		return fmt.Errorf("invalid containerd log level %q, must be one of %s, %s, %s", r.LogLevel,
+			ContainerdLogLevelInfo, ContainerdLogLevelDebug, ContainerdLogLevelWarn)
+	}
+	switch r.LogFormat {
+	case "", ContainerdLogFormatText, ContainerdLogFormatJSON:
+	default:
+		return fmt.Errorf("invalid containerd log format %q, must be one of %s, %s", r.LogFormat,
+			ContainerdLogFormatText, ContainerdLogFormatJSON)
+	}
+	return nil
+}
+
+// ValidateDefaultMirror check the default mirror is a registry host without scheme and path
+func (r *ContainerRuntime) ValidateDefaultMirror() error {
+	if r.DefaultMirror == "" {
+		return nil
+	}
+	if r.Type != CRIContainerd {
+		return fmt.Errorf("%s dose not support default mirror", r.Type)
+	}
+	if strings.Contains(r.DefaultMirror, "://") || strings.Contains(r.DefaultMirror, "/") ||
+		strings.EqualFold(r.DefaultMirror, DefaultMirrorServer) {
+		return fmt.Errorf("invalid default mirror %q, must be a registry host[:port]", r.DefaultMirror)
+	}
+	return nil
 }
 
 type CRIRegistry struct {
 	InsecureRegistry string  `json:"insecureRegistry,omitempty"`
 	RegistryRef      *string `json:"registryRef,omitempty"`
+	// HTTPOnly the insecure registry only serves plain http, so the https host with skip verify is not configured.
+	// By default both the http and the https host are configured for the insecure registry.
+	HTTPOnly bool `json:"httpOnly,omitempty" optional:"true"`
 }
 
 // taint define
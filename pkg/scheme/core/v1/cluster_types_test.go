@@ -0,0 +1,285 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNetworking_ValidateIPFamily(t *testing.T) {
+	tests := []struct {
+		name     string
+		family   IPFamily
+		pods     []string
+		services []string
+		wantErr  bool
+	}{
+		{name: "empty family", pods: []string{"fd00::/108"}},
+		{name: "ipv4", family: IPFamilyIPv4, pods: []string{"172.25.0.0/16"}, services: []string{"10.96.0.0/12"}},
+		{name: "ipv4 with ipv6 pod cidr", family: IPFamilyIPv4, pods: []string{"fd00::/108"}, wantErr: true},
+		{name: "ipv6", family: IPFamilyIPv6, pods: []string{"fd00::/108"}, services: []string{"fd00:10::/108"}},
+		{name: "ipv6 with ipv4 service cidr", family: IPFamilyIPv6, pods: []string{"fd00::/108"}, services: []string{"10.96.0.0/12"}, wantErr: true},
+		{name: "ipv6 with two pod cidrs", family: IPFamilyIPv6, pods: []string{"fd00::/108", "fd01::/108"}, wantErr: true},
+		{name: "dual-stack", family: IPFamilyDualStack, pods: []string{"172.25.0.0/16", "fd00::/108"}, services: []string{"10.96.0.0/12"}},
+		{name: "dual-stack with ipv6 first", family: IPFamilyDualStack, pods: []string{"fd00::/108", "172.25.0.0/16"}, wantErr: true},
+		{name: "invalid cidr", family: IPFamilyIPv4, pods: []string{"172.25.0.0"}, wantErr: true},
+		{name: "unknown family", family: "IPv5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &Networking{
+				IPFamily: tt.family,
+				Pods:     NetworkRanges{CIDRBlocks: tt.pods},
+				Services: NetworkRanges{CIDRBlocks: tt.services},
+			}
+			if err := n.ValidateIPFamily(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIPFamily() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNetworking_ValidateCIDROverlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		pods     []string
+		services []string
+		nodeIPs  []string
+		wantErr  string
+	}{
+		{name: "no overlap", pods: []string{"172.25.0.0/16"}, services: []string{"10.96.0.0/16"}, nodeIPs: []string{"192.168.10.2"}},
+		{name: "pod contains service", pods: []string{"10.0.0.0/8"}, services: []string{"10.96.0.0/16"},
+			wantErr: "pod cidr 10.0.0.0/8 overlaps with service cidr 10.96.0.0/16"},
+		{name: "service contains pod", pods: []string{"10.96.1.0/24"}, services: []string{"10.96.0.0/16"},
+			wantErr: "pod cidr 10.96.1.0/24 overlaps with service cidr 10.96.0.0/16"},
+		{name: "dual-stack no overlap", pods: []string{"172.25.0.0/16", "fd00::/108"}, services: []string{"10.96.0.0/16", "fd00:10::/108"}},
+		{name: "dual-stack ipv6 overlap", pods: []string{"172.25.0.0/16", "fd00::/64"}, services: []string{"10.96.0.0/16", "fd00::/108"},
+			wantErr: "pod cidr fd00::/64 overlaps with service cidr fd00::/108"},
+		{name: "node ip in pod cidr", pods: []string{"192.168.0.0/16"}, services: []string{"10.96.0.0/16"}, nodeIPs: []string{"192.168.10.2"},
+			wantErr: "pod cidr 192.168.0.0/16 overlaps with node ip 192.168.10.2"},
+		{name: "invalid cidr", pods: []string{"192.168.0.0"}, wantErr: "invalid pod cidr 192.168.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &Networking{
+				Pods:     NetworkRanges{CIDRBlocks: tt.pods},
+				Services: NetworkRanges{CIDRBlocks: tt.services},
+			}
+			err := n.ValidateCIDROverlap(tt.nodeIPs...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateCIDROverlap() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateCIDROverlap() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCluster_Complete_cniNamespace(t *testing.T) {
+	tests := []struct {
+		name        string
+		cni         CNI
+		kubeVersion string
+		want        string
+	}{
+		{name: "flannel default", cni: CNI{Type: "flannel"}, kubeVersion: "v1.23.6", want: "kube-flannel"},
+		{name: "calico default", cni: CNI{Type: "calico"}, kubeVersion: "v1.23.6", want: "kube-system"},
+		{name: "calico operator default", cni: CNI{Type: "calico"}, kubeVersion: "v1.27.4", want: "calico-system"},
+		{name: "explicit", cni: CNI{Type: "calico", Namespace: "calico"}, kubeVersion: "v1.23.6", want: "calico"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cluster{CNI: tt.cni, KubernetesVersion: tt.kubeVersion}
+			c.Complete()
+			if c.CNI.Namespace != tt.want {
+				t.Errorf("Complete() cni namespace = %s, want %s", c.CNI.Namespace, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterStatus_SetCertifications(t *testing.T) {
+	earliest := time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC)
+	s := &ClusterStatus{}
+	s.SetCertifications([]Certification{
+		{Name: "ca", ExpirationTime: metav1.Time{Time: earliest.AddDate(9, 0, 0)}},
+		{Name: "apiserver", CAName: "ca", ExpirationTime: metav1.Time{Time: earliest}},
+		{Name: "admin.conf", CAName: "ca", ExpirationTime: metav1.Time{Time: earliest.Add(time.Hour)}},
+	})
+	if s.CertificationExpiration == nil || !s.CertificationExpiration.Time.Equal(earliest) {
+		t.Errorf("SetCertifications() CertificationExpiration = %v, want %v", s.CertificationExpiration, earliest)
+	}
+	s.SetCertifications(nil)
+	if s.CertificationExpiration != nil {
+		t.Errorf("SetCertifications() want the expiration cleared, got %v", s.CertificationExpiration)
+	}
+}
+
+func TestKubelet_ValidateImageGCThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		high    int
+		low     int
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "custom", high: 90, low: 70},
+		{name: "only high", high: 95},
+		{name: "only low lower than default high", low: 60},
+		{name: "only low not lower than default high", low: 85, wantErr: true},
+		{name: "high equals low", high: 70, low: 70, wantErr: true},
+		{name: "high lower than low", high: 60, low: 70, wantErr: true},
+		{name: "high out of range", high: 101, low: 80, wantErr: true},
+		{name: "negative low", high: 90, low: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Kubelet{ImageGCHighThreshold: tt.high, ImageGCLowThreshold: tt.low}
+			if err := k.ValidateImageGCThresholds(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateImageGCThresholds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCluster_ResolveCgroupDriver(t *testing.T) {
+	tests := []struct {
+		name          string
+		cgroupDriver  string
+		cri           string
+		systemdCgroup string
+		want          string
+	}{
+		{name: "default", cri: CRIContainerd, want: CgroupDriverAuto},
+		{name: "explicit driver", cri: CRIContainerd, cgroupDriver: CgroupDriverCgroupfs, want: CgroupDriverCgroupfs},
+		{name: "follow containerd systemd cgroup", cri: CRIContainerd, systemdCgroup: SystemdCgroupTrue, want: CgroupDriverSystemd},
+		{name: "follow containerd cgroupfs", cri: CRIContainerd, systemdCgroup: SystemdCgroupFalse, want: CgroupDriverCgroupfs},
+		{name: "containerd auto", cri: CRIContainerd, cgroupDriver: CgroupDriverAuto, systemdCgroup: SystemdCgroupAuto, want: CgroupDriverAuto},
+		{name: "docker", cri: CRIDocker, want: CgroupDriverSystemd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cluster{CgroupDriver: tt.cgroupDriver, ContainerRuntime: ContainerRuntime{Type: tt.cri, SystemdCgroup: tt.systemdCgroup}}
+			if got := c.ResolveCgroupDriver(); got != tt.want {
+				t.Errorf("ResolveCgroupDriver() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCluster_ValidateCgroupDriver(t *testing.T) {
+	tests := []struct {
+		name          string
+		cgroupDriver  string
+		cri           string
+		systemdCgroup string
+		wantErr       bool
+	}{
+		{name: "default", cri: CRIContainerd},
+		{name: "systemd", cri: CRIContainerd, cgroupDriver: CgroupDriverSystemd, systemdCgroup: SystemdCgroupTrue},
+		{name: "cgroupfs with containerd auto", cri: CRIContainerd, cgroupDriver: CgroupDriverCgroupfs, systemdCgroup: SystemdCgroupAuto},
+		{name: "unsupported", cri: CRIContainerd, cgroupDriver: "cgroup", wantErr: true},
+		{name: "systemd with containerd cgroupfs", cri: CRIContainerd, cgroupDriver: CgroupDriverSystemd, systemdCgroup: SystemdCgroupFalse, wantErr: true},
+		{name: "cgroupfs with containerd systemd", cri: CRIContainerd, cgroupDriver: CgroupDriverCgroupfs, systemdCgroup: SystemdCgroupTrue, wantErr: true},
+		{name: "docker cgroupfs", cri: CRIDocker, cgroupDriver: CgroupDriverCgroupfs, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cluster{CgroupDriver: tt.cgroupDriver, ContainerRuntime: ContainerRuntime{Type: tt.cri, SystemdCgroup: tt.systemdCgroup}}
+			if err := c.ValidateCgroupDriver(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCgroupDriver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerRuntime_ValidateRuntimeGroups(t *testing.T) {
+	nvidia := CRIRuntimeHandler{Name: "nvidia", BinaryName: "/usr/bin/nvidia-container-runtime"}
+	tests := []struct {
+		name    string
+		cri     string
+		groups  []CRIRuntimeGroup
+		wantErr bool
+	}{
+		{name: "empty", cri: CRIDocker},
+		{name: "valid", cri: CRIContainerd, groups: []CRIRuntimeGroup{
+			{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{nvidia}},
+			{Nodes: []string{"n1"}, Runtimes: []CRIRuntimeHandler{{Name: "kata", RuntimeType: "io.containerd.kata.v2"}}},
+		}},
+		{name: "docker", cri: CRIDocker, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{nvidia}}}, wantErr: true},
+		{name: "no nodes", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Runtimes: []CRIRuntimeHandler{nvidia}}}, wantErr: true},
+		{name: "node in two groups", cri: CRIContainerd, groups: []CRIRuntimeGroup{
+			{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{nvidia}},
+			{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{{Name: "kata"}}},
+		}, wantErr: true},
+		{name: "invalid name", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{{Name: "Nvidia"}}}}, wantErr: true},
+		{name: "runc", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{{Name: "runc"}}}}, wantErr: true},
+		{name: "duplicated", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{nvidia, nvidia}}}, wantErr: true},
+		{name: "gpu only", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, GPU: true}}},
+		{name: "gpu with nvidia", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, GPU: true, Runtimes: []CRIRuntimeHandler{nvidia}}}, wantErr: true},
+		{name: "relative binary", cri: CRIContainerd, groups: []CRIRuntimeGroup{{Nodes: []string{"gpu1"}, Runtimes: []CRIRuntimeHandler{{Name: "nvidia", BinaryName: "nvidia-container-runtime"}}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ContainerRuntime{Type: tt.cri, RuntimeGroups: tt.groups}
+			if err := r.ValidateRuntimeGroups(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRuntimeGroups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerRuntime_ValidateLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		cri     string
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{name: "empty", cri: CRIDocker},
+		{name: "debug json", cri: CRIContainerd, level: ContainerdLogLevelDebug, format: ContainerdLogFormatJSON},
+		{name: "warn only", cri: CRIContainerd, level: ContainerdLogLevelWarn},
+		{name: "docker", cri: CRIDocker, level: ContainerdLogLevelDebug, wantErr: true},
+		{name: "invalid level", cri: CRIContainerd, level: "trace", wantErr: true},
+		{name: "invalid format", cri: CRIContainerd, format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ContainerRuntime{Type: tt.cri, LogLevel: tt.level, LogFormat: tt.format}
+			if err := r.ValidateLog(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerRuntime_ValidateDefaultMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		cri     string
+		mirror  string
+		wantErr bool
+	}{
+		{name: "empty", cri: CRIDocker},
+		{name: "host", cri: CRIContainerd, mirror: "10.0.0.1:5000"},
+		{name: "docker", cri: CRIDocker, mirror: "10.0.0.1:5000", wantErr: true},
+		{name: "scheme", cri: CRIContainerd, mirror: "https://10.0.0.1:5000", wantErr: true},
+		{name: "path", cri: CRIContainerd, mirror: "10.0.0.1:5000/library", wantErr: true},
+		{name: "default server", cri: CRIContainerd, mirror: DefaultMirrorServer, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ContainerRuntime{Type: tt.cri, DefaultMirror: tt.mirror}
+			if err := r.ValidateDefaultMirror(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDefaultMirror() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,21 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"go.uber.org/zap"
+
 	"github.com/kubeclipper/kubeclipper/pkg/component"
 	"github.com/kubeclipper/kubeclipper/pkg/component/common"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
-	"github.com/kubeclipper/kubeclipper/pkg/simple/downloader"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
 	tmplutil "github.com/kubeclipper/kubeclipper/pkg/utils/template"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 const (
+	// calicoOperatorNamespace the namespace of calico deployed by the tigera operator, it is not configurable
+	calicoOperatorNamespace = "calico-system"
 	// CalicoNetworkIPIPAll IPIP-All mode
 	CalicoNetworkIPIPAll = "Overlay-IPIP-All"
 	// CalicoNetworkIPIPSubnet IPIP-Cross-Subnet mode
@@ -32,16 +40,30 @@ const (
 	CalicoNetworkBGP = "BGP"
 )
 
+const (
+	// typhaAutoEnableNodes typha is enabled automatically when the cluster nodes exceed it
+	typhaAutoEnableNodes = 50
+	// typhaNodesPerReplica calico recommends at least one typha replica for every 200 nodes
+	typhaNodesPerReplica = 200
+	typhaMinReplicas     = 3
+	typhaMaxReplicas     = 20
+)
+
+// calicoDefaultController the calico kube-controller enabled by default in kubernetes datastore
+const calicoDefaultController = "node"
+
+// calicoControllers the controllers supported by calico-kube-controllers
+var calicoControllers = sets.NewString("node", "policy", "namespace", "serviceaccount", "workloadendpoint")
+
+// calicoConfigPrefixes the cni config files written by calico-node install-cni
+var calicoConfigPrefixes = []string{"10-calico", "calico-kubeconfig"}
+
 func init() {
 	Register(&CalicoRunnable{})
-	if err := component.RegisterTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat,
-		cniInfo+"-calico", version, component.TypeTemplate), &CalicoRunnable{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
-		cniInfo+"-calico", version, component.TypeStep), &CalicoRunnable{}); err != nil {
-		panic(err)
-	}
+	component.AddTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat,
+		cniInfo+"-calico", version, component.TypeTemplate), &CalicoRunnable{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-calico", version, component.TypeStep), &CalicoRunnable{})
 }
 
 type NodeAddressDetection struct {
@@ -53,6 +75,9 @@ type CalicoRunnable struct {
 	BaseCni
 	NodeAddressDetectionV4 NodeAddressDetection
 	NodeAddressDetectionV6 NodeAddressDetection
+	ASNumber               uint32       `json:"asNumber,omitempty"`
+	BGPPeers               []v1.BGPPeer `json:"bgpPeers,omitempty"`
+	TyphaReplicas          int          `json:"typhaReplicas,omitempty"`
 }
 
 func (runnable *CalicoRunnable) Type() string {
@@ -69,35 +94,85 @@ func (runnable *CalicoRunnable) NewInstance() component.ObjectMeta {
 
 func (runnable *CalicoRunnable) InitStep(metadata *component.ExtraMetadata, cni *v1.CNI, networking *v1.Networking) Stepper {
 	stepper := &CalicoRunnable{}
-	ipv6 := ""
-	if networking.IPFamily == v1.IPFamilyDualStack {
-		ipv6 = networking.Pods.CIDRBlocks[1]
-	}
 	stepper.CNI = *cni
 	stepper.LocalRegistry = cni.LocalRegistry
 	stepper.BaseCni.Type = "calico"
 	stepper.Version = cni.Version
 	stepper.CriType = metadata.CRI
+	stepper.ClusterName = metadata.ClusterName
 	stepper.Offline = cni.Offline
-	stepper.Namespace = cni.Namespace
-	stepper.DualStack = networking.IPFamily == v1.IPFamilyDualStack
-	stepper.PodIPv4CIDR = networking.Pods.CIDRBlocks[0]
-	stepper.PodIPv6CIDR = ipv6
-	stepper.NodeAddressDetectionV4 = ParseNodeAddressDetection(cni.Calico.IPv4AutoDetection)
-	stepper.NodeAddressDetectionV6 = ParseNodeAddressDetection(cni.Calico.IPv6AutoDetection)
+	stepper.Namespace = strutil.StringDefaultIfEmpty(calicoDefaultNamespace(metadata.KubeVersion), cni.Namespace)
+	stepper.setPodCIDRs(networking)
+	stepper.KubeletDataDir = strutil.StringDefaultIfEmpty(kubeletDefaultDataDir, metadata.KubeletDataDir)
+	stepper.NodeAddressDetectionV4 = parseNodeAddressDetectionOrDefault(cni.Calico.IPv4AutoDetection)
+	stepper.NodeAddressDetectionV6 = parseNodeAddressDetectionOrDefault(cni.Calico.IPv6AutoDetection)
+	if cni.Calico.Mode == CalicoNetworkBGP {
+		stepper.ASNumber = cni.Calico.ASNumber
+		stepper.BGPPeers = cni.Calico.BGPPeers
+	}
+	stepper.TyphaReplicas = typhaReplicas(cni.Calico.TyphaReplicas, len(metadata.GetAllNodes()))
+	stepper.registries = metadata.Registries
 
 	return stepper
 }
 
+// parseNodeAddressDetectionOrDefault the detection methods are validated with the cluster,
+// fallback to the calico default method if it is still invalid.
+func parseNodeAddressDetectionOrDefault(nodeAddressDetection string) NodeAddressDetection {
+	detection, err := ParseNodeAddressDetection(nodeAddressDetection)
+	if err != nil {
+		return NodeAddressDetection{Type: defaultNodeAddressDetectionMethod}
+	}
+	return detection
+}
+
+// typhaReplicas returns the replicas of calico-typha, the specified replicas take precedence,
+// otherwise typha is only enabled for large clusters with the recommended replicas.
+func typhaReplicas(replicas, nodes int) int {
+	if replicas > 0 {
+		return replicas
+	}
+	if nodes <= typhaAutoEnableNodes {
+		return 0
+	}
+	replicas = (nodes + typhaNodesPerReplica - 1) / typhaNodesPerReplica
+	if replicas < typhaMinReplicas {
+		return typhaMinReplicas
+	}
+	if replicas > typhaMaxReplicas {
+		return typhaMaxReplicas
+	}
+	return replicas
+}
+
 func (runnable *CalicoRunnable) LoadImage(nodes []v1.StepNode) ([]v1.Step, error) {
 	var steps []v1.Step
+	if runnable.useImageRegistrySource() {
+		images, err := renderImages(runnable.renderCalicoTo)
+		if err != nil {
+			return nil, err
+		}
+		runnable.Images = images
+	}
 	bytes, err := json.Marshal(runnable)
 	if err != nil {
 		return nil, err
 	}
 
 	if runnable.Offline && runnable.LocalRegistry == "" {
-		return []v1.Step{LoadImage("calico", bytes, nodes)}, nil
+		return []v1.Step{LoadImage("calico", bytes, nodes, runnable.ImageLoadConcurrency)}, nil
+	}
+	// the images of the tigera operator chart are not listed in the manifest
+	if runnable.Offline && len(nodes) > 0 && !runnable.operatorManaged() {
+		images, err := renderImages(runnable.renderCalicoTo)
+		if err != nil {
+			return nil, err
+		}
+		step, err := VerifyRegistryImages(images, runnable.registries, nodes[:1])
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
 	}
 
 	return steps, nil
@@ -122,15 +197,30 @@ func (runnable *CalicoRunnable) InstallSteps(nodes []v1.StepNode, kubernetesVers
 		}
 		steps = append(steps, cLoadSteps...)
 		steps = append(steps, RenderYaml("calico", bytes, nodes))
-		steps = append(steps, InstallCalicoRelease(filepath.Join(downloader.BaseDstDir, "."+chart.PkgName, chart.Version, downloader.ChartFilename), filepath.Join(manifestDir, "calico.yaml"), nodes))
+		steps = append(steps, InstallCalicoRelease(chart.ChartPath(), filepath.Join(manifestDir, "calico.yaml"), nodes))
 	} else {
 		steps = append(steps, RenderYaml("calico", bytes, nodes))
 		steps = append(steps, ApplyYaml(filepath.Join(manifestDir, "calico.yaml"), nodes))
 	}
+	// the bgp resources depend on the calico crds, so apply them after calico installed
+	if runnable.hasBGPConfig() {
+		steps = append(steps, ApplyYaml(filepath.Join(manifestDir, "calico-bgp.yaml"), nodes))
+	}
+	if runnable.encryptTraffic() {
+		steps = append(steps, ApplyYaml(filepath.Join(manifestDir, "calico-felix.yaml"), nodes))
+	}
 
 	return steps, nil
 }
 
+func (runnable *CalicoRunnable) HealthCheckSteps(nodes []v1.StepNode) ([]v1.Step, error) {
+	step, err := WaitDaemonSetReady(runnable.Namespace, "calico-node", "k8s-app=calico-node", nodes)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{step}, nil
+}
+
 func (runnable *CalicoRunnable) UninstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 	bytes, err := json.Marshal(runnable)
 	if err != nil {
@@ -144,10 +234,34 @@ func (runnable *CalicoRunnable) UninstallSteps(nodes []v1.StepNode) ([]v1.Step,
 	if runnable.Calico != nil {
 		steps = append(steps, runnable.clear(runnable.Calico, nodes)...)
 	}
+	nmStep, err := ConfigNetworkManager(nodes, v1.ActionUninstall)
+	if err != nil {
+		return nil, err
+	}
+	steps = append(steps, nmStep)
+	cleanStep, err := CleanConfig(calicoConfigPrefixes, nodes)
+	if err != nil {
+		return nil, err
+	}
+	steps = append(steps, cleanStep)
 
 	return steps, nil
 }
 
+func (runnable *CalicoRunnable) DeleteSteps(nodes []v1.StepNode, kubernetesVersion string) ([]v1.Step, error) {
+	if IsHighKubeVersion(kubernetesVersion) {
+		return []v1.Step{UninstallCalicoRelease(nodes)}, nil
+	}
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{
+		RenderYaml("calico", bytes, nodes),
+		DeleteYaml(filepath.Join(manifestDir, "calico.yaml"), nodes),
+	}, nil
+}
+
 func (runnable *CalicoRunnable) clear(calico *v1.Calico, nodes []v1.StepNode) []v1.Step {
 	if calico == nil {
 		return nil
@@ -211,6 +325,8 @@ func (runnable *CalicoRunnable) clear(calico *v1.Calico, nodes []v1.StepNode) []
 
 // CmdList cni kubectl cmd list
 func (runnable *CalicoRunnable) CmdList(namespace string) map[string]string {
+	// the namespace of the initialized stepper takes precedence over the one in the cluster metadata
+	namespace = strutil.StringDefaultIfEmpty(namespace, runnable.Namespace)
 	cmdList := make(map[string]string)
 	cmdList["get"] = fmt.Sprintf("kubectl get po -n %s | grep calico", namespace)
 	cmdList["restart"] = fmt.Sprintf("kubectl rollout restart ds calico-node -n %s", namespace)
@@ -218,30 +334,208 @@ func (runnable *CalicoRunnable) CmdList(namespace string) map[string]string {
 	return cmdList
 }
 
+// calicoDefaultNamespace the calico namespace when it is not specified, the tigera operator
+// used since kubernetes v1.26 always deploys calico into calico-system.
+func calicoDefaultNamespace(kubeVersion string) string {
+	if IsHighKubeVersion(kubeVersion) {
+		return calicoOperatorNamespace
+	}
+	return "kube-system"
+}
+
 func (runnable *CalicoRunnable) Render(ctx context.Context, opts component.Options) error {
 	if err := os.MkdirAll(manifestDir, 0755); err != nil {
 		return err
 	}
+	ctx = runnable.withLogger(ctx)
 	manifestFile := filepath.Join(manifestDir, "calico.yaml")
-	return fileutil.WriteFileWithContext(ctx, manifestFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
-		runnable.renderCalicoTo, opts.DryRun)
+	if err := fileutil.WriteFileWithContext(ctx, manifestFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
+		runnable.renderCalicoTo, opts.DryRun); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Debug("render calico manifest successfully", zap.String("file", manifestFile))
+	if runnable.hasBGPConfig() {
+		bgpFile := filepath.Join(manifestDir, "calico-bgp.yaml")
+		if err := fileutil.WriteFileWithContext(ctx, bgpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
+			runnable.renderCalicoBGPTo, opts.DryRun); err != nil {
+			return err
+		}
+	}
+	if !runnable.encryptTraffic() {
+		return nil
+	}
+	felixFile := filepath.Join(manifestDir, "calico-felix.yaml")
+	return fileutil.WriteFileWithContext(ctx, felixFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
+		runnable.renderCalicoFelixTo, opts.DryRun)
+}
+
+func (runnable *CalicoRunnable) hasBGPConfig() bool {
+	return runnable.ASNumber != 0 || len(runnable.BGPPeers) > 0
+}
+
+func (runnable *CalicoRunnable) encryptTraffic() bool {
+	return runnable.Calico != nil && runnable.Calico.EncryptTraffic
+}
+
+func (runnable *CalicoRunnable) renderCalicoFelixTo(w io.Writer) error {
+	return renderManifestTo(w, calicoFelixTemplate, runnable)
+}
+
+func (runnable *CalicoRunnable) renderCalicoBGPTo(w io.Writer) error {
+	return renderManifestTo(w, calicoBGPTemplate, runnable)
 }
 
 func (runnable *CalicoRunnable) renderCalicoTo(w io.Writer) error {
-	at := tmplutil.New()
 	calicoTemp, err := runnable.CalicoTemplate()
 	if err != nil {
 		return err
 	}
-	if _, err := at.RenderTo(w, calicoTemp, runnable); err != nil {
-		return err
+	// the chart values are not kubernetes manifest
+	if runnable.operatorManaged() {
+		at := tmplutil.New()
+		if _, err := at.RenderTo(w, calicoTemp, runnable); err != nil {
+			return err
+		}
+		return nil
+	}
+	if runnable.TyphaEnabled() {
+		calicoTemp += calicoTyphaTemplate
+	}
+	if runnable.Namespace != "" && runnable.Namespace != "kube-system" {
+		calicoTemp = calicoNamespaceTemplate + calicoTemp
+	}
+	return renderManifestTo(w, calicoTemp, runnable)
+}
+
+// operatorManaged whether calico is installed by the tigera operator chart, i.e. calico v3.26.1
+func (runnable *CalicoRunnable) operatorManaged() bool {
+	return runnable.Version == "v3.26.1"
+}
+
+// TyphaEnabled whether to deploy calico-typha with the manifest,
+// the tigera operator deploys and scales typha itself.
+func (runnable *CalicoRunnable) TyphaEnabled() bool {
+	return runnable.TyphaReplicas > 0 && !runnable.operatorManaged()
+}
+
+// IPv4PoolIPIPMode the CALICO_IPV4POOL_IPIP env of calico-node,
+// legacy calico versions config the default ippool encapsulation by env.
+func (runnable *CalicoRunnable) IPv4PoolIPIPMode() string {
+	switch runnable.Calico.Mode {
+	case CalicoNetworkIPIPSubnet:
+		return "CrossSubnet"
+	case CalicoNetworkBGP, CalicoNetworkVXLANAll, CalicoNetworkVXLANSubnet:
+		return "Never"
+	}
+	// IPIP-All and the default overlay mode
+	return "Always"
+}
+
+// IPv4PoolVXLANMode the CALICO_IPV4POOL_VXLAN env of calico-node.
+func (runnable *CalicoRunnable) IPv4PoolVXLANMode() string {
+	switch runnable.Calico.Mode {
+	case CalicoNetworkVXLANAll:
+		return "Always"
+	case CalicoNetworkVXLANSubnet:
+		return "CrossSubnet"
+	}
+	return "Never"
+}
+
+// BirdReadyCheck whether the calico-node readiness probe checks bird,
+// bird has no BGP peers to be ready with in vxlan mode.
+func (runnable *CalicoRunnable) BirdReadyCheck() bool {
+	if runnable.Calico.DisableBirdReadyCheck {
+		return false
+	}
+	switch runnable.Calico.Mode {
+	case CalicoNetworkVXLANAll, CalicoNetworkVXLANSubnet:
+		return false
+	}
+	return true
+}
+
+// EnabledControllers the ENABLED_CONTROLLERS env of calico-kube-controllers
+func (runnable *CalicoRunnable) EnabledControllers() string {
+	if runnable.Calico == nil || len(runnable.Calico.EnabledControllers) == 0 {
+		return calicoDefaultController
+	}
+	return strings.Join(runnable.Calico.EnabledControllers, ",")
+}
+
+// ValidateEnabledControllers check the calico kube-controllers are known and not duplicated
+func ValidateEnabledControllers(controllers []string) error {
+	seen := sets.NewString()
+	for _, c := range controllers {
+		if !calicoControllers.Has(c) {
+			return fmt.Errorf("unknown calico kube-controller: %s, valid controllers are %v", c, calicoControllers.List())
+		}
+		if seen.Has(c) {
+			return fmt.Errorf("duplicate calico kube-controller: %s", c)
+		}
+		seen.Insert(c)
 	}
 	return nil
 }
 
+const (
+	// defaultIPv4BlockSize the calico default block size of ipv4 pool
+	defaultIPv4BlockSize = 26
+	minIPv4BlockSize     = 20
+	maxIPv4BlockSize     = 32
+)
+
+// IPv4BlockSize the block size of the ipv4 pool, the calico default 26 is used when it is not set.
+func (runnable *CalicoRunnable) IPv4BlockSize() int {
+	if runnable.Calico == nil || runnable.Calico.BlockSize == 0 {
+		return defaultIPv4BlockSize
+	}
+	return runnable.Calico.BlockSize
+}
+
+// ValidateBlockSize check the ipv4 block size is in range 20-32 and fits in the pod cidr
+func ValidateBlockSize(blockSize int, podIPv4CIDR string) error {
+	if blockSize == 0 {
+		return nil
+	}
+	if blockSize < minIPv4BlockSize || blockSize > maxIPv4BlockSize {
+		return fmt.Errorf("invalid calico block size %d, it must be in range %d-%d", blockSize, minIPv4BlockSize, maxIPv4BlockSize)
+	}
+	if podIPv4CIDR == "" {
+		return nil
+	}
+	_, ipNet, err := net.ParseCIDR(podIPv4CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid pod cidr %s:%w", podIPv4CIDR, err)
+	}
+	if ones, _ := ipNet.Mask.Size(); blockSize < ones {
+		return fmt.Errorf("calico block size %d is larger than the pod cidr %s", blockSize, podIPv4CIDR)
+	}
+	return nil
+}
+
+// VethMTU the veth_mtu of calico config, "0" means calico auto-detects the MTU.
+func (runnable *CalicoRunnable) VethMTU() string {
+	if runnable.Calico.AutoMTU {
+		return "0"
+	}
+	return strconv.Itoa(runnable.Calico.MTU)
+}
+
 func (runnable *CalicoRunnable) CalicoTemplate() (string, error) {
+	switch runnable.Version {
+	case "v3.11.2", "v3.16.10":
+		// mtu auto-detection is supported since calico v3.17
+		if runnable.Calico != nil && runnable.Calico.AutoMTU {
+			return "", fmt.Errorf("calico %s dose not support auto mtu", runnable.Version)
+		}
+	}
 	switch runnable.Version {
 	case "v3.11.2":
+		// vxlan cross-subnet mode is supported since calico v3.14
+		if runnable.Calico != nil && runnable.Calico.Mode == CalicoNetworkVXLANSubnet {
+			return "", fmt.Errorf("calico %s dose not support mode: %s", runnable.Version, runnable.Calico.Mode)
+		}
 		return calicoV3112, nil
 	case "v3.16.10":
 		return calicoV31610, nil
@@ -252,7 +546,51 @@ func (runnable *CalicoRunnable) CalicoTemplate() (string, error) {
 	case "v3.24.5":
 		return calicoV3245, nil
 	case "v3.26.1":
+		// the felix env of operator managed calico-node can not be customized
+		if runnable.Calico != nil && runnable.Calico.IgnoreLooseRPF {
+			return "", fmt.Errorf("calico %s dose not support ignore loose rpf", runnable.Version)
+		}
+		if runnable.Calico != nil && len(runnable.Calico.EnabledControllers) > 0 {
+			return "", fmt.Errorf("calico %s dose not support enabled controllers", runnable.Version)
+		}
 		return calicoV3261, nil
 	}
 	return "", fmt.Errorf("calico dose not support version: %s", runnable.Version)
 }
+
+// ValidateBGPPeers check the calico bgp peers have valid peer ip and as number
+func ValidateBGPPeers(peers []v1.BGPPeer) error {
+	seen := make(map[string]struct{}, len(peers))
+	for _, peer := range peers {
+		ip := net.ParseIP(peer.PeerIP)
+		if ip == nil {
+			return fmt.Errorf("invalid calico bgp peer ip: %s", peer.PeerIP)
+		}
+		if peer.ASNumber == 0 {
+			return fmt.Errorf("invalid as number of calico bgp peer %s, it must be in range 1-4294967295", peer.PeerIP)
+		}
+		if _, ok := seen[ip.String()]; ok {
+			return fmt.Errorf("duplicate calico bgp peer ip: %s", peer.PeerIP)
+		}
+		seen[ip.String()] = struct{}{}
+	}
+	return nil
+}
+
+// ValidateIPAM check the calico ipam is supported and compatible with the network mode, bird advertises
+// the routes per calico ipam block, so the BGP and IPIP modes require calico-ipam.
+func ValidateIPAM(calico *v1.Calico) error {
+	switch calico.IPAM {
+	case "", v1.CalicoIPAMCalico, v1.CalicoIPAMHostLocal:
+	default:
+		return fmt.Errorf("unsupported calico ipam: %s, it must be %s or %s", calico.IPAM, v1.CalicoIPAMCalico, v1.CalicoIPAMHostLocal)
+	}
+	if calico.IPAMType() != v1.CalicoIPAMHostLocal {
+		return nil
+	}
+	switch calico.Mode {
+	case CalicoNetworkBGP, CalicoNetworkIPIPAll, CalicoNetworkIPIPSubnet:
+		return fmt.Errorf("calico mode %s requires the %s ipam", calico.Mode, v1.CalicoIPAMCalico)
+	}
+	return nil
+}
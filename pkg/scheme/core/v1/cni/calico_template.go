@@ -5,12 +5,12 @@ kind: ConfigMap
 apiVersion: v1
 metadata:
  name: calico-config
- namespace: kube-system
+ namespace: {{.Namespace}}
 data:
- typha_service_name: "none"
+ typha_service_name: "{{if .TyphaEnabled}}calico-typha{{else}}none{{end}}"
  calico_backend: "bird"
 
- veth_mtu: "{{.CNI.Calico.MTU}}"
+ veth_mtu: "{{.VethMTU}}"
 
  cni_network_config: |-
    {
@@ -23,11 +23,24 @@ data:
          "datastore_type": "kubernetes",
          "nodename": "__KUBERNETES_NODE_NAME__",
          "mtu": __CNI_MTU__,
-         {{if .CNI.Calico.IPManger}}"ipam": {
-           {{if .DualStack }}
+         {{with .CNI.Calico.IPAMType}}"ipam": {
+           {{if eq . "host-local"}}
+             "type": "host-local",
+             {{if $.DualStack}}
+             "ranges": [[{"subnet": "usePodCidr"}], [{"subnet": "usePodCidrIPv6"}]]
+             {{else if $.IPv6Only}}
+             "ranges": [[{"subnet": "usePodCidrIPv6"}]]
+             {{else}}
+             "subnet": "usePodCidr"
+             {{end}}
+           {{else if $.DualStack}}
              "type": "calico-ipam",
              "assign_ipv4": "true",
              "assign_ipv6": "true"
+           {{else if $.IPv6Only}}
+             "type": "calico-ipam",
+             "assign_ipv4": "false",
+             "assign_ipv6": "true"
            {{else}}
              "type": "calico-ipam"
            {{end}}
@@ -248,7 +261,7 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
  name: calico-kube-controllers
- namespace: kube-system
+ namespace: {{.Namespace}}
 
 ---
 kind: ClusterRole
@@ -304,7 +317,7 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 kind: ClusterRole
@@ -433,14 +446,14 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 kind: DaemonSet
 apiVersion: apps/v1
 metadata:
  name: calico-node
- namespace: kube-system
+ namespace: {{.Namespace}}
  labels:
    k8s-app: calico-node
 spec:
@@ -548,10 +561,10 @@ spec:
            - name: CLUSTER_TYPE
              value: "k8s,bgp"
            - name: IP
-             value: "autodetect"
+             value: "{{if .IPv6Only}}none{{else}}autodetect{{end}}"
            - name: IP_AUTODETECTION_METHOD
              value: "{{.CNI.Calico.IPv4AutoDetection}}"
-           {{if .DualStack}}
+           {{if .IPv6Enabled}}
            - name: IP6
              value: "autodetect"
            - name: CALICO_IPV6POOL_CIDR
@@ -559,42 +572,52 @@ spec:
            - name: IP6_AUTODETECTION_METHOD
              value: "{{.CNI.Calico.IPv6AutoDetection}}"
            {{end}}
-           {{if eq .CNI.Calico.Mode "BGP"}}
-           - name: CALICO_IPV4POOL_IPIP
-             value: "Never"
-           {{else if eq .CNI.Calico.Mode "Overlay-IPIP-All"}}
-           - name: CALICO_IPV4POOL_IPIP
-             value: "Always"
-           {{else if eq .CNI.Calico.Mode "Overlay-IPIP-Cross-Subnet"}}
-           - name: CALICO_IPV4POOL_IPIP
-             value: "CrossSubnet"
-           {{else if eq .CNI.Calico.Mode "Overlay-Vxlan-All"}}
-           - name: CALICO_IPV4POOL_IPIP
-             value: "Never"
-           - name: CALICO_IPV4POOL_VXLAN
-             value: "Always"
-           {{else if eq .CNI.Calico.Mode "Overlay-Vxlan-Cross-Subnet"}}
+           {{if .IPv6Only}}
+           - name: CALICO_ROUTER_ID
+             value: "hash"
+           {{end}}
+           {{if .IPv4Enabled}}
+           - name: CALICO_IPV4POOL_BLOCK_SIZE
+             value: "{{.IPv4BlockSize}}"
            - name: CALICO_IPV4POOL_IPIP
-             value: "Never"
+             value: "{{.IPv4PoolIPIPMode}}"
            - name: CALICO_IPV4POOL_VXLAN
-             value: "CrossSubnet"
-           {{else}}
-           - name: CALICO_IPV4POOL_IPIP
-             value: "Always"
+             value: "{{.IPv4PoolVXLANMode}}"
            {{end}}
            - name: FELIX_IPINIPMTU
              valueFrom:
                configMapKeyRef:
                  name: calico-config
                  key: veth_mtu
+           {{if .IPv4Enabled}}
            - name: CALICO_IPV4POOL_CIDR
              value: "{{.PodIPv4CIDR}}"
+           {{end}}
            - name: CALICO_DISABLE_FILE_LOGGING
              value: "true"
+           {{- if eq .CNI.Calico.IPAMType "host-local"}}
+           # Use the pod cidr of the node assigned by host-local ipam
+           - name: USE_POD_CIDR
+             value: "true"
+           {{- end}}
            - name: FELIX_DEFAULTENDPOINTTOHOSTACTION
              value: "ACCEPT"
+           {{- if .CNI.Calico.IgnoreLooseRPF}}
+           - name: FELIX_IGNORELOOSERPF
+             value: "true"
+           {{- end}}
+           {{- if .TyphaEnabled}}
+           # Typha support: controlled by the ConfigMap.
+           - name: FELIX_TYPHAK8SSERVICENAME
+             valueFrom:
+               configMapKeyRef:
+                 name: calico-config
+                 key: typha_service_name
+           - name: FELIX_TYPHAK8SNAMESPACE
+             value: "{{.Namespace}}"
+           {{- end}}
            - name: FELIX_IPV6SUPPORT
-             value: "{{.DualStack}}"
+             value: "{{.IPv6Enabled}}"
            - name: FELIX_LOGSEVERITYSCREEN
              value: "info"
            - name: FELIX_HEALTHENABLED
@@ -618,7 +641,9 @@ spec:
              command:
              - /bin/calico-node
              - -felix-ready
+{{- if .BirdReadyCheck}}
              - -bird-ready
+{{- end}}
            periodSeconds: 10
          volumeMounts:
            - mountPath: /lib/modules
@@ -672,14 +697,14 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
  name: calico-node
- namespace: kube-system
+ namespace: {{.Namespace}}
 
 ---
 apiVersion: apps/v1
 kind: Deployment
 metadata:
  name: calico-kube-controllers
- namespace: kube-system
+ namespace: {{.Namespace}}
  labels:
    k8s-app: calico-kube-controllers
 spec:
@@ -692,7 +717,7 @@ spec:
  template:
    metadata:
      name: calico-kube-controllers
-     namespace: kube-system
+     namespace: {{.Namespace}}
      labels:
        k8s-app: calico-kube-controllers
      annotations:
@@ -712,7 +737,7 @@ spec:
          image: {{with .CNI.LocalRegistry}}{{.}}/{{end}}calico/kube-controllers:{{.CNI.Version}}
          env:
            - name: ENABLED_CONTROLLERS
-             value: node
+             value: {{.EnabledControllers}}
            - name: DATASTORE_TYPE
              value: kubernetes
          readinessProbe:
@@ -730,11 +755,11 @@ kind: ConfigMap
 apiVersion: v1
 metadata:
   name: calico-config
-  namespace: kube-system
+  namespace: {{.Namespace}}
 data:
-  typha_service_name: "none"
+  typha_service_name: "{{if .TyphaEnabled}}calico-typha{{else}}none{{end}}"
   calico_backend: "bird"
-  veth_mtu: "{{.CNI.Calico.MTU}}"
+  veth_mtu: "{{.VethMTU}}"
   cni_network_config: |-
     {
       "name": "k8s-pod-network",
@@ -747,11 +772,24 @@ data:
           "datastore_type": "kubernetes",
           "nodename": "__KUBERNETES_NODE_NAME__",
           "mtu": __CNI_MTU__,
-         {{if .CNI.Calico.IPManger}}"ipam": {
-           {{if .DualStack }}
+         {{with .CNI.Calico.IPAMType}}"ipam": {
+           {{if eq . "host-local"}}
+             "type": "host-local",
+             {{if $.DualStack}}
+             "ranges": [[{"subnet": "usePodCidr"}], [{"subnet": "usePodCidrIPv6"}]]
+             {{else if $.IPv6Only}}
+             "ranges": [[{"subnet": "usePodCidrIPv6"}]]
+             {{else}}
+             "subnet": "usePodCidr"
+             {{end}}
+           {{else if $.DualStack}}
              "type": "calico-ipam",
              "assign_ipv4": "true",
              "assign_ipv6": "true"
+           {{else if $.IPv6Only}}
+             "type": "calico-ipam",
+             "assign_ipv4": "false",
+             "assign_ipv6": "true"
            {{else}}
              "type": "calico-ipam"
            {{end}}
@@ -4543,7 +4581,7 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
 ---
 kind: ClusterRole
 apiVersion: rbac.authorization.k8s.io/v1
@@ -4689,14 +4727,14 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 kind: DaemonSet
 apiVersion: apps/v1
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-node
 spec:
@@ -4814,17 +4852,24 @@ spec:
             - name: CLUSTER_TYPE
               value: "k8s,bgp"
             - name: IP
-              value: "autodetect"
+              value: "{{if .IPv6Only}}none{{else}}autodetect{{end}}"
             - name: IP_AUTODETECTION_METHOD
               value: "{{.CNI.Calico.IPv4AutoDetection}}"
-            {{if .DualStack}}
+            {{if .IPv6Enabled}}
             - name: IP6
               value: "autodetect"
             - name: CALICO_IPV6POOL_CIDR
-              value: "{{.CNI.PodIPv6CIDR}}"
+              value: "{{.PodIPv6CIDR}}"
             - name: IP6_AUTODETECTION_METHOD
               value: "{{.Calico.IPv6AutoDetection}}"
             {{end}}
+            {{if .IPv6Only}}
+            - name: CALICO_ROUTER_ID
+              value: "hash"
+            {{end}}
+            {{if .IPv4Enabled}}
+            - name: CALICO_IPV4POOL_BLOCK_SIZE
+              value: "{{.IPv4BlockSize}}"
             {{if eq .CNI.Calico.Mode "BGP"}}
             - name: CALICO_IPV4POOL_IPIP
               value: "Never"
@@ -4848,6 +4893,7 @@ spec:
             - name: CALICO_IPV4POOL_IPIP
               value: "Always"
             {{end}}
+            {{end}}
             - name: FELIX_IPINIPMTU
               valueFrom:
                 configMapKeyRef:
@@ -4865,10 +4911,29 @@ spec:
                   key: veth_mtu
             - name: CALICO_DISABLE_FILE_LOGGING
               value: "true"
+            {{- if eq .CNI.Calico.IPAMType "host-local"}}
+            # Use the pod cidr of the node assigned by host-local ipam
+            - name: USE_POD_CIDR
+              value: "true"
+            {{- end}}
             - name: FELIX_DEFAULTENDPOINTTOHOSTACTION
               value: "ACCEPT"
+            {{- if .CNI.Calico.IgnoreLooseRPF}}
+            - name: FELIX_IGNORELOOSERPF
+              value: "true"
+            {{- end}}
+            {{- if .TyphaEnabled}}
+            # Typha support: controlled by the ConfigMap.
+            - name: FELIX_TYPHAK8SSERVICENAME
+              valueFrom:
+                configMapKeyRef:
+                  name: calico-config
+                  key: typha_service_name
+            - name: FELIX_TYPHAK8SNAMESPACE
+              value: "{{.Namespace}}"
+            {{- end}}
             - name: FELIX_IPV6SUPPORT
-              value: "{{.DualStack}}"
+              value: "{{.IPv6Enabled}}"
             - name: FELIX_HEALTHENABLED
               value: "true"
           securityContext:
@@ -4897,7 +4962,9 @@ spec:
               command:
               - /bin/calico-node
               - -felix-ready
+{{- if .BirdReadyCheck}}
               - -bird-ready
+{{- end}}
             periodSeconds: 10
             timeoutSeconds: 10
           volumeMounts:
@@ -4968,14 +5035,14 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -4988,7 +5055,7 @@ spec:
   template:
     metadata:
       name: calico-kube-controllers
-      namespace: kube-system
+      namespace: {{.Namespace}}
       labels:
         k8s-app: calico-kube-controllers
     spec:
@@ -5006,7 +5073,7 @@ spec:
           image: {{with .CNI.LocalRegistry}}{{.}}/{{end}}calico/kube-controllers:{{.CNI.Version}}
           env:
             - name: ENABLED_CONTROLLERS
-              value: node
+              value: {{.EnabledControllers}}
             - name: DATASTORE_TYPE
               value: kubernetes
           livenessProbe:
@@ -5031,14 +5098,14 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 apiVersion: policy/v1beta1
 kind: PodDisruptionBudget
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -5054,11 +5121,11 @@ kind: ConfigMap
 apiVersion: v1
 metadata:
   name: calico-config
-  namespace: kube-system
+  namespace: {{.Namespace}}
 data:
-  typha_service_name: "none"
+  typha_service_name: "{{if .TyphaEnabled}}calico-typha{{else}}none{{end}}"
   calico_backend: "bird"
-  veth_mtu: "{{.CNI.Calico.MTU}}"
+  veth_mtu: "{{.VethMTU}}"
   cni_network_config: |-
     {
       "name": "k8s-pod-network",
@@ -5071,11 +5138,24 @@ data:
           "datastore_type": "kubernetes",
           "nodename": "__KUBERNETES_NODE_NAME__",
           "mtu": __CNI_MTU__,
-          {{if .CNI.Calico.IPManger}}"ipam": {
-            {{if .DualStack }}
+          {{with .CNI.Calico.IPAMType}}"ipam": {
+            {{if eq . "host-local"}}
+              "type": "host-local",
+              {{if $.DualStack}}
+              "ranges": [[{"subnet": "usePodCidr"}], [{"subnet": "usePodCidrIPv6"}]]
+              {{else if $.IPv6Only}}
+              "ranges": [[{"subnet": "usePodCidrIPv6"}]]
+              {{else}}
+              "subnet": "usePodCidr"
+              {{end}}
+            {{else if $.DualStack}}
               "type": "calico-ipam",
               "assign_ipv4": "true",
               "assign_ipv6": "true"
+            {{else if $.IPv6Only}}
+              "type": "calico-ipam",
+              "assign_ipv4": "false",
+              "assign_ipv6": "true"
             {{else}}
               "type": "calico-ipam"
             {{end}}
@@ -8372,7 +8452,7 @@ roleRef:
 subjects:
   - kind: ServiceAccount
     name: calico-kube-controllers
-    namespace: kube-system
+    namespace: {{.Namespace}}
 ---
 kind: ClusterRole
 apiVersion: rbac.authorization.k8s.io/v1
@@ -8504,14 +8584,14 @@ roleRef:
 subjects:
   - kind: ServiceAccount
     name: calico-node
-    namespace: kube-system
+    namespace: {{.Namespace}}
 
 ---
 kind: DaemonSet
 apiVersion: apps/v1
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-node
 spec:
@@ -8629,39 +8709,28 @@ spec:
             - name: CLUSTER_TYPE
               value: "k8s,bgp"
             - name: IP
-              value: "autodetect"
+              value: "{{if .IPv6Only}}none{{else}}autodetect{{end}}"
             - name: IP_AUTODETECTION_METHOD
               value: "{{.CNI.Calico.IPv4AutoDetection}}"
-            {{if .DualStack}}
+            {{if .IPv6Enabled}}
             - name: IP6
               value: "autodetect"
             - name: CALICO_IPV6POOL_CIDR
-              value: "{{.CNI.PodIPv6CIDR}}"
+              value: "{{.PodIPv6CIDR}}"
             - name: IP6_AUTODETECTION_METHOD
               value: "{{.Calico.IPv6AutoDetection}}"
             {{end}}
-            {{if eq .CNI.Calico.Mode "BGP"}}
-            - name: CALICO_IPV4POOL_IPIP
-              value: "Never"
-            {{else if eq .CNI.Calico.Mode "Overlay-IPIP-All"}}
-            - name: CALICO_IPV4POOL_IPIP
-              value: "Always"
-            {{else if eq .CNI.Calico.Mode "Overlay-IPIP-Cross-Subnet"}}
-            - name: CALICO_IPV4POOL_IPIP
-              value: "CrossSubnet"
-            {{else if eq .CNI.Calico.Mode "Overlay-Vxlan-All"}}
-            - name: CALICO_IPV4POOL_IPIP
-              value: "Never"
-            - name: CALICO_IPV4POOL_VXLAN
-              value: "Always"
-            {{else if eq .CNI.Calico.Mode "Overlay-Vxlan-Cross-Subnet"}}
+            {{if .IPv6Only}}
+            - name: CALICO_ROUTER_ID
+              value: "hash"
+            {{end}}
+            {{if .IPv4Enabled}}
+            - name: CALICO_IPV4POOL_BLOCK_SIZE
+              value: "{{.IPv4BlockSize}}"
             - name: CALICO_IPV4POOL_IPIP
-              value: "Never"
+              value: "{{.IPv4PoolIPIPMode}}"
             - name: CALICO_IPV4POOL_VXLAN
-              value: "CrossSubnet"
-            {{else}}
-            - name: CALICO_IPV4POOL_IPIP
-              value: "Always"
+              value: "{{.IPv4PoolVXLANMode}}"
             {{end}}
             - name: FELIX_IPINIPMTU
               valueFrom:
@@ -8680,10 +8749,29 @@ spec:
                   key: veth_mtu
             - name: CALICO_DISABLE_FILE_LOGGING
               value: "true"
+            {{- if eq .CNI.Calico.IPAMType "host-local"}}
+            # Use the pod cidr of the node assigned by host-local ipam
+            - name: USE_POD_CIDR
+              value: "true"
+            {{- end}}
             - name: FELIX_DEFAULTENDPOINTTOHOSTACTION
               value: "ACCEPT"
+            {{- if .CNI.Calico.IgnoreLooseRPF}}
+            - name: FELIX_IGNORELOOSERPF
+              value: "true"
+            {{- end}}
+            {{- if .TyphaEnabled}}
+            # Typha support: controlled by the ConfigMap.
+            - name: FELIX_TYPHAK8SSERVICENAME
+              valueFrom:
+                configMapKeyRef:
+                  name: calico-config
+                  key: typha_service_name
+            - name: FELIX_TYPHAK8SNAMESPACE
+              value: "{{.Namespace}}"
+            {{- end}}
             - name: FELIX_IPV6SUPPORT
-              value: "{{.DualStack}}"
+              value: "{{.IPv6Enabled}}"
             - name: FELIX_LOGSEVERITYSCREEN
               value: "info"
             - name: FELIX_HEALTHENABLED
@@ -8707,7 +8795,9 @@ spec:
               command:
                 - /bin/calico-node
                 - -felix-ready
+{{- if .BirdReadyCheck}}
                 - -bird-ready
+{{- end}}
             periodSeconds: 10
           volumeMounts:
             - mountPath: /lib/modules
@@ -8768,14 +8858,14 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -8788,7 +8878,7 @@ spec:
   template:
     metadata:
       name: calico-kube-controllers
-      namespace: kube-system
+      namespace: {{.Namespace}}
       labels:
         k8s-app: calico-kube-controllers
     spec:
@@ -8806,7 +8896,7 @@ spec:
           image: {{with .CNI.LocalRegistry}}{{.}}/{{end}}calico/kube-controllers:{{.CNI.Version}}
           env:
             - name: ENABLED_CONTROLLERS
-              value: node
+              value: {{.EnabledControllers}}
             - name: DATASTORE_TYPE
               value: kubernetes
           readinessProbe:
@@ -8821,7 +8911,7 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system`
+  namespace: {{.Namespace}}`
 
 // apiVersion: policy/v1beta1 => apiVersion: policy/v1
 // https://projectcalico.docs.tigera.io/archive/v3.22/manifests/calico.yaml
@@ -8830,11 +8920,11 @@ kind: ConfigMap
 apiVersion: v1
 metadata:
   name: calico-config
-  namespace: kube-system
+  namespace: {{.Namespace}}
 data:
-  typha_service_name: "none"
+  typha_service_name: "{{if .TyphaEnabled}}calico-typha{{else}}none{{end}}"
   calico_backend: "bird"
-  veth_mtu: "{{.CNI.Calico.MTU}}"
+  veth_mtu: "{{.VethMTU}}"
   cni_network_config: |-
     {
       "name": "k8s-pod-network",
@@ -8847,11 +8937,24 @@ data:
           "datastore_type": "kubernetes",
           "nodename": "__KUBERNETES_NODE_NAME__",
           "mtu": __CNI_MTU__,
-          {{if .CNI.Calico.IPManger}}"ipam": {
-            {{if .DualStack }}
+          {{with .CNI.Calico.IPAMType}}"ipam": {
+            {{if eq . "host-local"}}
+              "type": "host-local",
+              {{if $.DualStack}}
+              "ranges": [[{"subnet": "usePodCidr"}], [{"subnet": "usePodCidrIPv6"}]]
+              {{else if $.IPv6Only}}
+              "ranges": [[{"subnet": "usePodCidrIPv6"}]]
+              {{else}}
+              "subnet": "usePodCidr"
+              {{end}}
+            {{else if $.DualStack}}
               "type": "calico-ipam",
               "assign_ipv4": "true",
               "assign_ipv6": "true"
+            {{else if $.IPv6Only}}
+              "type": "calico-ipam",
+              "assign_ipv4": "false",
+              "assign_ipv6": "true"
             {{else}}
               "type": "calico-ipam"
             {{end}}
@@ -12760,7 +12863,7 @@ roleRef:
 subjects:
   - kind: ServiceAccount
     name: calico-kube-controllers
-    namespace: kube-system
+    namespace: {{.Namespace}}
 ---
 
 kind: ClusterRole
@@ -12907,14 +13010,14 @@ roleRef:
 subjects:
   - kind: ServiceAccount
     name: calico-node
-    namespace: kube-system
+    namespace: {{.Namespace}}
 
 ---
 kind: DaemonSet
 apiVersion: apps/v1
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-node
 spec:
@@ -13047,17 +13150,24 @@ spec:
             - name: CLUSTER_TYPE
               value: "k8s,bgp"
             - name: IP
-              value: "autodetect"
+              value: "{{if .IPv6Only}}none{{else}}autodetect{{end}}"
             - name: IP_AUTODETECTION_METHOD
               value: "{{.CNI.Calico.IPv4AutoDetection}}"
-            {{if .DualStack}}
+            {{if .IPv6Enabled}}
             - name: IP6
               value: "autodetect"
             - name: CALICO_IPV6POOL_CIDR
-              value: "{{.CNI.PodIPv6CIDR}}"
+              value: "{{.PodIPv6CIDR}}"
             - name: IP6_AUTODETECTION_METHOD
               value: "{{.Calico.IPv6AutoDetection}}"
             {{end}}
+            {{if .IPv6Only}}
+            - name: CALICO_ROUTER_ID
+              value: "hash"
+            {{end}}
+            {{if .IPv4Enabled}}
+            - name: CALICO_IPV4POOL_BLOCK_SIZE
+              value: "{{.IPv4BlockSize}}"
             {{if eq .CNI.Calico.Mode "BGP"}}
             - name: CALICO_IPV4POOL_IPIP
               value: "Never"
@@ -13081,6 +13191,7 @@ spec:
             - name: CALICO_IPV4POOL_IPIP
               value: "Always"
             {{end}}
+            {{end}}
             - name: FELIX_IPINIPMTU
               valueFrom:
                 configMapKeyRef:
@@ -13098,10 +13209,29 @@ spec:
                   key: veth_mtu
             - name: CALICO_DISABLE_FILE_LOGGING
               value: "true"
+            {{- if eq .CNI.Calico.IPAMType "host-local"}}
+            # Use the pod cidr of the node assigned by host-local ipam
+            - name: USE_POD_CIDR
+              value: "true"
+            {{- end}}
             - name: FELIX_DEFAULTENDPOINTTOHOSTACTION
               value: "ACCEPT"
+            {{- if .CNI.Calico.IgnoreLooseRPF}}
+            - name: FELIX_IGNORELOOSERPF
+              value: "true"
+            {{- end}}
+            {{- if .TyphaEnabled}}
+            # Typha support: controlled by the ConfigMap.
+            - name: FELIX_TYPHAK8SSERVICENAME
+              valueFrom:
+                configMapKeyRef:
+                  name: calico-config
+                  key: typha_service_name
+            - name: FELIX_TYPHAK8SNAMESPACE
+              value: "{{.Namespace}}"
+            {{- end}}
             - name: FELIX_IPV6SUPPORT
-              value: "{{.DualStack}}"
+              value: "{{.IPv6Enabled}}"
             - name: FELIX_HEALTHENABLED
               value: "true"
           securityContext:
@@ -13130,7 +13260,9 @@ spec:
               command:
                 - /bin/calico-node
                 - -felix-ready
+{{- if .BirdReadyCheck}}
                 - -bird-ready
+{{- end}}
             periodSeconds: 10
             timeoutSeconds: 10
           volumeMounts:
@@ -13207,14 +13339,14 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -13227,7 +13359,7 @@ spec:
   template:
     metadata:
       name: calico-kube-controllers
-      namespace: kube-system
+      namespace: {{.Namespace}}
       labels:
         k8s-app: calico-kube-controllers
     spec:
@@ -13245,7 +13377,7 @@ spec:
           image: {{with .CNI.LocalRegistry}}{{.}}/{{end}}calico/kube-controllers:{{.CNI.Version}}
           env:
             - name: ENABLED_CONTROLLERS
-              value: node
+              value: {{.EnabledControllers}}
             - name: DATASTORE_TYPE
               value: kubernetes
           livenessProbe:
@@ -13270,14 +13402,14 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
 
 ---
 apiVersion: policy/v1
 kind: PodDisruptionBudget
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -13293,7 +13425,7 @@ apiVersion: policy/v1
 kind: PodDisruptionBudget
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -13306,23 +13438,23 @@ apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
 ---
 apiVersion: v1
 kind: ServiceAccount
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 ---
 kind: ConfigMap
 apiVersion: v1
 metadata:
   name: calico-config
-  namespace: kube-system
+  namespace: {{.Namespace}}
 data:
-  typha_service_name: "none"
+  typha_service_name: "{{if .TyphaEnabled}}calico-typha{{else}}none{{end}}"
   calico_backend: "bird"
-  veth_mtu: "{{.CNI.Calico.MTU}}"
+  veth_mtu: "{{.VethMTU}}"
   cni_network_config: |-
     {
       "name": "k8s-pod-network",
@@ -13335,11 +13467,24 @@ data:
           "datastore_type": "kubernetes",
           "nodename": "__KUBERNETES_NODE_NAME__",
           "mtu": __CNI_MTU__,
-          {{if .CNI.Calico.IPManger}}"ipam": {
-            {{if .DualStack }}
+          {{with .CNI.Calico.IPAMType}}"ipam": {
+            {{if eq . "host-local"}}
+              "type": "host-local",
+              {{if $.DualStack}}
+              "ranges": [[{"subnet": "usePodCidr"}], [{"subnet": "usePodCidrIPv6"}]]
+              {{else if $.IPv6Only}}
+              "ranges": [[{"subnet": "usePodCidrIPv6"}]]
+              {{else}}
+              "subnet": "usePodCidr"
+              {{end}}
+            {{else if $.DualStack}}
               "type": "calico-ipam",
               "assign_ipv4": "true",
               "assign_ipv6": "true"
+            {{else if $.IPv6Only}}
+              "type": "calico-ipam",
+              "assign_ipv4": "false",
+              "assign_ipv6": "true"
             {{else}}
               "type": "calico-ipam"
             {{end}}
@@ -17547,7 +17692,7 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
@@ -17560,13 +17705,13 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
 ---
 kind: DaemonSet
 apiVersion: apps/v1
 metadata:
   name: calico-node
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-node
 spec:
@@ -17696,17 +17841,24 @@ spec:
             - name: CLUSTER_TYPE
               value: "k8s,bgp"
             - name: IP
-              value: "autodetect"
+              value: "{{if .IPv6Only}}none{{else}}autodetect{{end}}"
             - name: IP_AUTODETECTION_METHOD
               value: "{{.CNI.Calico.IPv4AutoDetection}}"
-            {{if .DualStack}}
+            {{if .IPv6Enabled}}
             - name: IP6
               value: "autodetect"
             - name: CALICO_IPV6POOL_CIDR
-              value: "{{.CNI.PodIPv6CIDR}}"
+              value: "{{.PodIPv6CIDR}}"
             - name: IP6_AUTODETECTION_METHOD
               value: "{{.Calico.IPv6AutoDetection}}"
             {{end}}
+            {{if .IPv6Only}}
+            - name: CALICO_ROUTER_ID
+              value: "hash"
+            {{end}}
+            {{if .IPv4Enabled}}
+            - name: CALICO_IPV4POOL_BLOCK_SIZE
+              value: "{{.IPv4BlockSize}}"
             {{if eq .CNI.Calico.Mode "BGP"}}
             - name: CALICO_IPV4POOL_IPIP
               value: "Never"
@@ -17730,6 +17882,7 @@ spec:
             - name: CALICO_IPV4POOL_IPIP
               value: "Always"
             {{end}}
+            {{end}}
             - name: FELIX_IPINIPMTU
               valueFrom:
                 configMapKeyRef:
@@ -17747,10 +17900,29 @@ spec:
                   key: veth_mtu
             - name: CALICO_DISABLE_FILE_LOGGING
               value: "true"
+            {{- if eq .CNI.Calico.IPAMType "host-local"}}
+            # Use the pod cidr of the node assigned by host-local ipam
+            - name: USE_POD_CIDR
+              value: "true"
+            {{- end}}
             - name: FELIX_DEFAULTENDPOINTTOHOSTACTION
               value: "ACCEPT"
+            {{- if .CNI.Calico.IgnoreLooseRPF}}
+            - name: FELIX_IGNORELOOSERPF
+              value: "true"
+            {{- end}}
+            {{- if .TyphaEnabled}}
+            # Typha support: controlled by the ConfigMap.
+            - name: FELIX_TYPHAK8SSERVICENAME
+              valueFrom:
+                configMapKeyRef:
+                  name: calico-config
+                  key: typha_service_name
+            - name: FELIX_TYPHAK8SNAMESPACE
+              value: "{{.Namespace}}"
+            {{- end}}
             - name: FELIX_IPV6SUPPORT
-              value: "{{.DualStack}}"
+              value: "{{.IPv6Enabled}}"
             - name: FELIX_HEALTHENABLED
               value: "true"
           securityContext:
@@ -17779,7 +17951,9 @@ spec:
               command:
               - /bin/calico-node
               - -felix-ready
+{{- if .BirdReadyCheck}}
               - -bird-ready
+{{- end}}
             periodSeconds: 10
             timeoutSeconds: 10
           volumeMounts:
@@ -17851,7 +18025,7 @@ apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: calico-kube-controllers
-  namespace: kube-system
+  namespace: {{.Namespace}}
   labels:
     k8s-app: calico-kube-controllers
 spec:
@@ -17864,7 +18038,7 @@ spec:
   template:
     metadata:
       name: calico-kube-controllers
-      namespace: kube-system
+      namespace: {{.Namespace}}
       labels:
         k8s-app: calico-kube-controllers
     spec:
@@ -17885,7 +18059,7 @@ spec:
           imagePullPolicy: IfNotPresent
           env:
             - name: ENABLED_CONTROLLERS
-              value: node
+              value: {{.EnabledControllers}}
             - name: DATASTORE_TYPE
               value: kubernetes
           livenessProbe:
@@ -17906,10 +18080,13 @@ spec:
 
 const calicoV3261 = `installation:
   registry: {{with .CNI.LocalRegistry}}{{.}}{{end}}
+  {{- with .KubeletDataDir}}
+  kubeletVolumePluginPath: {{.}}
+  {{- end}}
   cni:
     type: Calico
     ipam:
-      type: Calico
+      type: {{if eq .CNI.Calico.IPAMType "host-local"}}HostLocal{{else}}Calico{{end}}
   {{if eq .CNI.Calico.Mode "BGP"}}
   bgp: Enabled
   {{else}}
@@ -17918,7 +18095,10 @@ const calicoV3261 = `installation:
   calicoNetwork:
     # Iptables, BPF
     linuxDataplane: Iptables
+    {{- if not .CNI.Calico.AutoMTU}}
     mtu: {{.CNI.Calico.MTU}}
+    {{- end}}
+    {{if .IPv4Enabled}}
     nodeAddressAutodetectionV4:
       {{if eq .NodeAddressDetectionV4.Type "first-found"}}
       firstFound: true
@@ -17928,10 +18108,16 @@ const calicoV3261 = `installation:
       skipInterface: {{.NodeAddressDetectionV4.Value}}
       {{else if eq .NodeAddressDetectionV4.Type "can-reach"}}
       canReach: {{.NodeAddressDetectionV4.Value}}
+      {{else if eq .NodeAddressDetectionV4.Type "cidr"}}
+      cidrs:
+      {{- range .NodeAddressDetectionV4.Values}}
+        - {{.}}
+      {{- end}}
+      {{else if eq .NodeAddressDetectionV4.Type "kubernetes-internal-ip"}}
+      kubernetes: NodeInternalIP
       {{end}}
-      #cidrs: []
-      #kubernetes: xxx
-    {{if .DualStack}}
+    {{end}}
+    {{if .IPv6Enabled}}
     nodeAddressAutodetectionV6:
       {{if eq .NodeAddressDetectionV6.Type "first-found"}}
       firstFound: true
@@ -17941,10 +18127,18 @@ const calicoV3261 = `installation:
       skipInterface: {{.NodeAddressDetectionV6.Value}}
       {{else if eq .NodeAddressDetectionV6.Type "can-reach"}}
       canReach: {{.NodeAddressDetectionV6.Value}}
+      {{else if eq .NodeAddressDetectionV6.Type "cidr"}}
+      cidrs:
+      {{- range .NodeAddressDetectionV6.Values}}
+        - {{.}}
+      {{- end}}
+      {{else if eq .NodeAddressDetectionV6.Type "kubernetes-internal-ip"}}
+      kubernetes: NodeInternalIP
       {{end}}
     {{end}}
     ipPools:
-      - blockSize: 26
+      {{if .IPv4Enabled}}
+      - blockSize: {{.IPv4BlockSize}}
         cidr: {{.PodIPv4CIDR}}
         {{if eq .CNI.Calico.Mode "Overlay-IPIP-All"}}
         encapsulation: IPIP
@@ -17959,7 +18153,8 @@ const calicoV3261 = `installation:
         {{end}}
         natOutgoing: Enabled
         nodeSelector: all()
-      {{if .DualStack}}
+      {{end}}
+      {{if .IPv6Enabled}}
       - blockSize: 122
         cidr: {{.PodIPv6CIDR}}
         encapsulation: None
@@ -17977,3 +18172,174 @@ tigeraOperator:
 calicoctl:
   image: {{with .CNI.LocalRegistry}}{{.}}{{else}}docker.io{{end}}/calico/ctl
   tag: v3.26.1`
+
+// calicoBGPTemplate the calico bgp resources, rendered to a dedicated manifest
+// since they can only be applied after the calico crds are installed.
+const calicoBGPTemplate = `---
+apiVersion: crd.projectcalico.org/v1
+kind: BGPConfiguration
+metadata:
+  name: default
+spec:
+  logSeverityScreen: Info
+  nodeToNodeMeshEnabled: true
+  {{- with .ASNumber}}
+  asNumber: {{.}}
+  {{- end}}
+{{- range .BGPPeers}}
+---
+apiVersion: crd.projectcalico.org/v1
+kind: BGPPeer
+metadata:
+  name: peer-{{.PeerIP | replace "." "-" | replace ":" "-" | lower | trimAll "-"}}
+spec:
+  peerIP: {{.PeerIP}}
+  asNumber: {{.ASNumber}}
+{{- end}}
+`
+
+// calicoFelixTemplate the felix configuration of wireguard encryption, applied after the calico crds are installed.
+const calicoFelixTemplate = `---
+apiVersion: crd.projectcalico.org/v1
+kind: FelixConfiguration
+metadata:
+  name: default
+spec:
+  {{- if .IPv4Enabled}}
+  wireguardEnabled: true
+  {{- end}}
+  {{- if .IPv6Enabled}}
+  wireguardEnabledV6: true
+  {{- end}}
+`
+
+// calicoNamespaceTemplate the namespace of calico, prepended to the calico manifest when
+// calico is not deployed into kube-system.
+const calicoNamespaceTemplate = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+  labels:
+    pod-security.kubernetes.io/enforce: privileged
+`
+
+// calicoTyphaTemplate the calico-typha service and deployment, appended to the calico manifest
+// when typha is enabled. The tigera operator deploys typha itself, so it is used by manifest versions only.
+// https://projectcalico.docs.tigera.io/archive/v3.22/manifests/calico-typha.yaml
+const calicoTyphaTemplate = `
+---
+# Source: calico/templates/calico-typha.yaml
+# This manifest creates a Service, which will be backed by Calico's Typha daemon.
+# Typha sits in between Felix and the API server, reducing Calico's load on the API server.
+apiVersion: v1
+kind: Service
+metadata:
+  name: calico-typha
+  namespace: {{.Namespace}}
+  labels:
+    k8s-app: calico-typha
+spec:
+  ports:
+    - port: 5473
+      protocol: TCP
+      targetPort: calico-typha
+      name: calico-typha
+  selector:
+    k8s-app: calico-typha
+---
+# This manifest creates a Deployment of Typha to back the above service.
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: calico-typha
+  namespace: {{.Namespace}}
+  labels:
+    k8s-app: calico-typha
+spec:
+  # Number of Typha replicas. To enable Typha, set this to a non-zero value *and* set the
+  # typha_service_name variable in the calico-config ConfigMap above.
+  replicas: {{.TyphaReplicas}}
+  revisionHistoryLimit: 2
+  selector:
+    matchLabels:
+      k8s-app: calico-typha
+  strategy:
+    rollingUpdate:
+      # 100% surge allows a complete up-level set of typha instances to start and become ready,
+      # which in turn allows all the back-level typha instances to start shutting down. This
+      # means that connections tend to bounce directly from a back-level instance to an up-level
+      # instance.
+      maxSurge: 100%
+      # In case the cluster is unable to schedule extra surge instances, allow at most one instance
+      # to shut down to make room. You can set this to 0 if you're sure there'll always be enough room to
+      # schedule extra typha instances during an upgrade (because setting it to 0 blocks shutdown until
+      # up-level typha instances are online and ready).
+      maxUnavailable: 1
+    type: RollingUpdate
+  template:
+    metadata:
+      labels:
+        k8s-app: calico-typha
+      annotations:
+        cluster-autoscaler.kubernetes.io/safe-to-evict: 'true'
+    spec:
+      nodeSelector:
+        kubernetes.io/os: linux
+      hostNetwork: true
+      tolerations:
+        # Mark the pod as a critical add-on for rescheduling.
+        - key: CriticalAddonsOnly
+          operator: Exists
+      # Since Calico can't network a pod until Typha is up, we need to run Typha itself
+      # as a host-networked pod.
+      serviceAccountName: calico-node
+      priorityClassName: system-cluster-critical
+      # fsGroup allows using projected serviceaccount tokens as described here kubernetes/kubernetes#82573
+      securityContext:
+        fsGroup: 65534
+      containers:
+      - image: {{with .CNI.LocalRegistry}}{{.}}/{{end}}calico/typha:{{.CNI.Version}}
+        name: calico-typha
+        ports:
+        - containerPort: 5473
+          name: calico-typha
+          protocol: TCP
+        envFrom:
+        - configMapRef:
+            # Allow KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT to be overridden for eBPF mode.
+            name: kubernetes-services-endpoint
+            optional: true
+        env:
+          # Enable "info" logging by default. Can be set to "debug" to increase verbosity.
+          - name: TYPHA_LOGSEVERITYSCREEN
+            value: "info"
+          # Disable logging to file and syslog since those don't make sense in Kubernetes.
+          - name: TYPHA_LOGFILEPATH
+            value: "none"
+          - name: TYPHA_LOGSEVERITYSYS
+            value: "none"
+          # Monitor the Kubernetes API to find the number of running instances and rebalance
+          # connections.
+          - name: TYPHA_CONNECTIONREBALANCINGMODE
+            value: "kubernetes"
+          - name: TYPHA_DATASTORETYPE
+            value: "kubernetes"
+          - name: TYPHA_HEALTHENABLED
+            value: "true"
+        livenessProbe:
+          httpGet:
+            path: /liveness
+            port: 9098
+            host: localhost
+          periodSeconds: 30
+          initialDelaySeconds: 30
+        securityContext:
+          runAsNonRoot: true
+          allowPrivilegeEscalation: false
+        readinessProbe:
+          httpGet:
+            path: /readiness
+            port: 9098
+            host: localhost
+          periodSeconds: 10`
@@ -2,8 +2,12 @@ package cni
 
 import (
 	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/component/common"
 	"github.com/kubeclipper/kubeclipper/pkg/constatns"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 )
@@ -39,8 +43,8 @@ func TestCNI_renderCalicoTo(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		tt.stepper.NodeAddressDetectionV4 = ParseNodeAddressDetection(tt.stepper.Calico.IPv4AutoDetection)
-		tt.stepper.NodeAddressDetectionV6 = ParseNodeAddressDetection(tt.stepper.Calico.IPv6AutoDetection)
+		tt.stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(tt.stepper.Calico.IPv4AutoDetection)
+		tt.stepper.NodeAddressDetectionV6, _ = ParseNodeAddressDetection(tt.stepper.Calico.IPv6AutoDetection)
 		t.Run(tt.name, func(t *testing.T) {
 			w := &bytes.Buffer{}
 			err := tt.stepper.renderCalicoTo(w)
@@ -52,3 +56,812 @@ func TestCNI_renderCalicoTo(t *testing.T) {
 		})
 	}
 }
+
+func TestCNI_renderCalicoBGPTo(t *testing.T) {
+	stepper := CalicoRunnable{
+		ASNumber: 64512,
+		BGPPeers: []v1.BGPPeer{
+			{PeerIP: "192.168.10.1", ASNumber: 64513},
+			{PeerIP: "FD00::1", ASNumber: 64514},
+		},
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderCalicoBGPTo(w); err != nil {
+		t.Fatalf("renderCalicoBGPTo() error = %v", err)
+	}
+	for _, want := range []string{
+		"kind: BGPConfiguration",
+		"asNumber: 64512",
+		"name: peer-192-168-10-1",
+		"peerIP: 192.168.10.1",
+		"asNumber: 64513",
+		"name: peer-fd00--1",
+		"asNumber: 64514",
+	} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("renderCalicoBGPTo() want %q in:\n%s", want, w.String())
+		}
+	}
+}
+
+func TestValidateBGPPeers(t *testing.T) {
+	tests := []struct {
+		name    string
+		peers   []v1.BGPPeer
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			peers: []v1.BGPPeer{{PeerIP: "10.0.0.1", ASNumber: 64513}, {PeerIP: "fd00::1", ASNumber: 64513}},
+		},
+		{
+			name:    "invalid ip",
+			peers:   []v1.BGPPeer{{PeerIP: "10.0.0.300", ASNumber: 64513}},
+			wantErr: true,
+		},
+		{
+			name:    "empty as number",
+			peers:   []v1.BGPPeer{{PeerIP: "10.0.0.1"}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate peer",
+			peers:   []v1.BGPPeer{{PeerIP: "10.0.0.1", ASNumber: 64513}, {PeerIP: "10.0.0.1", ASNumber: 64514}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateBGPPeers(tt.peers); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBGPPeers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testCalicoRunnable the ipip calico stepper of version with the ipv4 pool, opts set the options under test.
+func testCalicoRunnable(version string, opts ...func(*CalicoRunnable)) CalicoRunnable {
+	stepper := CalicoRunnable{
+		BaseCni: BaseCni{
+			PodIPv4CIDR: constatns.ClusterPodSubnet,
+			PodIPv6CIDR: "fd00::/108",
+			CNI: v1.CNI{
+				Type:    "calico",
+				Version: version,
+				Calico: &v1.Calico{
+					IPv4AutoDetection: "first-found",
+					IPv6AutoDetection: "first-found",
+					Mode:              CalicoNetworkIPIPAll,
+					MTU:               1440,
+				},
+			},
+		},
+	}
+	for _, opt := range opts {
+		opt(&stepper)
+	}
+	stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(stepper.Calico.IPv4AutoDetection)
+	stepper.NodeAddressDetectionV6, _ = ParseNodeAddressDetection(stepper.Calico.IPv6AutoDetection)
+	return stepper
+}
+
+func withCalicoMode(mode string) func(*CalicoRunnable) {
+	return func(r *CalicoRunnable) { r.Calico.Mode = mode }
+}
+
+// TestCNI_renderCalicoTo_options the want and notWant are matched against the rendered manifest
+// with the whitespaces collapsed, e.g. `- name: CALICO_IPV4POOL_IPIP value: "Always"`.
+func TestCNI_renderCalicoTo_options(t *testing.T) {
+	tests := []struct {
+		name    string
+		stepper CalicoRunnable
+		want    []string
+		notWant []string
+		wantErr bool
+	}{
+		{
+			name:    "v3.11.2 bgp",
+			stepper: testCalicoRunnable("v3.11.2", withCalicoMode(CalicoNetworkBGP)),
+			want:    []string{`- name: CALICO_IPV4POOL_IPIP value: "Never"`, `- name: CALICO_IPV4POOL_VXLAN value: "Never"`},
+		},
+		{
+			name:    "v3.11.2 ipip all",
+			stepper: testCalicoRunnable("v3.11.2", withCalicoMode(CalicoNetworkIPIPAll)),
+			want:    []string{`- name: CALICO_IPV4POOL_IPIP value: "Always"`, `- name: CALICO_IPV4POOL_VXLAN value: "Never"`},
+		},
+		{
+			name:    "v3.11.2 ipip cross subnet",
+			stepper: testCalicoRunnable("v3.11.2", withCalicoMode(CalicoNetworkIPIPSubnet)),
+			want:    []string{`- name: CALICO_IPV4POOL_IPIP value: "CrossSubnet"`, `- name: CALICO_IPV4POOL_VXLAN value: "Never"`},
+		},
+		{
+			name:    "v3.11.2 vxlan all",
+			stepper: testCalicoRunnable("v3.11.2", withCalicoMode(CalicoNetworkVXLANAll)),
+			want:    []string{`- name: CALICO_IPV4POOL_IPIP value: "Never"`, `- name: CALICO_IPV4POOL_VXLAN value: "Always"`},
+		},
+		{
+			name:    "v3.11.2 vxlan cross subnet",
+			stepper: testCalicoRunnable("v3.11.2", withCalicoMode(CalicoNetworkVXLANSubnet)),
+			wantErr: true,
+		},
+		{
+			name:    "v3.11.2 overlay",
+			stepper: testCalicoRunnable("v3.11.2", withCalicoMode("overlay")),
+			want:    []string{`- name: CALICO_IPV4POOL_IPIP value: "Always"`, `- name: CALICO_IPV4POOL_VXLAN value: "Never"`},
+		},
+		{
+			name: "v3.16.10 vxlan cross subnet",
+			stepper: testCalicoRunnable("v3.16.10", withCalicoMode(CalicoNetworkVXLANSubnet), func(r *CalicoRunnable) {
+				r.DualStack = true
+			}),
+			want: []string{
+				`- name: CALICO_IPV4POOL_IPIP value: "Never"`,
+				`- name: CALICO_IPV4POOL_VXLAN value: "CrossSubnet"`,
+				`- name: CALICO_IPV6POOL_CIDR value: "fd00::/108"`,
+			},
+		},
+		{
+			name:    "manifest fixed mtu",
+			stepper: testCalicoRunnable("v3.22.4"),
+			want:    []string{`veth_mtu: "1440"`},
+		},
+		{
+			name:    "manifest auto mtu",
+			stepper: testCalicoRunnable("v3.22.4", func(r *CalicoRunnable) { r.Calico.AutoMTU = true }),
+			want:    []string{`veth_mtu: "0"`},
+			notWant: []string{`veth_mtu: "1440"`},
+		},
+		{
+			name:    "chart fixed mtu",
+			stepper: testCalicoRunnable("v3.26.1"),
+			want:    []string{"mtu: 1440"},
+		},
+		{
+			name:    "chart auto mtu",
+			stepper: testCalicoRunnable("v3.26.1", func(r *CalicoRunnable) { r.Calico.AutoMTU = true }),
+			notWant: []string{"mtu: 1440"},
+		},
+		{
+			name:    "legacy auto mtu",
+			stepper: testCalicoRunnable("v3.16.10", func(r *CalicoRunnable) { r.Calico.AutoMTU = true }),
+			wantErr: true,
+		},
+		{
+			name:    "manifest default loose rpf",
+			stepper: testCalicoRunnable("v3.22.4"),
+			notWant: []string{"FELIX_IGNORELOOSERPF"},
+		},
+		{
+			name:    "manifest ignore loose rpf",
+			stepper: testCalicoRunnable("v3.22.4", func(r *CalicoRunnable) { r.Calico.IgnoreLooseRPF = true }),
+			want:    []string{`- name: FELIX_IGNORELOOSERPF value: "true"`},
+		},
+		{
+			name:    "legacy manifest ignore loose rpf",
+			stepper: testCalicoRunnable("v3.11.2", func(r *CalicoRunnable) { r.Calico.IgnoreLooseRPF = true }),
+			want:    []string{`- name: FELIX_IGNORELOOSERPF value: "true"`},
+		},
+		{
+			name:    "chart ignore loose rpf",
+			stepper: testCalicoRunnable("v3.26.1", func(r *CalicoRunnable) { r.Calico.IgnoreLooseRPF = true }),
+			wantErr: true,
+		},
+		{
+			name:    "typha disabled",
+			stepper: testCalicoRunnable("v3.22.4"),
+			want:    []string{`typha_service_name: "none"`},
+			notWant: []string{"kind: Deployment metadata: name: calico-typha", "FELIX_TYPHAK8SSERVICENAME"},
+		},
+		{
+			name:    "typha enabled",
+			stepper: testCalicoRunnable("v3.22.4", func(r *CalicoRunnable) { r.TyphaReplicas = 3 }),
+			want: []string{
+				`typha_service_name: "calico-typha"`, "kind: Deployment metadata: name: calico-typha",
+				"replicas: 3", "FELIX_TYPHAK8SSERVICENAME",
+			},
+		},
+		{
+			name:    "legacy typha enabled",
+			stepper: testCalicoRunnable("v3.11.2", func(r *CalicoRunnable) { r.TyphaReplicas = 3 }),
+			want: []string{
+				`typha_service_name: "calico-typha"`, "kind: Deployment metadata: name: calico-typha",
+				"replicas: 3", "FELIX_TYPHAK8SSERVICENAME",
+			},
+		},
+		{
+			name:    "chart typha enabled",
+			stepper: testCalicoRunnable("v3.26.1", func(r *CalicoRunnable) { r.TyphaReplicas = 3 }),
+			notWant: []string{"kind: Deployment metadata: name: calico-typha", "FELIX_TYPHAK8SSERVICENAME"},
+		},
+		{
+			name:    "ipip bird ready check",
+			stepper: testCalicoRunnable("v3.22.4"),
+			want:    []string{"- -felix-ready", "- -bird-ready"},
+		},
+		{
+			name:    "bgp bird ready check",
+			stepper: testCalicoRunnable("v3.22.4", withCalicoMode(CalicoNetworkBGP)),
+			want:    []string{"- -felix-ready", "- -bird-ready"},
+		},
+		{
+			name:    "vxlan without bird ready check",
+			stepper: testCalicoRunnable("v3.22.4", withCalicoMode(CalicoNetworkVXLANAll)),
+			want:    []string{"- -felix-ready"},
+			notWant: []string{"- -bird-ready"},
+		},
+		{
+			name:    "vxlan cross subnet without bird ready check",
+			stepper: testCalicoRunnable("v3.22.4", withCalicoMode(CalicoNetworkVXLANSubnet)),
+			want:    []string{"- -felix-ready"},
+			notWant: []string{"- -bird-ready"},
+		},
+		{
+			name:    "bird ready check disabled",
+			stepper: testCalicoRunnable("v3.22.4", func(r *CalicoRunnable) { r.Calico.DisableBirdReadyCheck = true }),
+			want:    []string{"- -felix-ready"},
+			notWant: []string{"- -bird-ready"},
+		},
+		{
+			name:    "default enabled controllers",
+			stepper: testCalicoRunnable("v3.22.4"),
+			want:    []string{"- name: ENABLED_CONTROLLERS value: node "},
+		},
+		{
+			name:    "multiple enabled controllers",
+			stepper: testCalicoRunnable("v3.22.4", func(r *CalicoRunnable) { r.Calico.EnabledControllers = []string{"node", "policy"} }),
+			want:    []string{"- name: ENABLED_CONTROLLERS value: node,policy "},
+		},
+		{
+			name:    "v3.11.2 enabled controllers",
+			stepper: testCalicoRunnable("v3.11.2", func(r *CalicoRunnable) { r.Calico.EnabledControllers = []string{"namespace"} }),
+			want:    []string{"- name: ENABLED_CONTROLLERS value: namespace "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			err := tt.stepper.renderCalicoTo(w)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderCalicoTo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := strings.Join(strings.Fields(w.String()), " ")
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("renderCalicoTo() want %s", want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("renderCalicoTo() do not want %s", notWant)
+				}
+			}
+		})
+	}
+}
+
+func Test_typhaReplicas(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		nodes    int
+		want     int
+	}{
+		{name: "small cluster", nodes: 10, want: 0},
+		{name: "threshold", nodes: typhaAutoEnableNodes, want: 0},
+		{name: "large cluster", nodes: 51, want: typhaMinReplicas},
+		{name: "huge cluster", nodes: 1000, want: 5},
+		{name: "max replicas", nodes: 5000, want: typhaMaxReplicas},
+		{name: "specified replicas", replicas: 2, nodes: 10, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := typhaReplicas(tt.replicas, tt.nodes); got != tt.want {
+				t.Errorf("typhaReplicas() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNodeAddressDetection(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		want    NodeAddressDetection
+		wantErr bool
+	}{
+		{name: "empty", method: "", want: NodeAddressDetection{Type: "first-found"}},
+		{name: "first-found", method: "first-found", want: NodeAddressDetection{Type: "first-found"}},
+		{name: "kubernetes-internal-ip", method: "kubernetes-internal-ip", want: NodeAddressDetection{Type: "kubernetes-internal-ip"}},
+		{name: "can-reach", method: "can-reach=8.8.8.8", want: NodeAddressDetection{Type: "can-reach", Value: "8.8.8.8"}},
+		{name: "interface", method: "interface=eth.*,ens.*", want: NodeAddressDetection{Type: "interface", Value: "eth.*,ens.*"}},
+		{name: "skip-interface", method: "skip-interface=docker.*", want: NodeAddressDetection{Type: "skip-interface", Value: "docker.*"}},
+		{name: "cidr", method: "cidr=10.0.0.0/24,172.16.0.0/16", want: NodeAddressDetection{Type: "cidr", Value: "10.0.0.0/24,172.16.0.0/16"}},
+		{name: "unknown method", method: "first", wantErr: true},
+		{name: "missing value", method: "can-reach=", wantErr: true},
+		{name: "unexpected value", method: "first-found=eth0", wantErr: true},
+		{name: "invalid regex", method: "interface=eth[", wantErr: true},
+		{name: "invalid cidr", method: "cidr=10.0.0.0/33", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNodeAddressDetection(tt.method)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNodeAddressDetection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseNodeAddressDetection() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEnabledControllers(t *testing.T) {
+	tests := []struct {
+		name        string
+		controllers []string
+		wantErr     bool
+	}{
+		{name: "empty"},
+		{name: "valid", controllers: []string{"node", "policy", "namespace", "serviceaccount", "workloadendpoint"}},
+		{name: "unknown", controllers: []string{"node", "pod"}, wantErr: true},
+		{name: "duplicate", controllers: []string{"node", "node"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateEnabledControllers(tt.controllers); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEnabledControllers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCalicoRunnable_InitStep_ipFamily(t *testing.T) {
+	tests := []struct {
+		name     string
+		family   v1.IPFamily
+		cidrs    []string
+		wantIPv4 string
+		wantIPv6 string
+	}{
+		{name: "ipv4", family: v1.IPFamilyIPv4, cidrs: []string{"172.25.0.0/16"}, wantIPv4: "172.25.0.0/16"},
+		{name: "dual-stack", family: v1.IPFamilyDualStack, cidrs: []string{"172.25.0.0/16", "fd00::/108"}, wantIPv4: "172.25.0.0/16", wantIPv6: "fd00::/108"},
+		{name: "ipv6", family: v1.IPFamilyIPv6, cidrs: []string{"fd00::/108"}, wantIPv6: "fd00::/108"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stepper := (&CalicoRunnable{}).InitStep(&component.ExtraMetadata{}, &v1.CNI{Type: "calico", Calico: &v1.Calico{}},
+				&v1.Networking{IPFamily: tt.family, Pods: v1.NetworkRanges{CIDRBlocks: tt.cidrs}}).(*CalicoRunnable)
+			if stepper.PodIPv4CIDR != tt.wantIPv4 || stepper.PodIPv6CIDR != tt.wantIPv6 {
+				t.Errorf("InitStep() pod cidrs = %q, %q, want %q, %q", stepper.PodIPv4CIDR, stepper.PodIPv6CIDR, tt.wantIPv4, tt.wantIPv6)
+			}
+			if stepper.IPv6Only != (tt.family == v1.IPFamilyIPv6) {
+				t.Errorf("InitStep() IPv6Only = %v", stepper.IPv6Only)
+			}
+		})
+	}
+}
+
+func TestCNI_renderCalicoTo_ipv6Only(t *testing.T) {
+	for _, version := range []string{"v3.11.2", "v3.16.10", "v3.22.4", "v3.24.5", "v3.26.1"} {
+		t.Run(version, func(t *testing.T) {
+			stepper := CalicoRunnable{
+				BaseCni: BaseCni{
+					IPv6Only:    true,
+					PodIPv6CIDR: "fd00::/108",
+					CNI: v1.CNI{
+						Type:    "calico",
+						Version: version,
+						Calico: &v1.Calico{
+							IPv4AutoDetection: "first-found",
+							IPv6AutoDetection: "first-found",
+							Mode:              CalicoNetworkIPIPAll,
+							IPManger:          true,
+							MTU:               1440,
+						},
+					},
+				},
+			}
+			stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(stepper.Calico.IPv4AutoDetection)
+			stepper.NodeAddressDetectionV6, _ = ParseNodeAddressDetection(stepper.Calico.IPv6AutoDetection)
+			w := &bytes.Buffer{}
+			if err := stepper.renderCalicoTo(w); err != nil {
+				t.Fatalf("renderCalicoTo() error = %v", err)
+			}
+			got := strings.Join(strings.Fields(w.String()), " ")
+			wants := []string{
+				`- name: IP value: "none"`,
+				`- name: CALICO_IPV6POOL_CIDR value: "fd00::/108"`,
+				`- name: FELIX_IPV6SUPPORT value: "true"`,
+				`"assign_ipv4": "false", "assign_ipv6": "true"`,
+			}
+			unwanted := []string{"CALICO_IPV4POOL_"}
+			if version == "v3.26.1" {
+				wants = []string{"nodeAddressAutodetectionV6:", "cidr: fd00::/108"}
+				unwanted = []string{"nodeAddressAutodetectionV4:", "blockSize: 26"}
+			}
+			for _, want := range wants {
+				if !strings.Contains(got, want) {
+					t.Errorf("renderCalicoTo() want %s", want)
+				}
+			}
+			for _, s := range unwanted {
+				if strings.Contains(got, s) {
+					t.Errorf("renderCalicoTo() should not contain %s", s)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateBlockSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockSize int
+		cidr      string
+		wantErr   bool
+	}{
+		{name: "unset", cidr: "172.25.0.0/16"},
+		{name: "valid", blockSize: 28, cidr: "172.25.0.0/16"},
+		{name: "equal to the pod cidr", blockSize: 20, cidr: "172.25.0.0/20"},
+		{name: "too small", blockSize: 19, cidr: "172.25.0.0/16", wantErr: true},
+		{name: "too large", blockSize: 33, cidr: "172.25.0.0/16", wantErr: true},
+		{name: "larger than the pod cidr", blockSize: 22, cidr: "172.25.0.0/24", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateBlockSize(tt.blockSize, tt.cidr); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBlockSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCNI_renderCalicoTo_blockSize(t *testing.T) {
+	tests := []struct {
+		version   string
+		blockSize int
+		want      string
+	}{
+		{version: "v3.22.4", want: `- name: CALICO_IPV4POOL_BLOCK_SIZE value: "26"`},
+		{version: "v3.22.4", blockSize: 28, want: `- name: CALICO_IPV4POOL_BLOCK_SIZE value: "28"`},
+		{version: "v3.11.2", blockSize: 28, want: `- name: CALICO_IPV4POOL_BLOCK_SIZE value: "28"`},
+		{version: "v3.26.1", want: `- blockSize: 26 cidr: 172.25.0.0/16`},
+		{version: "v3.26.1", blockSize: 24, want: `- blockSize: 24 cidr: 172.25.0.0/16`},
+	}
+	for _, tt := range tests {
+		stepper := CalicoRunnable{
+			BaseCni: BaseCni{
+				PodIPv4CIDR: "172.25.0.0/16",
+				CNI: v1.CNI{
+					Type:    "calico",
+					Version: tt.version,
+					Calico: &v1.Calico{
+						IPv4AutoDetection: "first-found",
+						Mode:              CalicoNetworkIPIPAll,
+						MTU:               1440,
+						BlockSize:         tt.blockSize,
+					},
+				},
+			},
+		}
+		stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(stepper.Calico.IPv4AutoDetection)
+		w := &bytes.Buffer{}
+		if err := stepper.renderCalicoTo(w); err != nil {
+			t.Fatalf("renderCalicoTo() error = %v", err)
+		}
+		if got := strings.Join(strings.Fields(w.String()), " "); !strings.Contains(got, tt.want) {
+			t.Errorf("renderCalicoTo() %s block size %d want %s", tt.version, tt.blockSize, tt.want)
+		}
+	}
+}
+
+func TestCNI_renderCalicoTo_namespace(t *testing.T) {
+	tests := []struct {
+		namespace     string
+		wantNamespace bool
+	}{
+		{namespace: "kube-system"},
+		{namespace: "calico", wantNamespace: true},
+	}
+	for _, tt := range tests {
+		stepper := CalicoRunnable{
+			BaseCni: BaseCni{
+				PodIPv4CIDR: "172.25.0.0/16",
+				CNI: v1.CNI{
+					Type:      "calico",
+					Version:   "v3.22.4",
+					Namespace: tt.namespace,
+					Calico: &v1.Calico{
+						IPv4AutoDetection: "first-found",
+						Mode:              CalicoNetworkIPIPAll,
+						MTU:               1440,
+					},
+				},
+			},
+		}
+		stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(stepper.Calico.IPv4AutoDetection)
+		w := &bytes.Buffer{}
+		if err := stepper.renderCalicoTo(w); err != nil {
+			t.Fatalf("renderCalicoTo() error = %v", err)
+		}
+		got := w.String()
+		if !strings.Contains(got, "namespace: "+tt.namespace) {
+			t.Errorf("renderCalicoTo() want the resources in namespace %s", tt.namespace)
+		}
+		if tt.namespace != "kube-system" && strings.Contains(got, "namespace: kube-system") {
+			t.Errorf("renderCalicoTo() want no resources in namespace kube-system")
+		}
+		if gotNamespace := strings.Contains(got, "kind: Namespace"); gotNamespace != tt.wantNamespace {
+			t.Errorf("renderCalicoTo() namespace %s creates Namespace = %v, want %v", tt.namespace, gotNamespace, tt.wantNamespace)
+		}
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	tests := []struct {
+		name        string
+		cniType     string
+		namespace   string
+		kubeVersion string
+		wantErr     bool
+	}{
+		{name: "unset", cniType: "calico", kubeVersion: "v1.23.6"},
+		{name: "valid", cniType: "calico", namespace: "calico", kubeVersion: "v1.23.6"},
+		{name: "invalid label", cniType: "flannel", namespace: "Kube_Flannel", kubeVersion: "v1.23.6", wantErr: true},
+		{name: "operator calico-system", cniType: "calico", namespace: "calico-system", kubeVersion: "v1.27.4"},
+		{name: "operator other namespace", cniType: "calico", namespace: "kube-system", kubeVersion: "v1.27.4", wantErr: true},
+		{name: "flannel on high version", cniType: "flannel", namespace: "flannel", kubeVersion: "v1.27.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateNamespace(tt.cniType, tt.namespace, tt.kubeVersion); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCalicoRunnable_LoadImage_concurrency(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	stepper := CalicoRunnable{
+		BaseCni: BaseCni{
+			CNI: v1.CNI{
+				Type:                 "calico",
+				Version:              "v3.22.4",
+				Offline:              true,
+				ImageLoadConcurrency: 2,
+			},
+		},
+	}
+	steps, err := stepper.LoadImage(nodes)
+	if err != nil {
+		t.Fatalf("LoadImage() error = %v", err)
+	}
+	if len(steps) != 1 || len(steps[0].Nodes) != len(nodes) || steps[0].Concurrency != 2 {
+		t.Errorf("LoadImage() want one step of all nodes with concurrency 2, got %+v", steps)
+	}
+}
+
+func TestCalicoRunnable_LoadImage_localRegistry(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "1"}, {ID: "2"}}
+	stepper := CalicoRunnable{
+		BaseCni: BaseCni{
+			CNI: v1.CNI{
+				Type:          "calico",
+				Version:       "v3.22.4",
+				Offline:       true,
+				LocalRegistry: "10.0.0.1:5000",
+				Calico:        &v1.Calico{Mode: "Overlay-Vxlan-All", MTU: 1440},
+			},
+		},
+	}
+	steps, err := stepper.LoadImage(nodes)
+	if err != nil {
+		t.Fatalf("LoadImage() error = %v", err)
+	}
+	if len(steps) != 1 || steps[0].Name != "cniImageVerifier" || len(steps[0].Nodes) != 1 {
+		t.Fatalf("LoadImage() want one image verifier step on the first node, got %+v", steps)
+	}
+	var verifier RegistryImageVerifier
+	if err = json.Unmarshal(steps[0].Commands[0].CustomCommand, &verifier); err != nil {
+		t.Fatalf("unmarshal verifier error = %v", err)
+	}
+	if len(verifier.Images) == 0 {
+		t.Fatalf("verifier should check the calico images")
+	}
+	for _, image := range verifier.Images {
+		if !strings.HasPrefix(image, "10.0.0.1:5000/calico/") {
+			t.Errorf("image %s should be in the local registry", image)
+		}
+	}
+
+	stepper.Offline = false
+	if steps, err = stepper.LoadImage(nodes); err != nil || len(steps) != 0 {
+		t.Errorf("LoadImage() online want no steps, got %+v, %v", steps, err)
+	}
+}
+
+func TestCalicoRunnable_InstallSteps_offlineChart(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "1"}}
+	stepper := CalicoRunnable{
+		BaseCni: BaseCni{
+			CNI: v1.CNI{
+				Type:    "calico",
+				Version: "v3.26.1",
+				Offline: true,
+			},
+		},
+	}
+	steps, err := stepper.InstallSteps(nodes, "v1.27.4")
+	if err != nil {
+		t.Fatalf("InstallSteps() error = %v", err)
+	}
+	chart := &common.Chart{PkgName: "calico", Version: "v3.26.1", Offline: true}
+	var chartLoaded, chartInstalled bool
+	for _, step := range steps {
+		for _, cmd := range step.Commands {
+			if cmd.Type == v1.CommandCustom && step.Name == "calico-chartLoad" {
+				var got common.Chart
+				if err = json.Unmarshal(cmd.CustomCommand, &got); err != nil {
+					t.Fatalf("unmarshal chart step error = %v", err)
+				}
+				if !got.Offline {
+					t.Errorf("chart step want offline, got %+v", got)
+				}
+				chartLoaded = true
+			}
+			shell := strings.Join(cmd.ShellCommand, " ")
+			if strings.Contains(shell, "://") || strings.Contains(shell, "helm repo") {
+				t.Errorf("offline step %s must not fetch remotely, got %q", step.Name, shell)
+			}
+			if strings.HasPrefix(shell, "helm upgrade --install") {
+				if !strings.Contains(shell, " "+chart.ChartPath()+" ") {
+					t.Errorf("calico release want installed from %s, got %q", chart.ChartPath(), shell)
+				}
+				chartInstalled = true
+			}
+		}
+	}
+	if !chartLoaded || !chartInstalled {
+		t.Errorf("InstallSteps() want the chart loaded and installed from the bundle, got %+v", steps)
+	}
+}
+
+func TestCNI_renderCalicoTo_kubeletDataDir(t *testing.T) {
+	stepper := (&CalicoRunnable{}).InitStep(&component.ExtraMetadata{KubeletDataDir: "/data/kubelet"}, &v1.CNI{
+		Type:    "calico",
+		Version: "v3.26.1",
+		Calico: &v1.Calico{
+			IPv4AutoDetection: "first-found",
+			Mode:              CalicoNetworkIPIPAll,
+			MTU:               1440,
+		},
+	}, &v1.Networking{IPFamily: v1.IPFamilyIPv4, Pods: v1.NetworkRanges{CIDRBlocks: []string{"172.25.0.0/16"}}}).(*CalicoRunnable)
+	w := &bytes.Buffer{}
+	if err := stepper.renderCalicoTo(w); err != nil {
+		t.Fatalf("renderCalicoTo() error = %v", err)
+	}
+	if !strings.Contains(w.String(), "kubeletVolumePluginPath: /data/kubelet") {
+		t.Errorf("renderCalicoTo() want the custom kubelet dir, got %s", w.String())
+	}
+
+	stepper = (&CalicoRunnable{}).InitStep(&component.ExtraMetadata{}, &v1.CNI{Type: "calico", Calico: &v1.Calico{}},
+		&v1.Networking{IPFamily: v1.IPFamilyIPv4, Pods: v1.NetworkRanges{CIDRBlocks: []string{"172.25.0.0/16"}}}).(*CalicoRunnable)
+	if stepper.KubeletDataDir != kubeletDefaultDataDir {
+		t.Errorf("InitStep() KubeletDataDir = %s, want %s", stepper.KubeletDataDir, kubeletDefaultDataDir)
+	}
+}
+
+func TestCNI_renderCalicoTo_ipam(t *testing.T) {
+	tests := []struct {
+		name      string
+		ipManger  bool
+		ipam      string
+		dualStack bool
+		wants     []string
+		unwanted  []string
+		operator  []string
+	}{
+		{
+			name:     "legacy ip manager",
+			ipManger: true,
+			wants:    []string{`"ipam": { "type": "calico-ipam" },`},
+			unwanted: []string{`"type": "host-local"`, "USE_POD_CIDR"},
+			operator: []string{"ipam: type: Calico"},
+		},
+		{
+			name:     "unset",
+			unwanted: []string{`"ipam"`, "USE_POD_CIDR"},
+			operator: []string{"ipam: type: Calico"},
+		},
+		{
+			name:     "host-local",
+			ipManger: true,
+			ipam:     v1.CalicoIPAMHostLocal,
+			wants:    []string{`"ipam": { "type": "host-local", "subnet": "usePodCidr" },`, `- name: USE_POD_CIDR value: "true"`},
+			unwanted: []string{`"type": "calico-ipam"`},
+			operator: []string{"ipam: type: HostLocal"},
+		},
+		{
+			name:      "host-local dual stack",
+			ipam:      v1.CalicoIPAMHostLocal,
+			dualStack: true,
+			wants:     []string{`"type": "host-local", "ranges": [[{"subnet": "usePodCidr"}], [{"subnet": "usePodCidrIPv6"}]]`},
+			operator:  []string{"ipam: type: HostLocal"},
+		},
+	}
+	for _, tt := range tests {
+		for _, version := range []string{"v3.11.2", "v3.16.10", "v3.22.4", "v3.24.5", "v3.26.1"} {
+			t.Run(tt.name+" "+version, func(t *testing.T) {
+				stepper := CalicoRunnable{
+					BaseCni: BaseCni{
+						DualStack:   tt.dualStack,
+						PodIPv4CIDR: constatns.ClusterPodSubnet,
+						CNI: v1.CNI{
+							Type:    "calico",
+							Version: version,
+							Calico: &v1.Calico{
+								IPv4AutoDetection: "first-found",
+								IPv6AutoDetection: "first-found",
+								Mode:              CalicoNetworkVXLANAll,
+								IPManger:          tt.ipManger,
+								IPAM:              tt.ipam,
+								MTU:               1440,
+							},
+						},
+					},
+				}
+				if tt.dualStack {
+					stepper.PodIPv6CIDR = "fd00::/108"
+				}
+				stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(stepper.Calico.IPv4AutoDetection)
+				stepper.NodeAddressDetectionV6, _ = ParseNodeAddressDetection(stepper.Calico.IPv6AutoDetection)
+				w := &bytes.Buffer{}
+				if err := stepper.renderCalicoTo(w); err != nil {
+					t.Fatalf("renderCalicoTo() error = %v", err)
+				}
+				got := strings.Join(strings.Fields(w.String()), " ")
+				wants, unwanted := tt.wants, tt.unwanted
+				if version == "v3.26.1" {
+					wants, unwanted = tt.operator, nil
+				}
+				for _, want := range wants {
+					if !strings.Contains(got, want) {
+						t.Errorf("renderCalicoTo() want %s", want)
+					}
+				}
+				for _, s := range unwanted {
+					if strings.Contains(got, s) {
+						t.Errorf("renderCalicoTo() should not contain %s", s)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestValidateIPAM(t *testing.T) {
+	tests := []struct {
+		name    string
+		calico  v1.Calico
+		wantErr bool
+	}{
+		{name: "unset", calico: v1.Calico{Mode: CalicoNetworkBGP}},
+		{name: "legacy ip manager", calico: v1.Calico{Mode: CalicoNetworkBGP, IPManger: true}},
+		{name: "calico-ipam with bgp", calico: v1.Calico{Mode: CalicoNetworkBGP, IPAM: v1.CalicoIPAMCalico}},
+		{name: "host-local with vxlan", calico: v1.Calico{Mode: CalicoNetworkVXLANSubnet, IPAM: v1.CalicoIPAMHostLocal}},
+		{name: "host-local with bgp", calico: v1.Calico{Mode: CalicoNetworkBGP, IPAM: v1.CalicoIPAMHostLocal}, wantErr: true},
+		{name: "host-local with ipip", calico: v1.Calico{Mode: CalicoNetworkIPIPAll, IPAM: v1.CalicoIPAMHostLocal}, wantErr: true},
+		{name: "unknown", calico: v1.Calico{Mode: CalicoNetworkVXLANAll, IPAM: "dhcp"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateIPAM(&tt.calico); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIPAM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -40,15 +40,57 @@ const (
 type BaseCni struct {
 	v1.CNI
 	DualStack   bool   `json:"dualStack"`
+	IPv6Only    bool   `json:"ipv6Only,omitempty"`
 	PodIPv4CIDR string `json:"podIPv4CIDR"`
 	PodIPv6CIDR string `json:"podIPv6CIDR"`
+	// Images the cni images pulled from the image registry source
+	Images []string `json:"images,omitempty"`
+	// KubeletDataDir the kubelet root dir, the cni manifests mounting the kubelet dir must agree with it
+	KubeletDataDir string `json:"kubeletDataDir,omitempty"`
+	// ClusterName the cluster of the cni, carried by the logs of the steps on the nodes
+	ClusterName string `json:"clusterName,omitempty"`
+	// registries the cri registries of the cluster, the images in them are verified with their credentials
+	registries []v1.RegistrySpec
+}
+
+// kubeletDefaultDataDir the kubelet root dir when it is not specified
+const kubeletDefaultDataDir = "/var/lib/kubelet"
+
+// setPodCIDRs fill the pod cidrs by the ip family, the first cidr block is the IPv6 one of IPv6-only clusters.
+func (runnable *BaseCni) setPodCIDRs(networking *v1.Networking) {
+	runnable.DualStack = networking.IPFamily == v1.IPFamilyDualStack
+	runnable.IPv6Only = networking.IPFamily == v1.IPFamilyIPv6
+	runnable.PodIPv4CIDR, runnable.PodIPv6CIDR = "", ""
+	switch {
+	case runnable.IPv6Only:
+		runnable.PodIPv6CIDR = networking.Pods.CIDRBlocks[0]
+	case runnable.DualStack:
+		runnable.PodIPv4CIDR = networking.Pods.CIDRBlocks[0]
+		runnable.PodIPv6CIDR = networking.Pods.CIDRBlocks[1]
+	default:
+		runnable.PodIPv4CIDR = networking.Pods.CIDRBlocks[0]
+	}
+}
+
+// IPv4Enabled whether the pods are assigned IPv4 addresses
+func (runnable *BaseCni) IPv4Enabled() bool {
+	return !runnable.IPv6Only
+}
+
+// IPv6Enabled whether the pods are assigned IPv6 addresses
+func (runnable *BaseCni) IPv6Enabled() bool {
+	return runnable.DualStack || runnable.IPv6Only
 }
 
 type Stepper interface {
 	InitStep(metadata *component.ExtraMetadata, cni *v1.CNI, networking *v1.Networking) Stepper
 	LoadImage(nodes []v1.StepNode) ([]v1.Step, error)
 	InstallSteps(nodes []v1.StepNode, kubeVersion string) ([]v1.Step, error)
+	// HealthCheckSteps wait for the cni ready on all nodes after InstallSteps
+	HealthCheckSteps(nodes []v1.StepNode) ([]v1.Step, error)
 	UninstallSteps(nodes []v1.StepNode) ([]v1.Step, error)
+	// DeleteSteps delete the cni resources from kubernetes, used when switch to another cni
+	DeleteSteps(nodes []v1.StepNode, kubeVersion string) ([]v1.Step, error)
 	CmdList(namespace string) map[string]string
 }
 
@@ -56,13 +98,30 @@ func (runnable *BaseCni) NewInstance() component.ObjectMeta {
 	return &BaseCni{}
 }
 
+// withLogger put the cni step logger into the context, so the logs of the helpers carry the
+// cluster, node and operation of the step as well.
+func (runnable *BaseCni) withLogger(ctx context.Context) context.Context {
+	return logger.IntoContext(ctx, component.StepLogger(ctx, runnable.Type, runnable.ClusterName))
+}
+
 func (runnable *BaseCni) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	ctx = runnable.withLogger(ctx)
 	instance, err := downloader.NewInstance(ctx, runnable.Type, runnable.Version, runtime.GOARCH, !runnable.Offline, opts.DryRun)
 	if err != nil {
 		return nil, err
 	}
 
 	if runnable.Offline && runnable.LocalRegistry == "" {
+		if err = utils.WaitImagePullJitter(ctx, opts.DryRun); err != nil {
+			return nil, err
+		}
+		if runnable.ImageSource != "" {
+			if err = runnable.loadImagesFromSource(ctx, opts.DryRun); err != nil {
+				return nil, err
+			}
+			logger.FromContext(ctx).Infof("%s images loaded from %s successfully", runnable.Type, runnable.ImageSource)
+			return nil, nil
+		}
 		dstFile, err := instance.DownloadImages()
 		if err != nil {
 			return nil, err
@@ -71,19 +130,20 @@ func (runnable *BaseCni) Install(ctx context.Context, opts component.Options) ([
 		if err = utils.LoadImage(ctx, opts.DryRun, dstFile, runnable.CriType); err != nil {
 			return nil, err
 		}
-		logger.Info("calico packages offline install successfully")
+		logger.FromContext(ctx).Info("calico packages offline install successfully")
 	}
 
 	return nil, nil
 }
 
 func (runnable *BaseCni) Uninstall(ctx context.Context, opts component.Options) ([]byte, error) {
+	ctx = runnable.withLogger(ctx)
 	instance, err := downloader.NewInstance(ctx, runnable.Type, runnable.Version, runtime.GOARCH, !runnable.Offline, opts.DryRun)
 	if err != nil {
 		return nil, err
 	}
 	if err = instance.RemoveImages(); err != nil {
-		logger.Error("remove calico images compressed file failed", zap.Error(err))
+		logger.FromContext(ctx).Error("remove calico images compressed file failed", zap.Error(err))
 	}
 	return nil, nil
 }
@@ -0,0 +1,122 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	configCleaner = "configCleaner"
+	// cniConfigDir the default cni config dir read by kubelet and container runtime
+	cniConfigDir = "/etc/cni/net.d"
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+configCleaner, version, component.TypeStep), &ConfigCleaner{})
+}
+
+var _ component.StepRunnable = (*ConfigCleaner)(nil)
+
+// ConfigCleaner removes the cni config files managed by a cni plugin,
+// only files name start with one of the Prefixes are removed.
+type ConfigCleaner struct {
+	ConfigDir string   `json:"configDir"`
+	Prefixes  []string `json:"prefixes"`
+}
+
+func (c *ConfigCleaner) NewInstance() component.ObjectMeta {
+	return &ConfigCleaner{}
+}
+
+func (c *ConfigCleaner) Install(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("ConfigCleaner dose not support install")
+}
+
+func (c *ConfigCleaner) Uninstall(_ context.Context, opts component.Options) ([]byte, error) {
+	if opts.DryRun {
+		return nil, nil
+	}
+	removed, err := RemoveCNIConfigs(strutil.StringDefaultIfEmpty(cniConfigDir, c.ConfigDir), c.Prefixes...)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("remove cni config files: %v", removed)
+	return nil, nil
+}
+
+// RemoveCNIConfigs remove the files under dir whose name has one of the prefixes,
+// foreign cni config files are left untouched. It returns the removed file paths.
+func RemoveCNIConfigs(dir string, prefixes ...string) ([]string, error) {
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read cni config dir:%s failed:%w", dir, err)
+	}
+	var removed []string
+	for _, entry := range entries {
+		if !hasAnyPrefix(entry.Name(), prefixes) {
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		if err = os.RemoveAll(p); err != nil {
+			return removed, fmt.Errorf("remove cni config:%s failed:%w", p, err)
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanConfig the step of remove cni config files with the managed prefixes
+func CleanConfig(prefixes []string, nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&ConfigCleaner{
+		ConfigDir: cniConfigDir,
+		Prefixes:  prefixes,
+	})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "removeCniConfig",
+		Timeout:    metav1.Duration{Duration: 10 * time.Second},
+		ErrIgnore:  true,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionUninstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+configCleaner, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,40 @@
+package cni
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveCNIConfigs(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{"10-calico.conflist", "calico-kubeconfig", "10-flannel.conflist", "99-loopback.conf"}
+	for _, f := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte("{}"), 0644))
+	}
+
+	removed, err := RemoveCNIConfigs(dir, calicoConfigPrefixes...)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "10-calico.conflist"),
+		filepath.Join(dir, "calico-kubeconfig"),
+	}, removed)
+
+	for _, f := range []string{"10-calico.conflist", "calico-kubeconfig"} {
+		_, err = os.Stat(filepath.Join(dir, f))
+		assert.True(t, os.IsNotExist(err), "%s should be removed", f)
+	}
+	for _, f := range []string{"10-flannel.conflist", "99-loopback.conf"} {
+		_, err = os.Stat(filepath.Join(dir, f))
+		assert.NoError(t, err, "foreign cni config %s should be left", f)
+	}
+}
+
+func TestRemoveCNIConfigs_NotExistDir(t *testing.T) {
+	removed, err := RemoveCNIConfigs(filepath.Join(t.TempDir(), "not-exist"), calicoConfigPrefixes...)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+}
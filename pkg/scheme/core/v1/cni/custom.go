@@ -0,0 +1,230 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/simple/downloader"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	// CustomCNIType the cni type of user supplied manifest
+	CustomCNIType = "custom"
+	// customManifestTimeout the timeout of download the custom cni manifest
+	customManifestTimeout = 30 * time.Second
+	customManifestCheck   = "customManifestCheck"
+)
+
+func init() {
+	Register(&CustomCNIRunnable{})
+	component.AddTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat,
+		cniInfo+"-"+CustomCNIType, version, component.TypeTemplate), &CustomCNIRunnable{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+customManifestCheck, version, component.TypeStep), &CustomManifestCheck{})
+}
+
+// CustomCNIRunnable installs the cni from a user supplied manifest, for the cni plugins
+// without first-class support. The manifest is rendered with the runnable, so it can
+// reference the pod cidr by {{.PodIPv4CIDR}} and {{.PodIPv6CIDR}}.
+type CustomCNIRunnable struct {
+	BaseCni
+	Manifest       string   `json:"manifest"`
+	ConfigPrefixes []string `json:"configPrefixes,omitempty"`
+}
+
+func (runnable *CustomCNIRunnable) Type() string {
+	return CustomCNIType
+}
+
+func (runnable *CustomCNIRunnable) Create() Stepper {
+	return &CustomCNIRunnable{}
+}
+
+func (runnable *CustomCNIRunnable) NewInstance() component.ObjectMeta {
+	return &CustomCNIRunnable{}
+}
+
+func (runnable *CustomCNIRunnable) InitStep(metadata *component.ExtraMetadata, cni *v1.CNI, networking *v1.Networking) Stepper {
+	stepper := &CustomCNIRunnable{}
+	stepper.CNI = *cni
+	stepper.LocalRegistry = cni.LocalRegistry
+	stepper.BaseCni.Type = CustomCNIType
+	stepper.Version = cni.Version
+	stepper.CriType = metadata.CRI
+	stepper.ClusterName = metadata.ClusterName
+	stepper.Namespace = cni.Namespace
+	stepper.setPodCIDRs(networking)
+	stepper.KubeletDataDir = strutil.StringDefaultIfEmpty(kubeletDefaultDataDir, metadata.KubeletDataDir)
+	if cni.Custom != nil {
+		stepper.Manifest = cni.Custom.Manifest
+		stepper.ConfigPrefixes = cni.Custom.ConfigPrefixes
+	}
+
+	return stepper
+}
+
+// LoadImage the images of custom cni are pulled by the container runtime
+func (runnable *CustomCNIRunnable) LoadImage(_ []v1.StepNode) ([]v1.Step, error) {
+	return nil, nil
+}
+
+func (runnable *CustomCNIRunnable) InstallSteps(nodes []v1.StepNode, _ string) ([]v1.Step, error) {
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{
+		RenderYaml(CustomCNIType, bytes, nodes),
+		ApplyYaml(filepath.Join(manifestDir, "custom.yaml"), nodes),
+	}, nil
+}
+
+// HealthCheckSteps the workloads of custom cni are unknown, nothing to wait for
+func (runnable *CustomCNIRunnable) HealthCheckSteps(_ []v1.StepNode) ([]v1.Step, error) {
+	return nil, nil
+}
+
+// UninstallSteps remove the cni config files of ConfigPrefixes from the nodes, the other node resources
+// created by custom cni are unknown. The steps run per node, so the applied manifest is deleted from
+// kubernetes by DeleteSteps, which the cluster uninstall and the cni switch run on a master.
+func (runnable *CustomCNIRunnable) UninstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
+	if len(runnable.ConfigPrefixes) == 0 {
+		return nil, nil
+	}
+	step, err := CleanConfig(runnable.ConfigPrefixes, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{step}, nil
+}
+
+func (runnable *CustomCNIRunnable) DeleteSteps(nodes []v1.StepNode, _ string) ([]v1.Step, error) {
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{
+		RenderYaml(CustomCNIType, bytes, nodes),
+		DeleteYaml(filepath.Join(manifestDir, "custom.yaml"), nodes),
+	}, nil
+}
+
+// CmdList cni kubectl cmd list
+func (runnable *CustomCNIRunnable) CmdList(namespace string) map[string]string {
+	namespace = strutil.StringDefaultIfEmpty(namespace, runnable.Namespace)
+	cmdList := make(map[string]string)
+	cmdList["get"] = fmt.Sprintf("kubectl get po -n %s", namespace)
+
+	return cmdList
+}
+
+func (runnable *CustomCNIRunnable) Render(ctx context.Context, opts component.Options) error {
+	if err := os.MkdirAll(manifestDir, 0755); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+	tmpl, err := runnable.loadManifest()
+	if err != nil {
+		return err
+	}
+	manifestFile := filepath.Join(manifestDir, "custom.yaml")
+	return fileutil.WriteFileWithContext(ctx, manifestFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
+		func(w io.Writer) error {
+			return runnable.renderCustomTo(w, tmpl)
+		}, opts.DryRun)
+}
+
+func (runnable *CustomCNIRunnable) renderCustomTo(w io.Writer, tmpl string) error {
+	if err := renderManifestTo(w, tmpl, runnable); err != nil {
+		return fmt.Errorf("render custom cni manifest %s failed:%w", runnable.Manifest, err)
+	}
+	return nil
+}
+
+// CheckManifestStep the step of checking the manifest is loadable and renders to valid kubernetes objects,
+// it runs on the node which renders the manifest before the cluster is changed.
+func (runnable *CustomCNIRunnable) CheckManifestStep(nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&CustomManifestCheck{CustomCNIRunnable: *runnable})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "checkCustomCniManifest",
+		Timeout:    metav1.Duration{Duration: customManifestTimeout + 10*time.Second},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+customManifestCheck, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+var _ component.StepRunnable = (*CustomManifestCheck)(nil)
+
+// CustomManifestCheck load and render the custom cni manifest without writing it, so a malformed
+// or empty manifest fails the operation before any node is changed instead of on kubectl apply.
+type CustomManifestCheck struct {
+	CustomCNIRunnable
+}
+
+func (c *CustomManifestCheck) NewInstance() component.ObjectMeta {
+	return &CustomManifestCheck{}
+}
+
+// Install the check is read-only, so it runs the same with opts.DryRun.
+func (c *CustomManifestCheck) Install(_ context.Context, _ component.Options) ([]byte, error) {
+	tmpl, err := c.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.renderCustomTo(io.Discard, tmpl)
+}
+
+func (c *CustomManifestCheck) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("CustomManifestCheck dose not support uninstall")
+}
+
+// loadManifest read the custom cni manifest from the local file or download it from the url
+func (runnable *CustomCNIRunnable) loadManifest() (string, error) {
+	if runnable.Manifest == "" {
+		return "", fmt.Errorf("the manifest of custom cni is empty")
+	}
+	path := runnable.Manifest
+	if IsManifestURL(path) {
+		path = filepath.Join(manifestDir, "custom.src.yaml")
+		if err := downloader.DownloadURL(runnable.Manifest, path, customManifestTimeout); err != nil {
+			return "", fmt.Errorf("download custom cni manifest %s failed:%w", runnable.Manifest, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read custom cni manifest %s failed:%w", path, err)
+	}
+	return string(data), nil
+}
+
+// IsManifestURL whether the custom cni manifest is a http(s) url
+func IsManifestURL(manifest string) bool {
+	return strings.HasPrefix(manifest, "http://") || strings.HasPrefix(manifest, "https://")
+}
@@ -0,0 +1,99 @@
+package cni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestCustomCNIRunnable_render(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "cni.yaml")
+	require.NoError(t, os.WriteFile(manifest, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cni\ndata:\n  cidr: {{.PodIPv4CIDR}}\n"), 0644))
+
+	stepper := (&CustomCNIRunnable{}).InitStep(&component.ExtraMetadata{}, &v1.CNI{
+		Type:   CustomCNIType,
+		Custom: &v1.CustomCNI{Manifest: manifest},
+	}, &v1.Networking{
+		IPFamily: v1.IPFamilyIPv4,
+		Pods:     v1.NetworkRanges{CIDRBlocks: []string{"172.25.0.0/16"}},
+	}).(*CustomCNIRunnable)
+
+	tmpl, err := stepper.loadManifest()
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	require.NoError(t, stepper.renderCustomTo(w, tmpl))
+	assert.Equal(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cni\ndata:\n  cidr: 172.25.0.0/16\n", w.String())
+
+	steps, err := stepper.InstallSteps([]v1.StepNode{{ID: "1"}}, "v1.27.4")
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	assert.Equal(t, []string{"kubectl", "apply", "-f", filepath.Join(manifestDir, "custom.yaml")}, steps[1].Commands[0].ShellCommand)
+
+	steps, err = stepper.DeleteSteps([]v1.StepNode{{ID: "1"}}, "v1.27.4")
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	assert.Equal(t, []string{"kubectl", "delete", "-f", filepath.Join(manifestDir, "custom.yaml"), "--ignore-not-found"}, steps[1].Commands[0].ShellCommand)
+}
+
+func TestCustomCNIRunnable_render_kubeletDataDir(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "cni.yaml")
+	require.NoError(t, os.WriteFile(manifest, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cni\ndata:\n  path: {{.KubeletDataDir}}/plugins\n"), 0644))
+
+	stepper := (&CustomCNIRunnable{}).InitStep(&component.ExtraMetadata{KubeletDataDir: "/data/kubelet"}, &v1.CNI{
+		Type:   CustomCNIType,
+		Custom: &v1.CustomCNI{Manifest: manifest},
+	}, &v1.Networking{
+		IPFamily: v1.IPFamilyIPv4,
+		Pods:     v1.NetworkRanges{CIDRBlocks: []string{"172.25.0.0/16"}},
+	}).(*CustomCNIRunnable)
+
+	tmpl, err := stepper.loadManifest()
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	require.NoError(t, stepper.renderCustomTo(w, tmpl))
+	assert.Contains(t, w.String(), "path: /data/kubelet/plugins\n")
+}
+
+func TestCustomCNIRunnable_loadManifest_empty(t *testing.T) {
+	_, err := (&CustomCNIRunnable{}).loadManifest()
+	assert.Error(t, err)
+}
+
+func TestCustomManifestCheck_Install(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "cni.yaml")
+	require.NoError(t, os.WriteFile(manifest, []byte("# the manifest is not ready yet\n"), 0644))
+	runnable := &CustomCNIRunnable{Manifest: manifest}
+	step, err := runnable.CheckManifestStep([]v1.StepNode{{ID: "1"}})
+	require.NoError(t, err)
+	check := &CustomManifestCheck{}
+	require.NoError(t, json.Unmarshal(step.Commands[0].CustomCommand, check))
+	assert.Equal(t, manifest, check.Manifest)
+	_, err = check.Install(context.TODO(), component.Options{})
+	assert.Error(t, err, "the manifest without objects should be rejected")
+
+	require.NoError(t, os.WriteFile(manifest, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cni\n"), 0644))
+	_, err = check.Install(context.TODO(), component.Options{})
+	assert.NoError(t, err)
+}
+
+func TestIsManifestURL(t *testing.T) {
+	assert.True(t, IsManifestURL("https://example.com/cni.yaml"))
+	assert.True(t, IsManifestURL("http://10.0.0.1/cni.yaml"))
+	assert.False(t, IsManifestURL("/root/cni.yaml"))
+}
+
+func TestCustomCNIRunnable_CmdList(t *testing.T) {
+	runnable := &CustomCNIRunnable{}
+	assert.Equal(t, "kubectl get po -n kube-system", runnable.CmdList("kube-system")["get"])
+	runnable.Namespace = "cilium"
+	assert.Equal(t, "kubectl get po -n cilium", runnable.CmdList("kube-system")["get"])
+}
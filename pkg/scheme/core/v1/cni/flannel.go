@@ -0,0 +1,228 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+	tmplutil "github.com/kubeclipper/kubeclipper/pkg/utils/template"
+)
+
+const (
+	// FlannelBackendVXLAN vxlan backend
+	FlannelBackendVXLAN = "vxlan"
+	// FlannelBackendHostGW host-gw backend
+	FlannelBackendHostGW = "host-gw"
+)
+
+// flannelConfigPrefixes the cni config files written by the flannel install-cni container
+var flannelConfigPrefixes = []string{"10-flannel"}
+
+func init() {
+	Register(&FlannelRunnable{})
+	component.AddTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat,
+		cniInfo+"-flannel", version, component.TypeTemplate), &FlannelRunnable{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-flannel", version, component.TypeStep), &FlannelRunnable{})
+}
+
+type FlannelRunnable struct {
+	BaseCni
+	Backend string `json:"backend"`
+}
+
+func (runnable *FlannelRunnable) Type() string {
+	return "flannel"
+}
+
+func (runnable *FlannelRunnable) Create() Stepper {
+	return &FlannelRunnable{}
+}
+
+func (runnable *FlannelRunnable) NewInstance() component.ObjectMeta {
+	return &FlannelRunnable{}
+}
+
+func (runnable *FlannelRunnable) InitStep(metadata *component.ExtraMetadata, cni *v1.CNI, networking *v1.Networking) Stepper {
+	stepper := &FlannelRunnable{}
+	stepper.CNI = *cni
+	stepper.LocalRegistry = cni.LocalRegistry
+	stepper.BaseCni.Type = "flannel"
+	stepper.Version = cni.Version
+	stepper.CriType = metadata.CRI
+	stepper.ClusterName = metadata.ClusterName
+	stepper.Offline = cni.Offline
+	stepper.Namespace = strutil.StringDefaultIfEmpty("kube-flannel", cni.Namespace)
+	stepper.setPodCIDRs(networking)
+	stepper.KubeletDataDir = strutil.StringDefaultIfEmpty(kubeletDefaultDataDir, metadata.KubeletDataDir)
+	stepper.Backend = FlannelBackendVXLAN
+	if cni.Flannel != nil && cni.Flannel.Backend != "" {
+		stepper.Backend = cni.Flannel.Backend
+	}
+
+	return stepper
+}
+
+func (runnable *FlannelRunnable) LoadImage(nodes []v1.StepNode) ([]v1.Step, error) {
+	var steps []v1.Step
+	if runnable.useImageRegistrySource() {
+		images, err := renderImages(runnable.renderFlannelTo)
+		if err != nil {
+			return nil, err
+		}
+		runnable.Images = images
+	}
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+
+	if runnable.Offline && runnable.LocalRegistry == "" {
+		return []v1.Step{LoadImage("flannel", bytes, nodes, runnable.ImageLoadConcurrency)}, nil
+	}
+
+	return steps, nil
+}
+
+func (runnable *FlannelRunnable) InstallSteps(nodes []v1.StepNode, kubernetesVersion string) ([]v1.Step, error) {
+	var steps []v1.Step
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+	steps = append(steps, RenderYaml("flannel", bytes, nodes))
+	steps = append(steps, ApplyYaml(filepath.Join(manifestDir, "flannel.yaml"), nodes))
+
+	return steps, nil
+}
+
+func (runnable *FlannelRunnable) HealthCheckSteps(nodes []v1.StepNode) ([]v1.Step, error) {
+	step, err := WaitDaemonSetReady(runnable.Namespace, "kube-flannel-ds", "app=flannel", nodes)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{step}, nil
+}
+
+func (runnable *FlannelRunnable) UninstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+	var steps []v1.Step
+	if runnable.Offline && runnable.LocalRegistry == "" {
+		steps = append(steps, RemoveImage("flannel", bytes, nodes))
+	}
+	steps = append(steps, runnable.clear(nodes)...)
+	cleanStep, err := CleanConfig(flannelConfigPrefixes, nodes)
+	if err != nil {
+		return nil, err
+	}
+	steps = append(steps, cleanStep)
+
+	return steps, nil
+}
+
+func (runnable *FlannelRunnable) DeleteSteps(nodes []v1.StepNode, kubernetesVersion string) ([]v1.Step, error) {
+	bytes, err := json.Marshal(runnable)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{
+		RenderYaml("flannel", bytes, nodes),
+		DeleteYaml(filepath.Join(manifestDir, "flannel.yaml"), nodes),
+	}, nil
+}
+
+func (runnable *FlannelRunnable) clear(nodes []v1.StepNode) []v1.Step {
+	var steps []v1.Step
+	if runnable.Backend != FlannelBackendHostGW {
+		steps = append(steps, v1.Step{
+			ID:         strutil.GetUUID(),
+			Name:       "removeVtep",
+			Timeout:    metav1.Duration{Duration: 5 * time.Second},
+			ErrIgnore:  true,
+			Nodes:      nodes,
+			Action:     v1.ActionUninstall,
+			RetryTimes: 1,
+			Commands: []v1.Command{
+				{
+					Type:         v1.CommandShell,
+					ShellCommand: []string{"ip", "link", "delete", "flannel.1"},
+				},
+			},
+		})
+	}
+	// remove the cni bridge created by the flannel delegate plugin
+	steps = append(steps, v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "removeCniBridge",
+		Timeout:    metav1.Duration{Duration: 5 * time.Second},
+		ErrIgnore:  true,
+		Nodes:      nodes,
+		Action:     v1.ActionUninstall,
+		RetryTimes: 1,
+		Commands: []v1.Command{
+			{
+				Type:         v1.CommandShell,
+				ShellCommand: []string{"ip", "link", "delete", "cni0"},
+			},
+		},
+	})
+
+	return steps
+}
+
+// CmdList cni kubectl cmd list
+func (runnable *FlannelRunnable) CmdList(namespace string) map[string]string {
+	namespace = strutil.StringDefaultIfEmpty(namespace, runnable.Namespace)
+	cmdList := make(map[string]string)
+	cmdList["get"] = fmt.Sprintf("kubectl get po -n %s | grep flannel", namespace)
+	cmdList["restart"] = fmt.Sprintf("kubectl rollout restart ds kube-flannel-ds -n %s", namespace)
+
+	return cmdList
+}
+
+func (runnable *FlannelRunnable) Render(ctx context.Context, opts component.Options) error {
+	if err := os.MkdirAll(manifestDir, 0755); err != nil {
+		return err
+	}
+	manifestFile := filepath.Join(manifestDir, "flannel.yaml")
+	return fileutil.WriteFileWithContext(ctx, manifestFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
+		runnable.renderFlannelTo, opts.DryRun)
+}
+
+func (runnable *FlannelRunnable) renderFlannelTo(w io.Writer) error {
+	at := tmplutil.New()
+	flannelTemp, err := runnable.FlannelTemplate()
+	if err != nil {
+		return err
+	}
+	if _, err := at.RenderTo(w, flannelTemp, runnable); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (runnable *FlannelRunnable) FlannelTemplate() (string, error) {
+	switch runnable.Backend {
+	case FlannelBackendVXLAN, FlannelBackendHostGW:
+	default:
+		return "", fmt.Errorf("flannel dose not support backend: %s", runnable.Backend)
+	}
+	switch runnable.Version {
+	case "v0.22.0":
+		return flannelV0220, nil
+	}
+	return "", fmt.Errorf("flannel dose not support version: %s", runnable.Version)
+}
@@ -0,0 +1,91 @@
+package cni
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/constatns"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestCNI_renderFlannelTo(t *testing.T) {
+	tests := []struct {
+		name        string
+		stepper     FlannelRunnable
+		wantBackend string
+		wantErr     bool
+	}{
+		{
+			name: "vxlan",
+			stepper: FlannelRunnable{
+				BaseCni: BaseCni{
+					PodIPv4CIDR: constatns.ClusterPodSubnet,
+					CNI: v1.CNI{
+						LocalRegistry: "172.0.0.1:5000",
+						Type:          "flannel",
+						Version:       "v0.22.0",
+						Namespace:     "kube-flannel",
+					},
+				},
+				Backend: FlannelBackendVXLAN,
+			},
+			wantBackend: `"Type": "vxlan"`,
+		},
+		{
+			name: "host-gw",
+			stepper: FlannelRunnable{
+				BaseCni: BaseCni{
+					PodIPv4CIDR: constatns.ClusterPodSubnet,
+					CNI: v1.CNI{
+						Type:      "flannel",
+						Version:   "v0.22.0",
+						Namespace: "kube-flannel",
+					},
+				},
+				Backend: FlannelBackendHostGW,
+			},
+			wantBackend: `"Type": "host-gw"`,
+		},
+		{
+			name: "unsupported backend",
+			stepper: FlannelRunnable{
+				BaseCni: BaseCni{
+					PodIPv4CIDR: constatns.ClusterPodSubnet,
+					CNI: v1.CNI{
+						Type:    "flannel",
+						Version: "v0.22.0",
+					},
+				},
+				Backend: "udp",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			err := tt.stepper.renderFlannelTo(w)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderFlannelTo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.Contains(w.String(), tt.wantBackend) {
+				t.Errorf("renderFlannelTo() backend not rendered, want %s", tt.wantBackend)
+			}
+			if !strings.Contains(w.String(), `"Network": "`+constatns.ClusterPodSubnet+`"`) {
+				t.Errorf("renderFlannelTo() pod cidr not rendered")
+			}
+		})
+	}
+}
+
+func TestFlannelRunnable_CmdList(t *testing.T) {
+	cmds := (&FlannelRunnable{}).CmdList("kube-flannel")
+	if cmds["restart"] != "kubectl rollout restart ds kube-flannel-ds -n kube-flannel" {
+		t.Errorf("unexpected restart cmd: %s", cmds["restart"])
+	}
+}
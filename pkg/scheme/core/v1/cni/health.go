@@ -0,0 +1,123 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	daemonSetChecker = "daemonSetChecker"
+	// daemonSetReadyTimeout the default timeout of waiting for the cni daemonset ready on all nodes
+	daemonSetReadyTimeout = 5 * time.Minute
+	// daemonSetPollInterval the interval of waiting for the cni daemonset created, e.g. by the tigera operator
+	daemonSetPollInterval = 5 * time.Second
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+daemonSetChecker, version, component.TypeStep), &DaemonSetChecker{})
+}
+
+var _ component.StepRunnable = (*DaemonSetChecker)(nil)
+
+// runKubectl run kubectl, replaced in tests
+var runKubectl = cmdutil.RunKubectlWithContext
+
+// DaemonSetChecker waits for the cni daemonset ready on all nodes, the operation fails
+// with the status of the cni pods if the daemonset is not ready in time.
+type DaemonSetChecker struct {
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	Selector  string        `json:"selector"`
+	Timeout   time.Duration `json:"timeout"`
+}
+
+func (c *DaemonSetChecker) NewInstance() component.ObjectMeta {
+	return &DaemonSetChecker{}
+}
+
+func (c *DaemonSetChecker) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	if opts.DryRun {
+		return nil, nil
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = daemonSetReadyTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	// the daemonset may be created asynchronously, e.g. calico-node is created by the tigera operator
+	for {
+		if _, err := runKubectl(ctx, false, "get", "ds", c.Name, "-n", c.Namespace); err == nil {
+			break
+		} else if time.Now().Add(daemonSetPollInterval).After(deadline) {
+			return nil, c.notReadyError(ctx, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(daemonSetPollInterval):
+		}
+	}
+	remaining := time.Until(deadline).Round(time.Second)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+	if _, err := runKubectl(ctx, false, "rollout", "status", "ds/"+c.Name, "-n", c.Namespace,
+		fmt.Sprintf("--timeout=%s", remaining)); err != nil {
+		return nil, c.notReadyError(ctx, err)
+	}
+	logger.Infof("cni daemonset %s/%s is ready", c.Namespace, c.Name)
+	return nil, nil
+}
+
+func (c *DaemonSetChecker) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("DaemonSetChecker dose not support uninstall")
+}
+
+// notReadyError wrap the cause with the status of the cni pods
+func (c *DaemonSetChecker) notReadyError(ctx context.Context, cause error) error {
+	pods, err := runKubectl(ctx, false, "get", "po", "-n", c.Namespace, "-l", c.Selector, "-o", "wide")
+	if err != nil {
+		pods = fmt.Sprintf("get pods failed: %v", err)
+	}
+	return fmt.Errorf("cni daemonset %s/%s is not ready:%w\n%s", c.Namespace, c.Name, cause, pods)
+}
+
+// WaitDaemonSetReady the post-install step of waiting for the cni daemonset ready
+func WaitDaemonSetReady(namespace, name, selector string, nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&DaemonSetChecker{
+		Namespace: namespace,
+		Name:      name,
+		Selector:  selector,
+		Timeout:   daemonSetReadyTimeout,
+	})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "waitCniReady",
+		Timeout:    metav1.Duration{Duration: daemonSetReadyTimeout + time.Minute},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+daemonSetChecker, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
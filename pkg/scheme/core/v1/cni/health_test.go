@@ -0,0 +1,82 @@
+package cni
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+)
+
+func fakeKubectl(t *testing.T, fn func(args []string) (string, error)) *[]string {
+	var calls []string
+	origin := runKubectl
+	runKubectl = func(_ context.Context, _ bool, args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return fn(args)
+	}
+	t.Cleanup(func() { runKubectl = origin })
+	return &calls
+}
+
+func TestDaemonSetChecker_Install(t *testing.T) {
+	c := &DaemonSetChecker{Namespace: "kube-system", Name: "calico-node", Selector: "k8s-app=calico-node", Timeout: time.Minute}
+	calls := fakeKubectl(t, func(args []string) (string, error) {
+		return "", nil
+	})
+	_, err := c.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "get ds calico-node -n kube-system", (*calls)[0])
+	assert.True(t, strings.HasPrefix((*calls)[1], "rollout status ds/calico-node -n kube-system --timeout="), (*calls)[1])
+}
+
+func TestDaemonSetChecker_Install_notReady(t *testing.T) {
+	c := &DaemonSetChecker{Namespace: "kube-system", Name: "calico-node", Selector: "k8s-app=calico-node", Timeout: time.Minute}
+	fakeKubectl(t, func(args []string) (string, error) {
+		switch args[0] {
+		case "rollout":
+			return "", errors.New("timed out waiting for the condition")
+		case "get":
+			if args[1] == "po" {
+				return "calico-node-abcde   0/1   CrashLoopBackOff   5   node1", nil
+			}
+		}
+		return "", nil
+	})
+	_, err := c.Install(context.TODO(), component.Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out waiting for the condition")
+	assert.Contains(t, err.Error(), "CrashLoopBackOff")
+}
+
+func TestDaemonSetChecker_Install_notCreated(t *testing.T) {
+	c := &DaemonSetChecker{Namespace: "calico-system", Name: "calico-node", Selector: "k8s-app=calico-node", Timeout: time.Second}
+	fakeKubectl(t, func(args []string) (string, error) {
+		if args[1] == "ds" {
+			return "", errors.New(`daemonsets.apps "calico-node" not found`)
+		}
+		return "No resources found", nil
+	})
+	_, err := c.Install(context.TODO(), component.Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestHealthCheckSteps(t *testing.T) {
+	calico := &CalicoRunnable{BaseCni: BaseCni{}}
+	calico.Namespace = "calico-system"
+	steps, err := calico.HealthCheckSteps(nil)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	assert.Equal(t, "waitCniReady", steps[0].Name)
+	assert.Contains(t, string(steps[0].Commands[0].CustomCommand), `"namespace":"calico-system"`)
+
+	steps, err = (&CustomCNIRunnable{}).HealthCheckSteps(nil)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+}
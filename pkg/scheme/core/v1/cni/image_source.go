@@ -0,0 +1,142 @@
+package cni
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/simple/downloader"
+)
+
+// imageSourceDownloadTimeout the timeout of download the image tarball from the image source
+const imageSourceDownloadTimeout = 5 * time.Minute
+
+// manifestImageRegex matches the image of containers in the manifest, e.g. `image: calico/node:v3.22.4`
+var manifestImageRegex = regexp.MustCompile(`(?m)^\s*-?\s*image:\s*["']?([^"'\s]+)["']?\s*$`)
+
+// IsImageSourceURL whether the cni image source is the http(s) url of the image tarball,
+// otherwise it is the address of an image registry.
+func IsImageSourceURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// useImageRegistrySource whether the offline cni images are pulled from the image registry source
+func (runnable *BaseCni) useImageRegistrySource() bool {
+	return runnable.Offline && runnable.LocalRegistry == "" && runnable.ImageSource != "" &&
+		!IsImageSourceURL(runnable.ImageSource)
+}
+
+// ValidateImageSource check the cni image source, it only takes effect on offline install without local registry.
+func ValidateImageSource(c *v1.CNI) error {
+	if c.ImageSource == "" {
+		return nil
+	}
+	if IsImageSourceURL(c.ImageSource) {
+		if _, err := url.ParseRequestURI(c.ImageSource); err != nil {
+			return fmt.Errorf("invalid cni image source %s:%w", c.ImageSource, err)
+		}
+		return nil
+	}
+	if strings.Contains(c.ImageSource, "://") || strings.ContainsAny(c.ImageSource, " \t") {
+		return fmt.Errorf("invalid cni image source %s, must be a http(s) url or an image registry address", c.ImageSource)
+	}
+	// the images of the tigera operator chart are not listed in the manifest
+	if c.Type == "calico" && c.Version == "v3.26.1" {
+		return fmt.Errorf("calico %s dose not support pulling images from the image registry source", c.Version)
+	}
+	return nil
+}
+
+// manifestImages returns the sorted images referenced by the manifest
+func manifestImages(manifest string) []string {
+	set := make(map[string]struct{})
+	for _, m := range manifestImageRegex.FindAllStringSubmatch(manifest, -1) {
+		set[m[1]] = struct{}{}
+	}
+	images := make([]string, 0, len(set))
+	for image := range set {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// renderImages render the manifest by render and returns the images referenced by it
+func renderImages(render func(w io.Writer) error) ([]string, error) {
+	buf := &bytes.Buffer{}
+	if err := render(buf); err != nil {
+		return nil, fmt.Errorf("render manifest for the cni images failed:%w", err)
+	}
+	return manifestImages(buf.String()), nil
+}
+
+// Images returns the images referenced by the manifest of the cni, they are in their own registries
+// instead of the local registry, so they can be synced into the local registry.
+func Images(metadata *component.ExtraMetadata, c *v1.CNI, networking *v1.Networking) ([]string, error) {
+	factory, err := Load(c.Type)
+	if err != nil {
+		return nil, err
+	}
+	origin := *c
+	origin.LocalRegistry = ""
+	switch stepper := factory.Create().InitStep(metadata, &origin, networking).(type) {
+	case *CalicoRunnable:
+		// the images of the tigera operator chart are not listed in the manifest
+		if stepper.operatorManaged() {
+			return nil, fmt.Errorf("calico %s dose not support listing images", c.Version)
+		}
+		return renderImages(stepper.renderCalicoTo)
+	case *FlannelRunnable:
+		return renderImages(stepper.renderFlannelTo)
+	default:
+		return nil, fmt.Errorf("%s cni dose not support listing images", c.Type)
+	}
+}
+
+// sourceImage the image in the registry source, e.g. calico/node:v3.22.4 in the
+// registry 10.0.0.1:5000 is 10.0.0.1:5000/calico/node:v3.22.4
+func sourceImage(source, image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	return strings.TrimSuffix(source, "/") + "/" + image
+}
+
+// loadImagesFromSource load the cni images from the central image source, the image tarball is
+// downloaded from the url, or the images are pulled from the registry and tagged as the manifest references.
+func (runnable *BaseCni) loadImagesFromSource(ctx context.Context, dryRun bool) error {
+	if IsImageSourceURL(runnable.ImageSource) {
+		u, err := url.Parse(runnable.ImageSource)
+		if err != nil {
+			return fmt.Errorf("invalid cni image source %s:%w", runnable.ImageSource, err)
+		}
+		dstFile := filepath.Join(manifestDir, fmt.Sprintf("%s-%s-%s", runnable.Type, runnable.Version, path.Base(u.Path)))
+		if !dryRun {
+			if err = os.MkdirAll(manifestDir, 0755); err != nil {
+				return err
+			}
+			if err = downloader.DownloadURL(runnable.ImageSource, dstFile, imageSourceDownloadTimeout); err != nil {
+				return fmt.Errorf("download cni images from %s failed:%w", runnable.ImageSource, err)
+			}
+		}
+		return utils.LoadImage(ctx, dryRun, dstFile, runnable.CriType)
+	}
+	for i, image := range runnable.Images {
+		if err := utils.PullImage(ctx, dryRun, sourceImage(runnable.ImageSource, image), image, runnable.CriType); err != nil {
+			return err
+		}
+		logger.FromContext(ctx).Infof("cni image %s pulled from %s (%d/%d)", image, runnable.ImageSource, i+1, len(runnable.Images))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cni
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestManifestImages(t *testing.T) {
+	manifest := `
+containers:
+  - name: node
+    image: calico/node:v3.22.4
+  - image: "docker.io/calico/cni:v3.22.4"
+    name: cni
+  - name: install-cni
+    image: calico/cni:v3.22.4
+    imagePullPolicy: IfNotPresent
+`
+	assert.Equal(t, []string{"calico/cni:v3.22.4", "calico/node:v3.22.4", "docker.io/calico/cni:v3.22.4"}, manifestImages(manifest))
+}
+
+func TestSourceImage(t *testing.T) {
+	assert.Equal(t, "10.0.0.1:5000/calico/node:v3.22.4", sourceImage("10.0.0.1:5000", "calico/node:v3.22.4"))
+	assert.Equal(t, "10.0.0.1:5000/mirror/calico/node:v3.22.4", sourceImage("10.0.0.1:5000/mirror/", "docker.io/calico/node:v3.22.4"))
+}
+
+func TestValidateImageSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		cni     v1.CNI
+		wantErr bool
+	}{
+		{name: "unset", cni: v1.CNI{Type: "calico", Version: "v3.22.4"}},
+		{name: "url", cni: v1.CNI{Type: "calico", Version: "v3.22.4", ImageSource: "http://10.0.0.1:8080/calico/images.tar"}},
+		{name: "registry", cni: v1.CNI{Type: "calico", Version: "v3.22.4", ImageSource: "10.0.0.1:5000"}},
+		{name: "unsupported scheme", cni: v1.CNI{Type: "calico", Version: "v3.22.4", ImageSource: "nfs://10.0.0.1/images"}, wantErr: true},
+		{name: "registry of operator", cni: v1.CNI{Type: "calico", Version: "v3.26.1", ImageSource: "10.0.0.1:5000"}, wantErr: true},
+		{name: "url of operator", cni: v1.CNI{Type: "calico", Version: "v3.26.1", ImageSource: "https://10.0.0.1/images.tar"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateImageSource(&tt.cni)
+			assert.Equal(t, tt.wantErr, err != nil, "ValidateImageSource() error = %v", err)
+		})
+	}
+}
+
+func TestCalicoRunnable_LoadImage_imageSource(t *testing.T) {
+	stepper := CalicoRunnable{
+		BaseCni: BaseCni{
+			PodIPv4CIDR: "172.25.0.0/16",
+			CNI: v1.CNI{
+				Type:        "calico",
+				Version:     "v3.22.4",
+				Offline:     true,
+				Namespace:   "kube-system",
+				ImageSource: "10.0.0.1:5000",
+				Calico: &v1.Calico{
+					IPv4AutoDetection: "first-found",
+					Mode:              CalicoNetworkIPIPAll,
+					MTU:               1440,
+				},
+			},
+		},
+	}
+	stepper.NodeAddressDetectionV4, _ = ParseNodeAddressDetection(stepper.Calico.IPv4AutoDetection)
+	steps, err := stepper.LoadImage([]v1.StepNode{{ID: "1"}})
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+
+	got := &CalicoRunnable{}
+	require.NoError(t, json.Unmarshal(steps[0].Commands[0].CustomCommand, got))
+	assert.Contains(t, got.Images, "calico/node:v3.22.4")
+	assert.Contains(t, got.Images, "calico/cni:v3.22.4")
+	assert.Contains(t, got.Images, "calico/kube-controllers:v3.22.4")
+}
+
+func TestImages(t *testing.T) {
+	metadata := &component.ExtraMetadata{KubeVersion: "v1.23.6"}
+	networking := &v1.Networking{IPFamily: v1.IPFamilyIPv4, Pods: v1.NetworkRanges{CIDRBlocks: []string{"172.25.0.0/16"}}}
+
+	images, err := Images(metadata, &v1.CNI{
+		Type:          "calico",
+		Version:       "v3.22.4",
+		LocalRegistry: "10.0.0.1:5000",
+		Calico:        &v1.Calico{IPv4AutoDetection: "first-found", Mode: CalicoNetworkIPIPAll, MTU: 1440},
+	}, networking)
+	require.NoError(t, err)
+	assert.Contains(t, images, "calico/node:v3.22.4")
+	assert.Contains(t, images, "calico/cni:v3.22.4")
+	for _, image := range images {
+		assert.NotContains(t, image, "10.0.0.1:5000", "the images should not be in the local registry")
+	}
+
+	images, err = Images(metadata, &v1.CNI{Type: "flannel", Version: "v0.22.0", LocalRegistry: "10.0.0.1:5000"}, networking)
+	require.NoError(t, err)
+	assert.Contains(t, images, "docker.io/flannel/flannel:v0.22.0")
+
+	_, err = Images(metadata, &v1.CNI{Type: "calico", Version: "v3.26.1", Calico: &v1.Calico{}}, networking)
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package cni
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	tmplutil "github.com/kubeclipper/kubeclipper/pkg/utils/template"
+)
+
+// ValidateManifest check the manifest is well-formed multi-doc yaml with at least one object,
+// each non-empty doc must be a kubernetes object with apiVersion, kind and metadata.name.
+func ValidateManifest(data []byte) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	objects := 0
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) && objects == 0 {
+				return fmt.Errorf("manifest has no kubernetes object")
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read manifest doc %d failed:%w", i, err)
+		}
+		content := map[string]interface{}{}
+		if err = yaml.Unmarshal(doc, &content); err != nil {
+			return fmt.Errorf("decode manifest doc %d failed:%w", i, err)
+		}
+		// empty or comment only doc
+		if len(content) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: content}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			return fmt.Errorf("manifest doc %d is invalid, apiVersion:%q kind:%q metadata.name:%q must not be empty",
+				i, obj.GetAPIVersion(), obj.GetKind(), obj.GetName())
+		}
+		objects++
+	}
+}
+
+// renderManifestTo render the manifest template and validate it before writes to w,
+// so a template bug fails the render instead of shipping a broken manifest.
+func renderManifestTo(w io.Writer, tmpl string, vars interface{}) error {
+	out, err := tmplutil.New().Render(tmpl, vars)
+	if err != nil {
+		return err
+	}
+	if err = ValidateManifest([]byte(out)); err != nil {
+		return fmt.Errorf("rendered manifest is invalid:%w", err)
+	}
+	_, err = w.Write([]byte(out))
+	return err
+}
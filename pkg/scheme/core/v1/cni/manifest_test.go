@@ -0,0 +1,66 @@
+package cni
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		wantErr  bool
+	}{
+		{
+			name:     "valid multi docs",
+			manifest: "---\n# comment only doc\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: calico-config\n---\napiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: calico-node\n",
+		},
+		{
+			name:     "broken yaml",
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: calico-config\ndata:\n  key: \"value\n    bad: [\n",
+			wantErr:  true,
+		},
+		{
+			name:     "no object",
+			manifest: "---\n# comment only doc\n",
+			wantErr:  true,
+		},
+		{
+			name:     "missing kind",
+			manifest: "apiVersion: v1\nmetadata:\n  name: calico-config\n",
+			wantErr:  true,
+		},
+		{
+			name:     "missing name",
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  namespace: kube-system\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateManifest([]byte(tt.manifest))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_renderManifestTo_malformedTemplate(t *testing.T) {
+	// the kind is rendered from an empty field and the name is lost by a bad indentation
+	tmpl := "apiVersion: v1\nkind: {{.Kind}}\nmetadata:\nname: {{.Name}}\n"
+	w := &bytes.Buffer{}
+	err := renderManifestTo(w, tmpl, struct{ Kind, Name string }{Name: "calico-config"})
+	assert.Error(t, err)
+	assert.Empty(t, w.String(), "invalid manifest should not be written")
+
+	w.Reset()
+	tmpl = "apiVersion: v1\nkind: {{.Kind}}\nmetadata:\n  name: {{.Name}}\n"
+	err = renderManifestTo(w, tmpl, struct{ Kind, Name string }{Kind: "ConfigMap", Name: "calico-config"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, w.String())
+}
@@ -0,0 +1,146 @@
+package cni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/initsystem"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	networkManagerConfigurer = "networkManagerConfigurer"
+	networkManagerService    = "NetworkManager"
+	// calicoNetworkManagerConfig the NetworkManager config of ignoring the calico interfaces
+	calicoNetworkManagerConfig = "/etc/NetworkManager/conf.d/calico.conf"
+)
+
+// calicoNetworkManagerConfigContent the recommended NetworkManager config of calico, NetworkManager
+// manipulates the routing table of the interfaces it manages, which interferes with calico.
+// https://docs.tigera.io/calico/latest/operations/troubleshoot/troubleshooting#configure-networkmanager
+const calicoNetworkManagerConfigContent = `[keyfile]
+unmanaged-devices=interface-name:cali*;interface-name:tunl*;interface-name:vxlan.calico;interface-name:vxlan-v6.calico;interface-name:wireguard.cali;interface-name:wg-v6.cali
+`
+
+var (
+	// networkManagerActive whether NetworkManager is running on the node, replaced in tests
+	networkManagerActive = func() bool {
+		initSystem, err := initsystem.GetInitSystem()
+		if err != nil {
+			return false
+		}
+		return initSystem.ServiceIsActive(networkManagerService)
+	}
+	// reloadNetworkManager reload the NetworkManager configs, replaced in tests
+	reloadNetworkManager = func(ctx context.Context) error {
+		_, err := cmdutil.RunCmdWithContext(ctx, false, "systemctl", "reload", networkManagerService)
+		return err
+	}
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+networkManagerConfigurer, version, component.TypeStep), &NetworkManagerConfigurer{})
+}
+
+var _ component.StepRunnable = (*NetworkManagerConfigurer)(nil)
+
+// NetworkManagerConfigurer tells NetworkManager to ignore the calico interfaces, otherwise
+// NetworkManager may grab the cali* and vxlan.calico interfaces and make them flapping.
+// It only takes effect on the nodes NetworkManager is active.
+type NetworkManagerConfigurer struct {
+	ConfigFile string `json:"configFile"`
+}
+
+func (c *NetworkManagerConfigurer) NewInstance() component.ObjectMeta {
+	return &NetworkManagerConfigurer{}
+}
+
+func (c *NetworkManagerConfigurer) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	if !networkManagerActive() {
+		logger.Debug("NetworkManager is not active, skip configuring it to ignore calico interfaces")
+		return nil, nil
+	}
+	file := strutil.StringDefaultIfEmpty(calicoNetworkManagerConfig, c.ConfigFile)
+	if data, err := os.ReadFile(file); err == nil && bytes.Equal(data, []byte(calicoNetworkManagerConfigContent)) {
+		return nil, nil
+	}
+	logger.Warnf("NetworkManager is active, write %s to make it ignore calico interfaces", file)
+	if opts.DryRun {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(file, []byte(calicoNetworkManagerConfigContent), 0644); err != nil {
+		return nil, fmt.Errorf("write NetworkManager config %s failed:%w", file, err)
+	}
+	if err := reloadNetworkManager(ctx); err != nil {
+		return nil, fmt.Errorf("reload NetworkManager failed:%w", err)
+	}
+	return nil, nil
+}
+
+func (c *NetworkManagerConfigurer) Uninstall(ctx context.Context, opts component.Options) ([]byte, error) {
+	file := strutil.StringDefaultIfEmpty(calicoNetworkManagerConfig, c.ConfigFile)
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if opts.DryRun {
+		return nil, nil
+	}
+	if err := os.Remove(file); err != nil {
+		return nil, fmt.Errorf("remove NetworkManager config %s failed:%w", file, err)
+	}
+	logger.Infof("remove NetworkManager config %s", file)
+	if networkManagerActive() {
+		if err := reloadNetworkManager(ctx); err != nil {
+			return nil, fmt.Errorf("reload NetworkManager failed:%w", err)
+		}
+	}
+	return nil, nil
+}
+
+// ConfigNetworkManager the step of configuring NetworkManager to ignore the calico interfaces on install,
+// and removing the config on uninstall.
+func ConfigNetworkManager(nodes []v1.StepNode, action v1.StepAction) (v1.Step, error) {
+	bytes, err := json.Marshal(&NetworkManagerConfigurer{
+		ConfigFile: calicoNetworkManagerConfig,
+	})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "configNetworkManager",
+		Timeout:    metav1.Duration{Duration: 30 * time.Second},
+		ErrIgnore:  true,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     action,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+networkManagerConfigurer, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+// NeedNetworkManagerConfig whether the cni nodes need to configure NetworkManager before install
+func NeedNetworkManagerConfig(c *v1.CNI) bool {
+	return c.Type == "calico"
+}
@@ -0,0 +1,63 @@
+package cni
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+)
+
+func fakeNetworkManager(t *testing.T, active bool) *int {
+	reloads := 0
+	originActive, originReload := networkManagerActive, reloadNetworkManager
+	networkManagerActive = func() bool { return active }
+	reloadNetworkManager = func(_ context.Context) error {
+		reloads++
+		return nil
+	}
+	t.Cleanup(func() { networkManagerActive, reloadNetworkManager = originActive, originReload })
+	return &reloads
+}
+
+func TestNetworkManagerConfigurer_Install(t *testing.T) {
+	reloads := fakeNetworkManager(t, true)
+	file := filepath.Join(t.TempDir(), "conf.d", "calico.conf")
+	c := &NetworkManagerConfigurer{ConfigFile: file}
+
+	_, err := c.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "interface-name:cali*")
+	assert.Contains(t, string(data), "interface-name:vxlan.calico")
+	assert.Equal(t, 1, *reloads)
+
+	// the config is up to date, no need to reload
+	_, err = c.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, *reloads)
+
+	_, err = c.Uninstall(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	assert.NoFileExists(t, file)
+	assert.Equal(t, 2, *reloads)
+}
+
+func TestNetworkManagerConfigurer_Install_inactive(t *testing.T) {
+	reloads := fakeNetworkManager(t, false)
+	file := filepath.Join(t.TempDir(), "calico.conf")
+	c := &NetworkManagerConfigurer{ConfigFile: file}
+
+	_, err := c.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	assert.NoFileExists(t, file)
+	assert.Equal(t, 0, *reloads)
+
+	_, err = c.Uninstall(context.TODO(), component.Options{})
+	require.NoError(t, err)
+}
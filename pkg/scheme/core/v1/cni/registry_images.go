@@ -0,0 +1,192 @@
+package cni
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/reference/docker"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	registryImageVerifier = "registryImageVerifier"
+	// registryImageTimeout the timeout of checking one image manifest in the registry
+	registryImageTimeout = 10 * time.Second
+)
+
+// manifestMediaTypes the manifest media types accepted on checking the image exists
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+registryImageVerifier, version, component.TypeStep), &RegistryImageVerifier{})
+}
+
+var _ component.StepRunnable = (*RegistryImageVerifier)(nil)
+
+// RegistryImageVerifier checks the cni images exist in the local registry by the registry api,
+// so the install fails early with the missing images instead of the pods in ImagePullBackOff.
+type RegistryImageVerifier struct {
+	Images []string `json:"images"`
+	// Registries the registries of the images with credentials
+	Registries []v1.RegistrySpec `json:"registries,omitempty"`
+}
+
+func (v *RegistryImageVerifier) NewInstance() component.ObjectMeta {
+	return &RegistryImageVerifier{}
+}
+
+// Install the check is read-only, so it runs the same with opts.DryRun.
+func (v *RegistryImageVerifier) Install(ctx context.Context, _ component.Options) ([]byte, error) {
+	var missing []string
+	for _, image := range v.Images {
+		exists, err := v.imageExists(ctx, image)
+		if err != nil {
+			// e.g. the registry requires credentials, leave it to the image pull
+			logger.Warnf("cannot verify image %s in registry: %v", image, err)
+			continue
+		}
+		if !exists {
+			missing = append(missing, image)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("cni images not found in local registry: %s", strings.Join(missing, ", "))
+	}
+	return nil, nil
+}
+
+func (v *RegistryImageVerifier) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("RegistryImageVerifier dose not support uninstall")
+}
+
+// imageExists check the image by the resolver of its registry with the credentials,
+// the image of the registry without credentials is checked anonymously.
+func (v *RegistryImageVerifier) imageExists(ctx context.Context, image string) (bool, error) {
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return false, fmt.Errorf("invalid image %s:%w", image, err)
+	}
+	r, ok := v.registryOf(docker.Domain(named))
+	if !ok {
+		return registryImageExists(ctx, image, registryImageTimeout)
+	}
+	resolver, err := cri.RegistryResolver(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, registryImageTimeout)
+	defer cancel()
+	if _, _, err = resolver.Resolve(ctx, named.String()); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// registryOf the registry of the host with credentials
+func (v *RegistryImageVerifier) registryOf(host string) (v1.RegistrySpec, bool) {
+	for _, r := range v.Registries {
+		if strings.EqualFold(r.Host, host) {
+			return r, true
+		}
+	}
+	return v1.RegistrySpec{}, false
+}
+
+// registryImageExists HEAD the manifest of image in its registry, https is tried before http as containerd
+// does for the local registry. The cert is not verified since no credential is sent and no content is read.
+func registryImageExists(ctx context.Context, image string, timeout time.Duration) (bool, error) {
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return false, fmt.Errorf("invalid image %s:%w", image, err)
+	}
+	ref := "latest"
+	if tagged, ok := named.(docker.Tagged); ok {
+		ref = tagged.Tag()
+	}
+	if digested, ok := named.(docker.Digested); ok {
+		ref = digested.Digest().String()
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+
+	var lastErr error
+	for _, scheme := range []string{"https", "http"} {
+		url := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, docker.Domain(named), docker.Path(named), ref)
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusNotFound:
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+		}
+	}
+	return false, fmt.Errorf("registry %s unreachable:%w", docker.Domain(named), lastErr)
+}
+
+// VerifyRegistryImages the step of checking the cni images in the local registry on the nodes,
+// one node is enough since all nodes pull from the same registry.
+// The images are checked with the credentials of the registries if they have.
+func VerifyRegistryImages(images []string, registries []v1.RegistrySpec, nodes []v1.StepNode) (v1.Step, error) {
+	verifier := &RegistryImageVerifier{Images: images}
+	for _, r := range registries {
+		if r.Username != "" {
+			verifier.Registries = append(verifier.Registries, r)
+		}
+	}
+	bytes, err := json.Marshal(verifier)
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "cniImageVerifier",
+		Timeout:    metav1.Duration{Duration: time.Duration(2*len(images)+1) * registryImageTimeout},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+registryImageVerifier, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,101 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+// fakeRegistry serves the manifests of the images, the other manifests are not found
+func fakeRegistry(images ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, image := range images {
+			if r.Method == http.MethodHead && r.URL.Path == "/v2/"+image {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
+
+func TestRegistryImageVerifier_Install(t *testing.T) {
+	handler := fakeRegistry("calico/node/manifests/v3.22.4", "calico/cni/manifests/v3.22.4")
+	for name, server := range map[string]*httptest.Server{
+		"https": httptest.NewTLSServer(handler),
+		"http":  httptest.NewServer(handler),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer server.Close()
+			host := strings.TrimPrefix(strings.TrimPrefix(server.URL, "https://"), "http://")
+			v := &RegistryImageVerifier{Images: []string{host + "/calico/node:v3.22.4", host + "/calico/cni:v3.22.4"}}
+			if _, err := v.Install(context.TODO(), component.Options{}); err != nil {
+				t.Errorf("Install() error = %v", err)
+			}
+
+			v.Images = append(v.Images, host+"/calico/kube-controllers:v3.22.4")
+			_, err := v.Install(context.TODO(), component.Options{})
+			if err == nil || !strings.Contains(err.Error(), host+"/calico/kube-controllers:v3.22.4") ||
+				strings.Contains(err.Error(), "calico/node") {
+				t.Errorf("Install() should fail with only the missing image, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistryImageVerifier_Install_unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	v := &RegistryImageVerifier{Images: []string{strings.TrimPrefix(server.URL, "http://") + "/calico/node:v3.22.4"}}
+	if _, err := v.Install(context.TODO(), component.Options{}); err != nil {
+		t.Errorf("Install() should leave the unverifiable image to the image pull, got %v", err)
+	}
+}
+
+func TestRegistryImageVerifier_Install_credentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "passw0rd" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/calico/node/manifests/v3.22.4" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+		w.Header().Set("Content-Length", "2")
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	registries := []v1.RegistrySpec{{Scheme: "http", Host: host, Username: "admin", Password: "passw0rd"}, {Scheme: "http", Host: "10.0.0.1:5000"}}
+	step, err := VerifyRegistryImages([]string{host + "/calico/node:v3.22.4"}, registries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &RegistryImageVerifier{}
+	if err = json.Unmarshal(step.Commands[0].CustomCommand, v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Registries) != 1 || v.Registries[0].Host != host {
+		t.Fatalf("VerifyRegistryImages() want only the registry with credentials, got %+v", v.Registries)
+	}
+
+	ctx := context.TODO()
+	if _, err = v.Install(ctx, component.Options{}); err != nil {
+		t.Errorf("Install() error = %v", err)
+	}
+	v.Images = append(v.Images, host+"/calico/cni:v3.22.4")
+	if _, err = v.Install(ctx, component.Options{}); err == nil || !strings.Contains(err.Error(), "calico/cni") {
+		t.Errorf("Install() should fail with the missing image, got %v", err)
+	}
+}
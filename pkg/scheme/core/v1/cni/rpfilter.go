@@ -0,0 +1,114 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	rpFilterChecker = "rpFilterChecker"
+	// ipv4ConfDir the sysctl dir of ipv4 interface configs
+	ipv4ConfDir = "/proc/sys/net/ipv4/conf"
+	// looseRPFilter rp_filter value of loose mode reverse path filtering
+	looseRPFilter = "2"
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+rpFilterChecker, version, component.TypeStep), &RPFilterChecker{})
+}
+
+var _ component.StepRunnable = (*RPFilterChecker)(nil)
+
+// RPFilterChecker warns the hosts with loose reverse path filtering,
+// felix refuses to start on them unless FELIX_IGNORELOOSERPF is set.
+type RPFilterChecker struct {
+	ConfDir string `json:"confDir"`
+}
+
+func (c *RPFilterChecker) NewInstance() component.ObjectMeta {
+	return &RPFilterChecker{}
+}
+
+func (c *RPFilterChecker) Install(_ context.Context, opts component.Options) ([]byte, error) {
+	if opts.DryRun {
+		return nil, nil
+	}
+	loose, err := LooseRPFilters(strutil.StringDefaultIfEmpty(ipv4ConfDir, c.ConfDir))
+	if err != nil {
+		return nil, err
+	}
+	if len(loose) > 0 {
+		warning := fmt.Sprintf("loose reverse path filtering(rp_filter=2) is enabled on %v, calico-node will not start "+
+			"unless ignoreLooseRPF is set or rp_filter is changed to 1", loose)
+		logger.Warn(warning)
+		opts.ReportProgress(warning)
+	}
+	return nil, nil
+}
+
+func (c *RPFilterChecker) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("RPFilterChecker dose not support uninstall")
+}
+
+// LooseRPFilters returns the configs under dir which rp_filter is loose mode, e.g. "all" or "eth0".
+func LooseRPFilters(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read sysctl dir:%s failed:%w", dir, err)
+	}
+	var loose []string
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "rp_filter"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(data)) == looseRPFilter {
+			loose = append(loose, entry.Name())
+		}
+	}
+	return loose, nil
+}
+
+// CheckRPFilter the preflight step of warning the nodes with loose reverse path filtering
+func CheckRPFilter(nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&RPFilterChecker{
+		ConfDir: ipv4ConfDir,
+	})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "checkRPFilter",
+		Timeout:    metav1.Duration{Duration: 10 * time.Second},
+		ErrIgnore:  true,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+rpFilterChecker, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+// NeedRPFilterCheck whether the cni nodes need to check the loose reverse path filtering before install
+func NeedRPFilterCheck(c *v1.CNI) bool {
+	return c.Type == "calico" && c.Calico != nil && !c.Calico.IgnoreLooseRPF
+}
@@ -0,0 +1,41 @@
+package cni
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+)
+
+func TestLooseRPFilters(t *testing.T) {
+	dir := t.TempDir()
+	confs := map[string]string{"all": "2\n", "default": "1\n", "eth0": "0\n", "eth1": "2\n"}
+	for name, value := range confs {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, "rp_filter"), []byte(value), 0644))
+	}
+	// interface without rp_filter is skipped
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lo"), 0755))
+
+	loose, err := LooseRPFilters(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"all", "eth1"}, loose)
+}
+
+func TestRPFilterChecker_Install(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "all"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "all", "rp_filter"), []byte("2\n"), 0644))
+
+	var phases []string
+	c := &RPFilterChecker{ConfDir: dir}
+	_, err := c.Install(context.TODO(), component.Options{Progress: func(phase string) { phases = append(phases, phase) }})
+	require.NoError(t, err)
+	require.Len(t, phases, 1, "the loose rp_filter warning should be reported")
+	assert.Contains(t, phases[0], "rp_filter=2")
+}
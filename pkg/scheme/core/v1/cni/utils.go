@@ -2,7 +2,8 @@ package cni
 
 import (
 	"fmt"
-	"strconv"
+	"net"
+	"regexp"
 	"strings"
 	"time"
 
@@ -10,18 +11,23 @@ import (
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
 )
 
-func LoadImage(name string, custom []byte, nodes []v1.StepNode) v1.Step {
+// LoadImage the step of loading the offline cni images, at most concurrency nodes load
+// the images at the same time, 0 means all nodes.
+func LoadImage(name string, custom []byte, nodes []v1.StepNode, concurrency int) v1.Step {
 	return v1.Step{
 
-		ID:         strutil.GetUUID(),
-		Name:       "cniImageLoader",
-		Timeout:    metav1.Duration{Duration: 5 * time.Minute},
-		ErrIgnore:  false,
-		RetryTimes: 1,
-		Nodes:      nodes,
-		Action:     v1.ActionInstall,
+		ID:          strutil.GetUUID(),
+		Name:        "cniImageLoader",
+		Timeout:     metav1.Duration{Duration: 5 * time.Minute},
+		ErrIgnore:   false,
+		RetryTimes:  1,
+		Nodes:       nodes,
+		Action:      v1.ActionInstall,
+		Concurrency: int32(concurrency),
 		Commands: []v1.Command{
 			{
 				Type:          v1.CommandCustom,
@@ -69,6 +75,24 @@ func ApplyYaml(yamlName string, nodes []v1.StepNode) v1.Step {
 	}
 }
 
+func DeleteYaml(yamlName string, nodes []v1.StepNode) v1.Step {
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "deleteCniYaml",
+		Timeout:    metav1.Duration{Duration: 3 * time.Minute},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionUninstall,
+		Commands: []v1.Command{
+			{
+				Type:         v1.CommandShell,
+				ShellCommand: []string{"kubectl", "delete", "-f", yamlName, "--ignore-not-found"},
+			},
+		},
+	}
+}
+
 func RemoveImage(name string, custom []byte, nodes []v1.StepNode) v1.Step {
 	return v1.Step{
 		ID:         strutil.GetUUID(),
@@ -97,60 +121,123 @@ func InstallCalicoRelease(chartPath string, yamlName string, nodes []v1.StepNode
 		RetryTimes: 1,
 		Nodes:      nodes,
 		Commands: []v1.Command{
+			{
+				// the chart is installed from the local bundle, fail early instead of letting helm resolve it from a repo
+				Type:         v1.CommandShell,
+				ShellCommand: []string{"/bin/sh", "-c", fmt.Sprintf("test -f %[1]s || { echo 'calico chart bundle %[1]s is missing' >&2; exit 1; }", chartPath)},
+			},
 			{
 				Type:         v1.CommandShell,
-				ShellCommand: []string{"helm", "upgrade", "--install", "--create-namespace", "calico", "-n", "calico-system", chartPath, "-f", yamlName},
+				ShellCommand: []string{"helm", "upgrade", "--install", "--create-namespace", "calico", "-n", calicoOperatorNamespace, chartPath, "-f", yamlName},
 			},
 		},
 	}
 }
 
-func IsHighKubeVersion(kubeVersion string) bool {
-	if kubeVersion == "" {
-		return false
+func UninstallCalicoRelease(nodes []v1.StepNode) v1.Step {
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "uninstallCalicoRelease",
+		Timeout:    metav1.Duration{Duration: 3 * time.Minute},
+		ErrIgnore:  true,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionUninstall,
+		Commands: []v1.Command{
+			{
+				Type:         v1.CommandShell,
+				ShellCommand: []string{"helm", "uninstall", "calico", "-n", calicoOperatorNamespace, "--wait"},
+			},
+		},
 	}
-	kubeVersion = strings.ReplaceAll(kubeVersion, "v", "")
-	kubeVersion = strings.ReplaceAll(kubeVersion, ".", "")
+}
 
-	kubeVersion = strings.Join(strings.Split(kubeVersion, "")[0:3], "")
+// calicoHelmMinKubeVersion the first kubernetes version whose calico is installed by the tigera operator helm chart,
+// the lower versions apply the raw calico manifest.
+var calicoHelmMinKubeVersion = utilversion.MustParseGeneric("1.26.0")
 
-	if v, _ := strconv.Atoi(kubeVersion); v >= 126 {
-		return true
+// IsHighKubeVersion reports whether the kubernetes version is at least 1.26, the leading v is optional and
+// the pre-release or build suffix is ignored, so v1.26.0-rc.1 and 1.26 are both high versions.
+// The empty or malformed version is treated as a low version.
+func IsHighKubeVersion(kubeVersion string) bool {
+	v, err := utilversion.ParseGeneric(kubeVersion)
+	if err != nil {
+		return false
 	}
-	return false
+	return v.AtLeast(calicoHelmMinKubeVersion)
 }
 
-func ParseNodeAddressDetection(nodeAddressDetection string) NodeAddressDetection {
-	// nodeAddressDetection first-found|can-reach=DESTINATION|interface=INTERFACE-REGEX|skip-interface=INTERFACE-REGEX
-	detections := strings.Split(nodeAddressDetection, "=")
-	if len(detections) == 0 {
-		return NodeAddressDetection{
-			Type: "first-found",
-		}
+const (
+	NodeAddressDetectionFirstFound     = "first-found"
+	NodeAddressDetectionCanReach       = "can-reach"
+	NodeAddressDetectionInterface      = "interface"
+	NodeAddressDetectionSkipInterface  = "skip-interface"
+	NodeAddressDetectionCIDR           = "cidr"
+	NodeAddressDetectionKubernetesIP   = "kubernetes-internal-ip"
+	defaultNodeAddressDetectionMethod  = NodeAddressDetectionFirstFound
+	nodeAddressDetectionValueSeparator = "="
+)
+
+// ParseNodeAddressDetection parse the calico node address auto-detection method, one of
+// first-found|kubernetes-internal-ip|can-reach=DESTINATION|interface=INTERFACE-REGEX|skip-interface=INTERFACE-REGEX|cidr=CIDR[,CIDR]
+// An empty method means first-found, which is the calico default.
+func ParseNodeAddressDetection(nodeAddressDetection string) (NodeAddressDetection, error) {
+	if nodeAddressDetection == "" {
+		return NodeAddressDetection{Type: defaultNodeAddressDetectionMethod}, nil
 	}
-	switch detections[0] {
-	case "first-found":
-		return NodeAddressDetection{
-			Type: "first-found",
-		}
-	case "can-reach":
-		return NodeAddressDetection{
-			Type:  "can-reach",
-			Value: strings.TrimPrefix(nodeAddressDetection, "can-reach="),
-		}
-	case "interface":
-		return NodeAddressDetection{
-			Type:  "interface",
-			Value: strings.TrimPrefix(nodeAddressDetection, "interface="),
-		}
-	case "skip-interface":
-		return NodeAddressDetection{
-			Type:  "skip-interface",
-			Value: strings.TrimPrefix(nodeAddressDetection, "skip-interface="),
+	kind, value, hasValue := strings.Cut(nodeAddressDetection, nodeAddressDetectionValueSeparator)
+	switch kind {
+	case NodeAddressDetectionFirstFound, NodeAddressDetectionKubernetesIP:
+		if hasValue {
+			return NodeAddressDetection{}, fmt.Errorf("node address detection method %s does not take a value: %s", kind, nodeAddressDetection)
 		}
+		return NodeAddressDetection{Type: kind}, nil
+	case NodeAddressDetectionCanReach, NodeAddressDetectionInterface, NodeAddressDetectionSkipInterface, NodeAddressDetectionCIDR:
 	default:
-		return NodeAddressDetection{
-			Type: "first-found",
+		return NodeAddressDetection{}, fmt.Errorf("unsupported node address detection method: %s, "+
+			"it must be one of first-found, kubernetes-internal-ip, can-reach=DESTINATION, interface=INTERFACE-REGEX, "+
+			"skip-interface=INTERFACE-REGEX or cidr=CIDR", nodeAddressDetection)
+	}
+	if value == "" {
+		return NodeAddressDetection{}, fmt.Errorf("node address detection method %s requires a value, e.g. %s=VALUE", kind, kind)
+	}
+	switch kind {
+	case NodeAddressDetectionInterface, NodeAddressDetectionSkipInterface:
+		for _, re := range strings.Split(value, ",") {
+			if _, err := regexp.Compile(re); err != nil {
+				return NodeAddressDetection{}, fmt.Errorf("invalid interface regex %s of node address detection method %s:%w", re, kind, err)
+			}
 		}
+	case NodeAddressDetectionCIDR:
+		for _, cidr := range strings.Split(value, ",") {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return NodeAddressDetection{}, fmt.Errorf("invalid cidr %s of node address detection method %s:%w", cidr, kind, err)
+			}
+		}
+	}
+	return NodeAddressDetection{Type: kind, Value: value}, nil
+}
+
+// Values split the comma separated detection value, e.g. the cidrs of cidr method
+func (d NodeAddressDetection) Values() []string {
+	if d.Value == "" {
+		return nil
+	}
+	return strings.Split(d.Value, ",")
+}
+
+// ValidateNamespace check the cni namespace is a valid namespace name,
+// and calico deployed by the tigera operator must use calico-system.
+func ValidateNamespace(cniType, namespace, kubeVersion string) error {
+	if namespace == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid cni namespace %s: %s", namespace, strings.Join(errs, ","))
+	}
+	if cniType == "calico" && IsHighKubeVersion(kubeVersion) && namespace != calicoOperatorNamespace {
+		return fmt.Errorf("calico on kubernetes %s is deployed by the tigera operator, the namespace must be %s",
+			kubeVersion, calicoOperatorNamespace)
 	}
+	return nil
 }
@@ -0,0 +1,30 @@
+package cni
+
+import "testing"
+
+func TestIsHighKubeVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		kubeVersion string
+		want        bool
+	}{
+		{name: "last low version", kubeVersion: "v1.25.16", want: false},
+		{name: "first high version", kubeVersion: "v1.26.0", want: true},
+		{name: "without leading v", kubeVersion: "1.26.0", want: true},
+		{name: "major and minor only", kubeVersion: "1.26", want: true},
+		{name: "pre-release of first high version", kubeVersion: "v1.26.0-rc.1", want: true},
+		{name: "build suffix of low version", kubeVersion: "v1.25.3+k3s1", want: false},
+		{name: "single digit minor", kubeVersion: "v1.9.0", want: false},
+		{name: "higher version", kubeVersion: "v1.28.2", want: true},
+		{name: "empty", kubeVersion: "", want: false},
+		{name: "garbage", kubeVersion: "latest", want: false},
+		{name: "major only", kubeVersion: "v1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsHighKubeVersion(tt.kubeVersion); got != tt.want {
+				t.Errorf("IsHighKubeVersion(%q) = %v, want %v", tt.kubeVersion, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	wireGuardChecker = "wireGuardChecker"
+	// sysModuleDir the dir of the loaded and built-in kernel modules
+	sysModuleDir = "/sys/module"
+)
+
+var (
+	// wireGuardMinVersion the first calico version supports wireguard encryption
+	wireGuardMinVersion = utilversion.MustParseGeneric("3.14.0")
+	// wireGuardV6MinVersion the first calico version supports wireguard encryption of ipv6 traffic
+	wireGuardV6MinVersion = utilversion.MustParseGeneric("3.23.0")
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat,
+		cniInfo+"-"+wireGuardChecker, version, component.TypeStep), &WireGuardChecker{})
+}
+
+var _ component.StepRunnable = (*WireGuardChecker)(nil)
+
+// WireGuardChecker ensures the wireguard kernel module is available on the node,
+// felix can not encrypt the pod traffic without it.
+type WireGuardChecker struct {
+	ModuleDir string `json:"moduleDir"`
+}
+
+func (c *WireGuardChecker) NewInstance() component.ObjectMeta {
+	return &WireGuardChecker{}
+}
+
+func (c *WireGuardChecker) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	// the module is loaded or built into the kernel
+	if _, err := os.Stat(filepath.Join(strutil.StringDefaultIfEmpty(sysModuleDir, c.ModuleDir), "wireguard")); err == nil {
+		return nil, nil
+	}
+	if _, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "modprobe", "wireguard"); err != nil {
+		return nil, fmt.Errorf("wireguard kernel module is not available on the node, calico traffic encryption "+
+			"requires linux 5.6+ or the wireguard module installed:%w", err)
+	}
+	logger.Info("wireguard kernel module is loaded")
+	return nil, nil
+}
+
+func (c *WireGuardChecker) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("WireGuardChecker dose not support uninstall")
+}
+
+// CheckWireGuard the preflight step of ensuring the wireguard kernel module is available on the nodes
+func CheckWireGuard(nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&WireGuardChecker{
+		ModuleDir: sysModuleDir,
+	})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "checkWireGuard",
+		Timeout:    metav1.Duration{Duration: 30 * time.Second},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, cniInfo+"-"+wireGuardChecker, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+// NeedWireGuardCheck whether the cni nodes need to check the wireguard kernel module before install
+func NeedWireGuardCheck(c *v1.CNI) bool {
+	return c.Type == "calico" && c.Calico != nil && c.Calico.EncryptTraffic
+}
+
+// ValidateEncryptTraffic check the calico version supports wireguard encryption of the ip families
+func ValidateEncryptTraffic(calicoVersion string, ipv6 bool) error {
+	v, err := utilversion.ParseGeneric(calicoVersion)
+	if err != nil {
+		return fmt.Errorf("invalid calico version %s:%w", calicoVersion, err)
+	}
+	if !v.AtLeast(wireGuardMinVersion) {
+		return fmt.Errorf("calico %s dose not support wireguard encryption, requires %s or later", calicoVersion, wireGuardMinVersion)
+	}
+	if ipv6 && !v.AtLeast(wireGuardV6MinVersion) {
+		return fmt.Errorf("calico %s dose not support wireguard encryption of ipv6 traffic, requires %s or later",
+			calicoVersion, wireGuardV6MinVersion)
+	}
+	return nil
+}
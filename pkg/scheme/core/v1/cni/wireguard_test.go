@@ -0,0 +1,70 @@
+package cni
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestWireGuardChecker_Install_moduleLoaded(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "wireguard"), 0755))
+	c := &WireGuardChecker{ModuleDir: dir}
+	_, err := c.Install(context.TODO(), component.Options{})
+	assert.NoError(t, err)
+}
+
+func TestValidateEncryptTraffic(t *testing.T) {
+	tests := []struct {
+		version string
+		ipv6    bool
+		wantErr bool
+	}{
+		{version: "v3.11.2", wantErr: true},
+		{version: "v3.16.10"},
+		{version: "v3.22.4", ipv6: true, wantErr: true},
+		{version: "v3.24.5", ipv6: true},
+		{version: "v3.26.1"},
+	}
+	for _, tt := range tests {
+		if err := ValidateEncryptTraffic(tt.version, tt.ipv6); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateEncryptTraffic(%s, %v) error = %v, wantErr %v", tt.version, tt.ipv6, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCNI_renderCalicoFelixTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   BaseCni
+		want   []string
+		unwant []string
+	}{
+		{name: "ipv4", base: BaseCni{}, want: []string{"wireguardEnabled: true"}, unwant: []string{"wireguardEnabledV6"}},
+		{name: "dual-stack", base: BaseCni{DualStack: true}, want: []string{"wireguardEnabled: true", "wireguardEnabledV6: true"}},
+		{name: "ipv6", base: BaseCni{IPv6Only: true}, want: []string{"wireguardEnabledV6: true"}, unwant: []string{"wireguardEnabled: true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stepper := CalicoRunnable{BaseCni: tt.base}
+			stepper.Calico = &v1.Calico{EncryptTraffic: true}
+			w := &bytes.Buffer{}
+			require.NoError(t, stepper.renderCalicoFelixTo(w))
+			assert.Contains(t, w.String(), "kind: FelixConfiguration")
+			for _, s := range tt.want {
+				assert.Contains(t, w.String(), s)
+			}
+			for _, s := range tt.unwant {
+				assert.NotContains(t, w.String(), s)
+			}
+		})
+	}
+}
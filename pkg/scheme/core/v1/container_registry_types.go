@@ -18,7 +18,17 @@
 
 package v1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	RegistrySchemeHTTP  = "http"
+	RegistrySchemeHTTPS = "https"
+)
 
 // +genclient
 // +genclient:nonNamespaced
@@ -38,6 +48,22 @@ type RegistrySpec struct {
 	Host       string `json:"host,omitempty"`
 	SkipVerify bool   `json:"skipVerify,omitempty"`
 	CA         string `json:"ca,omitempty"`
+	// TrustOnFirstUse pin the certificate served by the registry on first connect and use it as the CA,
+	// only takes effect for https registry without CA.
+	TrustOnFirstUse bool `json:"trustOnFirstUse,omitempty"`
+	// Priority the order of the registry host tried by containerd among the mirrors of the same server,
+	// the lower is tried first. The hosts of same priority are tried in the order of host string.
+	// The mirrors are always sorted before the server itself, so the priority does not move the server
+	// ahead of its mirrors.
+	Priority int `json:"priority,omitempty"`
+	// MirrorFor the server mirrored by the registry, example: docker.io. The registry is placed under the
+	// hosts of the mirrored server and tried before the server itself. Empty means the registry is the server.
+	MirrorFor string `json:"mirrorFor,omitempty"`
+	// Username and Password the basic auth credentials of the registry, only supported by containerd.
+	// They are rendered as the Authorization header of the host in its hosts.toml, which is only readable by root,
+	// rather than the plaintext auths of config.toml. The password is not returned by the api.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
 }
 
 // RegistryList is a resource containing a list of RegistryList objects.
@@ -50,3 +76,78 @@ type RegistryList struct {
 	// Items is the list of registry.
 	Items []Registry
 }
+
+// ValidateRegistrySpec check the scheme is http or https and the host is not empty,
+// the hosts.toml key of containerd is built by them.
+func ValidateRegistrySpec(spec *RegistrySpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch spec.Scheme {
+	case RegistrySchemeHTTP, RegistrySchemeHTTPS:
+	case "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("scheme"), ""))
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("scheme"), spec.Scheme,
+			[]string{RegistrySchemeHTTP, RegistrySchemeHTTPS}))
+	}
+	if spec.Host == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("host"), ""))
+	}
+	if strings.Contains(spec.MirrorFor, "://") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("mirrorFor"), spec.MirrorFor, "must not contain scheme"))
+	}
+	if spec.Password != "" && spec.Username == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("username"), "required when password is set"))
+	}
+	if strings.Contains(spec.Username, ":") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("username"), spec.Username, "must not contain ':'"))
+	}
+	return allErrs
+}
+
+// InsecureRegistrySpecs the registry specs of the insecure registry host, the http host and the https host
+// skipping verify are both returned unless the registry is http only.
+func InsecureRegistrySpecs(host string, httpOnly bool) []RegistrySpec {
+	if httpOnly {
+		return []RegistrySpec{{Scheme: RegistrySchemeHTTP, Host: host}}
+	}
+	return []RegistrySpec{
+		{Scheme: RegistrySchemeHTTP, Host: host},
+		{Scheme: RegistrySchemeHTTPS, Host: host, SkipVerify: true},
+	}
+}
+
+// DefaultMirrorServer the server of the containerd hosts dir used by the registries without their own hosts dir
+const DefaultMirrorServer = "_default"
+
+// DefaultMirrorSpec the registry spec mirroring all the registries through host. The spec of host in registries
+// is preferred, the verified https one first, so its CA and credentials are kept. The host is treated as
+// a verified https registry if it is not in registries, an insecure one must be listed in registries.
+func DefaultMirrorSpec(registries []RegistrySpec, host string) RegistrySpec {
+	host = strings.ToLower(host)
+	spec := RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: host}
+	found := false
+	for _, r := range registries {
+		if strings.ToLower(r.Host) != host || r.MirrorFor != "" {
+			continue
+		}
+		if r.Scheme == RegistrySchemeHTTPS && !r.SkipVerify {
+			spec = r
+			break
+		}
+		if !found {
+			spec, found = r, true
+		}
+	}
+	spec.Host = host
+	spec.MirrorFor = DefaultMirrorServer
+	return spec
+}
+
+// ValidateRegistrySpecs validate each registry of the list
+func ValidateRegistrySpecs(specs []RegistrySpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i := range specs {
+		allErrs = append(allErrs, ValidateRegistrySpec(&specs[i], fldPath.Index(i))...)
+	}
+	return allErrs
+}
@@ -0,0 +1,51 @@
+package v1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateRegistrySpec_auth(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    RegistrySpec
+		wantErr bool
+	}{
+		{name: "no auth", spec: RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: "a.io"}},
+		{name: "basic auth", spec: RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: "a.io", Username: "admin", Password: "secret"}},
+		{name: "password without username", spec: RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: "a.io", Password: "secret"}, wantErr: true},
+		{name: "colon in username", spec: RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: "a.io", Username: "ad:min"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := ValidateRegistrySpec(&tt.spec, field.NewPath("registry")); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("ValidateRegistrySpec() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultMirrorSpec(t *testing.T) {
+	registries := []RegistrySpec{
+		{Scheme: RegistrySchemeHTTP, Host: "10.0.0.1:5000"},
+		{Scheme: RegistrySchemeHTTPS, Host: "10.0.0.1:5000", SkipVerify: true},
+		{Scheme: RegistrySchemeHTTPS, Host: "harbor.example.com", MirrorFor: "docker.io"},
+		{Scheme: RegistrySchemeHTTPS, Host: "harbor.example.com", CA: "ca", Username: "admin", Password: "secret"},
+	}
+	tests := []struct {
+		host string
+		want RegistrySpec
+	}{
+		{host: "10.0.0.1:5000", want: RegistrySpec{Scheme: RegistrySchemeHTTP, Host: "10.0.0.1:5000", MirrorFor: DefaultMirrorServer}},
+		{host: "Harbor.example.com", want: RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: "harbor.example.com", CA: "ca",
+			Username: "admin", Password: "secret", MirrorFor: DefaultMirrorServer}},
+		// the host not in registries is not downgraded to http
+		{host: "10.0.0.2:5000", want: RegistrySpec{Scheme: RegistrySchemeHTTPS, Host: "10.0.0.2:5000", MirrorFor: DefaultMirrorServer}},
+	}
+	for _, tt := range tests {
+		if got := DefaultMirrorSpec(registries, tt.host); got != tt.want {
+			t.Errorf("DefaultMirrorSpec(%s) = %+v, want %+v", tt.host, got, tt.want)
+		}
+	}
+}
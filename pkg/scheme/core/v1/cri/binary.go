@@ -0,0 +1,179 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+)
+
+// ServiceFunc controls the service which runs the binary, e.g. stop or start it.
+type ServiceFunc func(ctx context.Context) error
+
+// SystemdService returns a ServiceFunc runs 'systemctl <action> <service>'.
+func SystemdService(service, action string, dryRun bool) ServiceFunc {
+	return func(ctx context.Context) error {
+		_, err := cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", action, service)
+		return err
+	}
+}
+
+// SwapBinary replaces the dst binary with src while the service using it is stopped.
+// Overwriting a binary in use fails with "text file busy", so src is first copied to
+// a temp file beside dst (the same filesystem, so rename is atomic), then the service
+// is stopped and the temp file is renamed into place. If the service fails to start
+// with the new binary, the old one is restored and the service is started again.
+func SwapBinary(ctx context.Context, dst, src string, stop, start ServiceFunc, dryRun bool) error {
+	if dryRun {
+		logger.FromContext(ctx).Info("dry run swap binary", zap.String("dst", dst), zap.String("src", src))
+		return nil
+	}
+	tmp, err := copyToTemp(dst, src)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err = stop(ctx); err != nil {
+		return fmt.Errorf("stop service before swap %s failed:%w", dst, err)
+	}
+	backup := dst + ".bak"
+	hasBackup := true
+	if err = os.Rename(dst, backup); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("backup binary %s failed:%w", dst, err)
+		}
+		hasBackup = false
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		if hasBackup {
+			_ = os.Rename(backup, dst)
+		}
+		return fmt.Errorf("move new binary to %s failed:%w", dst, err)
+	}
+	if err = start(ctx); err == nil {
+		if hasBackup {
+			_ = os.Remove(backup)
+		}
+		return nil
+	}
+	if !hasBackup {
+		return fmt.Errorf("start service with new binary %s failed:%w", dst, err)
+	}
+	logger.FromContext(ctx).Warn("start service with new binary failed, rollback", zap.String("binary", dst), zap.Error(err))
+	if rbErr := os.Rename(backup, dst); rbErr != nil {
+		return fmt.Errorf("start service with new binary %s failed:%v, rollback failed:%w", dst, err, rbErr)
+	}
+	if rbErr := start(ctx); rbErr != nil {
+		return fmt.Errorf("start service with new binary %s failed:%v, start with old binary failed:%w", dst, err, rbErr)
+	}
+	return fmt.Errorf("start service with new binary %s failed, old binary restored:%w", dst, err)
+}
+
+// fileBackups records the files replaced by replaceFiles, keyed by the dst,
+// the value is whether dst existed and was backed up to dst.bak.
+type fileBackups map[string]bool
+
+// replaceFiles replace each dst with its src by replaceFile. The old dst is hard linked to dst.bak
+// first, so it is kept without copying even if it is running, until the backups are restored or removed.
+func replaceFiles(files map[string]string) (fileBackups, error) {
+	backups := make(fileBackups, len(files))
+	for dst, src := range files {
+		backup := dst + ".bak"
+		_ = os.Remove(backup)
+		existed := true
+		if err := os.Link(dst, backup); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return backups, fmt.Errorf("backup %s failed:%w", dst, err)
+			}
+			existed = false
+		}
+		backups[dst] = existed
+		if err := replaceFile(dst, src); err != nil {
+			return backups, err
+		}
+	}
+	return backups, nil
+}
+
+// restore moves the backups back in place, the files which did not exist before are removed.
+func (b fileBackups) restore() error {
+	var errs []error
+	for dst, existed := range b {
+		var err error
+		if existed {
+			err = os.Rename(dst+".bak", dst)
+		} else {
+			err = os.Remove(dst)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("restore %s failed:%w", dst, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// remove deletes the backups once the replaced files are in use.
+func (b fileBackups) remove() {
+	for dst, existed := range b {
+		if existed {
+			_ = os.Remove(dst + ".bak")
+		}
+	}
+}
+
+// copyToTemp copy src to a temp file in the dir of dst, keeps the mode of dst if it exists.
+func copyToTemp(dst, src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	mode := os.FileMode(0755)
+	if fi, err := os.Stat(dst); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".new-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), mode)
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", fmt.Errorf("copy %s to temp file failed:%w", src, err)
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,133 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapBinary(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "containerd")
+	src := filepath.Join(dir, "containerd-new")
+	require.NoError(t, os.WriteFile(dst, []byte("old"), 0755))
+	require.NoError(t, os.WriteFile(src, []byte("new"), 0644))
+
+	var calls []string
+	stop := func(ctx context.Context) error {
+		calls = append(calls, "stop")
+		return nil
+	}
+	start := func(ctx context.Context) error {
+		calls = append(calls, "start")
+		return nil
+	}
+	require.NoError(t, SwapBinary(context.TODO(), dst, src, stop, start, false))
+
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	fi, err := os.Stat(dst)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+	assert.Equal(t, []string{"stop", "start"}, calls)
+	_, err = os.Stat(dst + ".bak")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSwapBinary_rollback(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "containerd")
+	src := filepath.Join(dir, "containerd-new")
+	require.NoError(t, os.WriteFile(dst, []byte("old"), 0755))
+	require.NoError(t, os.WriteFile(src, []byte("new"), 0755))
+
+	starts := 0
+	stop := func(ctx context.Context) error { return nil }
+	start := func(ctx context.Context) error {
+		starts++
+		// simulate the new binary fails to start
+		if data, _ := os.ReadFile(dst); string(data) == "new" {
+			return fmt.Errorf("exit status 1")
+		}
+		return nil
+	}
+	err := SwapBinary(context.TODO(), dst, src, stop, start, false)
+	assert.Error(t, err)
+
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data), "old binary should be restored")
+	assert.Equal(t, 2, starts, "service should be restarted with the old binary")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "temp and backup files should be cleaned")
+}
+
+func TestReplaceFiles_restore(t *testing.T) {
+	dir := t.TempDir()
+	shim := filepath.Join(dir, "containerd-shim-runc-v2")
+	added := filepath.Join(dir, "containerd-stress")
+	require.NoError(t, os.WriteFile(shim, []byte("old"), 0755))
+	staging := t.TempDir()
+	for _, f := range []string{"shim", "stress"} {
+		require.NoError(t, os.WriteFile(filepath.Join(staging, f), []byte("new"), 0755))
+	}
+
+	backups, err := replaceFiles(map[string]string{
+		shim:  filepath.Join(staging, "shim"),
+		added: filepath.Join(staging, "stress"),
+	})
+	require.NoError(t, err)
+	data, err := os.ReadFile(shim)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	require.NoError(t, backups.restore())
+	data, err = os.ReadFile(shim)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data), "old shim should be restored")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "added file and backup should be removed")
+}
+
+func TestStagedFiles(t *testing.T) {
+	staging := t.TempDir()
+	for _, f := range []string{"usr/local/bin/containerd", "usr/local/bin/ctr", "etc/containerd/config.toml", "etc/systemd/system/containerd.service"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(staging, filepath.Dir(f)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(staging, f), []byte(f), 0755))
+	}
+	files, err := stagedFiles(staging, "/", "/etc/containerd")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/usr/local/bin/containerd":              filepath.Join(staging, "usr/local/bin/containerd"),
+		"/usr/local/bin/ctr":                     filepath.Join(staging, "usr/local/bin/ctr"),
+		"/etc/systemd/system/containerd.service": filepath.Join(staging, "etc/systemd/system/containerd.service"),
+	}, files)
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.WriteFile(src, []byte("new"), 0644))
+	dst := filepath.Join(dir, "bin", "runc")
+	require.NoError(t, replaceFile(dst, src))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestContainerdVersionMatch(t *testing.T) {
+	out := "containerd github.com/containerd/containerd v1.6.4 212e8b6fa2f44b9c21b2798135fc6fb7c53efc16\n"
+	assert.True(t, containerdVersionMatch(out, "1.6.4"))
+	assert.True(t, containerdVersionMatch(out, "v1.6.4"))
+	assert.False(t, containerdVersionMatch(out, "1.6.41"))
+	assert.False(t, containerdVersionMatch(out, "1.7.2"))
+}
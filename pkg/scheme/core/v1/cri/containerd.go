@@ -19,14 +19,19 @@
 package cri
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -34,6 +39,8 @@ import (
 	"github.com/pelletier/go-toml"
 	"go.uber.org/zap"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/kubeclipper/kubeclipper/pkg/component"
 	"github.com/kubeclipper/kubeclipper/pkg/logger"
@@ -41,6 +48,9 @@ import (
 	"github.com/kubeclipper/kubeclipper/pkg/simple/downloader"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/initsystem"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/netutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/sliceutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
 	tmplutil "github.com/kubeclipper/kubeclipper/pkg/utils/template"
 )
@@ -53,6 +63,42 @@ type ContainerdRunnable struct {
 	PauseVersion        string `json:"pauseVersion"`
 	PauseRegistry       string `json:"pauseRegistry"`
 	EnableSystemdCgroup string `json:"enableSystemdCgroup"`
+	// SystemdCgroup the user setting of EnableSystemdCgroup, auto detected on the node when it is auto
+	SystemdCgroup string `json:"systemdCgroup,omitempty"`
+	// MaxConcurrentDownloads the max_concurrent_downloads of config.toml, the containerd default is used when it is 0
+	MaxConcurrentDownloads int `json:"maxConcurrentDownloads,omitempty"`
+	// EnableTLSStreaming serve the cri stream server with the tls cert and key files on the node
+	EnableTLSStreaming   bool   `json:"enableTLSStreaming,omitempty"`
+	TLSStreamingCertFile string `json:"tlsStreamingCertFile,omitempty"`
+	TLSStreamingKeyFile  string `json:"tlsStreamingKeyFile,omitempty"`
+	// BundleSHA256 the expected sha256 digest of the downloaded containerd bundle
+	BundleSHA256 string `json:"bundleSHA256,omitempty"`
+	// EnableNRI enable the node resource interface plugin of containerd,
+	// NRISocketPath defaults to /var/run/nri/nri.sock when it is empty.
+	EnableNRI     bool   `json:"enableNRI,omitempty"`
+	NRISocketPath string `json:"nriSocketPath,omitempty"`
+	// PreserveData keep the data root and state dir on uninstall, e.g. to reuse the image cache
+	PreserveData bool `json:"preserveData,omitempty"`
+	// DownloadRetries the times of retrying the failed package download with exponential backoff
+	// starting from DownloadRetryBackoff.
+	DownloadRetries      int           `json:"downloadRetries,omitempty"`
+	DownloadRetryBackoff time.Duration `json:"downloadRetryBackoff,omitempty"`
+	// HTTPProxy, HTTPSProxy and NoProxy the proxy environments of the containerd service, they are
+	// rendered to a systemd drop-in only if any proxy is set.
+	HTTPProxy  string   `json:"httpProxy,omitempty"`
+	HTTPSProxy string   `json:"httpsProxy,omitempty"`
+	NoProxy    []string `json:"noProxy,omitempty"`
+	// Runtimes the runtime handlers rendered besides runc, which differ between the node groups
+	Runtimes []v1.CRIRuntimeHandler `json:"runtimes,omitempty"`
+	// GPURuntime configure the nvidia runtime handler running nvidia-container-runtime
+	GPURuntime bool `json:"gpuRuntime,omitempty"`
+	// ClusterName the cluster of the node, carried by the logs of the steps on the node
+	ClusterName string `json:"clusterName,omitempty"`
+	// DiscardUnpackedLayers drop the compressed layers once they are unpacked into the snapshotter
+	DiscardUnpackedLayers bool `json:"discardUnpackedLayers,omitempty"`
+	// LogLevel and LogFormat the [debug] level and format of config.toml, empty means the containerd default
+	LogLevel  string `json:"logLevel,omitempty"`
+	LogFormat string `json:"logFormat,omitempty"`
 
 	installSteps   []v1.Step
 	uninstallSteps []v1.Step
@@ -60,38 +106,100 @@ type ContainerdRunnable struct {
 }
 
 func (runnable *ContainerdRunnable) InitStep(ctx context.Context, cluster *v1.Cluster, nodes []v1.StepNode) error {
+	runnable.RegistryConfigDir = strutil.StringDefaultIfEmpty(ContainerdDefaultRegistryConfigDir, runnable.RegistryConfigDir)
+	if err := validateRegistryConfigDir(runnable.RegistryConfigDir); err != nil {
+		return err
+	}
+	if err := cluster.ContainerRuntime.ValidateLog(); err != nil {
+		return err
+	}
 	metadata := component.GetExtraMetadata(ctx)
+	runnable.ClusterName = metadata.ClusterName
 	runnable.Version = cluster.ContainerRuntime.Version
 	runnable.Offline = metadata.Offline
 	runnable.DataRootDir = strutil.StringDefaultIfEmpty(containerdDefaultConfigDir, cluster.ContainerRuntime.DataRootDir)
 	runnable.LocalRegistry = metadata.LocalRegistry
 	runnable.Registies = cluster.Status.Registries
+	runnable.MaxConcurrentDownloads = cluster.ContainerRuntime.MaxConcurrentDownloads
+	runnable.EnableTLSStreaming = cluster.ContainerRuntime.EnableTLSStreaming
+	runnable.TLSStreamingCertFile = cluster.ContainerRuntime.TLSStreamingCertFile
+	runnable.TLSStreamingKeyFile = cluster.ContainerRuntime.TLSStreamingKeyFile
+	runnable.SystemdCgroup = systemdCgroupOf(cluster.ResolveCgroupDriver())
+	runnable.BundleSHA256 = cluster.ContainerRuntime.BundleSHA256
+	runnable.EnableNRI = cluster.ContainerRuntime.EnableNRI
+	runnable.NRISocketPath = cluster.ContainerRuntime.NRISocketPath
+	runnable.PreserveData = metadata.PreserveRuntimeData
+	runnable.DiscardUnpackedLayers = cluster.ContainerRuntime.DiscardUnpackedLayers
+	runnable.LogLevel = cluster.ContainerRuntime.LogLevel
+	runnable.LogFormat = cluster.ContainerRuntime.LogFormat
+	runnable.DownloadRetries = cluster.ContainerRuntime.DownloadRetries
+	runnable.DownloadRetryBackoff = cluster.ContainerRuntime.DownloadRetryBackoff.Duration
+	if proxy := cluster.ContainerRuntime.Proxy; proxy != nil && (proxy.HTTPProxy != "" || proxy.HTTPSProxy != "") {
+		runnable.HTTPProxy = proxy.HTTPProxy
+		runnable.HTTPSProxy = proxy.HTTPSProxy
+		runnable.NoProxy = containerdNoProxy(proxy.NoProxy, cluster, append(metadata.GetAllNodes().GetNodeIPs(), stepNodeIPs(nodes)...))
+	}
 
 	runnable.PauseVersion, runnable.PauseRegistry = runnable.matchPauseVersion(metadata.KubeVersion)
 	runtimeBytes, err := json.Marshal(runnable)
 	if err != nil {
 		return err
 	}
+	groups, err := runnable.runtimeGroupCommands(cluster.ContainerRuntime.RuntimeGroups, nodes)
+	if err != nil {
+		return err
+	}
 
 	// nodes := utils.UnwrapNodeList(metadata.GetAllNodes())
 	if len(runnable.installSteps) == 0 {
-		runnable.installSteps = []v1.Step{
-			{
+		for _, group := range groups {
+			runnable.installSteps = append(runnable.installSteps, v1.Step{
 				ID:         strutil.GetUUID(),
 				Name:       "installRuntime",
 				Timeout:    metav1.Duration{Duration: 10 * time.Minute},
 				ErrIgnore:  false,
 				RetryTimes: 1,
-				Nodes:      nodes,
+				Nodes:      group.nodes,
 				Action:     v1.ActionInstall,
 				Commands: []v1.Command{
 					{
 						Type:          v1.CommandCustom,
 						Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, criContainerd, criVersion, component.TypeStep),
-						CustomCommand: runtimeBytes,
+						CustomCommand: group.command,
 					},
 				},
-			},
+			})
+		}
+		pin, err := RegistryCertPinStep(runnable.ClusterName, runnable.RegistryConfigDir, cluster.Status.Registries, nodes)
+		if err != nil {
+			return err
+		}
+		if pin != nil {
+			runnable.installSteps = append([]v1.Step{*pin}, runnable.installSteps...)
+		}
+		preflight, err := RegistryPreflightStep(cluster.Status.Registries, nodes)
+		if err != nil {
+			return err
+		}
+		if preflight != nil {
+			runnable.installSteps = append([]v1.Step{*preflight}, runnable.installSteps...)
+		}
+		for _, group := range groups {
+			if !group.gpu {
+				continue
+			}
+			step, err := GPUPreflightStep(group.nodes)
+			if err != nil {
+				return err
+			}
+			runnable.installSteps = append([]v1.Step{step}, runnable.installSteps...)
+		}
+		if cluster.ContainerRuntime.PreloadImageDir != "" {
+			step, err := PreloadImagesStep(cluster.ContainerRuntime.PreloadImageDir, nodes)
+			if err != nil {
+				return err
+			}
+			runnable.installSteps = append(runnable.installSteps, step)
 		}
 	}
 	if len(runnable.uninstallSteps) == 0 {
@@ -114,10 +222,68 @@ func (runnable *ContainerdRunnable) InitStep(ctx context.Context, cluster *v1.Cl
 			},
 		}
 	}
+	if len(runnable.upgradeSteps) == 0 {
+		for _, group := range groups {
+			runnable.upgradeSteps = append(runnable.upgradeSteps, v1.Step{
+				ID:         strutil.GetUUID(),
+				Name:       "upgradeRuntime",
+				Timeout:    metav1.Duration{Duration: 10 * time.Minute},
+				ErrIgnore:  false,
+				RetryTimes: 1,
+				Nodes:      group.nodes,
+				Action:     v1.ActionUpgrade,
+				Commands: []v1.Command{
+					{
+						Type:          v1.CommandCustom,
+						Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, criContainerd, criVersion, component.TypeStep),
+						CustomCommand: group.command,
+					},
+				},
+			})
+		}
+	}
 
 	return nil
 }
 
+// runtimeNodeGroup the nodes sharing the same runtime handlers and their containerd command
+type runtimeNodeGroup struct {
+	nodes   []v1.StepNode
+	gpu     bool
+	command []byte
+}
+
+// runtimeGroupCommands split the nodes by the runtime groups they belong to, the nodes outside any group
+// come first with runc only. The groups without any of the nodes are skipped.
+func (runnable ContainerdRunnable) runtimeGroupCommands(runtimeGroups []v1.CRIRuntimeGroup, nodes []v1.StepNode) ([]runtimeNodeGroup, error) {
+	groupOf := make(map[string]int)
+	for i, group := range runtimeGroups {
+		for _, id := range group.Nodes {
+			groupOf[id] = i + 1
+		}
+	}
+	grouped := make([][]v1.StepNode, len(runtimeGroups)+1)
+	for _, node := range nodes {
+		grouped[groupOf[node.ID]] = append(grouped[groupOf[node.ID]], node)
+	}
+	var groups []runtimeNodeGroup
+	for i, groupNodes := range grouped {
+		if len(groupNodes) == 0 {
+			continue
+		}
+		runnable.Runtimes, runnable.GPURuntime = nil, false
+		if i > 0 {
+			runnable.Runtimes, runnable.GPURuntime = runtimeGroups[i-1].Runtimes, runtimeGroups[i-1].GPU
+		}
+		command, err := json.Marshal(runnable)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, runtimeNodeGroup{nodes: groupNodes, gpu: runnable.GPURuntime, command: command})
+	}
+	return groups, nil
+}
+
 func (runnable *ContainerdRunnable) GetActionSteps(action v1.StepAction) []v1.Step {
 	switch action {
 	case v1.ActionInstall:
@@ -135,101 +301,279 @@ func (runnable *ContainerdRunnable) NewInstance() component.ObjectMeta {
 	return &ContainerdRunnable{}
 }
 
+// withLogger put the containerd step logger into the context, so the logs of the helpers carry the
+// cluster, node and operation of the step as well.
+func (runnable *ContainerdRunnable) withLogger(ctx context.Context) context.Context {
+	return logger.IntoContext(ctx, component.StepLogger(ctx, criContainerd, runnable.ClusterName))
+}
+
 func (runnable ContainerdRunnable) Install(ctx context.Context, opts component.Options) ([]byte, error) {
-	instance, err := downloader.NewInstance(ctx, criContainerd, runnable.Version, runtime.GOARCH, !runnable.Offline, opts.DryRun)
-	if err != nil {
+	ctx = runnable.withLogger(ctx)
+	if err := runnable.checkTLSStreamingFiles(); err != nil {
 		return nil, err
 	}
-	if _, err = instance.DownloadAndUnpackConfigs(); err != nil {
+	instance, err := downloader.NewInstance(ctx, criContainerd, runnable.Version, runtime.GOARCH, !runnable.Offline, opts.DryRun)
+	if err != nil {
 		return nil, err
 	}
-	runnable.EnableSystemdCgroup = "false"
-	// check whether cgroup2 is used as the cgroup driver, if is it, enable containerd systemd cgroup
-	res, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "bash", "-c", "cat /proc/self/mountinfo")
+	instance.WithRetry(runnable.DownloadRetries, runnable.DownloadRetryBackoff).
+		WithConfigsSHA256(runnable.BundleSHA256).WithProgress(opts.Progress)
+	// the package ships a config.toml as well, so the config of the operator is backed up before it is unpacked
+	backup, err := backupFile(filepath.Join(containerdDefaultConfigDir, "config.toml"), opts.DryRun)
 	if err != nil {
 		return nil, err
 	}
-	if strings.Contains(res.StdOut(), "cgroup2") {
-		runnable.EnableSystemdCgroup = "true"
+	if _, err = instance.DownloadAndUnpackConfigs(); err != nil {
+		return nil, rollbackContainerdConfig(ctx, backup, err)
+	}
+	opts.ReportProgress("containerd package installed")
+	runnable.EnableSystemdCgroup, err = resolveSystemdCgroup(runnable.SystemdCgroup, func() (bool, error) {
+		// check whether cgroup2 is used as the cgroup driver, if is it, enable containerd systemd cgroup
+		return IsCgroupV2(ctx, opts.DryRun)
+	})
+	if err != nil {
+		return nil, rollbackContainerdConfig(ctx, backup, err)
 	}
 	// generate containerd daemon config file
 	if err = runnable.setupContainerdConfig(ctx, opts.DryRun); err != nil {
-		return nil, err
+		return nil, rollbackContainerdConfig(ctx, backup, err)
+	}
+	// the drop-in is loaded by the daemon-reload of enabling containerd service
+	if err = runnable.setupProxyDropIn(ctx, opts.DryRun); err != nil {
+		return nil, rollbackContainerdConfig(ctx, backup, err)
 	}
+	opts.ReportProgress("containerd config rendered")
 	// launch and enable containerd service
 	if err = runnable.enableContainerdService(ctx, opts.DryRun); err != nil {
-		return nil, err
+		return nil, rollbackContainerdConfig(ctx, backup, err)
 	}
-	// crictl config runtime-endpoint /run/containerd/containerd.sock
-	_, err = cmdutil.RunCmdWithContext(ctx, opts.DryRun, "crictl", "config", "runtime-endpoint", "/run/containerd/containerd.sock")
-	if err != nil {
-		return nil, err
+	opts.ReportProgress("containerd service enabled")
+	// the socket is read from the config rendered above
+	if err = configureCrictl(ctx, crictlConfigFile, ContainerdSocketOf(ContainerdConfigFile), opts.DryRun); err != nil {
+		return nil, rollbackContainerdConfig(ctx, backup, err)
 	}
-	logger.Debugf("install containerd successfully, online: %b", !runnable.Offline)
+	opts.ReportProgress("crictl runtime-endpoint configured")
+	backup.clean()
+	logger.FromContext(ctx).Debugf("install containerd successfully, online: %t", !runnable.Offline)
 	return nil, nil
 }
 
 func (runnable ContainerdRunnable) Uninstall(ctx context.Context, opts component.Options) ([]byte, error) {
+	ctx = runnable.withLogger(ctx)
+	log := logger.FromContext(ctx)
 	if err := runnable.disableContainerdService(ctx, opts.DryRun); err != nil {
 		return nil, err
 	}
+	opts.ReportProgress("containerd service disabled")
+	runnable.removeProxyDropIn(ctx, opts.DryRun)
 	// remove related binary configuration files
 	instance, err := downloader.NewInstance(ctx, criContainerd, runnable.Version, runtime.GOARCH, !runnable.Offline, opts.DryRun)
 	if err != nil {
 		return nil, err
 	}
 	if err = instance.RemoveConfigs(); err != nil {
-		logger.Error("remove contanierd configs compressed file failed", zap.Error(err))
-	}
-	// remove containerd run dir
-	if err = os.RemoveAll("/run/containerd"); err == nil {
-		logger.Debug("remove containerd config dir successfully")
+		log.Error("remove contanierd configs compressed file failed", zap.Error(err))
 	}
-	// remove containerd data dir
-	if err = os.RemoveAll(strutil.StringDefaultIfEmpty(containerdDefaultConfigDir, runnable.DataRootDir)); err == nil {
-		logger.Debug("remove containerd data dir successfully")
-	}
-	// remove containerd config dir
-	if err = os.RemoveAll(containerdDefaultConfigDir); err == nil {
-		logger.Debug("remove containerd config dir successfully")
+	opts.ReportProgress("containerd package removed")
+	removes, preserves := runnable.cleanupDirs()
+	for _, dir := range removes {
+		if err = os.RemoveAll(dir); err == nil {
+			log.Debug("remove containerd dir successfully", zap.String("dir", dir))
+		}
 	}
-	// remove containerd data
-	if err = os.RemoveAll(containerdDefaultDataDir); err == nil {
-		logger.Debug("remove containerd systemd config successfully")
+	if len(preserves) > 0 {
+		log.Info("containerd data is preserved", zap.Strings("dirs", preserves))
+		opts.ReportProgress("containerd configs removed, data preserved")
+	} else {
+		opts.ReportProgress("containerd data and configs removed")
 	}
-	logger.Debug("uninstall containerd successfully")
+	log.Debug("uninstall containerd successfully")
 	return nil, nil
 }
 
+func (runnable *ContainerdRunnable) Upgrade(ctx context.Context, opts component.Options) ([]byte, error) {
+	if runnable.Offline {
+		return runnable.OfflineUpgrade(ctx, opts.DryRun)
+	}
+	return runnable.OnlineUpgrade(ctx, opts.DryRun)
+}
+
 func (runnable *ContainerdRunnable) OfflineUpgrade(ctx context.Context, dryRun bool) ([]byte, error) {
-	return nil, fmt.Errorf("ContainerdRunnable dose not support offlineUpgrade")
+	return nil, runnable.upgrade(ctx, false, dryRun)
 }
 
 func (runnable *ContainerdRunnable) OnlineUpgrade(ctx context.Context, dryRun bool) ([]byte, error) {
-	return nil, fmt.Errorf("ContainerdRunnable not supported onlineUpgrade")
+	return nil, runnable.upgrade(ctx, true, dryRun)
+}
+
+// upgrade containerd to runnable.Version in place, the running containers survive the containerd restart,
+// so the node is not cordoned. The configs under /etc/containerd are kept as is.
+func (runnable *ContainerdRunnable) upgrade(ctx context.Context, online, dryRun bool) error {
+	ctx = runnable.withLogger(ctx)
+	log := logger.FromContext(ctx)
+	instance, err := downloader.NewInstance(ctx, criContainerd, runnable.Version, runtime.GOARCH, online, dryRun)
+	if err != nil {
+		return err
+	}
+	pkg, err := instance.WithRetry(runnable.DownloadRetries, runnable.DownloadRetryBackoff).
+		WithConfigsSHA256(runnable.BundleSHA256).DownloadConfigs()
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		log.Info("dry run upgrade containerd", zap.String("version", runnable.Version), zap.String("package", pkg))
+		return nil
+	}
+	staging, err := os.MkdirTemp("", "containerd-upgrade-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if _, err = cmdutil.RunCmdWithContext(ctx, false, "tar", "-zxf", pkg, "-C", staging); err != nil {
+		return err
+	}
+	files, err := stagedFiles(staging, "/", containerdDefaultConfigDir)
+	if err != nil {
+		return err
+	}
+	bin, err := exec.LookPath(criContainerd)
+	if err != nil {
+		bin = containerdDefaultBinary
+	}
+	src, ok := files[bin]
+	if !ok {
+		return fmt.Errorf("containerd binary %s is not found in package %s", bin, pkg)
+	}
+	delete(files, bin)
+	// the shims and runc are in use by the running containers, replace them by rename,
+	// they are restored with the containerd binary if the new containerd fails to start
+	backups, err := replaceFiles(files)
+	if err != nil {
+		if rbErr := backups.restore(); rbErr != nil {
+			log.Warn("restore containerd binaries failed", zap.Error(rbErr))
+		}
+		return err
+	}
+	start := func(ctx context.Context) error {
+		if _, err := cmdutil.RunCmdWithContext(ctx, false, "systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		return restartContainerd(ctx, false)
+	}
+	if err = SwapBinary(ctx, bin, src, SystemdService(criContainerd, "stop", false), start, false); err != nil {
+		if rbErr := backups.restore(); rbErr != nil {
+			log.Warn("restore containerd binaries failed", zap.Error(rbErr))
+		}
+		return err
+	}
+	backups.remove()
+	ec, err := cmdutil.RunCmdWithContext(ctx, false, bin, "--version")
+	if err != nil {
+		return err
+	}
+	if !containerdVersionMatch(ec.StdOut(), runnable.Version) {
+		return fmt.Errorf("containerd version is %s after upgrade, expect %s", strings.TrimSpace(ec.StdOut()), runnable.Version)
+	}
+	log.Info("upgrade containerd successfully", zap.String("version", runnable.Version))
+	return nil
+}
+
+// stagedFiles returns the regular files unpacked under staging, keyed by the install path under root.
+// The files under the skip dirs are excluded.
+func stagedFiles(staging, root string, skipDirs ...string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(staging, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(root, rel)
+		if d.IsDir() {
+			for _, dir := range skipDirs {
+				if dst == filepath.Join(root, dir) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files[dst] = path
+		}
+		return nil
+	})
+	return files, err
+}
+
+// replaceFile atomically replace dst with src, which does not fail with "text file busy" if dst is running.
+func replaceFile(dst, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := copyToTemp(dst, src)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replace %s failed:%w", dst, err)
+	}
+	return nil
+}
+
+// containerdVersionMatch whether the 'containerd --version' output is the version,
+// e.g. "containerd github.com/containerd/containerd v1.6.4 212e8b6fa2f44b9c21b2798135fc6fb7c53efc16"
+func containerdVersionMatch(output, version string) bool {
+	want := "v" + strings.TrimPrefix(version, "v")
+	for _, field := range strings.Fields(output) {
+		if field == want {
+			return true
+		}
+	}
+	return false
 }
 
 func (runnable *ContainerdRunnable) matchPauseVersion(kubeVersion string) (string, string) {
-	registry := "k8s.gcr.io"
 	if kubeVersion == "" {
-		return "", registry
+		return "", legacyPauseRegistry
 	}
-	kubeVersion = strings.ReplaceAll(kubeVersion, "v", "")
-	kubeVersion = strings.ReplaceAll(kubeVersion, ".", "")
-
-	kubeVersion = strings.Join(strings.Split(kubeVersion, "")[0:3], "")
+	return matchPauseVersion(kubeVersion)
+}
 
-	if v, _ := strconv.Atoi(kubeVersion); v >= 125 {
-		registry = "registry.k8s.io"
+// matchPauseVersion returns the pause version and registry of the kubernetes version.
+// The latest known pause version is used if the version is unknown, the oldest one if it is too old.
+func matchPauseVersion(kubeVersion string) (string, string) {
+	latest := k8sPauseVersions[len(k8sPauseVersions)-1]
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil {
+		logger.Warnf("parse kubernetes version %s failed: %v, use the latest known pause version %s", kubeVersion, err, latest.pause)
+		return latest.pause, pauseRegistry
+	}
+	registry := legacyPauseRegistry
+	if v.AtLeast(pauseRegistryMinVersion) {
+		registry = pauseRegistry
+	}
+	if v.Major() != 1 || v.Minor() > latest.minor {
+		logger.Warnf("unknown pause version of kubernetes %s, use the latest known pause version %s", kubeVersion, latest.pause)
+		return latest.pause, registry
 	}
-	return k8sMatchPauseVersion[kubeVersion], registry
+	for _, p := range k8sPauseVersions {
+		if p.minor == v.Minor() {
+			return p.pause, registry
+		}
+	}
+	oldest := k8sPauseVersions[0]
+	logger.Warnf("kubernetes %s is older than the supported versions, use the oldest known pause version %s", kubeVersion, oldest.pause)
+	return oldest.pause, registry
 }
 
 func (runnable *ContainerdRunnable) setupContainerdConfig(ctx context.Context, dryRun bool) error {
 	// local registry not filled and is in online mode, the default repo mirror proxy will be used
 	if !runnable.Offline && runnable.LocalRegistry == "" {
 		runnable.LocalRegistry = component.GetRepoMirror(ctx)
-		logger.Info("render containerd config, the default repo mirror proxy will be used", zap.String("local_registry", runnable.LocalRegistry))
+		logger.FromContext(ctx).Info("render containerd config, the default repo mirror proxy will be used", zap.String("local_registry", runnable.LocalRegistry))
 	}
 	if runnable.RegistryConfigDir == "" {
 		runnable.RegistryConfigDir = ContainerdDefaultRegistryConfigDir
@@ -238,12 +582,248 @@ func (runnable *ContainerdRunnable) setupContainerdConfig(ctx context.Context, d
 	if err := os.MkdirAll(containerdDefaultConfigDir, 0755); err != nil {
 		return err
 	}
+	if err := runnable.ensureNRIDirs(dryRun); err != nil {
+		return err
+	}
 	if err := fileutil.WriteFileWithContext(ctx, cf, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644, runnable.renderTo, dryRun); err != nil {
 		return err
 	}
 	return runnable.renderRegistryConfig(dryRun)
 }
 
+// containerdNoProxy the no proxy list of containerd, the local addresses, the pod and service cidrs
+// and the node ips are appended to the user list, so the in-cluster traffic never goes through the proxy.
+func containerdNoProxy(noProxy []string, cluster *v1.Cluster, nodeIPs []string) []string {
+	items := append([]string{"localhost", "127.0.0.1"}, noProxy...)
+	items = append(items, cluster.Networking.Pods.CIDRBlocks...)
+	items = append(items, cluster.Networking.Services.CIDRBlocks...)
+	items = append(items, nodeIPs...)
+	var list []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" && !sliceutil.HasString(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func stepNodeIPs(nodes []v1.StepNode) []string {
+	var ips []string
+	for _, node := range nodes {
+		for _, ip := range []string{node.IPv4, node.NodeIPv4} {
+			if ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// ProxyEnabled whether the proxy environments of containerd are set
+func (runnable *ContainerdRunnable) ProxyEnabled() bool {
+	return runnable.HTTPProxy != "" || runnable.HTTPSProxy != ""
+}
+
+func (runnable *ContainerdRunnable) renderProxyDropInTo(w io.Writer) error {
+	at := tmplutil.New()
+	_, err := at.RenderTo(w, containerdProxyDropInTemplate, runnable)
+	return err
+}
+
+// setupProxyDropIn render the proxy drop-in of containerd service, the stale drop-in is removed
+// if no proxy is set. The caller is responsible for the daemon-reload.
+func (runnable *ContainerdRunnable) setupProxyDropIn(ctx context.Context, dryRun bool) error {
+	if !runnable.ProxyEnabled() {
+		if dryRun {
+			return nil
+		}
+		if err := os.Remove(containerdProxyDropInFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove containerd proxy drop-in failed:%w", err)
+		}
+		return nil
+	}
+	if !dryRun {
+		if err := os.MkdirAll(filepath.Dir(containerdProxyDropInFile), 0755); err != nil {
+			return err
+		}
+	}
+	return fileutil.WriteFileWithContext(ctx, containerdProxyDropInFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644, runnable.renderProxyDropInTo, dryRun)
+}
+
+// removeProxyDropIn remove the proxy drop-in of containerd service on uninstall, the errors are ignored.
+func (runnable *ContainerdRunnable) removeProxyDropIn(ctx context.Context, dryRun bool) {
+	if dryRun {
+		return
+	}
+	if err := os.Remove(containerdProxyDropInFile); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.FromContext(ctx).Warn("remove containerd proxy drop-in failed", zap.Error(err))
+		}
+		return
+	}
+	if _, err := cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", "daemon-reload"); err != nil {
+		logger.FromContext(ctx).Warn("reload systemd after removing containerd proxy drop-in failed", zap.Error(err))
+	}
+}
+
+const (
+	// nriDefaultSocketPath the default socket of the containerd nri plugin
+	nriDefaultSocketPath = "/var/run/nri/nri.sock"
+	// nriPluginDir the dir of the pre-installed nri plugins started by containerd
+	nriPluginDir = "/opt/nri/plugins"
+	// nriPluginConfigDir the dir of the pre-installed nri plugin configs
+	nriPluginConfigDir = "/etc/nri/conf.d"
+)
+
+// NRISocket the socket_path of the nri plugin
+func (runnable *ContainerdRunnable) NRISocket() string {
+	return strutil.StringDefaultIfEmpty(nriDefaultSocketPath, runnable.NRISocketPath)
+}
+
+func (runnable *ContainerdRunnable) NRIPluginDir() string {
+	return nriPluginDir
+}
+
+func (runnable *ContainerdRunnable) NRIPluginConfigDir() string {
+	return nriPluginConfigDir
+}
+
+// ensureNRIDirs create the plugin dirs of nri, containerd fails to start the nri plugin without them.
+func (runnable *ContainerdRunnable) ensureNRIDirs(dryRun bool) error {
+	if !runnable.EnableNRI || dryRun {
+		return nil
+	}
+	for _, dir := range []string{runnable.NRIPluginDir(), runnable.NRIPluginConfigDir(), filepath.Dir(runnable.NRISocket())} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create nri dir %s failed:%w", dir, err)
+		}
+	}
+	return nil
+}
+
+// cleanupDirs returns the dirs removed on uninstall and the dirs preserved, the config dir
+// is always removed, the state dir and data dirs are preserved if PreserveData is set.
+func (runnable *ContainerdRunnable) cleanupDirs() (removes, preserves []string) {
+	dataDirs := []string{"/run/containerd"}
+	for _, dir := range []string{strutil.StringDefaultIfEmpty(containerdDefaultConfigDir, runnable.DataRootDir), containerdDefaultDataDir} {
+		if dir != containerdDefaultConfigDir && !sliceutil.HasString(dataDirs, dir) {
+			dataDirs = append(dataDirs, dir)
+		}
+	}
+	removes = []string{containerdDefaultConfigDir}
+	if runnable.PreserveData {
+		return removes, dataDirs
+	}
+	return append(removes, dataDirs...), nil
+}
+
+// ContainerdSocketOf the grpc address of the containerd config file, ContainerdSocket is returned
+// if the config file does not exist or the address is not set.
+func ContainerdSocketOf(configFile string) string {
+	tree, err := toml.LoadFile(configFile)
+	if err != nil {
+		return ContainerdSocket
+	}
+	if address, ok := tree.GetPath([]string{"grpc", "address"}).(string); ok && address != "" {
+		return address
+	}
+	return ContainerdSocket
+}
+
+// crictlConfigFile the default config file of crictl
+const crictlConfigFile = "/etc/crictl.yaml"
+
+// configureCrictl point crictl to the containerd socket. 'crictl config' is used if crictl is installed,
+// otherwise the config file is written directly, so the install does not depend on crictl.
+func configureCrictl(ctx context.Context, configFile, socket string, dryRun bool) error {
+	endpoint := "unix://" + socket
+	if _, err := exec.LookPath("crictl"); err == nil {
+		logger.FromContext(ctx).Info("configure crictl runtime-endpoint by crictl", zap.String("endpoint", endpoint))
+		// crictl config runtime-endpoint unix:///run/containerd/containerd.sock
+		_, err = cmdutil.RunCmdWithContext(ctx, dryRun, "crictl", "config", "runtime-endpoint", endpoint)
+		return err
+	}
+	logger.FromContext(ctx).Info("crictl is not found, write crictl config file", zap.String("file", configFile), zap.String("endpoint", endpoint))
+	content := fmt.Sprintf("runtime-endpoint: %s\nimage-endpoint: %s\n", endpoint, endpoint)
+	return fileutil.WriteFileWithContext(ctx, configFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644,
+		func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}, dryRun)
+}
+
+// fileBackup the copy of a file before it is overwritten, it is restored if the install fails.
+type fileBackup struct {
+	file    string
+	existed bool
+	dryRun  bool
+}
+
+func backupFile(file string, dryRun bool) (*fileBackup, error) {
+	b := &fileBackup{file: file, dryRun: dryRun}
+	if dryRun {
+		return b, nil
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return b, nil
+		}
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(b.path(), data, fi.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("backup %s failed:%w", file, err)
+	}
+	b.existed = true
+	return b, nil
+}
+
+func (b *fileBackup) path() string {
+	return b.file + ".bak"
+}
+
+// restore the file to the backup, or remove it if there was no file before.
+func (b *fileBackup) restore() error {
+	if b.dryRun {
+		return nil
+	}
+	if !b.existed {
+		if err := os.Remove(b.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.Rename(b.path(), b.file)
+}
+
+// clean remove the backup after the install succeeded.
+func (b *fileBackup) clean() {
+	if b.dryRun || !b.existed {
+		return
+	}
+	_ = os.Remove(b.path())
+}
+
+// rollbackContainerdConfig restore the previous config and restart the prior containerd service,
+// so the failed install does not leave the node with a new config and a dead service.
+func rollbackContainerdConfig(ctx context.Context, backup *fileBackup, cause error) error {
+	logger.FromContext(ctx).Warn("install containerd failed, rollback config", zap.String("config", backup.file), zap.Error(cause))
+	if err := backup.restore(); err != nil {
+		return fmt.Errorf("%v, rollback config %s failed:%w", cause, backup.file, err)
+	}
+	if !backup.existed || backup.dryRun {
+		return cause
+	}
+	if err := restartContainerd(ctx, false); err != nil {
+		return fmt.Errorf("%v, restart containerd with previous config failed:%w", cause, err)
+	}
+	return cause
+}
+
 func (runnable *ContainerdRunnable) enableContainerdService(ctx context.Context, dryRun bool) error {
 	_, err := cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", "daemon-reload")
 	if err != nil {
@@ -254,21 +834,104 @@ func (runnable *ContainerdRunnable) enableContainerdService(ctx context.Context,
 		return err
 	}
 	// restart containerd to active config, if it is already running
-	_, err = cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", "restart", "containerd")
-	if err != nil {
+	if err = restartContainerd(ctx, dryRun); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Debug("enable containerd systemd service successfully")
+	return nil
+}
+
+// containerdReadyTimeout the max time to wait for the containerd socket serving after restart
+const containerdReadyTimeout = time.Minute
+
+// restartContainerd restart containerd and wait until it is ready,
+// so the following crictl or ctr commands do not race against the restarting socket.
+func restartContainerd(ctx context.Context, dryRun bool) error {
+	if _, err := cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", "restart", "containerd"); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	if err := initsystem.WaitServiceActive("containerd", containerdReadyTimeout); err != nil {
 		return err
 	}
-	logger.Debug("enable containerd systemd service successfully")
+	return waitContainerdReady(ctx, ContainerdSocket, time.Second, containerdReadyTimeout)
+}
+
+// waitContainerdReady poll the containerd socket until it accepts connections or timeout.
+func waitContainerdReady(ctx context.Context, socket string, interval, timeout time.Duration) error {
+	err := wait.PollImmediateWithContext(ctx, interval, timeout, func(ctx context.Context) (bool, error) {
+		return netutil.Reachable("unix", socket, interval) == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait containerd socket %s ready failed:%w", socket, err)
+	}
+	logger.FromContext(ctx).Debug("containerd is ready", zap.String("socket", socket))
 	return nil
 }
 
 func (runnable *ContainerdRunnable) disableContainerdService(ctx context.Context, dryRun bool) error {
 	// the following command execution error is ignored
 	if _, err := cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", "stop", "containerd"); err != nil {
-		logger.Warn("stop systemd containerd service failed", zap.Error(err))
+		logger.FromContext(ctx).Warn("stop systemd containerd service failed", zap.Error(err))
 	}
 	if _, err := cmdutil.RunCmdWithContext(ctx, dryRun, "systemctl", "disable", "containerd"); err != nil {
-		logger.Warn("disable systemd containerd service failed", zap.Error(err))
+		logger.FromContext(ctx).Warn("disable systemd containerd service failed", zap.Error(err))
+	}
+	return nil
+}
+
+// systemdCgroupOf the containerd systemd cgroup setting of the cluster cgroup driver
+func systemdCgroupOf(cgroupDriver string) string {
+	switch cgroupDriver {
+	case v1.CgroupDriverSystemd:
+		return v1.SystemdCgroupTrue
+	case v1.CgroupDriverCgroupfs:
+		return v1.SystemdCgroupFalse
+	}
+	return v1.SystemdCgroupAuto
+}
+
+// IsCgroupV2 whether the node mounts the cgroup v2 hierarchy, which the auto cgroup driver
+// of kubelet and containerd both detect to choose the systemd cgroup driver.
+func IsCgroupV2(ctx context.Context, dryRun bool) (bool, error) {
+	res, err := cmdutil.RunCmdWithContext(ctx, dryRun, "bash", "-c", "cat /proc/self/mountinfo")
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(res.StdOut(), "cgroup2"), nil
+}
+
+// resolveSystemdCgroup returns the SystemdCgroup value of config.toml,
+// the explicit setting is honored and detect is only called for auto.
+func resolveSystemdCgroup(setting string, detect func() (bool, error)) (string, error) {
+	switch setting {
+	case v1.SystemdCgroupTrue, v1.SystemdCgroupFalse:
+		return setting, nil
+	case "", v1.SystemdCgroupAuto:
+		enabled, err := detect()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(enabled), nil
+	}
+	return "", fmt.Errorf("containerd dose not support systemd cgroup setting: %s", setting)
+}
+
+// checkTLSStreamingFiles the cert and key files of tls streaming must exist on the node,
+// otherwise containerd fails to start the cri plugin.
+func (runnable *ContainerdRunnable) checkTLSStreamingFiles() error {
+	if !runnable.EnableTLSStreaming {
+		return nil
+	}
+	for _, f := range []string{runnable.TLSStreamingCertFile, runnable.TLSStreamingKeyFile} {
+		if f == "" {
+			return fmt.Errorf("tls streaming cert file and key file are required")
+		}
+		if _, err := os.Stat(f); err != nil {
+			return fmt.Errorf("check tls streaming file %s failed:%w", f, err)
+		}
 	}
 	return nil
 }
@@ -293,22 +956,41 @@ func (runnable *ContainerdRunnable) renderRegistryConfig(dryRun bool) error {
 }
 
 type ContainerdRegistryConfigure struct {
-	Registries map[string]*ContainerdRegistry `json:"registries,omitempty"`
-	ConfigDir  string                         `json:"configDir"`
+	// ClusterName the cluster of the nodes, carried by the logs of the step
+	ClusterName string                         `json:"clusterName,omitempty"`
+	Registries  map[string]*ContainerdRegistry `json:"registries,omitempty"`
+	ConfigDir   string                         `json:"configDir"`
+	// ConfigFile the containerd config.toml, if it is set, the registry config_path
+	// of it is pointed to ConfigDir and containerd is restarted when it is changed.
+	ConfigFile string `json:"configFile,omitempty"`
+	// Incremental only the hosts of Registries are rendered and the hosts of RemovedHosts are deleted,
+	// the other host dirs are kept. Otherwise, the host dirs not in Registries are deleted.
+	Incremental  bool     `json:"incremental,omitempty"`
+	RemovedHosts []string `json:"removedHosts,omitempty"`
 }
 
 func (c *ContainerdRegistryConfigure) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	if err := validateRegistryConfigDir(c.ConfigDir); err != nil {
+		return nil, err
+	}
 	if opts.DryRun {
 		return nil, nil
 	}
-	entries, err := os.ReadDir(c.ConfigDir)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return nil, fmt.Errorf("read registry config dir:%s failed:%w", c.ConfigDir, err)
-	}
-	oldDirs := make(map[string]struct{}, len(entries))
-	for _, entry := range entries {
-		if entry.IsDir() {
-			oldDirs[entry.Name()] = struct{}{}
+	ctx = logger.IntoContext(ctx, component.StepLogger(ctx, criContainerd, c.ClusterName))
+	oldDirs := make(map[string]struct{})
+	if c.Incremental {
+		for _, host := range c.RemovedHosts {
+			oldDirs[strings.ToLower(host)] = struct{}{}
+		}
+	} else {
+		entries, err := os.ReadDir(c.ConfigDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read registry config dir:%s failed:%w", c.ConfigDir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				oldDirs[entry.Name()] = struct{}{}
+			}
 		}
 	}
 	for _, r := range c.Registries {
@@ -316,17 +998,92 @@ func (c *ContainerdRegistryConfigure) Install(ctx context.Context, opts componen
 		if err != nil {
 			return nil, fmt.Errorf("renderConfigs to %s failed:%w", c.ConfigDir, err)
 		}
-		delete(oldDirs, r.Server)
+		delete(oldDirs, strings.ToLower(r.Server))
 	}
 	for d := range oldDirs {
-		err = os.RemoveAll(filepath.Join(c.ConfigDir, d))
+		err := os.RemoveAll(filepath.Join(c.ConfigDir, d))
 		if err != nil {
-			logger.Errorf("clear old registry config dir: %s failed:%s", d, err)
+			logger.FromContext(ctx).Errorf("clear old registry config dir: %s failed:%s", d, err)
+		}
+	}
+	if c.ConfigFile == "" {
+		return nil, nil
+	}
+	changed, err := ensureRegistryConfigPath(c.ConfigFile, c.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
+	// the hosts dir is read on every pull, only the config.toml change needs a restart
+	if changed {
+		if err = restartContainerd(ctx, opts.DryRun); err != nil {
+			return nil, fmt.Errorf("restart containerd to apply registry config path failed:%w", err)
 		}
 	}
 	return nil, nil
 }
 
+// validateRegistryConfigDir check the registry config dir is an absolute path, the hosts dirs are
+// written relative to the working dir of the agent otherwise.
+func validateRegistryConfigDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("containerd registry config dir %q must be an absolute path", dir)
+	}
+	return nil
+}
+
+// criRegistryPath the toml path of the cri registry section, plugins."io.containerd.grpc.v1.cri".registry
+var criRegistryPath = []string{"plugins", "io.containerd.grpc.v1.cri", "registry"}
+
+// criRegistryLegacyKeys the deprecated registry keys, containerd refuses to start if they are not empty with config_path
+var criRegistryLegacyKeys = []string{"mirrors", "configs"}
+
+// ensureRegistryConfigPath point the registry config_path of containerd config file to dir,
+// it returns whether the config file is changed.
+// Only the cri registry section is merged into the config file, the other customizations are kept.
+func ensureRegistryConfigPath(configFile, dir string) (bool, error) {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return false, fmt.Errorf("read containerd config file:%s failed:%w", configFile, err)
+	}
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return false, fmt.Errorf("parse containerd config file:%s failed:%w", configFile, err)
+	}
+	changed := false
+	registry, ok := tree.GetPath(criRegistryPath).(*toml.Tree)
+	if !ok {
+		registry, err = toml.TreeFromMap(map[string]interface{}{})
+		if err != nil {
+			return false, err
+		}
+		tree.SetPath(criRegistryPath, registry)
+		changed = true
+	}
+	if path, _ := registry.Get("config_path").(string); path != dir {
+		registry.Set("config_path", dir)
+		changed = true
+	}
+	for _, key := range criRegistryLegacyKeys {
+		if legacy, ok := registry.Get(key).(*toml.Tree); ok && len(legacy.Keys()) > 0 {
+			if err = registry.Delete(key); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	data, err := tree.Marshal()
+	if err != nil {
+		return false, fmt.Errorf("encode containerd config file:%s failed:%w", configFile, err)
+	}
+	if err = os.WriteFile(configFile, data, 0644); err != nil {
+		return false, fmt.Errorf("write containerd config file:%s failed:%w", configFile, err)
+	}
+	return true, nil
+}
+
 func (c *ContainerdRegistryConfigure) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
 	return nil, nil
 }
@@ -347,6 +1104,13 @@ type ContainerdHost struct {
 	Capabilities []string
 	SkipVerify   bool
 	CA           []byte
+	// TrustOnFirstUse use the cert served by host and pinned by ContainerdRegistryCertPin as CA if CA is empty
+	TrustOnFirstUse bool
+	// Priority the lower priority host is tried first
+	Priority int
+	// Username and Password the basic auth credentials sent in the Authorization header
+	Username string
+	Password string
 }
 
 type ContainerdRegistry struct {
@@ -356,17 +1120,30 @@ type ContainerdRegistry struct {
 
 // generate hosts.toml and ca file
 func (h *ContainerdRegistry) renderConfigs(dir string) error {
-	hostDir := filepath.Join(dir, h.Server)
-	err := os.MkdirAll(hostDir, 0755)
+	// registry host is case-insensitive, keep one host dir for the different casings
+	server := strings.ToLower(h.Server)
+	hostDir := filepath.Join(dir, server)
+	err := os.MkdirAll(hostDir, registryDirMode)
 	if err != nil {
 		return err
 	}
+	// the host dir created by the previous versions may be writable by others
+	if err = os.Chmod(hostDir, registryDirMode); err != nil {
+		return err
+	}
 
 	c := HostFile{
-		Server:      h.Server,
+		Server:      server,
 		HostConfigs: make(map[string]HostFileConfig),
 	}
+	// the default hosts dir has no server of its own, the requested registry is the fallback
+	if server == v1.DefaultMirrorServer {
+		c.Server = ""
+	}
+	// the hosts.toml holding credentials is only readable by root
+	mode := registryFileMode
 	for _, host := range h.Hosts {
+		host.Host = strings.ToLower(host.Host)
 		var (
 			caFile     = ""
 			skipVerify *bool
@@ -377,9 +1154,15 @@ func (h *ContainerdRegistry) renderConfigs(dir string) error {
 		}
 		if len(host.CA) > 0 {
 			caFile = filepath.Join(hostDir, fmt.Sprintf("%s.pem", host.Host))
-			if err = os.WriteFile(caFile, host.CA, 0666); err != nil {
+			if err = writeFileIfChanged(caFile, host.CA, registryFileMode); err != nil {
 				return fmt.Errorf("write ca file:%s failed:%w", caFile, err)
 			}
+		} else if host.pinCert() {
+			// the cert is pinned by the ContainerdRegistryCertPin step before
+			caFile = pinnedCertFile(hostDir, host.Host)
+			if _, err = os.Stat(caFile); err != nil {
+				return fmt.Errorf("registry %s cert is not pinned:%w", host.Host, err)
+			}
 		}
 		hostConfig := HostFileConfig{
 			Capabilities: host.Capabilities,
@@ -388,14 +1171,55 @@ func (h *ContainerdRegistry) renderConfigs(dir string) error {
 		if caFile != "" {
 			hostConfig.CACert = caFile
 		}
-		c.HostConfigs[fmt.Sprintf("%s://%s", host.Scheme, host.Host)] = hostConfig
+		if host.Username != "" {
+			hostConfig.Header = map[string]interface{}{"Authorization": basicAuth(host.Username, host.Password)}
+			mode = registryAuthFileMode
+		}
+		key := fmt.Sprintf("%s://%s", host.Scheme, host.Host)
+		if _, ok := c.HostConfigs[key]; !ok {
+			c.hostOrder = append(c.hostOrder, key)
+		}
+		c.HostConfigs[key] = hostConfig
 	}
-	f, err := os.Create(filepath.Join(hostDir, "hosts.toml"))
-	if err != nil {
+	buf := &bytes.Buffer{}
+	if err = c.encodeTo(buf); err != nil {
+		return err
+	}
+	return writeFileIfChanged(filepath.Join(hostDir, "hosts.toml"), buf.Bytes(), mode)
+}
+
+const (
+	// registryDirMode and registryFileMode the modes of the registry host dirs and the hosts.toml and CA files,
+	// they are readable by all but only writable by root.
+	registryDirMode  os.FileMode = 0755
+	registryFileMode os.FileMode = 0644
+	// registryAuthFileMode the mode of the hosts.toml with the Authorization header, the only file holding
+	// the registry credentials on the node.
+	registryAuthFileMode os.FileMode = 0600
+)
+
+// basicAuth the value of the basic Authorization header
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// writeFileIfChanged write data to the file only if its content differs, so the unchanged files keep their mtime.
+// The mode of the existing file is set to perm before the content is written, so the credentials are never
+// written to a file readable by others.
+func writeFileIfChanged(file string, data []byte, perm os.FileMode) error {
+	if old, err := os.ReadFile(file); err == nil {
+		if err = os.Chmod(file, perm); err != nil {
+			return err
+		}
+		if bytes.Equal(old, data) {
+			return nil
+		}
+	}
+	if err := os.WriteFile(file, data, perm); err != nil {
 		return err
 	}
-	defer f.Close()
-	return toml.NewEncoder(f).Encode(c)
+	// the mode of the created file is masked by umask
+	return os.Chmod(file, perm)
 }
 
 type HostFileConfig struct {
@@ -442,25 +1266,118 @@ type HostFile struct {
 	Server string `toml:"server"`
 	// HostConfigs store the per-host configuration
 	HostConfigs map[string]HostFileConfig `toml:"host"`
+	// hostOrder the keys of HostConfigs in the order they are tried
+	hostOrder []string
+}
+
+// encodeTo writes the host sections in hostOrder, containerd tries the hosts in file order
+// while the toml encoder sorts the map keys.
+func (c *HostFile) encodeTo(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(struct {
+		Server string `toml:"server,omitempty"`
+	}{c.Server}); err != nil {
+		return err
+	}
+	keys := c.orderedHosts()
+	if len(keys) > 0 {
+		buf.WriteString("\n[host]\n")
+	}
+	for _, key := range keys {
+		hostBuf := &bytes.Buffer{}
+		if err := toml.NewEncoder(hostBuf).Encode(c.HostConfigs[key]); err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "\n  [host.%q]\n", key)
+		for _, line := range strings.Split(strings.TrimRight(hostBuf.String(), "\n"), "\n") {
+			// the sub tables of host, e.g. [header], must be nested under the host table
+			if trimmed := strings.TrimLeft(line, " "); strings.HasPrefix(trimmed, "[") {
+				line = line[:len(line)-len(trimmed)] + fmt.Sprintf("[host.%q.%s", key, trimmed[1:])
+			}
+			if line != "" {
+				buf.WriteString("    " + line)
+			}
+			buf.WriteString("\n")
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// orderedHosts returns the keys of HostConfigs in hostOrder, the keys not in hostOrder
+// are appended in lexical order, so the same HostFile always encodes to the same bytes.
+func (c *HostFile) orderedHosts() []string {
+	keys := make([]string, 0, len(c.HostConfigs))
+	seen := make(map[string]struct{}, len(c.HostConfigs))
+	for _, key := range c.hostOrder {
+		if _, ok := c.HostConfigs[key]; !ok {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	rest := make([]string, 0, len(c.HostConfigs)-len(keys))
+	for key := range c.HostConfigs {
+		if _, ok := seen[key]; !ok {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
 }
 
 func ToContainerdRegistryConfig(registries []v1.RegistrySpec) map[string]*ContainerdRegistry {
 	cfgs := make(map[string]*ContainerdRegistry, len(registries))
 	for _, r := range registries {
-		cfg, ok := cfgs[r.Host]
+		r.Host = strings.ToLower(r.Host)
+		server := registryServer(r)
+		cfg, ok := cfgs[server]
 		if !ok {
 			cfg = &ContainerdRegistry{
-				Server: r.Host,
+				Server: server,
 			}
-			cfgs[r.Host] = cfg
+			cfgs[server] = cfg
 		}
 		cfg.Hosts = append(cfg.Hosts, ContainerdHost{
-			Scheme:       r.Scheme,
-			Host:         r.Host,
-			Capabilities: []string{CapabilityPull, CapabilityResolve},
-			SkipVerify:   r.SkipVerify,
-			CA:           []byte(r.CA),
+			Scheme:          r.Scheme,
+			Host:            r.Host,
+			Capabilities:    []string{CapabilityPull, CapabilityResolve},
+			SkipVerify:      r.SkipVerify,
+			CA:              []byte(r.CA),
+			TrustOnFirstUse: r.TrustOnFirstUse,
+			Priority:        r.Priority,
+			Username:        r.Username,
+			Password:        r.Password,
+		})
+	}
+	for _, cfg := range cfgs {
+		sortHosts(cfg.Hosts)
+		// the mirrors are tried before the server itself regardless of priority
+		sort.SliceStable(cfg.Hosts, func(i, j int) bool {
+			return cfg.Hosts[i].Host != cfg.Server && cfg.Hosts[j].Host == cfg.Server
 		})
 	}
 	return cfgs
 }
+
+// registryServer the server which the registry hosts belong to, the host is the server unless it mirrors another one.
+func registryServer(r v1.RegistrySpec) string {
+	if r.MirrorFor != "" {
+		return strings.ToLower(r.MirrorFor)
+	}
+	return strings.ToLower(r.Host)
+}
+
+// sortHosts sort the hosts by priority ascending, the hosts of same priority are sorted by host string,
+// and keep the original order if both are equal.
+func sortHosts(hosts []ContainerdHost) {
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if hosts[i].Priority != hosts[j].Priority {
+			return hosts[i].Priority < hosts[j].Priority
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+}
@@ -2,12 +2,17 @@ package cri
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/pelletier/go-toml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -143,3 +148,576 @@ func TestContainerdRegistryRender(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, exp, string(hostConfig))
 }
+
+func TestContainerdRunnable_renderTo_maxConcurrentDownloads(t *testing.T) {
+	runnable := &ContainerdRunnable{
+		Base: Base{
+			Version:     "1.7.2",
+			DataRootDir: "/var/lib/containerd",
+		},
+		PauseVersion:           "3.9",
+		EnableSystemdCgroup:    "true",
+		MaxConcurrentDownloads: 10,
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, runnable.renderTo(w))
+	tree, err := toml.LoadBytes(w.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), tree.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "max_concurrent_downloads"}))
+
+	// the key is omitted when it is not set, containerd uses its default
+	runnable.MaxConcurrentDownloads = 0
+	w.Reset()
+	require.NoError(t, runnable.renderTo(w))
+	assert.NotContains(t, w.String(), "max_concurrent_downloads")
+}
+
+func TestContainerdRunnable_renderTo_tlsStreaming(t *testing.T) {
+	tests := []struct {
+		name      string
+		enable    bool
+		wantLines []string
+	}{
+		{
+			name: "disabled",
+			wantLines: []string{
+				"enable_tls_streaming = false",
+				`tls_cert_file = ""`,
+				`tls_key_file = ""`,
+			},
+		},
+		{
+			name:   "enabled",
+			enable: true,
+			wantLines: []string{
+				"enable_tls_streaming = true",
+				`tls_cert_file = "/etc/containerd/certs/stream.crt"`,
+				`tls_key_file = "/etc/containerd/certs/stream.key"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnable := &ContainerdRunnable{
+				Base: Base{
+					Version:     "1.6.4",
+					DataRootDir: "/var/lib/containerd",
+				},
+				PauseVersion:         "3.2",
+				EnableTLSStreaming:   tt.enable,
+				TLSStreamingCertFile: "/etc/containerd/certs/stream.crt",
+				TLSStreamingKeyFile:  "/etc/containerd/certs/stream.key",
+			}
+			w := &bytes.Buffer{}
+			if err := runnable.renderTo(w); err != nil {
+				t.Fatalf("renderTo() error = %v", err)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(w.String(), line) {
+					t.Errorf("renderTo() should contain %q", line)
+				}
+			}
+		})
+	}
+}
+
+func TestContainerdRunnable_renderTo_nri(t *testing.T) {
+	tests := []struct {
+		name       string
+		enable     bool
+		socketPath string
+		wantSocket string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:       "enabled with default socket",
+			enable:     true,
+			wantSocket: "/var/run/nri/nri.sock",
+		},
+		{
+			name:       "enabled with custom socket",
+			enable:     true,
+			socketPath: "/run/nri/custom.sock",
+			wantSocket: "/run/nri/custom.sock",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnable := &ContainerdRunnable{
+				Base: Base{
+					Version:     "1.7.2",
+					DataRootDir: "/var/lib/containerd",
+				},
+				PauseVersion:        "3.9",
+				EnableSystemdCgroup: "true",
+				EnableNRI:           tt.enable,
+				NRISocketPath:       tt.socketPath,
+			}
+			w := &bytes.Buffer{}
+			require.NoError(t, runnable.renderTo(w))
+			tree, err := toml.LoadBytes(w.Bytes())
+			require.NoError(t, err)
+			nri, ok := tree.GetPath([]string{"plugins", "io.containerd.nri.v1.nri"}).(*toml.Tree)
+			if !tt.enable {
+				assert.False(t, ok, "nri plugin should not be rendered")
+				return
+			}
+			require.True(t, ok, "nri plugin should be rendered")
+			assert.Equal(t, false, nri.Get("disable"))
+			assert.Equal(t, tt.wantSocket, nri.Get("socket_path"))
+			assert.Equal(t, "/opt/nri/plugins", nri.Get("plugin_path"))
+			assert.Equal(t, "/etc/nri/conf.d", nri.Get("plugin_config_path"))
+		})
+	}
+}
+
+func TestContainerdRunnable_renderTo_discardUnpackedLayers(t *testing.T) {
+	for _, discard := range []bool{false, true} {
+		runnable := &ContainerdRunnable{
+			Base: Base{
+				Version:     "1.7.2",
+				DataRootDir: "/var/lib/containerd",
+			},
+			PauseVersion:          "3.9",
+			EnableSystemdCgroup:   "true",
+			DiscardUnpackedLayers: discard,
+		}
+		w := &bytes.Buffer{}
+		require.NoError(t, runnable.renderTo(w))
+		tree, err := toml.LoadBytes(w.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, discard, tree.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "discard_unpacked_layers"}))
+	}
+}
+
+func TestContainerdRunnable_renderTo_registryConfigDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs.d")
+	runnable := &ContainerdRunnable{
+		Base: Base{
+			Version:     "1.7.2",
+			DataRootDir: "/var/lib/containerd",
+			Registies:   []v1.RegistrySpec{{Scheme: "https", Host: "local.registry.com"}},
+		},
+		PauseVersion:        "3.9",
+		EnableSystemdCgroup: "true",
+		RegistryConfigDir:   dir,
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, runnable.renderTo(w))
+	tree, err := toml.LoadBytes(w.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, dir, tree.GetPath(append(criRegistryPath, "config_path")))
+	assert.NotContains(t, w.String(), ContainerdDefaultRegistryConfigDir)
+
+	// the hosts.toml is rendered to the same dir referenced by config_path
+	require.NoError(t, runnable.renderRegistryConfig(false))
+	_, err = os.Stat(filepath.Join(dir, "local.registry.com", "hosts.toml"))
+	assert.NoError(t, err)
+}
+
+func TestContainerdRunnable_renderTo_log(t *testing.T) {
+	runnable := &ContainerdRunnable{
+		Base: Base{
+			Version:     "1.7.2",
+			DataRootDir: "/var/lib/containerd",
+		},
+		PauseVersion:        "3.9",
+		EnableSystemdCgroup: "true",
+		LogLevel:            v1.ContainerdLogLevelDebug,
+		LogFormat:           v1.ContainerdLogFormatJSON,
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, runnable.renderTo(w))
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configFile, w.Bytes(), 0644))
+
+	// the registry update rewrites config_path only, the log settings are kept
+	changed, err := ensureRegistryConfigPath(configFile, filepath.Join(t.TempDir(), "certs.d"))
+	require.NoError(t, err)
+	require.True(t, changed)
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	tree, err := toml.LoadBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, "debug", tree.GetPath([]string{"debug", "level"}))
+	assert.Equal(t, "json", tree.GetPath([]string{"debug", "format"}))
+}
+
+func TestContainerdNoProxy(t *testing.T) {
+	cluster := &v1.Cluster{}
+	cluster.Networking.Pods.CIDRBlocks = []string{"172.25.0.0/16"}
+	cluster.Networking.Services.CIDRBlocks = []string{"10.96.0.0/16"}
+	got := containerdNoProxy([]string{" .example.com", "127.0.0.1", ""}, cluster, []string{"192.168.10.1", "192.168.10.1", "192.168.10.2"})
+	assert.Equal(t, []string{
+		"localhost", "127.0.0.1", ".example.com", "172.25.0.0/16", "10.96.0.0/16", "192.168.10.1", "192.168.10.2",
+	}, got)
+}
+
+func TestContainerdRunnable_renderProxyDropInTo(t *testing.T) {
+	runnable := &ContainerdRunnable{
+		HTTPProxy: "http://proxy.example.com:3128",
+		NoProxy:   []string{"localhost", "10.96.0.0/16"},
+	}
+	assert.True(t, runnable.ProxyEnabled())
+	w := &bytes.Buffer{}
+	require.NoError(t, runnable.renderProxyDropInTo(w))
+	assert.Equal(t, `[Service]
+Environment="HTTP_PROXY=http://proxy.example.com:3128"
+Environment="NO_PROXY=localhost,10.96.0.0/16"
+`, w.String())
+
+	assert.False(t, (&ContainerdRunnable{NoProxy: []string{"localhost"}}).ProxyEnabled())
+}
+
+func TestContainerdRunnable_checkTLSStreamingFiles(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "stream.crt")
+	key := filepath.Join(dir, "stream.key")
+	require.NoError(t, os.WriteFile(cert, []byte("cert"), 0600))
+	require.NoError(t, os.WriteFile(key, []byte("key"), 0600))
+
+	runnable := &ContainerdRunnable{}
+	assert.NoError(t, runnable.checkTLSStreamingFiles())
+
+	runnable.EnableTLSStreaming = true
+	assert.Error(t, runnable.checkTLSStreamingFiles())
+
+	runnable.TLSStreamingCertFile, runnable.TLSStreamingKeyFile = cert, filepath.Join(dir, "missing.key")
+	assert.Error(t, runnable.checkTLSStreamingFiles())
+
+	runnable.TLSStreamingKeyFile = key
+	assert.NoError(t, runnable.checkTLSStreamingFiles())
+}
+
+func Test_resolveSystemdCgroup(t *testing.T) {
+	tests := []struct {
+		name       string
+		setting    string
+		detected   bool
+		want       string
+		wantDetect bool
+		wantErr    bool
+	}{
+		{name: "empty is auto", setting: "", detected: true, want: "true", wantDetect: true},
+		{name: "auto cgroup v1", setting: v1.SystemdCgroupAuto, detected: false, want: "false", wantDetect: true},
+		{name: "auto cgroup v2", setting: v1.SystemdCgroupAuto, detected: true, want: "true", wantDetect: true},
+		{name: "explicit true", setting: v1.SystemdCgroupTrue, detected: false, want: "true"},
+		{name: "explicit false", setting: v1.SystemdCgroupFalse, detected: true, want: "false"},
+		{name: "invalid", setting: "yes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			got, err := resolveSystemdCgroup(tt.setting, func() (bool, error) {
+				called = true
+				return tt.detected, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveSystemdCgroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantDetect, called)
+		})
+	}
+}
+
+func Test_waitContainerdReady(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	err := waitContainerdReady(context.TODO(), socket, 10*time.Millisecond, 50*time.Millisecond)
+	assert.Error(t, err)
+
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+	assert.NoError(t, waitContainerdReady(context.TODO(), socket, 10*time.Millisecond, time.Second))
+}
+
+func TestToContainerdRegistryConfig_priority(t *testing.T) {
+	hosts := []ContainerdHost{
+		{Scheme: "https", Host: "upstream.registry.com", Priority: 10},
+		{Scheme: "https", Host: "b.mirror.com", Priority: 1},
+		{Scheme: "http", Host: "a.mirror.com", Priority: 1},
+		{Scheme: "https", Host: "a.mirror.com", Priority: 1},
+		{Scheme: "https", Host: "default.registry.com"},
+	}
+	sortHosts(hosts)
+	var got []string
+	for _, h := range hosts {
+		got = append(got, fmt.Sprintf("%s://%s", h.Scheme, h.Host))
+	}
+	// same priority sorted by host, same host keeps the original order
+	assert.Equal(t, []string{
+		"https://default.registry.com",
+		"http://a.mirror.com",
+		"https://a.mirror.com",
+		"https://b.mirror.com",
+		"https://upstream.registry.com",
+	}, got)
+
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "local.registry.com", Priority: 2},
+		{Scheme: "http", Host: "local.registry.com", Priority: 1},
+	})
+	require.Len(t, cfgs["local.registry.com"].Hosts, 2)
+	assert.Equal(t, "http", cfgs["local.registry.com"].Hosts[0].Scheme)
+
+	// hosts.toml keeps the priority order instead of sorting the host keys
+	dir := t.TempDir()
+	r := ContainerdRegistry{
+		Server: "docker.io",
+		Hosts: []ContainerdHost{
+			{Scheme: "https", Host: "z.mirror.com", Capabilities: []string{CapabilityPull}},
+			{Scheme: "https", Host: "a.mirror.com", Capabilities: []string{CapabilityPull}},
+		},
+	}
+	require.NoError(t, r.renderConfigs(dir))
+	hostConfig, err := os.ReadFile(filepath.Join(dir, "docker.io", "hosts.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, `server = "docker.io"
+
+[host]
+
+  [host."https://z.mirror.com"]
+    capabilities = ["pull"]
+
+  [host."https://a.mirror.com"]
+    capabilities = ["pull"]
+`, string(hostConfig))
+}
+
+func TestToContainerdRegistryConfig_caseInsensitive(t *testing.T) {
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "Local.Registry.com"},
+		{Scheme: "https", Host: "local.registry.com"},
+	})
+	require.Len(t, cfgs, 1)
+	r, ok := cfgs["local.registry.com"]
+	require.True(t, ok)
+
+	dir := t.TempDir()
+	require.NoError(t, r.renderConfigs(dir))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "local.registry.com", entries[0].Name())
+	hostConfig, err := os.ReadFile(filepath.Join(dir, "local.registry.com", "hosts.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(hostConfig), `[host."https://local.registry.com"]`))
+}
+
+func TestToContainerdRegistryConfig_mirrorFor(t *testing.T) {
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "docker.io"},
+		{Scheme: "https", Host: "backup.mirror.com", MirrorFor: "docker.io", Priority: 2},
+		{Scheme: "https", Host: "primary.mirror.com", MirrorFor: "Docker.io", Priority: 1},
+		{Scheme: "https", Host: "local.registry.com"},
+	})
+	require.Len(t, cfgs, 2)
+	r, ok := cfgs["docker.io"]
+	require.True(t, ok)
+	var got []string
+	for _, h := range r.Hosts {
+		got = append(got, h.Host)
+	}
+	// the mirrors are tried by priority before the server itself
+	assert.Equal(t, []string{"primary.mirror.com", "backup.mirror.com", "docker.io"}, got)
+	require.Len(t, cfgs["local.registry.com"].Hosts, 1)
+}
+
+func TestFileBackup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte("old"), 0644))
+
+	b, err := backupFile(file, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, []byte("new"), 0644))
+	require.NoError(t, b.restore())
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	assert.NoFileExists(t, b.path())
+
+	// the backup is removed after a successful install
+	b, err = backupFile(file, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, []byte("new"), 0644))
+	b.clean()
+	assert.NoFileExists(t, b.path())
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	// the config written by the failed first install is removed
+	fresh := filepath.Join(dir, "fresh.toml")
+	b, err = backupFile(fresh, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fresh, []byte("new"), 0644))
+	cause := fmt.Errorf("enable containerd failed")
+	assert.Equal(t, cause, rollbackContainerdConfig(context.TODO(), b, cause))
+	assert.NoFileExists(t, fresh)
+}
+
+func TestMatchPauseVersion(t *testing.T) {
+	tests := []struct {
+		kubeVersion string
+		pause       string
+		registry    string
+	}{
+		{kubeVersion: "", pause: "", registry: "k8s.gcr.io"},
+		{kubeVersion: "v1.18.0", pause: "3.2", registry: "k8s.gcr.io"},
+		{kubeVersion: "v1.24.17", pause: "3.7", registry: "k8s.gcr.io"},
+		{kubeVersion: "v1.25.0", pause: "3.8", registry: "registry.k8s.io"},
+		{kubeVersion: "1.27.3", pause: "3.9", registry: "registry.k8s.io"},
+		{kubeVersion: "v1.30.1", pause: "3.9", registry: "registry.k8s.io"},
+		{kubeVersion: "v1.31.0", pause: "3.10", registry: "registry.k8s.io"},
+		// unknown versions fall back to the latest or oldest known pause
+		{kubeVersion: "v1.35.0", pause: "3.10", registry: "registry.k8s.io"},
+		{kubeVersion: "v1.16.2", pause: "3.2", registry: "k8s.gcr.io"},
+		{kubeVersion: "invalid", pause: "3.10", registry: "registry.k8s.io"},
+	}
+	runnable := &ContainerdRunnable{}
+	for _, tt := range tests {
+		t.Run(tt.kubeVersion, func(t *testing.T) {
+			pause, registry := runnable.matchPauseVersion(tt.kubeVersion)
+			assert.Equal(t, tt.pause, pause)
+			assert.Equal(t, tt.registry, registry)
+		})
+	}
+}
+
+func TestConfigureCrictl_withoutCrictl(t *testing.T) {
+	// crictl is not on the PATH
+	t.Setenv("PATH", t.TempDir())
+	file := filepath.Join(t.TempDir(), "crictl.yaml")
+	require.NoError(t, configureCrictl(context.TODO(), file, "/data/containerd/containerd.sock", false))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "runtime-endpoint: unix:///data/containerd/containerd.sock\n"+
+		"image-endpoint: unix:///data/containerd/containerd.sock\n", string(data))
+}
+
+func TestContainerdRunnable_cleanupDirs(t *testing.T) {
+	runnable := &ContainerdRunnable{Base: Base{DataRootDir: "/data/containerd"}}
+	removes, preserves := runnable.cleanupDirs()
+	assert.Equal(t, []string{"/etc/containerd", "/run/containerd", "/data/containerd", "/var/lib/containerd"}, removes)
+	assert.Empty(t, preserves)
+
+	runnable.PreserveData = true
+	removes, preserves = runnable.cleanupDirs()
+	assert.Equal(t, []string{"/etc/containerd"}, removes)
+	assert.Equal(t, []string{"/run/containerd", "/data/containerd", "/var/lib/containerd"}, preserves)
+
+	// the default data root is the same as the data dir
+	runnable.DataRootDir = "/var/lib/containerd"
+	_, preserves = runnable.cleanupDirs()
+	assert.Equal(t, []string{"/run/containerd", "/var/lib/containerd"}, preserves)
+}
+
+func TestHostFile_encodeTo_stable(t *testing.T) {
+	skipVerify := true
+	c := HostFile{
+		Server: "docker.io",
+		HostConfigs: map[string]HostFileConfig{
+			"https://c.registry.com": {Capabilities: []string{CapabilityPull}},
+			"https://a.registry.com": {Capabilities: []string{CapabilityPull}, SkipVerify: &skipVerify},
+			"http://b.registry.com": {
+				Capabilities: []string{CapabilityPull, CapabilityResolve},
+				Header:       map[string]interface{}{"x-b": "b", "x-a": "a", "x-c": "c"},
+			},
+		},
+		hostOrder: []string{"https://c.registry.com"},
+	}
+	first := &bytes.Buffer{}
+	require.NoError(t, c.encodeTo(first))
+	for i := 0; i < 50; i++ {
+		w := &bytes.Buffer{}
+		require.NoError(t, c.encodeTo(w))
+		require.Equal(t, first.String(), w.String(), "encode %d differs", i)
+	}
+
+	// ordered hosts first, then the others in lexical order
+	out := first.String()
+	c1 := strings.Index(out, `[host."https://c.registry.com"]`)
+	b := strings.Index(out, `[host."http://b.registry.com"]`)
+	a := strings.Index(out, `[host."https://a.registry.com"]`)
+	assert.True(t, c1 >= 0 && c1 < b && b < a, out)
+
+	tree, err := toml.LoadBytes(first.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "a", tree.GetPath([]string{"host", "http://b.registry.com", "header", "x-a"}))
+}
+
+func TestContainerdRunnable_renderTo_runtimes(t *testing.T) {
+	runnable := &ContainerdRunnable{
+		Base: Base{
+			Version:     "1.7.2",
+			DataRootDir: "/var/lib/containerd",
+		},
+		PauseVersion:        "3.9",
+		EnableSystemdCgroup: "true",
+		Runtimes: []v1.CRIRuntimeHandler{
+			{Name: "nvidia", BinaryName: "/usr/bin/nvidia-container-runtime"},
+			{Name: "kata", RuntimeType: "io.containerd.kata.v2"},
+		},
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, runnable.renderTo(w))
+	tree, err := toml.LoadBytes(w.Bytes())
+	require.NoError(t, err)
+	runtimes := []string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes"}
+	assert.Equal(t, "io.containerd.runc.v2", tree.GetPath(append(runtimes, "runc", "runtime_type")))
+	assert.Equal(t, "io.containerd.runc.v2", tree.GetPath(append(runtimes, "nvidia", "runtime_type")))
+	assert.Equal(t, "/usr/bin/nvidia-container-runtime", tree.GetPath(append(runtimes, "nvidia", "options", "BinaryName")))
+	assert.Equal(t, true, tree.GetPath(append(runtimes, "nvidia", "options", "SystemdCgroup")))
+	assert.Equal(t, "io.containerd.kata.v2", tree.GetPath(append(runtimes, "kata", "runtime_type")))
+	// the runc options are not set for the other shims
+	assert.Nil(t, tree.GetPath(append(runtimes, "kata", "options", "BinaryName")))
+	assert.Nil(t, tree.GetPath(append(runtimes, "kata", "options", "SystemdCgroup")))
+}
+
+func TestContainerdRunnable_runtimeGroupCommands(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "n1"}, {ID: "gpu1"}, {ID: "n2"}, {ID: "gpu2"}}
+	nvidia := []v1.CRIRuntimeHandler{{Name: "nvidia", BinaryName: "/usr/bin/nvidia-container-runtime"}}
+	groups, err := ContainerdRunnable{}.runtimeGroupCommands([]v1.CRIRuntimeGroup{
+		{Nodes: []string{"absent"}, Runtimes: []v1.CRIRuntimeHandler{{Name: "kata"}}},
+		{Nodes: []string{"gpu1", "gpu2"}, Runtimes: nvidia},
+	}, nodes)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, []v1.StepNode{{ID: "n1"}, {ID: "n2"}}, groups[0].nodes)
+	var runnable ContainerdRunnable
+	require.NoError(t, json.Unmarshal(groups[0].command, &runnable))
+	assert.Empty(t, runnable.Runtimes)
+
+	assert.Equal(t, []v1.StepNode{{ID: "gpu1"}, {ID: "gpu2"}}, groups[1].nodes)
+	runnable = ContainerdRunnable{}
+	require.NoError(t, json.Unmarshal(groups[1].command, &runnable))
+	assert.Equal(t, nvidia, runnable.Runtimes)
+
+	groups, err = ContainerdRunnable{}.runtimeGroupCommands(nil, nodes)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, nodes, groups[0].nodes)
+}
+
+func TestContainerdRunnable_InitStep_registryConfigDir(t *testing.T) {
+	cluster := &v1.Cluster{ContainerRuntime: v1.ContainerRuntime{Type: v1.CRIContainerd, Version: "1.6.4"}}
+	nodes := []v1.StepNode{{ID: "node-1", IPv4: "10.0.0.1"}}
+
+	runnable := &ContainerdRunnable{}
+	require.NoError(t, runnable.InitStep(context.TODO(), cluster, nodes))
+	assert.Equal(t, ContainerdDefaultRegistryConfigDir, runnable.RegistryConfigDir)
+
+	runnable = &ContainerdRunnable{RegistryConfigDir: "/data/containerd/certs.d"}
+	require.NoError(t, runnable.InitStep(context.TODO(), cluster, nodes))
+	assert.Equal(t, "/data/containerd/certs.d", runnable.RegistryConfigDir)
+
+	runnable = &ContainerdRunnable{RegistryConfigDir: "containerd/certs.d"}
+	err := runnable.InitStep(context.TODO(), cluster, nodes)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be an absolute path")
+}
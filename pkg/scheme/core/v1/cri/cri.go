@@ -21,34 +21,28 @@ package cri
 import (
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/util/version"
+
 	"github.com/kubeclipper/kubeclipper/pkg/component"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 )
 
 func init() {
-	if err := component.RegisterAgentStep(
+	component.AddAgentStep(
 		fmt.Sprintf(component.RegisterStepKeyFormat, criContainerd, criVersion, component.TypeStep),
-		&ContainerdRunnable{}); err != nil {
-		panic(err)
-	}
+		&ContainerdRunnable{})
 
-	if err := component.RegisterAgentStep(
+	component.AddAgentStep(
 		fmt.Sprintf(component.RegisterStepKeyFormat, criDocker, criVersion, component.TypeStep),
-		&DockerRunnable{}); err != nil {
-		panic(err)
-	}
+		&DockerRunnable{})
 
-	if err := component.RegisterAgentStep(
+	component.AddAgentStep(
 		ContainerdRegistryConfigureIdentity,
-		&ContainerdRegistryConfigure{}); err != nil {
-		panic(err)
-	}
+		&ContainerdRegistryConfigure{})
 
-	if err := component.RegisterAgentStep(
+	component.AddAgentStep(
 		DockerInsecureRegistryConfigureIdentity,
-		&DockerInsecureRegistryConfigure{}); err != nil {
-		panic(err)
-	}
+		&DockerInsecureRegistryConfigure{})
 }
 
 const (
@@ -69,6 +63,12 @@ const (
 	ContainerdDefaultRegistryConfigDir = "/etc/containerd/certs.d"
 	// containerdDefaultSystemdDir = "/etc/systemd/system"
 	containerdDefaultDataDir = "/var/lib/containerd"
+	ContainerdSocket         = "/run/containerd/containerd.sock"
+	containerdDefaultBinary  = "/usr/local/bin/containerd"
+	// containerdProxyDropInFile the systemd drop-in of the containerd proxy environments
+	containerdProxyDropInFile = "/etc/systemd/system/containerd.service.d/http-proxy.conf"
+	// ContainerdConfigFile the config file of containerd, the grpc address in it overrides ContainerdSocket
+	ContainerdConfigFile = "/etc/containerd/config.toml"
 )
 
 var (
@@ -78,24 +78,39 @@ var (
 		component.RegisterStepKeyFormat, criContainerd, criVersion, component.TypeRegistryConfigure)
 )
 
-var k8sMatchPauseVersion = map[string]string{
-	"118": "3.2",
-	"119": "3.2",
-	"120": "3.2",
-	"121": "3.4.1",
-	"122": "3.5",
-	"123": "3.6",
-	"124": "3.7",
-	"125": "3.8",
-	"126": "3.9",
-	"127": "3.9",
-	"128": "3.9",
-	"129": "3.9",
-	"130": "3.9",
+// k8sPauseVersions the pause image version used by kubeadm of each kubernetes minor version, ordered by the minor version.
+// Add the new minor version here when it is supported.
+var k8sPauseVersions = []struct {
+	minor uint
+	pause string
+}{
+	{18, "3.2"},
+	{19, "3.2"},
+	{20, "3.2"},
+	{21, "3.4.1"},
+	{22, "3.5"},
+	{23, "3.6"},
+	{24, "3.7"},
+	{25, "3.8"},
+	{26, "3.9"},
+	{27, "3.9"},
+	{28, "3.9"},
+	{29, "3.9"},
+	{30, "3.9"},
+	{31, "3.10"},
 }
 
+const (
+	legacyPauseRegistry = "k8s.gcr.io"
+	pauseRegistry       = "registry.k8s.io"
+)
+
+// pauseRegistryMinVersion the pause image is published to registry.k8s.io since kubernetes v1.25
+var pauseRegistryMinVersion = version.MustParseGeneric("1.25.0")
+
 var _ component.StepRunnable = (*ContainerdRunnable)(nil)
 var _ component.StepRunnable = (*DockerRunnable)(nil)
+var _ component.Upgradable = (*ContainerdRunnable)(nil)
 
 type Base struct {
 	Version     string            `json:"version,omitempty"`
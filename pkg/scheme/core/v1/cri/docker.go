@@ -84,6 +84,13 @@ func (runnable *DockerRunnable) InitStep(ctx context.Context, cluster *v1.Cluste
 				},
 			},
 		}
+		preflight, err := RegistryPreflightStep(cluster.Status.Registries, nodes)
+		if err != nil {
+			return err
+		}
+		if preflight != nil {
+			runnable.installSteps = append([]v1.Step{*preflight}, runnable.installSteps...)
+		}
 	}
 	if len(runnable.uninstallSteps) == 0 {
 		runnable.uninstallSteps = []v1.Step{
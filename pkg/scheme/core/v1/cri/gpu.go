@@ -0,0 +1,158 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	// NvidiaRuntimeName the containerd runtime handler and the RuntimeClass of the gpu nodes
+	NvidiaRuntimeName = "nvidia"
+	// nvidiaRuntimeBinary the oci runtime installed by the nvidia container toolkit
+	nvidiaRuntimeBinary = "/usr/bin/nvidia-container-runtime"
+)
+
+// nvidiaDriverVersionFile exists only if the nvidia kernel driver is loaded
+var nvidiaDriverVersionFile = "/proc/driver/nvidia/version"
+
+var GPUPreflightIdentity = fmt.Sprintf(
+	component.RegisterStepKeyFormat, "gpu-preflight", criVersion, component.TypeStep)
+
+func init() {
+	component.AddAgentStep(GPUPreflightIdentity, &GPUPreflight{})
+}
+
+var _ component.StepRunnable = (*GPUPreflight)(nil)
+
+// GPUPreflight checks the nvidia container runtime and the nvidia driver on the gpu nodes,
+// containerd starts the nvidia runtime handler without them but every gpu pod fails.
+type GPUPreflight struct {
+	RuntimeBinary string `json:"runtimeBinary"`
+}
+
+func (p *GPUPreflight) NewInstance() component.ObjectMeta {
+	return &GPUPreflight{}
+}
+
+// Install the check is read-only, so it runs the same with opts.DryRun.
+func (p *GPUPreflight) Install(_ context.Context, _ component.Options) ([]byte, error) {
+	var errs []error
+	if _, err := os.Stat(strutil.StringDefaultIfEmpty(nvidiaRuntimeBinary, p.RuntimeBinary)); err != nil {
+		errs = append(errs, fmt.Errorf("nvidia container runtime not found, install the nvidia container toolkit:%w", err))
+	}
+	if _, err := os.Stat(nvidiaDriverVersionFile); err != nil {
+		errs = append(errs, fmt.Errorf("nvidia driver not loaded:%w", err))
+	}
+	if len(errs) == 0 {
+		logger.Info("nvidia container runtime and driver are present")
+	}
+	return nil, utilerrors.NewAggregate(errs)
+}
+
+func (p *GPUPreflight) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("GPUPreflight dose not support uninstall")
+}
+
+// GPUPreflightStep the preflight step of checking the nvidia runtime and driver on the gpu nodes.
+func GPUPreflightStep(nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&GPUPreflight{RuntimeBinary: nvidiaRuntimeBinary})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "checkGPURuntime",
+		Timeout:    metav1.Duration{Duration: 10 * time.Second},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      GPUPreflightIdentity,
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+// nvidiaRuntimeClass the RuntimeClass selecting the nvidia runtime handler
+const nvidiaRuntimeClass = `apiVersion: node.k8s.io/v1
+kind: RuntimeClass
+metadata:
+  name: ` + NvidiaRuntimeName + `
+handler: ` + NvidiaRuntimeName + `
+`
+
+// GPURuntimeClassStep the post-install step of creating the nvidia RuntimeClass on the master,
+// so the gpu workloads select the nvidia runtime by runtimeClassName. It returns nil if no runtime
+// group enables the gpu runtime.
+func GPURuntimeClassStep(runtimeGroups []v1.CRIRuntimeGroup, master v1.StepNode) *v1.Step {
+	if !hasGPURuntime(runtimeGroups) {
+		return nil
+	}
+	return &v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "createGPURuntimeClass",
+		Timeout:    metav1.Duration{Duration: 30 * time.Second},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      []v1.StepNode{master},
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:         v1.CommandShell,
+				ShellCommand: []string{"/bin/bash", "-c", fmt.Sprintf("cat <<EOF | kubectl apply -f -\n%sEOF", nvidiaRuntimeClass)},
+			},
+		},
+	}
+}
+
+func hasGPURuntime(runtimeGroups []v1.CRIRuntimeGroup) bool {
+	for _, group := range runtimeGroups {
+		if group.GPU {
+			return true
+		}
+	}
+	return false
+}
+
+// RuntimeHandlers the runtime handlers rendered besides runc, the nvidia handler comes last if the gpu runtime is enabled.
+func (runnable ContainerdRunnable) RuntimeHandlers() []v1.CRIRuntimeHandler {
+	if !runnable.GPURuntime {
+		return runnable.Runtimes
+	}
+	handlers := make([]v1.CRIRuntimeHandler, 0, len(runnable.Runtimes)+1)
+	handlers = append(handlers, runnable.Runtimes...)
+	return append(handlers, v1.CRIRuntimeHandler{Name: NvidiaRuntimeName, BinaryName: nvidiaRuntimeBinary})
+}
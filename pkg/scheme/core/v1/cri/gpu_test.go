@@ -0,0 +1,80 @@
+package cri
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestGPUPreflight_Install(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "nvidia-container-runtime")
+	driver := filepath.Join(dir, "version")
+	origin := nvidiaDriverVersionFile
+	nvidiaDriverVersionFile = driver
+	defer func() { nvidiaDriverVersionFile = origin }()
+
+	p := &GPUPreflight{RuntimeBinary: binary}
+	_, err := p.Install(context.TODO(), component.Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nvidia container runtime not found")
+	assert.Contains(t, err.Error(), "nvidia driver not loaded")
+
+	require.NoError(t, os.WriteFile(binary, nil, 0755))
+	require.NoError(t, os.WriteFile(driver, []byte("NVRM version: 535.104.05"), 0644))
+	_, err = p.Install(context.TODO(), component.Options{})
+	assert.NoError(t, err)
+}
+
+func TestContainerdRunnable_renderTo_gpuRuntime(t *testing.T) {
+	runnable := &ContainerdRunnable{
+		Base:                Base{Version: "1.7.2", DataRootDir: "/var/lib/containerd"},
+		PauseVersion:        "3.9",
+		EnableSystemdCgroup: "true",
+		Runtimes:            []v1.CRIRuntimeHandler{{Name: "kata", RuntimeType: "io.containerd.kata.v2"}},
+		GPURuntime:          true,
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, runnable.renderTo(w))
+	tree, err := toml.LoadBytes(w.Bytes())
+	require.NoError(t, err)
+	nvidia := []string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", NvidiaRuntimeName}
+	assert.Equal(t, "io.containerd.runc.v2", tree.GetPath(append(nvidia, "runtime_type")))
+	assert.Equal(t, nvidiaRuntimeBinary, tree.GetPath(append(nvidia, "options", "BinaryName")))
+	assert.Len(t, runnable.Runtimes, 1, "the user runtimes should not be changed")
+}
+
+func TestGPURuntimeClassStep(t *testing.T) {
+	master := v1.StepNode{ID: "m1"}
+	assert.Nil(t, GPURuntimeClassStep(nil, master))
+	assert.Nil(t, GPURuntimeClassStep([]v1.CRIRuntimeGroup{{Nodes: []string{"n1"}, Runtimes: []v1.CRIRuntimeHandler{{Name: "kata"}}}}, master))
+
+	step := GPURuntimeClassStep([]v1.CRIRuntimeGroup{{Nodes: []string{"gpu1"}, GPU: true}}, master)
+	require.NotNil(t, step)
+	assert.Equal(t, []v1.StepNode{master}, step.Nodes)
+	cmd := strings.Join(step.Commands[0].ShellCommand, " ")
+	assert.Contains(t, cmd, "kubectl apply -f -")
+	assert.Contains(t, cmd, "kind: RuntimeClass\nmetadata:\n  name: nvidia\nhandler: nvidia\nEOF")
+}
+
+func TestContainerdRunnable_runtimeGroupCommands_gpu(t *testing.T) {
+	groups, err := ContainerdRunnable{}.runtimeGroupCommands([]v1.CRIRuntimeGroup{
+		{Nodes: []string{"gpu1"}, GPU: true},
+	}, []v1.StepNode{{ID: "n1"}, {ID: "gpu1"}})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.False(t, groups[0].gpu)
+	assert.True(t, groups[1].gpu)
+	assert.Contains(t, string(groups[1].command), `"gpuRuntime":true`)
+	assert.NotContains(t, string(groups[0].command), `"gpuRuntime"`)
+}
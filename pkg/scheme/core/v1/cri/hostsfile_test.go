@@ -0,0 +1,174 @@
+package cri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+// hostsToml the decoded hosts.toml, the CA is decoded as string since only a single file is rendered.
+type hostsToml struct {
+	Server string `toml:"server"`
+	Host   map[string]struct {
+		Capabilities []string `toml:"capabilities"`
+		CA           string   `toml:"ca"`
+		SkipVerify   *bool    `toml:"skip_verify"`
+	} `toml:"host"`
+}
+
+func decodeHostsToml(t *testing.T, dir, server string) hostsToml {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, server, "hosts.toml"))
+	require.NoError(t, err)
+	var got hostsToml
+	require.NoError(t, toml.Unmarshal(data, &got), string(data))
+	return got
+}
+
+func TestContainerdRegistryRender_roundTrip(t *testing.T) {
+	const ca = "-----BEGIN CERTIFICATE-----\nfake\n-----END CERTIFICATE-----\n"
+	dir := t.TempDir()
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "http", Host: "plain.registry.com"},
+		{Scheme: "https", Host: "ca.registry.com", CA: ca},
+		{Scheme: "https", Host: "insecure.registry.com", SkipVerify: true},
+		{Scheme: "http", Host: "multi.registry.com"},
+		{Scheme: "https", Host: "multi.registry.com", SkipVerify: true},
+	})
+	require.Len(t, cfgs, 4)
+	for _, cfg := range cfgs {
+		require.NoError(t, cfg.renderConfigs(dir))
+	}
+	pullResolve := []string{CapabilityPull, CapabilityResolve}
+
+	got := decodeHostsToml(t, dir, "plain.registry.com")
+	assert.Equal(t, "plain.registry.com", got.Server)
+	require.Len(t, got.Host, 1)
+	plain := got.Host["http://plain.registry.com"]
+	assert.Equal(t, pullResolve, plain.Capabilities)
+	assert.Empty(t, plain.CA)
+	assert.Nil(t, plain.SkipVerify)
+
+	got = decodeHostsToml(t, dir, "ca.registry.com")
+	require.Len(t, got.Host, 1)
+	withCA := got.Host["https://ca.registry.com"]
+	assert.Equal(t, pullResolve, withCA.Capabilities)
+	caFile := filepath.Join(dir, "ca.registry.com", "ca.registry.com.pem")
+	assert.Equal(t, caFile, withCA.CA)
+	assert.Nil(t, withCA.SkipVerify)
+	data, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	assert.Equal(t, ca, string(data))
+
+	got = decodeHostsToml(t, dir, "insecure.registry.com")
+	require.Len(t, got.Host, 1)
+	insecure := got.Host["https://insecure.registry.com"]
+	assert.Empty(t, insecure.CA)
+	require.NotNil(t, insecure.SkipVerify)
+	assert.True(t, *insecure.SkipVerify)
+
+	got = decodeHostsToml(t, dir, "multi.registry.com")
+	require.Len(t, got.Host, 2)
+	assert.Nil(t, got.Host["http://multi.registry.com"].SkipVerify)
+	require.NotNil(t, got.Host["https://multi.registry.com"].SkipVerify)
+	assert.True(t, *got.Host["https://multi.registry.com"].SkipVerify)
+	for _, h := range got.Host {
+		assert.Equal(t, pullResolve, h.Capabilities)
+	}
+}
+
+func TestContainerdRegistryRender_roundTripMirror(t *testing.T) {
+	dir := t.TempDir()
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "docker.io"},
+		{Scheme: "https", Host: "mirror.registry.com", MirrorFor: "docker.io"},
+	})
+	require.Len(t, cfgs, 1)
+	require.NoError(t, cfgs["docker.io"].renderConfigs(dir))
+
+	got := decodeHostsToml(t, dir, "docker.io")
+	assert.Equal(t, "docker.io", got.Server)
+	require.Len(t, got.Host, 2)
+	assert.Contains(t, got.Host, "https://mirror.registry.com")
+	assert.Contains(t, got.Host, "https://docker.io")
+	_, err := os.Stat(filepath.Join(dir, "mirror.registry.com"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestContainerdRegistryRender_roundTripDefaultMirror(t *testing.T) {
+	dir := t.TempDir()
+	registries := []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}}
+	cfgs := ToContainerdRegistryConfig(append(registries, v1.DefaultMirrorSpec(registries, "10.0.0.1:5000")))
+	require.Len(t, cfgs, 2)
+	require.NoError(t, cfgs[v1.DefaultMirrorServer].renderConfigs(dir))
+
+	got := decodeHostsToml(t, dir, v1.DefaultMirrorServer)
+	// no server, the requested registry is the fallback of the mirror
+	assert.Empty(t, got.Server)
+	require.Len(t, got.Host, 1)
+	assert.Contains(t, got.Host, "http://10.0.0.1:5000")
+	data, err := os.ReadFile(filepath.Join(dir, v1.DefaultMirrorServer, "hosts.toml"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "server")
+}
+
+func TestContainerdRegistryRender_fileModes(t *testing.T) {
+	const ca = "-----BEGIN CERTIFICATE-----\nfake\n-----END CERTIFICATE-----\n"
+	dir := t.TempDir()
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{{Scheme: "https", Host: "ca.registry.com", CA: ca}})
+	hostDir := filepath.Join(dir, "ca.registry.com")
+	caFile := filepath.Join(hostDir, "ca.registry.com.pem")
+	hostsFile := filepath.Join(hostDir, "hosts.toml")
+	assertModes := func() {
+		t.Helper()
+		for file, want := range map[string]os.FileMode{hostDir: 0755, caFile: 0644, hostsFile: 0644} {
+			info, err := os.Stat(file)
+			require.NoError(t, err)
+			assert.Equal(t, want, info.Mode().Perm(), file)
+		}
+	}
+	require.NoError(t, cfgs["ca.registry.com"].renderConfigs(dir))
+	assertModes()
+
+	// the world-writable files and dir rendered by the previous versions are fixed, even if unchanged
+	for _, file := range []string{hostDir, caFile, hostsFile} {
+		require.NoError(t, os.Chmod(file, 0777))
+	}
+	require.NoError(t, cfgs["ca.registry.com"].renderConfigs(dir))
+	assertModes()
+}
+
+func TestContainerdRegistryRender_auth(t *testing.T) {
+	dir := t.TempDir()
+	hostsFile := filepath.Join(dir, "auth.registry.com", "hosts.toml")
+	require.NoError(t, ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "auth.registry.com"},
+	})["auth.registry.com"].renderConfigs(dir))
+	info, err := os.Stat(hostsFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	require.NoError(t, ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "auth.registry.com", Username: "admin", Password: "secret"},
+	})["auth.registry.com"].renderConfigs(dir))
+	info, err = os.Stat(hostsFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	var got struct {
+		Host map[string]struct {
+			Header map[string]string `toml:"header"`
+		} `toml:"host"`
+	}
+	require.NoError(t, toml.Unmarshal(data, &got), string(data))
+	// base64 of admin:secret
+	assert.Equal(t, "Basic YWRtaW46c2VjcmV0", got.Host["https://auth.registry.com"].Header["Authorization"])
+	assert.NotContains(t, string(data), "secret")
+}
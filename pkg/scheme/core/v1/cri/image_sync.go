@@ -0,0 +1,374 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	dockerremote "github.com/containerd/containerd/remotes/docker"
+	"github.com/opencontainers/go-digest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	// imageSyncNamespace the containerd namespace the images are fetched into while syncing,
+	// so the images used by kubelet in k8s.io are not touched
+	imageSyncNamespace = "kc-image-sync"
+	imageSyncTimeout   = 30 * time.Minute
+)
+
+var ContainerdImageSyncIdentity = fmt.Sprintf(
+	component.RegisterStepKeyFormat, criContainerd+"-imageSync", criVersion, component.TypeStep)
+
+func init() {
+	component.AddAgentStep(ContainerdImageSyncIdentity, &ContainerdImageSync{})
+}
+
+var _ component.StepRunnable = (*ContainerdImageSync)(nil)
+
+// listKubeadmImages list the images of the kubernetes version by kubeadm, the images are in the repository
+// if it is set, replaced in tests
+var listKubeadmImages = func(ctx context.Context, kubeVersion, repository string) ([]string, error) {
+	args := []string{"config", "images", "list", "--kubernetes-version", kubeVersion}
+	if repository != "" {
+		args = append(args, "--image-repository", repository)
+	}
+	ec, err := cmdutil.RunCmdWithContext(ctx, false, "kubeadm", args...)
+	if err != nil {
+		return nil, fmt.Errorf("list images of kubernetes %s failed:%w", kubeVersion, err)
+	}
+	var list []string
+	for _, line := range strings.Split(ec.StdOut(), "\n") {
+		// skip the blank and the log lines
+		if line = strings.TrimSpace(line); line != "" && !strings.ContainsAny(line, " \t") {
+			list = append(list, line)
+		}
+	}
+	return list, nil
+}
+
+// ContainerdImageSync mirrors the images into the local registry by containerd, the images are pulled from
+// their source or imported from the tarball, retagged to the registry and pushed.
+// The images already in the registry with the same digest are skipped.
+type ContainerdImageSync struct {
+	// KubernetesVersion the kubernetes images listed by kubeadm are synced if it is set,
+	// they are flattened into the registry as kubeadm expects with the image repository.
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// Images the other images, their repository path is kept in the registry,
+	// e.g. calico/cni:v3.22.4 is synced to {Registry}/calico/cni:v3.22.4
+	Images []string `json:"images,omitempty"`
+	// Source the registry the images are pulled from, each image is pulled from its own registry if the host is empty
+	Source v1.RegistrySpec `json:"source,omitempty"`
+	// Tarball the image tarball on the node, the images are imported from it instead of pulled from the source
+	Tarball string `json:"tarball,omitempty"`
+	// Registry the local registry of the cluster, a host with an optional path prefix
+	Registry string `json:"registry"`
+	// RegistrySpec the scheme and tls config of the registry host
+	RegistrySpec v1.RegistrySpec `json:"registrySpec"`
+	// Socket the containerd socket, the grpc address of the containerd config on the node is used if empty
+	Socket string `json:"socket,omitempty"`
+}
+
+// imageMirror the source and the target of a synced image
+type imageMirror struct {
+	source string
+	target string
+}
+
+func (c *ContainerdImageSync) NewInstance() component.ObjectMeta {
+	return &ContainerdImageSync{}
+}
+
+func (c *ContainerdImageSync) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	mirrors, err := c.mirrors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		for _, m := range mirrors {
+			logger.Infof("dry run: sync image %s to %s", m.source, m.target)
+		}
+		return nil, nil
+	}
+
+	client, err := containerd.New(strutil.StringDefaultIfEmpty(ContainerdSocketOf(ContainerdConfigFile), c.Socket))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	ctx = namespaces.WithNamespace(ctx, imageSyncNamespace)
+	// the fetched content is kept until the images are pushed
+	ctx, done, err := client.WithLease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = done(namespaces.WithNamespace(context.Background(), imageSyncNamespace)) }()
+
+	s, err := c.newSyncer(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	defer s.cleanup()
+	synced, skipped, err := syncImages(ctx, s, mirrors)
+	logger.Infof("%d images synced to %s, %d images already present are skipped", synced, c.Registry, skipped)
+	return nil, err
+}
+
+func (c *ContainerdImageSync) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("ContainerdImageSync dose not support uninstall")
+}
+
+// mirrors returns the source and target of the kubernetes images and the other images.
+func (c *ContainerdImageSync) mirrors(ctx context.Context) ([]imageMirror, error) {
+	var mirrors []imageMirror
+	if c.KubernetesVersion != "" {
+		sources, err := listKubeadmImages(ctx, c.KubernetesVersion, c.Source.Host)
+		if err != nil {
+			return nil, err
+		}
+		targets, err := listKubeadmImages(ctx, c.KubernetesVersion, c.Registry)
+		if err != nil {
+			return nil, err
+		}
+		if len(sources) != len(targets) {
+			return nil, fmt.Errorf("kubeadm lists %d images of kubernetes %s, but %d images in registry %s",
+				len(sources), c.KubernetesVersion, len(targets), c.Registry)
+		}
+		for i := range sources {
+			mirrors = append(mirrors, imageMirror{source: sources[i], target: targets[i]})
+		}
+	}
+	for _, image := range c.Images {
+		m, err := newImageMirror(image, c.Source.Host, c.Registry)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, m)
+	}
+	return mirrors, nil
+}
+
+// newImageMirror the image keeps its repository path in the source and the registry as the templates reference it
+// with the local registry, e.g. docker.io/flannel/flannel:v0.21.5 in registry 10.0.0.1:5000 is
+// 10.0.0.1:5000/flannel/flannel:v0.21.5, and busybox:1.36 is 10.0.0.1:5000/busybox:1.36.
+func newImageMirror(image, source, registry string) (imageMirror, error) {
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return imageMirror{}, fmt.Errorf("invalid image %s:%w", image, err)
+	}
+	// the familiar name of the docker hub images has neither the domain nor the library prefix
+	ref := strings.TrimPrefix(docker.FamiliarString(named), docker.Domain(named)+"/")
+	m := imageMirror{source: named.String(), target: strings.TrimSuffix(registry, "/") + "/" + ref}
+	if source != "" {
+		m.source = strings.TrimSuffix(source, "/") + "/" + ref
+	}
+	return m, nil
+}
+
+// imageSyncer the registry operations of syncing an image, replaced in tests
+type imageSyncer interface {
+	// sourceDigest the digest of the source image
+	sourceDigest(ctx context.Context, ref string) (digest.Digest, error)
+	// targetDigest the digest of the target image, the error is not found if it is absent
+	targetDigest(ctx context.Context, ref string) (digest.Digest, error)
+	// copy pushes the source image as the target
+	copy(ctx context.Context, source, target string) error
+}
+
+// syncImages copy the images absent or different in the registry, the failed images do not stop the others.
+func syncImages(ctx context.Context, s imageSyncer, mirrors []imageMirror) (synced, skipped int, err error) {
+	var errs []error
+	for i, m := range mirrors {
+		src, err := s.sourceDigest(ctx, m.source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve image %s failed:%w", m.source, err))
+			continue
+		}
+		dst, err := s.targetDigest(ctx, m.target)
+		if err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("resolve image %s failed:%w", m.target, err))
+			continue
+		}
+		if err == nil && dst == src {
+			logger.Infof("image %s@%s is already present, skip (%d/%d)", m.target, dst, i+1, len(mirrors))
+			skipped++
+			continue
+		}
+		if err = s.copy(ctx, m.source, m.target); err != nil {
+			errs = append(errs, fmt.Errorf("sync image %s to %s failed:%w", m.source, m.target, err))
+			continue
+		}
+		logger.Infof("image %s@%s synced to %s (%d/%d)", m.source, src, m.target, i+1, len(mirrors))
+		synced++
+	}
+	return synced, skipped, utilerrors.NewAggregate(errs)
+}
+
+// containerdSyncer fetches and pushes the images by containerd, the images of the tarball are imported once.
+type containerdSyncer struct {
+	client   *containerd.Client
+	source   remotes.Resolver
+	target   remotes.Resolver
+	imported bool
+	// fetched the images created in the sync namespace, they are deleted after sync
+	fetched []string
+}
+
+func (c *ContainerdImageSync) newSyncer(ctx context.Context, client *containerd.Client) (*containerdSyncer, error) {
+	source, err := RegistryResolver(ctx, c.Source)
+	if err != nil {
+		return nil, err
+	}
+	target, err := RegistryResolver(ctx, c.RegistrySpec)
+	if err != nil {
+		return nil, err
+	}
+	s := &containerdSyncer{client: client, source: source, target: target}
+	if c.Tarball == "" {
+		return s, nil
+	}
+	f, err := os.Open(c.Tarball)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	imgs, err := client.Import(ctx, f, containerd.WithAllPlatforms(true))
+	if err != nil {
+		return nil, fmt.Errorf("import image tarball %s failed:%w", c.Tarball, err)
+	}
+	for _, img := range imgs {
+		s.fetched = append(s.fetched, img.Name)
+	}
+	s.imported = true
+	return s, nil
+}
+
+func (s *containerdSyncer) sourceDigest(ctx context.Context, ref string) (digest.Digest, error) {
+	if s.imported {
+		img, err := s.client.ImageService().Get(ctx, ref)
+		if err != nil {
+			return "", fmt.Errorf("image is not in the tarball:%w", err)
+		}
+		return img.Target.Digest, nil
+	}
+	_, desc, err := s.source.Resolve(ctx, ref)
+	return desc.Digest, err
+}
+
+func (s *containerdSyncer) targetDigest(ctx context.Context, ref string) (digest.Digest, error) {
+	_, desc, err := s.target.Resolve(ctx, ref)
+	return desc.Digest, err
+}
+
+func (s *containerdSyncer) copy(ctx context.Context, source, target string) error {
+	var (
+		img images.Image
+		err error
+	)
+	if s.imported {
+		img, err = s.client.ImageService().Get(ctx, source)
+	} else {
+		// all platforms are fetched, so the pushed index is complete and keeps the digest of the source
+		img, err = s.client.Fetch(ctx, source, containerd.WithResolver(s.source))
+		if err == nil {
+			s.fetched = append(s.fetched, img.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return s.client.Push(ctx, target, img.Target, containerd.WithResolver(s.target))
+}
+
+// cleanup delete the images of the sync namespace, their content is garbage collected by containerd
+func (s *containerdSyncer) cleanup() {
+	ctx := namespaces.WithNamespace(context.Background(), imageSyncNamespace)
+	for _, name := range s.fetched {
+		if err := s.client.ImageService().Delete(ctx, name); err != nil && !errdefs.IsNotFound(err) {
+			logger.Warnf("delete synced image %s failed: %v", name, err)
+		}
+	}
+}
+
+// RegistryResolver the resolver of the registry with its scheme, tls config and credentials. The challenges
+// of the registry host are answered with the credentials, the others by an anonymous token request.
+// The hosts of the refs are used if the registry host is empty.
+func RegistryResolver(ctx context.Context, r v1.RegistrySpec) (remotes.Resolver, error) {
+	// the layers may take long to transfer, they are limited by the step timeout instead
+	client, err := registryClient(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	creds := func(host string) (string, string, error) {
+		if r.Username == "" || !strings.EqualFold(host, r.Host) {
+			return "", "", nil
+		}
+		return r.Username, r.Password, nil
+	}
+	return dockerremote.NewResolver(dockerremote.ResolverOptions{
+		Hosts: dockerremote.ConfigureDefaultRegistries(
+			dockerremote.WithClient(client),
+			dockerremote.WithAuthorizer(dockerremote.NewDockerAuthorizer(
+				dockerremote.WithAuthClient(client), dockerremote.WithAuthCreds(creds))),
+			dockerremote.WithPlainHTTP(func(string) (bool, error) { return r.Scheme == "http", nil }),
+		),
+	}), nil
+}
+
+// SyncImagesStep the step of syncing the images into the local registry on the node
+func SyncImagesStep(sync *ContainerdImageSync, node v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(sync)
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "syncImages",
+		Timeout:    metav1.Duration{Duration: imageSyncTimeout},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      []v1.StepNode{node},
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      ContainerdImageSyncIdentity,
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,176 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestNewImageMirror(t *testing.T) {
+	tests := []struct {
+		image  string
+		source string
+		want   imageMirror
+	}{
+		{image: "calico/cni:v3.22.4", want: imageMirror{source: "docker.io/calico/cni:v3.22.4", target: "10.0.0.1:5000/calico/cni:v3.22.4"}},
+		{image: "docker.io/flannel/flannel:v0.21.5", want: imageMirror{source: "docker.io/flannel/flannel:v0.21.5", target: "10.0.0.1:5000/flannel/flannel:v0.21.5"}},
+		{image: "busybox:1.36", want: imageMirror{source: "docker.io/library/busybox:1.36", target: "10.0.0.1:5000/busybox:1.36"}},
+		{image: "quay.io/tigera/operator:v1.30.4", want: imageMirror{source: "quay.io/tigera/operator:v1.30.4", target: "10.0.0.1:5000/tigera/operator:v1.30.4"}},
+		{image: "calico/node:v3.22.4", source: "10.0.0.2:5000", want: imageMirror{source: "10.0.0.2:5000/calico/node:v3.22.4", target: "10.0.0.1:5000/calico/node:v3.22.4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := newImageMirror(tt.image, tt.source, "10.0.0.1:5000/")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := newImageMirror("Invalid:Image", "", "10.0.0.1:5000")
+	assert.Error(t, err)
+}
+
+func TestContainerdImageSync_mirrors(t *testing.T) {
+	origin := listKubeadmImages
+	listKubeadmImages = func(_ context.Context, kubeVersion, repository string) ([]string, error) {
+		if repository == "" {
+			return []string{"registry.k8s.io/kube-apiserver:" + kubeVersion, "registry.k8s.io/coredns/coredns:v1.10.1"}, nil
+		}
+		return []string{repository + "/kube-apiserver:" + kubeVersion, repository + "/coredns:v1.10.1"}, nil
+	}
+	t.Cleanup(func() { listKubeadmImages = origin })
+
+	c := &ContainerdImageSync{
+		KubernetesVersion: "v1.27.4",
+		Images:            []string{"calico/cni:v3.22.4"},
+		Registry:          "10.0.0.1:5000",
+	}
+	mirrors, err := c.mirrors(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, []imageMirror{
+		{source: "registry.k8s.io/kube-apiserver:v1.27.4", target: "10.0.0.1:5000/kube-apiserver:v1.27.4"},
+		{source: "registry.k8s.io/coredns/coredns:v1.10.1", target: "10.0.0.1:5000/coredns:v1.10.1"},
+		{source: "docker.io/calico/cni:v3.22.4", target: "10.0.0.1:5000/calico/cni:v3.22.4"},
+	}, mirrors)
+}
+
+type fakeImageSyncer struct {
+	source map[string]digest.Digest
+	target map[string]digest.Digest
+	copied []string
+}
+
+func (f *fakeImageSyncer) sourceDigest(_ context.Context, ref string) (digest.Digest, error) {
+	d, ok := f.source[ref]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", ref, errdefs.ErrNotFound)
+	}
+	return d, nil
+}
+
+func (f *fakeImageSyncer) targetDigest(_ context.Context, ref string) (digest.Digest, error) {
+	d, ok := f.target[ref]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", ref, errdefs.ErrNotFound)
+	}
+	return d, nil
+}
+
+func (f *fakeImageSyncer) copy(_ context.Context, source, target string) error {
+	f.copied = append(f.copied, source)
+	f.target[target] = f.source[source]
+	return nil
+}
+
+func TestSyncImages(t *testing.T) {
+	s := &fakeImageSyncer{
+		source: map[string]digest.Digest{
+			"a:v1": digest.FromString("a"),
+			"b:v1": digest.FromString("b"),
+			"c:v1": digest.FromString("c"),
+		},
+		target: map[string]digest.Digest{
+			// present with the same digest
+			"r/a:v1": digest.FromString("a"),
+			// present with a different digest
+			"r/b:v1": digest.FromString("old"),
+		},
+	}
+	mirrors := []imageMirror{
+		{source: "a:v1", target: "r/a:v1"},
+		{source: "b:v1", target: "r/b:v1"},
+		{source: "c:v1", target: "r/c:v1"},
+		{source: "missing:v1", target: "r/missing:v1"},
+	}
+	synced, skipped, err := syncImages(context.TODO(), s, mirrors)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resolve image missing:v1 failed")
+	assert.Equal(t, 2, synced)
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, []string{"b:v1", "c:v1"}, s.copied)
+
+	// all present after the sync
+	s.copied = nil
+	synced, skipped, err = syncImages(context.TODO(), s, mirrors[:3])
+	require.NoError(t, err)
+	assert.Equal(t, 0, synced)
+	assert.Equal(t, 3, skipped)
+	assert.Empty(t, s.copied)
+}
+
+func TestSyncImagesStep(t *testing.T) {
+	step, err := SyncImagesStep(&ContainerdImageSync{
+		Images:       []string{"calico/cni:v3.22.4"},
+		Registry:     "10.0.0.1:5000",
+		RegistrySpec: v1.RegistrySpec{Scheme: "http", Host: "10.0.0.1:5000"},
+	}, v1.StepNode{ID: "1"})
+	require.NoError(t, err)
+	require.Len(t, step.Nodes, 1)
+	assert.Equal(t, ContainerdImageSyncIdentity, step.Commands[0].Identity)
+
+	got := &ContainerdImageSync{}
+	require.NoError(t, json.Unmarshal(step.Commands[0].CustomCommand, got))
+	// the socket is resolved on the node
+	assert.Empty(t, got.Socket)
+	assert.Equal(t, "10.0.0.1:5000", got.RegistrySpec.Host)
+}
+
+func TestRegistryResolver_credentials(t *testing.T) {
+	const dgst = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "passw0rd" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", dgst)
+		w.Header().Set("Content-Length", "2")
+	}))
+	defer srv.Close()
+	ctx := context.TODO()
+	spec := registrySpec(t, srv)
+	ref := spec.Host + "/library/busybox:1.36"
+
+	anonymous, err := RegistryResolver(ctx, spec)
+	require.NoError(t, err)
+	_, _, err = anonymous.Resolve(ctx, ref)
+	assert.Error(t, err)
+
+	spec.Username = "admin"
+	spec.Password = "passw0rd"
+	resolver, err := RegistryResolver(ctx, spec)
+	require.NoError(t, err)
+	_, desc, err := resolver.Resolve(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, digest.Digest(dgst), desc.Digest)
+}
@@ -0,0 +1,212 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/remotes/docker/auth"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const registryPingTimeout = 10 * time.Second
+
+var RegistryPreflightIdentity = fmt.Sprintf(
+	component.RegisterStepKeyFormat, "registry-preflight", criVersion, component.TypeStep)
+
+func init() {
+	component.AddAgentStep(RegistryPreflightIdentity, &RegistryPreflight{})
+}
+
+var _ component.StepRunnable = (*RegistryPreflight)(nil)
+
+// RegistryPreflight pings the OCI '/v2/' endpoint of each registry, so the operation fails early
+// if a registry is unreachable or refuses the pull of its credentials.
+type RegistryPreflight struct {
+	Registries []v1.RegistrySpec `json:"registries"`
+}
+
+func (p *RegistryPreflight) NewInstance() component.ObjectMeta {
+	return &RegistryPreflight{}
+}
+
+// Install the check is read-only, so it runs the same with opts.DryRun.
+func (p *RegistryPreflight) Install(ctx context.Context, _ component.Options) ([]byte, error) {
+	var errs []error
+	for _, r := range p.Registries {
+		if err := pingRegistry(ctx, r, registryPingTimeout); err != nil {
+			errs = append(errs, fmt.Errorf("registry %s://%s:%w", r.Scheme, r.Host, err))
+			continue
+		}
+		logger.Infof("registry %s://%s is reachable", r.Scheme, r.Host)
+	}
+	return nil, utilerrors.NewAggregate(errs)
+}
+
+func (p *RegistryPreflight) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("RegistryPreflight dose not support uninstall")
+}
+
+// pingRegistry GET the '/v2/' endpoint with the scheme, CA and skip-verify of registry.
+// The basic and bearer challenges are answered with the credentials of the registry as containerd does,
+// the bearer token is requested anonymously if the registry has no credentials.
+func pingRegistry(ctx context.Context, r v1.RegistrySpec, timeout time.Duration) error {
+	client, err := registryClient(r, timeout)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", r.Scheme, r.Host), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable:%w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+	default:
+		return fmt.Errorf("unexpected status %s of /v2/", resp.Status)
+	}
+	for _, c := range auth.ParseAuthHeader(resp.Header) {
+		switch c.Scheme {
+		case auth.BasicAuth:
+			if r.Username == "" {
+				continue
+			}
+			return pingRegistryBasic(ctx, client, r)
+		case auth.BearerAuth:
+			to, err := auth.GenerateTokenOptions(ctx, r.Host, r.Username, r.Password, c)
+			if err != nil {
+				return fmt.Errorf("unauthorized:%w", err)
+			}
+			if _, err = auth.FetchToken(ctx, client, nil, to); err != nil {
+				if r.Username != "" {
+					return fmt.Errorf("unauthorized, fetch token of user %s failed:%w", r.Username, err)
+				}
+				return fmt.Errorf("unauthorized, fetch anonymous token failed:%w", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unauthorized, the registry requires credentials")
+}
+
+// pingRegistryBasic GET the '/v2/' endpoint again with the basic credentials of registry
+func pingRegistryBasic(ctx context.Context, client *http.Client, r v1.RegistrySpec) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", r.Scheme, r.Host), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.Username, r.Password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable:%w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unauthorized, the credentials of user %s are refused with status %s", r.Username, resp.Status)
+	}
+	return nil
+}
+
+func registryClient(r v1.RegistrySpec, timeout time.Duration) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		// the cert served by registry is trusted without CA, same as the rendered hosts.toml
+		InsecureSkipVerify: r.SkipVerify || (r.TrustOnFirstUse && r.CA == ""),
+	}
+	if r.CA != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(r.CA)) {
+			return nil, fmt.Errorf("invalid ca of registry %s", r.Host)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// RegistryPreflightStep the preflight step of checking the registries on nodes, each registry may take
+// a ping and a token request. A host mirroring another server, e.g. the default mirror, is pinged once.
+// It returns nil if there is no registry.
+func RegistryPreflightStep(registries []v1.RegistrySpec, nodes []v1.StepNode) (*v1.Step, error) {
+	registries = uniqueRegistryEndpoints(registries)
+	if len(registries) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(&RegistryPreflight{Registries: registries})
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "checkRegistries",
+		Timeout:    metav1.Duration{Duration: time.Duration(2*len(registries)+1) * registryPingTimeout},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      RegistryPreflightIdentity,
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+// uniqueRegistryEndpoints the registries deduplicated by scheme and host, the mirrors are pinged the same as the host
+func uniqueRegistryEndpoints(registries []v1.RegistrySpec) []v1.RegistrySpec {
+	seen := make(map[string]struct{}, len(registries))
+	unique := make([]v1.RegistrySpec, 0, len(registries))
+	for _, r := range registries {
+		key := r.Scheme + "://" + strings.ToLower(r.Host)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, r)
+	}
+	return unique
+}
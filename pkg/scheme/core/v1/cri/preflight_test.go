@@ -0,0 +1,155 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func registrySpec(t *testing.T, srv *httptest.Server) v1.RegistrySpec {
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return v1.RegistrySpec{Scheme: u.Scheme, Host: u.Host}
+}
+
+func TestPingRegistry(t *testing.T) {
+	ctx := context.TODO()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/", r.URL.Path)
+	}))
+	defer ok.Close()
+	require.NoError(t, pingRegistry(ctx, registrySpec(t, ok), time.Second))
+
+	var bearer *httptest.Server
+	bearer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"token":"abc"}`))
+			return
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, bearer.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer bearer.Close()
+	require.NoError(t, pingRegistry(ctx, registrySpec(t, bearer), time.Second))
+
+	basic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); ok && username == "admin" && password == "passw0rd" {
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer basic.Close()
+	err := pingRegistry(ctx, registrySpec(t, basic), time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	withCredentials := registrySpec(t, basic)
+	withCredentials.Username, withCredentials.Password = "admin", "passw0rd"
+	require.NoError(t, pingRegistry(ctx, withCredentials, time.Second))
+	withCredentials.Password = "wrong"
+	err = pingRegistry(ctx, withCredentials, time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refused")
+
+	var bearerAuth *httptest.Server
+	bearerAuth = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if username, _, ok := r.BasicAuth(); !ok || username != "admin" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"abc"}`))
+			return
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, bearerAuth.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer bearerAuth.Close()
+	require.Error(t, pingRegistry(ctx, registrySpec(t, bearerAuth), time.Second))
+	withCredentials = registrySpec(t, bearerAuth)
+	withCredentials.Username, withCredentials.Password = "admin", "passw0rd"
+	require.NoError(t, pingRegistry(ctx, withCredentials, time.Second))
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	spec := registrySpec(t, closed)
+	closed.Close()
+	err = pingRegistry(ctx, spec, time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unreachable")
+}
+
+func TestPingRegistry_TLS(t *testing.T) {
+	ctx := context.TODO()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	spec := registrySpec(t, srv)
+	assert.Error(t, pingRegistry(ctx, spec, time.Second), "untrusted cert must be rejected")
+
+	skip := spec
+	skip.SkipVerify = true
+	assert.NoError(t, pingRegistry(ctx, skip, time.Second))
+
+	withCA := spec
+	withCA.CA = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	assert.NoError(t, pingRegistry(ctx, withCA, time.Second))
+}
+
+func TestRegistryPreflight_Install(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	p := &RegistryPreflight{Registries: []v1.RegistrySpec{registrySpec(t, ok), registrySpec(t, notFound)}}
+	// the reachability is checked under dry run too
+	_, err := p.Install(context.TODO(), component.Options{DryRun: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), registrySpec(t, notFound).Host)
+	assert.NotContains(t, err.Error(), registrySpec(t, ok).Host)
+
+	// the basic challenge is answered with the credentials
+	basic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); ok && password == "passw0rd" {
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer basic.Close()
+	withCredentials := registrySpec(t, basic)
+	withCredentials.Username = "admin"
+	withCredentials.Password = "passw0rd"
+	p = &RegistryPreflight{Registries: []v1.RegistrySpec{withCredentials}}
+	_, err = p.Install(context.TODO(), component.Options{})
+	assert.NoError(t, err)
+	withCredentials.Password = "wrong"
+	p = &RegistryPreflight{Registries: []v1.RegistrySpec{withCredentials}}
+	_, err = p.Install(context.TODO(), component.Options{})
+	assert.Error(t, err)
+
+	step, err := RegistryPreflightStep(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, step)
+
+	// the default mirror is pinged once with its host
+	registries := []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}}
+	step, err = RegistryPreflightStep(append(registries, v1.DefaultMirrorSpec(registries, "10.0.0.1:5000")), nil)
+	require.NoError(t, err)
+	require.NotNil(t, step)
+	got := &RegistryPreflight{}
+	require.NoError(t, json.Unmarshal(step.Commands[0].CustomCommand, got))
+	assert.Equal(t, []v1.RegistrySpec{{Scheme: "http", Host: "10.0.0.1:5000"}}, got.Registries)
+}
@@ -0,0 +1,299 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	// k8sNamespace the containerd namespace of the images used by kubelet
+	k8sNamespace = "k8s.io"
+	// ociIndexFile the index file of the oci image layout tarball
+	ociIndexFile = "index.json"
+	// dockerManifestFile the manifest file of the docker save tarball
+	dockerManifestFile = "manifest.json"
+)
+
+var ContainerdImagePreloadIdentity = fmt.Sprintf(
+	component.RegisterStepKeyFormat, criContainerd+"-imagePreload", criVersion, component.TypeStep)
+
+func init() {
+	component.AddAgentStep(ContainerdImagePreloadIdentity, &ContainerdImagePreload{})
+}
+
+var _ component.StepRunnable = (*ContainerdImagePreload)(nil)
+
+// ContainerdImagePreload imports the image tarballs(*.tar) under Dir into the k8s.io namespace of containerd,
+// so the images are present before the cluster bootstrap in the air-gapped environment.
+// Both the oci layout and the docker save tarballs are supported, the tarball whose images are all present is skipped.
+type ContainerdImagePreload struct {
+	Dir string `json:"dir"`
+	// Socket the containerd socket, the grpc address of the containerd config on the node is used if empty
+	Socket string `json:"socket,omitempty"`
+}
+
+func (c *ContainerdImagePreload) NewInstance() component.ObjectMeta {
+	return &ContainerdImagePreload{}
+}
+
+func (c *ContainerdImagePreload) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	tarballs, err := imageTarballs(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		for _, tarball := range tarballs {
+			logger.Infof("dry run: import image tarball %s into containerd namespace %s", tarball, k8sNamespace)
+		}
+		return nil, nil
+	}
+	if len(tarballs) == 0 {
+		logger.Infof("no image tarball found in %s, skip preload", c.Dir)
+		return nil, nil
+	}
+
+	client, err := containerd.New(strutil.StringDefaultIfEmpty(ContainerdSocketOf(ContainerdConfigFile), c.Socket))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	ctx = namespaces.WithNamespace(ctx, k8sNamespace)
+
+	var errs []error
+	for _, tarball := range tarballs {
+		if err = importImageTarball(ctx, client, tarball); err != nil {
+			logger.Warnf("import image tarball %s failed: %v", tarball, err)
+			errs = append(errs, fmt.Errorf("import image tarball %s failed:%w", tarball, err))
+		}
+	}
+	return nil, utilerrors.NewAggregate(errs)
+}
+
+func (c *ContainerdImagePreload) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("ContainerdImagePreload dose not support uninstall")
+}
+
+// imageTarballs returns the sorted *.tar files under dir.
+func imageTarballs(dir string) ([]string, error) {
+	tarballs, err := filepath.Glob(filepath.Join(dir, "*.tar"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tarballs)
+	return tarballs, nil
+}
+
+func importImageTarball(ctx context.Context, client *containerd.Client, tarball string) error {
+	imgs, err := tarballImages(tarball)
+	if err != nil {
+		return err
+	}
+	if len(imgs) > 0 {
+		present, err := imagesPresent(ctx, client.ImageService(), client.ContentStore(), imgs)
+		if err != nil {
+			return err
+		}
+		if present {
+			logger.Infof("images of tarball %s are already present, skip import", tarball)
+			return nil
+		}
+	}
+
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	imported, err := client.Import(ctx, f)
+	if err != nil {
+		return err
+	}
+	for _, img := range imported {
+		// unpack into the default snapshotter, so the image is ready to run by kubelet
+		if err = containerd.NewImage(client, img).Unpack(ctx, ""); err != nil {
+			return fmt.Errorf("unpack image %s failed:%w", img.Name, err)
+		}
+		logger.Infof("import image %s@%s from %s successfully", img.Name, img.Target.Digest, tarball)
+	}
+	return nil
+}
+
+// tarballImage a named image in the image tarball.
+type tarballImage struct {
+	Name string
+	// Digest the manifest digest in the index.json of the oci layout tarball
+	Digest digest.Digest
+	// Config the config digest in the manifest.json of the docker save tarball,
+	// its manifest is generated on import, so the manifest digest is unknown before.
+	Config digest.Digest
+}
+
+// dockerManifest an entry of the manifest.json of the docker save tarball
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// tarballImages returns the named images of the oci layout tarball, in its index.json,
+// or of the docker save tarball, in its manifest.json. The index.json is preferred if the tarball has both.
+// The untagged images are not returned, they are not tracked by name in the image store.
+func tarballImages(tarball string) ([]tarballImage, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ociImages, dockerImages []tarballImage
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("read image tarball %s failed:%w", tarball, err)
+		}
+		switch filepath.Clean(hdr.Name) {
+		case ociIndexFile:
+			var idx ocispec.Index
+			if err = json.NewDecoder(tr).Decode(&idx); err != nil {
+				return nil, fmt.Errorf("decode %s of image tarball %s failed:%w", ociIndexFile, tarball, err)
+			}
+			for _, m := range idx.Manifests {
+				if name := imageRefName(m); name != "" {
+					ociImages = append(ociImages, tarballImage{Name: name, Digest: m.Digest})
+				}
+			}
+		case dockerManifestFile:
+			var manifests []dockerManifest
+			if err = json.NewDecoder(tr).Decode(&manifests); err != nil {
+				return nil, fmt.Errorf("decode %s of image tarball %s failed:%w", dockerManifestFile, tarball, err)
+			}
+			for _, m := range manifests {
+				// the config is named by its sha256, i.e. "<hex>.json" or "blobs/sha256/<hex>"
+				config := digest.NewDigestFromEncoded(digest.SHA256, strings.TrimSuffix(path.Base(m.Config), ".json"))
+				if config.Validate() != nil {
+					return nil, fmt.Errorf("unknown config %s in %s of image tarball %s", m.Config, dockerManifestFile, tarball)
+				}
+				for _, tag := range m.RepoTags {
+					// containerd imports the tag by its normalized name
+					named, err := docker.ParseDockerRef(tag)
+					if err != nil {
+						return nil, fmt.Errorf("invalid tag %s in image tarball %s:%w", tag, tarball, err)
+					}
+					dockerImages = append(dockerImages, tarballImage{Name: named.String(), Config: config})
+				}
+			}
+		}
+	}
+	if len(ociImages) > 0 {
+		return ociImages, nil
+	}
+	return dockerImages, nil
+}
+
+// imagesPresent whether all images are present in the image store with the same manifest digest,
+// or with the same config digest for the images of the docker save tarball.
+func imagesPresent(ctx context.Context, store images.Store, provider content.Provider, imgs []tarballImage) (bool, error) {
+	for _, want := range imgs {
+		img, err := store.Get(ctx, want.Name)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if want.Digest != "" {
+			if img.Target.Digest != want.Digest {
+				return false, nil
+			}
+			continue
+		}
+		config, err := img.Config(ctx, provider, platforms.Default())
+		if err != nil {
+			// e.g. the content is missing, the import repairs it
+			logger.Debugf("read config of image %s failed, import it again: %v", want.Name, err)
+			return false, nil
+		}
+		if config.Digest != want.Config {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func imageRefName(desc ocispec.Descriptor) string {
+	if name := desc.Annotations[images.AnnotationImageName]; name != "" {
+		return name
+	}
+	return desc.Annotations[ocispec.AnnotationRefName]
+}
+
+// PreloadImagesStep the step of importing the image tarballs under dir on nodes
+func PreloadImagesStep(dir string, nodes []v1.StepNode) (v1.Step, error) {
+	bytes, err := json.Marshal(&ContainerdImagePreload{Dir: dir})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "preloadImages",
+		Timeout:    metav1.Duration{Duration: 10 * time.Minute},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      ContainerdImagePreloadIdentity,
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
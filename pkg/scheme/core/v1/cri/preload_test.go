@@ -0,0 +1,163 @@
+package cri
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+)
+
+func writeOCITarball(t *testing.T, path string, idx *ocispec.Index) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	data, err := json.Marshal(idx)
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "oci-layout", Mode: 0644, Size: 2}))
+	_, err = tw.Write([]byte("{}"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: ociIndexFile, Mode: 0644, Size: int64(len(data))}))
+	_, err = tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+}
+
+func writeDockerTarball(t *testing.T, path string, manifests []dockerManifest) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	data, err := json.Marshal(manifests)
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: dockerManifestFile, Mode: 0644, Size: int64(len(data))}))
+	_, err = tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+}
+
+func TestTarballImages(t *testing.T) {
+	dir := t.TempDir()
+	pause := digest.FromString("pause")
+	writeOCITarball(t, filepath.Join(dir, "pause.tar"), &ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			{Digest: pause, Annotations: map[string]string{images.AnnotationImageName: "registry.k8s.io/pause:3.9"}},
+			// the unnamed manifest is not tracked by the image store
+			{Digest: digest.FromString("unnamed")},
+		},
+	})
+	imgs, err := tarballImages(filepath.Join(dir, "pause.tar"))
+	require.NoError(t, err)
+	assert.Equal(t, []tarballImage{{Name: "registry.k8s.io/pause:3.9", Digest: pause}}, imgs)
+
+	config := digest.FromString("config")
+	writeDockerTarball(t, filepath.Join(dir, "docker.tar"), []dockerManifest{
+		{Config: config.Encoded() + ".json", RepoTags: []string{"nginx:1.23", "registry.k8s.io/pause:3.9"}},
+		{Config: "blobs/sha256/" + config.Encoded()},
+	})
+	imgs, err = tarballImages(filepath.Join(dir, "docker.tar"))
+	require.NoError(t, err)
+	assert.Equal(t, []tarballImage{
+		{Name: "docker.io/library/nginx:1.23", Config: config},
+		{Name: "registry.k8s.io/pause:3.9", Config: config},
+	}, imgs)
+
+	writeDockerTarball(t, filepath.Join(dir, "invalid.tar"), []dockerManifest{{Config: "config.json", RepoTags: []string{"nginx:1.23"}}})
+	_, err = tarballImages(filepath.Join(dir, "invalid.tar"))
+	assert.Error(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "invalid.tar")))
+
+	tarballs, err := imageTarballs(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "docker.tar"), filepath.Join(dir, "pause.tar")}, tarballs)
+}
+
+type fakeImageStore struct {
+	images.Store
+	imgs map[string]images.Image
+}
+
+func (s *fakeImageStore) Get(_ context.Context, name string) (images.Image, error) {
+	img, ok := s.imgs[name]
+	if !ok {
+		return images.Image{}, errdefs.ErrNotFound
+	}
+	return img, nil
+}
+
+func TestImagesPresent(t *testing.T) {
+	pause := tarballImage{Name: "registry.k8s.io/pause:3.9", Digest: digest.FromString("pause")}
+	store := &fakeImageStore{imgs: map[string]images.Image{}}
+	ctx := context.TODO()
+
+	present, err := imagesPresent(ctx, store, nil, []tarballImage{pause})
+	require.NoError(t, err)
+	assert.False(t, present)
+
+	store.imgs["registry.k8s.io/pause:3.9"] = images.Image{Target: ocispec.Descriptor{Digest: digest.FromString("old")}}
+	present, err = imagesPresent(ctx, store, nil, []tarballImage{pause})
+	require.NoError(t, err)
+	assert.False(t, present, "the image of different digest must be imported")
+
+	store.imgs["registry.k8s.io/pause:3.9"] = images.Image{Target: ocispec.Descriptor{Digest: pause.Digest}}
+	present, err = imagesPresent(ctx, store, nil, []tarballImage{pause})
+	require.NoError(t, err)
+	assert.True(t, present)
+}
+
+func TestImagesPresent_dockerConfig(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	writeManifest := func(config digest.Digest) ocispec.Descriptor {
+		data, err := json.Marshal(ocispec.Manifest{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: config},
+		})
+		require.NoError(t, err)
+		desc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromBytes(data), Size: int64(len(data))}
+		require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(data), desc))
+		return desc
+	}
+	nginx := tarballImage{Name: "docker.io/library/nginx:1.23", Config: digest.FromString("config")}
+	store := &fakeImageStore{imgs: map[string]images.Image{}}
+
+	store.imgs[nginx.Name] = images.Image{Target: writeManifest(digest.FromString("old"))}
+	present, err := imagesPresent(ctx, store, cs, []tarballImage{nginx})
+	require.NoError(t, err)
+	assert.False(t, present, "the image of different config must be imported")
+
+	store.imgs[nginx.Name] = images.Image{Target: writeManifest(nginx.Config)}
+	present, err = imagesPresent(ctx, store, cs, []tarballImage{nginx})
+	require.NoError(t, err)
+	assert.True(t, present)
+
+	// the manifest content is missing
+	store.imgs[nginx.Name] = images.Image{Target: ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("missing")}}
+	present, err = imagesPresent(ctx, store, cs, []tarballImage{nginx})
+	require.NoError(t, err)
+	assert.False(t, present)
+}
+
+func TestContainerdImagePreload_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	writeOCITarball(t, filepath.Join(dir, "pause.tar"), &ocispec.Index{})
+	// containerd is not connected in dry run
+	p := &ContainerdImagePreload{Dir: dir, Socket: filepath.Join(dir, "containerd.sock")}
+	_, err := p.Install(context.TODO(), component.Options{DryRun: true})
+	assert.NoError(t, err)
+}
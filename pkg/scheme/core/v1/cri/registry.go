@@ -0,0 +1,178 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+// ConfigureRegistriesSteps returns only the steps of configure the cri registries on nodes,
+// so the registries can be reconciled without touching the rest of the cluster.
+// For containerd, the certs.d hosts config is rendered and the config_path of config.toml
+// is ensured, containerd is restarted only if config.toml is changed.
+// For docker, the insecure registries of daemon.json is updated and docker is reloaded.
+func ConfigureRegistriesSteps(cluster *v1.Cluster, registries []v1.RegistrySpec, nodes []v1.StepNode) ([]v1.Step, error) {
+	var (
+		step     component.StepRunnable
+		identity string
+	)
+	switch cluster.ContainerRuntime.Type {
+	case v1.CRIDocker:
+		identity = DockerInsecureRegistryConfigureIdentity
+		step = &DockerInsecureRegistryConfigure{
+			InsecureRegistry: ToDockerInsecureRegistry(registries),
+		}
+	case v1.CRIContainerd:
+		return containerdRegistriesSteps(registries, &ContainerdRegistryConfigure{
+			ClusterName: cluster.Name,
+			Registries:  ToContainerdRegistryConfig(registries),
+			// TODO: get from config
+			ConfigDir:  ContainerdDefaultRegistryConfigDir,
+			ConfigFile: filepath.Join(containerdDefaultConfigDir, "config.toml"),
+		}, nodes)
+	default:
+		return nil, fmt.Errorf("unknown CRI type:%s", cluster.ContainerRuntime.Type)
+	}
+	return registriesSteps(identity, step, nodes)
+}
+
+// UpdateRegistriesSteps returns the steps of updating the cri registries from old to new on nodes,
+// nil is returned if no host is changed.
+// For containerd, only the hosts dirs of the changed hosts are rewritten and the dirs of the removed hosts
+// are deleted, the other hosts are not touched. All the hosts are rendered if the old registries are unknown.
+// For docker, the insecure registries are updated as a whole.
+func UpdateRegistriesSteps(cluster *v1.Cluster, old, new []v1.RegistrySpec, nodes []v1.StepNode) ([]v1.Step, error) {
+	changed, removed := DiffRegistries(old, new)
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil, nil
+	}
+	if cluster.ContainerRuntime.Type != v1.CRIContainerd || len(old) == 0 {
+		return ConfigureRegistriesSteps(cluster, new, nodes)
+	}
+	return containerdRegistriesSteps(changed, &ContainerdRegistryConfigure{
+		ClusterName:  cluster.Name,
+		Registries:   ToContainerdRegistryConfig(changed),
+		ConfigDir:    ContainerdDefaultRegistryConfigDir,
+		ConfigFile:   filepath.Join(containerdDefaultConfigDir, "config.toml"),
+		Incremental:  true,
+		RemovedHosts: removed,
+	}, nodes)
+}
+
+// containerdRegistriesSteps the steps of configure, and the step of pinning the certs of
+// the trust-on-first-use registries before, so a cert mismatch fails before any config is changed.
+func containerdRegistriesSteps(registries []v1.RegistrySpec, configure *ContainerdRegistryConfigure, nodes []v1.StepNode) ([]v1.Step, error) {
+	steps, err := registriesSteps(ContainerdRegistryConfigureIdentity, configure, nodes)
+	if err != nil {
+		return nil, err
+	}
+	pin, err := RegistryCertPinStep(configure.ClusterName, configure.ConfigDir, registries, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if pin == nil {
+		return steps, nil
+	}
+	return append([]v1.Step{*pin}, steps...), nil
+}
+
+// DiffRegistries compares the registries by server, the server is case-insensitive and the order is ignored.
+// The mirrors are grouped under the server they mirror.
+// It returns the registries of the servers added or changed in new, and the servers only in old.
+func DiffRegistries(old, new []v1.RegistrySpec) (changed []v1.RegistrySpec, removed []string) {
+	oldHosts, newHosts := groupRegistriesByHost(old), groupRegistriesByHost(new)
+	for _, r := range new {
+		host := registryServer(r)
+		if !registrySetEqual(oldHosts[host], newHosts[host]) {
+			changed = append(changed, r)
+		}
+	}
+	for host := range oldHosts {
+		if _, ok := newHosts[host]; !ok {
+			removed = append(removed, host)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+func groupRegistriesByHost(registries []v1.RegistrySpec) map[string][]v1.RegistrySpec {
+	hosts := make(map[string][]v1.RegistrySpec, len(registries))
+	for _, r := range registries {
+		r.Host = strings.ToLower(r.Host)
+		server := registryServer(r)
+		hosts[server] = append(hosts[server], r)
+	}
+	return hosts
+}
+
+func registrySetEqual(a, b []v1.RegistrySpec) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, r := range a {
+		found := false
+		for _, o := range b {
+			if r == o {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func registriesSteps(identity string, step component.StepRunnable, nodes []v1.StepNode) ([]v1.Step, error) {
+	stepData, err := json.Marshal(step)
+	if err != nil {
+		return nil, fmt.Errorf("step marshal:%w", err)
+	}
+	return []v1.Step{
+		{
+			ID:     strutil.GetUUID(),
+			Name:   "update-cri-registry-config",
+			Nodes:  nodes,
+			Action: v1.ActionInstall,
+			Timeout: metav1.Duration{
+				Duration: time.Second * 30,
+			},
+			Commands: []v1.Command{
+				{
+					Type:          v1.CommandCustom,
+					Identity:      identity,
+					CustomCommand: stepData,
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,211 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestConfigureRegistriesSteps(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "node1"}, {ID: "node2"}}
+	registries := []v1.RegistrySpec{{Scheme: "https", Host: "mirror.example.com"}}
+	cluster := &v1.Cluster{ContainerRuntime: v1.ContainerRuntime{Type: v1.CRIContainerd}}
+	cluster.Name = "test"
+
+	steps, err := ConfigureRegistriesSteps(cluster, registries, nodes)
+	require.NoError(t, err)
+	require.NotEmpty(t, steps)
+	for _, step := range steps {
+		assert.Equal(t, nodes, step.Nodes)
+		assert.NotEqual(t, v1.ActionUninstall, step.Action)
+		for _, cmd := range step.Commands {
+			// only the registry configure, no cri install or uninstall commands
+			assert.Equal(t, v1.CommandCustom, cmd.Type)
+			assert.Equal(t, ContainerdRegistryConfigureIdentity, cmd.Identity)
+			c := ContainerdRegistryConfigure{}
+			require.NoError(t, json.Unmarshal(cmd.CustomCommand, &c))
+			assert.Contains(t, c.Registries, "mirror.example.com")
+			assert.Equal(t, ContainerdDefaultRegistryConfigDir, c.ConfigDir)
+			assert.Equal(t, "test", c.ClusterName, "the step logs carry the cluster")
+		}
+	}
+
+	_, err = ConfigureRegistriesSteps(&v1.Cluster{ContainerRuntime: v1.ContainerRuntime{Type: "unknown"}}, registries, nodes)
+	assert.Error(t, err)
+}
+
+func Test_ensureRegistryConfigPath(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	content := `version = 2
+
+[debug]
+  level = "debug"
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = "registry.k8s.io/pause:3.6"
+    [plugins."io.containerd.grpc.v1.cri".registry]
+      config_path = "/etc/containerd/old"
+      [plugins."io.containerd.grpc.v1.cri".registry.mirrors]
+        [plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+          endpoint = ["https://mirror.example.com"]
+  [plugins."io.containerd.nri.v1.nri"]
+    disable = false
+    plugin_path = "/opt/nri/plugins"
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(content), 0644))
+
+	changed, err := ensureRegistryConfigPath(configFile, ContainerdDefaultRegistryConfigDir)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	tree, err := toml.LoadBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, ContainerdDefaultRegistryConfigDir, tree.GetPath(append(criRegistryPath, "config_path")))
+	assert.False(t, tree.HasPath(append(criRegistryPath, "mirrors")), "legacy mirrors conflicts with config_path")
+	// the user customizations are kept
+	assert.Equal(t, "debug", tree.GetPath([]string{"debug", "level"}))
+	assert.Equal(t, "/opt/nri/plugins", tree.GetPath([]string{"plugins", "io.containerd.nri.v1.nri", "plugin_path"}))
+	assert.Equal(t, "registry.k8s.io/pause:3.6", tree.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "sandbox_image"}))
+	assert.Equal(t, int64(2), tree.Get("version"))
+
+	changed, err = ensureRegistryConfigPath(configFile, ContainerdDefaultRegistryConfigDir)
+	require.NoError(t, err)
+	assert.False(t, changed, "config.toml already points to the registry config dir")
+}
+
+func Test_ensureRegistryConfigPath_noRegistrySection(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configFile, []byte("version = 2\n"), 0644))
+
+	changed, err := ensureRegistryConfigPath(configFile, ContainerdDefaultRegistryConfigDir)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	tree, err := toml.LoadFile(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, ContainerdDefaultRegistryConfigDir, tree.GetPath(append(criRegistryPath, "config_path")))
+}
+
+func TestDiffRegistries(t *testing.T) {
+	old := []v1.RegistrySpec{
+		{Scheme: "http", Host: "a.io"},
+		{Scheme: "https", Host: "a.io", SkipVerify: true},
+		{Scheme: "https", Host: "b.io"},
+		{Scheme: "https", Host: "c.io"},
+	}
+	new := []v1.RegistrySpec{
+		// reordered and upper case, not changed
+		{Scheme: "https", Host: "A.io", SkipVerify: true},
+		{Scheme: "http", Host: "a.io"},
+		{Scheme: "https", Host: "b.io", CA: "ca data"},
+		{Scheme: "https", Host: "d.io"},
+	}
+	changed, removed := DiffRegistries(old, new)
+	assert.Equal(t, []v1.RegistrySpec{{Scheme: "https", Host: "b.io", CA: "ca data"}, {Scheme: "https", Host: "d.io"}}, changed)
+	assert.Equal(t, []string{"c.io"}, removed)
+
+	changed, removed = DiffRegistries(old, old)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+
+	// the mirror is grouped under the server it mirrors
+	mirror := v1.RegistrySpec{Scheme: "https", Host: "mirror.io", MirrorFor: "a.io"}
+	changed, removed = DiffRegistries(old, append(old, mirror))
+	assert.ElementsMatch(t, []v1.RegistrySpec{old[0], old[1], mirror}, changed)
+	assert.Empty(t, removed)
+}
+
+func TestUpdateRegistriesSteps(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "node1"}}
+	cluster := &v1.Cluster{ContainerRuntime: v1.ContainerRuntime{Type: v1.CRIContainerd}}
+	old := []v1.RegistrySpec{{Scheme: "https", Host: "a.io"}, {Scheme: "https", Host: "b.io"}}
+	new := []v1.RegistrySpec{{Scheme: "https", Host: "a.io"}, {Scheme: "https", Host: "c.io"}}
+
+	steps, err := UpdateRegistriesSteps(cluster, old, new, nodes)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	c := ContainerdRegistryConfigure{}
+	require.NoError(t, json.Unmarshal(steps[0].Commands[0].CustomCommand, &c))
+	assert.True(t, c.Incremental)
+	assert.Len(t, c.Registries, 1)
+	assert.Contains(t, c.Registries, "c.io")
+	assert.Equal(t, []string{"b.io"}, c.RemovedHosts)
+
+	steps, err = UpdateRegistriesSteps(cluster, old, old, nodes)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	// the old registries are unknown, all the hosts are rendered
+	steps, err = UpdateRegistriesSteps(cluster, nil, new, nodes)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	c = ContainerdRegistryConfigure{}
+	require.NoError(t, json.Unmarshal(steps[0].Commands[0].CustomCommand, &c))
+	assert.False(t, c.Incremental)
+	assert.Len(t, c.Registries, 2)
+}
+
+func TestContainerdRegistryConfigure_Install_incremental(t *testing.T) {
+	dir := t.TempDir()
+	full := &ContainerdRegistryConfigure{
+		Registries: ToContainerdRegistryConfig([]v1.RegistrySpec{
+			{Scheme: "https", Host: "a.io"},
+			{Scheme: "https", Host: "b.io"},
+			{Scheme: "https", Host: "c.io"},
+		}),
+		ConfigDir: dir,
+	}
+	_, err := full.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	unchanged := filepath.Join(dir, "a.io", "hosts.toml")
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(unchanged, past, past))
+
+	incremental := &ContainerdRegistryConfigure{
+		Registries:   ToContainerdRegistryConfig([]v1.RegistrySpec{{Scheme: "https", Host: "b.io", SkipVerify: true}}),
+		ConfigDir:    dir,
+		Incremental:  true,
+		RemovedHosts: []string{"c.io"},
+	}
+	_, err = incremental.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	info, err := os.Stat(unchanged)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(past), "the hosts.toml of the unchanged host is rewritten")
+	data, err := os.ReadFile(filepath.Join(dir, "b.io", "hosts.toml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "skip_verify = true")
+	assert.NoDirExists(t, filepath.Join(dir, "c.io"))
+
+	// rendering the same config again keeps the file untouched
+	require.NoError(t, os.Chtimes(unchanged, past, past))
+	_, err = full.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	info, err = os.Stat(unchanged)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(past))
+}
+
+func TestContainerdRegistryConfigure_Install_relativeConfigDir(t *testing.T) {
+	for _, dir := range []string{"", "certs.d", "./etc/containerd/certs.d"} {
+		c := &ContainerdRegistryConfigure{
+			Registries: ToContainerdRegistryConfig([]v1.RegistrySpec{{Scheme: "https", Host: "a.io"}}),
+			ConfigDir:  dir,
+		}
+		_, err := c.Install(context.TODO(), component.Options{})
+		if assert.Error(t, err, dir) {
+			assert.Contains(t, err.Error(), "must be an absolute path")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/initsystem"
+)
+
+// crictlInfo the part of 'crictl info -o json' describing the cri config of containerd
+type crictlInfo struct {
+	Config struct {
+		Containerd struct {
+			DefaultRuntimeName string `json:"defaultRuntimeName"`
+			Runtimes           map[string]struct {
+				Options map[string]interface{} `json:"options"`
+			} `json:"runtimes"`
+		} `json:"containerd"`
+		Registry struct {
+			ConfigPath string `json:"configPath"`
+			Mirrors    map[string]struct {
+				Endpoint []string `json:"endpoint"`
+			} `json:"mirrors"`
+		} `json:"registry"`
+		SandboxImage  string `json:"sandboxImage"`
+		SystemdCgroup bool   `json:"systemdCgroup"`
+	} `json:"config"`
+}
+
+// RuntimeInfo the version and the cri config of the container runtime running on the node,
+// nil is returned if no container runtime is running.
+func RuntimeInfo(ctx context.Context) (*v1.ContainerRuntimeInfo, error) {
+	initSystem, err := initsystem.GetInitSystem()
+	if err != nil {
+		return nil, err
+	}
+	switch detectRuntime(initSystem.ServiceIsActive) {
+	case v1.CRIDocker:
+		return dockerRuntimeInfo(ctx)
+	case v1.CRIContainerd:
+		return containerdRuntimeInfo(ctx)
+	}
+	return nil, nil
+}
+
+// detectRuntime the type of the running container runtime. Docker ships and runs containerd
+// as its own runtime, so docker is checked first.
+func detectRuntime(serviceIsActive func(service string) bool) string {
+	switch {
+	case serviceIsActive("docker"):
+		return v1.CRIDocker
+	case serviceIsActive("containerd"):
+		return v1.CRIContainerd
+	}
+	return ""
+}
+
+// dockerRuntimeInfo the version and the cgroup driver of the docker running on the node.
+func dockerRuntimeInfo(ctx context.Context) (*v1.ContainerRuntimeInfo, error) {
+	ec, err := cmdutil.RunCmdWithContext(ctx, false, "docker", "info", "--format", "{{.ServerVersion}} {{.CgroupDriver}}")
+	if err != nil {
+		return nil, fmt.Errorf("get docker info failed:%w", err)
+	}
+	fields := strings.Fields(ec.StdOut())
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected docker info output: %q", strings.TrimSpace(ec.StdOut()))
+	}
+	return &v1.ContainerRuntimeInfo{Type: v1.CRIDocker, Version: fields[0], CgroupDriver: fields[1]}, nil
+}
+
+// containerdRuntimeInfo the version and the cri config of the containerd running on the node,
+// the cri config is read by crictl and skipped if crictl is not installed.
+func containerdRuntimeInfo(ctx context.Context) (*v1.ContainerRuntimeInfo, error) {
+	ec, err := cmdutil.RunCmdWithContext(ctx, false, "containerd", "--version")
+	if err != nil {
+		return nil, fmt.Errorf("get containerd version failed:%w", err)
+	}
+	version, err := parseContainerdVersion(ec.StdOut())
+	if err != nil {
+		return nil, err
+	}
+	info := &v1.ContainerRuntimeInfo{Type: v1.CRIContainerd, Version: version}
+	if _, err = exec.LookPath("crictl"); err != nil {
+		return info, nil
+	}
+	ec, err = cmdutil.RunCmdWithContext(ctx, false, "crictl", "info", "-o", "json")
+	if err != nil {
+		return info, fmt.Errorf("get containerd cri info failed:%w", err)
+	}
+	if err = parseCrictlInfo([]byte(ec.StdOut()), info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// parseContainerdVersion the version of 'containerd --version', e.g.
+// containerd github.com/containerd/containerd v1.6.4 212e8b6fa2f44b9c21b2798135fc6fb7c53efc16
+func parseContainerdVersion(out string) (string, error) {
+	fields := strings.Fields(out)
+	if len(fields) < 3 || fields[0] != "containerd" {
+		return "", fmt.Errorf("unexpected containerd version output: %q", strings.TrimSpace(out))
+	}
+	return strings.TrimPrefix(fields[2], "v"), nil
+}
+
+// parseCrictlInfo fill the cgroup driver, sandbox image and registry mirrors of 'crictl info -o json' into info.
+// The mirrors of the hosts dirs under the registry config path are preferred to the legacy mirrors.
+func parseCrictlInfo(data []byte, info *v1.ContainerRuntimeInfo) error {
+	var ci crictlInfo
+	if err := json.Unmarshal(data, &ci); err != nil {
+		return fmt.Errorf("parse crictl info failed:%w", err)
+	}
+	info.SandboxImage = ci.Config.SandboxImage
+	info.CgroupDriver = v1.CgroupDriverCgroupfs
+	if systemd, _ := ci.Config.Containerd.Runtimes[ci.Config.Containerd.DefaultRuntimeName].Options["SystemdCgroup"].(bool); systemd || ci.Config.SystemdCgroup {
+		info.CgroupDriver = v1.CgroupDriverSystemd
+	}
+	info.Mirrors = nil
+	if ci.Config.Registry.ConfigPath != "" {
+		mirrors, err := registryConfigPathMirrors(ci.Config.Registry.ConfigPath)
+		if err != nil {
+			return err
+		}
+		info.Mirrors = mirrors
+		return nil
+	}
+	for server, mirror := range ci.Config.Registry.Mirrors {
+		if info.Mirrors == nil {
+			info.Mirrors = make(map[string][]string)
+		}
+		info.Mirrors[server] = mirror.Endpoint
+	}
+	return nil
+}
+
+// registryConfigPathMirrors the hosts of the hosts.toml of each server under the registry config path,
+// the config path may be a list of dirs separated by ':' like containerd does.
+func registryConfigPathMirrors(configPath string) (map[string][]string, error) {
+	var mirrors map[string][]string
+	for _, dir := range filepath.SplitList(configPath) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("read registry config dir:%s failed:%w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if _, ok := mirrors[entry.Name()]; ok {
+				// the server is configured by the former dir
+				continue
+			}
+			tree, err := toml.LoadFile(filepath.Join(dir, entry.Name(), "hosts.toml"))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("parse hosts.toml of %s failed:%w", entry.Name(), err)
+			}
+			hosts, _ := tree.Get("host").(*toml.Tree)
+			if hosts == nil {
+				continue
+			}
+			keys := hosts.Keys()
+			// the hosts are tried in the order of the file
+			sort.SliceStable(keys, func(i, j int) bool {
+				// the keys are urls containing dots, so they are not parsed as a dotted path
+				pi, pj := hosts.GetPositionPath([]string{keys[i]}), hosts.GetPositionPath([]string{keys[j]})
+				return pi.Line < pj.Line
+			})
+			if mirrors == nil {
+				mirrors = make(map[string][]string)
+			}
+			mirrors[entry.Name()] = keys
+		}
+	}
+	return mirrors, nil
+}
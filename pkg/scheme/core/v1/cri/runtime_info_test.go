@@ -0,0 +1,75 @@
+package cri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func Test_parseContainerdVersion(t *testing.T) {
+	version, err := parseContainerdVersion("containerd github.com/containerd/containerd v1.6.4 212e8b6fa2f44b9c21b2798135fc6fb7c53efc16\n")
+	require.NoError(t, err)
+	assert.Equal(t, "1.6.4", version)
+
+	_, err = parseContainerdVersion("command not found")
+	assert.Error(t, err)
+}
+
+func Test_parseCrictlInfo(t *testing.T) {
+	const legacy = `{"config": {
+  "containerd": {"defaultRuntimeName": "runc", "runtimes": {"runc": {"options": {"SystemdCgroup": true}}}},
+  "registry": {"configPath": "", "mirrors": {"docker.io": {"endpoint": ["https://mirror.io", "https://registry-1.docker.io"]}}},
+  "sandboxImage": "registry.k8s.io/pause:3.9"
+}}`
+	info := &v1.ContainerRuntimeInfo{}
+	require.NoError(t, parseCrictlInfo([]byte(legacy), info))
+	assert.Equal(t, v1.CgroupDriverSystemd, info.CgroupDriver)
+	assert.Equal(t, "registry.k8s.io/pause:3.9", info.SandboxImage)
+	assert.Equal(t, map[string][]string{"docker.io": {"https://mirror.io", "https://registry-1.docker.io"}}, info.Mirrors)
+
+	// the hosts of config path are rendered by the registry configure step
+	dir := t.TempDir()
+	cfgs := ToContainerdRegistryConfig([]v1.RegistrySpec{
+		{Scheme: "https", Host: "docker.io"},
+		{Scheme: "https", Host: "mirror.registry.com", MirrorFor: "docker.io"},
+		{Scheme: "http", Host: "10.0.0.1:5000"},
+	})
+	for _, cfg := range cfgs {
+		require.NoError(t, cfg.renderConfigs(dir))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stray"), nil, 0644))
+	configPath := `{"config": {
+  "containerd": {"defaultRuntimeName": "runc", "runtimes": {"runc": {"options": {"SystemdCgroup": false}}}},
+  "registry": {"configPath": "` + dir + `"}
+}}`
+	require.NoError(t, parseCrictlInfo([]byte(configPath), info))
+	assert.Equal(t, v1.CgroupDriverCgroupfs, info.CgroupDriver)
+	assert.Equal(t, map[string][]string{
+		"docker.io":     {"https://mirror.registry.com", "https://docker.io"},
+		"10.0.0.1:5000": {"http://10.0.0.1:5000"},
+	}, info.Mirrors)
+
+	assert.Error(t, parseCrictlInfo([]byte("not json"), info))
+}
+
+func Test_detectRuntime(t *testing.T) {
+	active := func(services ...string) func(string) bool {
+		return func(service string) bool {
+			for _, s := range services {
+				if s == service {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	// docker runs the containerd shipped with it
+	assert.Equal(t, v1.CRIDocker, detectRuntime(active("containerd", "docker")))
+	assert.Equal(t, v1.CRIContainerd, detectRuntime(active("containerd")))
+	assert.Equal(t, "", detectRuntime(active()))
+}
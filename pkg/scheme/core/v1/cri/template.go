@@ -61,9 +61,9 @@ version = 2
 
 [debug]
   address = ""
-  format = ""
+  format = "{{.LogFormat}}"
   gid = 0
-  level = ""
+  level = "{{.LogLevel}}"
   uid = 0
 
 [grpc]
@@ -98,11 +98,13 @@ version = 2
     disable_proc_mount = false
     disable_tcp_service = true
     enable_selinux = false
-    enable_tls_streaming = false
+    enable_tls_streaming = {{.EnableTLSStreaming}}
     enable_unprivileged_icmp = false
     enable_unprivileged_ports = false
     ignore_image_defined_volumes = false
-    max_concurrent_downloads = 3
+{{- if .MaxConcurrentDownloads}}
+    max_concurrent_downloads = {{.MaxConcurrentDownloads}}
+{{- end}}
     max_container_log_line_size = 16384
     netns_mounts_under_state_dir = false
     restrict_oom_score_adj = false
@@ -130,7 +132,7 @@ version = 2
     [plugins."io.containerd.grpc.v1.cri".containerd]
       default_runtime_name = "runc"
       disable_snapshot_annotations = true
-      discard_unpacked_layers = false
+      discard_unpacked_layers = {{.DiscardUnpackedLayers}}
       ignore_rdt_not_enabled_errors = false
       no_pivot = false
       snapshotter = "overlayfs"
@@ -175,6 +177,20 @@ version = 2
             Root = ""
             ShimCgroup = ""
             SystemdCgroup = {{.EnableSystemdCgroup}}
+{{- range .RuntimeHandlers}}
+
+        [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.{{.Name}}]
+          privileged_without_host_devices = false
+          runtime_type = "{{with .RuntimeType}}{{.}}{{else}}io.containerd.runc.v2{{end}}"
+
+          [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.{{.Name}}.options]
+{{- with .BinaryName}}
+            BinaryName = "{{.}}"
+{{- end}}
+{{- if or (not .RuntimeType) (hasPrefix "io.containerd.runc." .RuntimeType)}}
+            SystemdCgroup = {{$.EnableSystemdCgroup}}
+{{- end}}
+{{- end}}
 
       [plugins."io.containerd.grpc.v1.cri".containerd.untrusted_workload_runtime]
         base_runtime_spec = ""
@@ -205,8 +221,8 @@ version = 2
       [plugins."io.containerd.grpc.v1.cri".registry.mirrors]
 
     [plugins."io.containerd.grpc.v1.cri".x509_key_pair_streaming]
-      tls_cert_file = ""
-      tls_key_file = ""
+      tls_cert_file = "{{if .EnableTLSStreaming}}{{.TLSStreamingCertFile}}{{end}}"
+      tls_key_file = "{{if .EnableTLSStreaming}}{{.TLSStreamingKeyFile}}{{end}}"
 
   [plugins."io.containerd.internal.v1.opt"]
     path = "/opt/containerd"
@@ -223,6 +239,17 @@ version = 2
 
   [plugins."io.containerd.monitor.v1.cgroups"]
     no_prometheus = false
+{{- if .EnableNRI}}
+
+  [plugins."io.containerd.nri.v1.nri"]
+    disable = false
+    disable_connections = false
+    plugin_config_path = "{{.NRIPluginConfigDir}}"
+    plugin_path = "{{.NRIPluginDir}}"
+    plugin_registration_timeout = "5s"
+    plugin_request_timeout = "2s"
+    socket_path = "{{.NRISocket}}"
+{{- end}}
 
   [plugins."io.containerd.runtime.v1.linux"]
     no_shim = false
@@ -300,3 +327,15 @@ version = 2
   address = ""
   gid = 0
   uid = 0`
+
+const containerdProxyDropInTemplate = `[Service]
+{{- with .HTTPProxy}}
+Environment="HTTP_PROXY={{.}}"
+{{- end}}
+{{- with .HTTPSProxy}}
+Environment="HTTPS_PROXY={{.}}"
+{{- end}}
+{{- with .NoProxy}}
+Environment="NO_PROXY={{join "," .}}"
+{{- end}}
+`
@@ -0,0 +1,221 @@
+/*
+ *
+ *  * Copyright 2021 KubeClipper Authors.
+ *  *
+ *  * Licensed under the Apache License, Version 2.0 (the "License");
+ *  * you may not use this file except in compliance with the License.
+ *  * You may obtain a copy of the License at
+ *  *
+ *  *     http://www.apache.org/licenses/LICENSE-2.0
+ *  *
+ *  * Unless required by applicable law or agreed to in writing, software
+ *  * distributed under the License is distributed on an "AS IS" BASIS,
+ *  * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  * See the License for the specific language governing permissions and
+ *  * limitations under the License.
+ *
+ */
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const tofuDialTimeout = 10 * time.Second
+
+var ContainerdRegistryCertPinIdentity = fmt.Sprintf(
+	component.RegisterStepKeyFormat, criContainerd+"-registryCertPin", criVersion, component.TypeStep)
+
+func init() {
+	component.AddAgentStep(ContainerdRegistryCertPinIdentity, &ContainerdRegistryCertPin{})
+}
+
+var _ component.StepRunnable = (*ContainerdRegistryCertPin)(nil)
+
+// ContainerdRegistryCertPin pins the certs served by the trust-on-first-use hosts under ConfigDir,
+// before the hosts.toml are rendered. The cert is fetched and pinned on first use, later it must
+// match the pinned one. Nothing is written unless all hosts pass, so a mismatch fails the operation
+// before any registry config is changed.
+type ContainerdRegistryCertPin struct {
+	// ClusterName the cluster of the nodes, carried by the logs of the step
+	ClusterName string                         `json:"clusterName,omitempty"`
+	Registries  map[string]*ContainerdRegistry `json:"registries,omitempty"`
+	ConfigDir   string                         `json:"configDir"`
+}
+
+func (p *ContainerdRegistryCertPin) NewInstance() component.ObjectMeta {
+	return &ContainerdRegistryCertPin{}
+}
+
+func (p *ContainerdRegistryCertPin) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	if err := validateRegistryConfigDir(p.ConfigDir); err != nil {
+		return nil, err
+	}
+	log := component.StepLogger(ctx, criContainerd, p.ClusterName)
+	pins := make(map[string][]byte)
+	var errs []error
+	for _, r := range p.Registries {
+		hostDir := filepath.Join(p.ConfigDir, strings.ToLower(r.Server))
+		for _, host := range r.Hosts {
+			if !host.pinCert() {
+				continue
+			}
+			caFile := pinnedCertFile(hostDir, host.Host)
+			certs, err := checkPinnedCert(log, caFile, host.Host)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if certs != nil {
+				pins[caFile] = certs
+			}
+		}
+	}
+	if len(errs) > 0 || opts.DryRun {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	for caFile, certs := range pins {
+		if err := os.MkdirAll(filepath.Dir(caFile), registryDirMode); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(caFile, certs, registryFileMode); err != nil {
+			return nil, fmt.Errorf("write ca file:%s failed:%w", caFile, err)
+		}
+		log.Infof("pin registry cert to %s", caFile)
+	}
+	return nil, nil
+}
+
+func (p *ContainerdRegistryCertPin) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("ContainerdRegistryCertPin dose not support uninstall")
+}
+
+// checkPinnedCert fetch the cert served by host and compare it with the pinned caFile.
+// It returns the cert to pin if caFile does not exist, or nil if the pinned one matches.
+// The pinned cert is kept if host is unreachable, the registry may be down for a while.
+func checkPinnedCert(log logger.Logging, caFile, host string) ([]byte, error) {
+	pinned, err := os.ReadFile(caFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read ca file:%s failed:%w", caFile, err)
+	}
+	certs, fetchErr := FetchServerCert(host, tofuDialTimeout)
+	if pinned == nil {
+		if fetchErr != nil {
+			return nil, fmt.Errorf("fetch registry %s cert failed:%w", host, fetchErr)
+		}
+		return certs, nil
+	}
+	if fetchErr != nil {
+		log.Warnf("fetch registry %s cert failed, keep the pinned %s: %v", host, caFile, fetchErr)
+		return nil, nil
+	}
+	if !bytes.Equal(pinned, certs) {
+		return nil, fmt.Errorf("the cert served by registry %s does not match the pinned %s, "+
+			"remove it to trust the new cert", host, caFile)
+	}
+	return nil, nil
+}
+
+// pinnedCertFile the pinned cert file of host under the host dir of its server
+func pinnedCertFile(hostDir, host string) string {
+	return filepath.Join(hostDir, fmt.Sprintf("%s.tofu.pem", host))
+}
+
+// pinCert whether the cert served by host is pinned as its CA
+func (host ContainerdHost) pinCert() bool {
+	return len(host.CA) == 0 && host.TrustOnFirstUse && host.Scheme == "https" && !host.SkipVerify
+}
+
+// RegistryCertPinStep the step of pinning the certs of the trust-on-first-use registries on nodes,
+// it runs before the registry configs are rendered. It returns nil if no registry trusts on first use.
+func RegistryCertPinStep(clusterName, configDir string, registries []v1.RegistrySpec, nodes []v1.StepNode) (*v1.Step, error) {
+	cfgs := make(map[string]*ContainerdRegistry)
+	pins := 0
+	for server, cfg := range ToContainerdRegistryConfig(registries) {
+		for _, host := range cfg.Hosts {
+			if host.pinCert() {
+				// only the host names are needed, the credentials are not sent in the step
+				pinned, ok := cfgs[server]
+				if !ok {
+					pinned = &ContainerdRegistry{Server: cfg.Server}
+					cfgs[server] = pinned
+				}
+				pinned.Hosts = append(pinned.Hosts, ContainerdHost{Scheme: host.Scheme, Host: host.Host, TrustOnFirstUse: true})
+				pins++
+			}
+		}
+	}
+	if pins == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(&ContainerdRegistryCertPin{ClusterName: clusterName, Registries: cfgs, ConfigDir: configDir})
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "pinRegistryCerts",
+		Timeout:    metav1.Duration{Duration: time.Duration(pins+1) * tofuDialTimeout},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      ContainerdRegistryCertPinIdentity,
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
+
+// FetchServerCert fetch the certificate chain served by host and encode it to PEM,
+// host is in 'host[:port]' format, the port defaults to 443.
+func FetchServerCert(host string, timeout time.Duration) ([]byte, error) {
+	addr := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(host, "443")
+	}
+	serverName, _, _ := net.SplitHostPort(addr)
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{
+		ServerName: serverName,
+		// the cert is untrusted until it is pinned
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate served by %s", addr)
+	}
+	buf := &bytes.Buffer{}
+	for _, cert := range certs {
+		if err = pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package cri
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestContainerdRegistryRender_TrustOnFirstUse(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	r := ContainerdRegistry{
+		Server: u.Host,
+		Hosts: []ContainerdHost{
+			{
+				Scheme:          "https",
+				Host:            u.Host,
+				Capabilities:    []string{CapabilityPull, CapabilityResolve},
+				TrustOnFirstUse: true,
+			},
+		},
+	}
+	assert.Error(t, r.renderConfigs(dir), "the cert must be pinned before render")
+
+	pin := &ContainerdRegistryCertPin{Registries: map[string]*ContainerdRegistry{u.Host: &r}, ConfigDir: dir}
+	_, err = pin.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	require.NoError(t, r.renderConfigs(dir))
+
+	caFile := filepath.Join(dir, u.Host, u.Host+".tofu.pem")
+	ca, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	block, _ := pem.Decode(ca)
+	require.NotNil(t, block)
+	assert.Equal(t, srv.Certificate().Raw, block.Bytes, "the served cert should be pinned")
+
+	hostConfig, err := os.ReadFile(filepath.Join(dir, u.Host, "hosts.toml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(hostConfig), `ca = "`+strings.ReplaceAll(caFile, `\`, `\\`)+`"`)
+
+	// the pinned cert matches on the next install
+	_, err = pin.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+
+	// the pinned cert is reused even if the registry is unreachable later
+	srv.Close()
+	_, err = pin.Install(context.TODO(), component.Options{})
+	require.NoError(t, err)
+	require.NoError(t, r.renderConfigs(dir))
+	pinned, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	assert.Equal(t, ca, pinned)
+}
+
+func TestContainerdRegistryCertPin_mismatch(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, u.Host, u.Host+".tofu.pem")
+	require.NoError(t, os.MkdirAll(filepath.Dir(caFile), 0755))
+	require.NoError(t, os.WriteFile(caFile, []byte("other cert"), 0644))
+	// the unreachable host is not pinned either, nothing is written if any host fails
+	newHost := "127.0.0.1:1"
+	pin := &ContainerdRegistryCertPin{
+		Registries: map[string]*ContainerdRegistry{
+			u.Host:  {Server: u.Host, Hosts: []ContainerdHost{{Scheme: "https", Host: u.Host, TrustOnFirstUse: true}}},
+			newHost: {Server: newHost, Hosts: []ContainerdHost{{Scheme: "https", Host: newHost, TrustOnFirstUse: true}}},
+		},
+		ConfigDir: dir,
+	}
+	_, err = pin.Install(context.TODO(), component.Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the pinned")
+	pinned, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	assert.Equal(t, "other cert", string(pinned), "the pinned cert must not be overwritten")
+}
+
+func TestRegistryCertPinStep(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "n1"}}
+	step, err := RegistryCertPinStep("test", ContainerdDefaultRegistryConfigDir, []v1.RegistrySpec{
+		{Scheme: "https", Host: "ca.registry.com", CA: "ca"},
+		{Scheme: "http", Host: "insecure.registry.com", TrustOnFirstUse: true},
+	}, nodes)
+	require.NoError(t, err)
+	assert.Nil(t, step, "no registry trusts on first use")
+
+	step, err = RegistryCertPinStep("test", ContainerdDefaultRegistryConfigDir, []v1.RegistrySpec{
+		{Scheme: "https", Host: "tofu.registry.com", TrustOnFirstUse: true, Username: "admin", Password: "passw0rd"},
+	}, nodes)
+	require.NoError(t, err)
+	require.NotNil(t, step)
+	assert.Equal(t, ContainerdRegistryCertPinIdentity, step.Commands[0].Identity)
+	assert.NotContains(t, string(step.Commands[0].CustomCommand), "passw0rd", "the credentials are not needed to pin")
+}
@@ -0,0 +1,255 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	certification = "certification"
+	// staticPodManifestsBackupDir the dir the static pod manifests are moved to while restarting the control plane
+	staticPodManifestsBackupDir = "/tmp/.k8s/config"
+	// staticPodStopWait the time to wait for kubelet stopping the static pods after their manifests are moved out
+	staticPodStopWait = 20 * time.Second
+	// controlPlaneReadyTimeout the timeout of waiting for the apiserver and the local etcd member healthy after restarted
+	controlPlaneReadyTimeout = 3 * time.Minute
+	// localEtcdHealthURL the health endpoint of the local etcd member, kubeadm listens the metrics urls on it
+	localEtcdHealthURL = "http://127.0.0.1:2381/health"
+)
+
+// controlPlaneReadyInterval the interval of polling the control plane health, replaced in tests
+var controlPlaneReadyInterval = 5 * time.Second
+
+// certsExpirationRowRe the row of 'kubeadm certs check-expiration', the name is followed by the expiration time
+// like "Oct 14, 2027 08:00 UTC", the columns after it differ between the certificates and the certificate authorities.
+var certsExpirationRowRe = regexp.MustCompile(`^(\S+)\s+([A-Z][a-z]{2} \d{1,2}, \d{4} \d{2}:\d{2} \S+)\s*(.*)$`)
+
+// controlPlaneManifests the static pod manifests restarted after the certificates are renewed,
+// etcd.yaml is absent when kubernetes uses an external etcd cluster
+var controlPlaneManifests = []string{"etcd.yaml", "kube-apiserver.yaml", "kube-controller-manager.yaml", "kube-scheduler.yaml"}
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, certification, version, component.TypeStep), &Certification{})
+}
+
+var _ component.StepRunnable = (*Certification)(nil)
+
+// Certification renews the control plane certificates of a master, restarts the static pods to load them,
+// regenerates the admin kubeconfig, waits for the control plane ready and responds the output of
+// 'kubeadm certs check-expiration'.
+type Certification struct {
+	KubernetesVersion string `json:"kubernetesVersion"`
+	ManifestsDir      string `json:"manifestsDir,omitempty"`
+	BackupDir         string `json:"backupDir,omitempty"`
+	EtcdHealthURL     string `json:"etcdHealthURL,omitempty"`
+}
+
+func (stepper *Certification) NewInstance() component.ObjectMeta {
+	return &Certification{}
+}
+
+func (stepper *Certification) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	renew := CertsCmd(stepper.KubernetesVersion, "renew", "all")
+	if _, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, renew[0], renew[1:]...); err != nil {
+		return nil, fmt.Errorf("renew certificates failed:%w", err)
+	}
+	if opts.DryRun {
+		return nil, nil
+	}
+	if err := stepper.restartStaticPods(ctx); err != nil {
+		return nil, err
+	}
+	if err := generateKubeConfig(ctx); err != nil {
+		return nil, fmt.Errorf("regenerate admin kubeconfig failed:%w", err)
+	}
+	// the next master is renewed only after this control plane serves again
+	if err := stepper.waitControlPlaneReady(ctx, controlPlaneReadyTimeout); err != nil {
+		return nil, err
+	}
+	check := CertsCmd(stepper.KubernetesVersion, "check-expiration")
+	ec, err := cmdutil.RunCmdWithContext(ctx, false, check[0], check[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("check certificates expiration failed:%w", err)
+	}
+	logger.Infof("certificates renewed:\n%s", ec.StdOut())
+	return []byte(ec.StdOut()), nil
+}
+
+func (stepper *Certification) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("Certification dose not support uninstall")
+}
+
+// restartStaticPods moves the control plane manifests out until kubelet stops the static pods, and moves them back.
+// The manifests are moved back even if the context is canceled, otherwise the control plane is left down.
+func (stepper *Certification) restartStaticPods(ctx context.Context) error {
+	manifestsDir := strutil.StringDefaultIfEmpty(KubeManifestsDir, stepper.ManifestsDir)
+	backupDir := strutil.StringDefaultIfEmpty(staticPodManifestsBackupDir, stepper.BackupDir)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+	var moved []string
+	defer func() {
+		for _, m := range moved {
+			if err := os.Rename(filepath.Join(backupDir, m), filepath.Join(manifestsDir, m)); err != nil {
+				logger.Errorf("restore static pod manifest %s failed: %v", m, err)
+			}
+		}
+	}()
+	for _, m := range controlPlaneManifests {
+		err := os.Rename(filepath.Join(manifestsDir, m), filepath.Join(backupDir, m))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("move static pod manifest %s failed:%w", m, err)
+		}
+		moved = append(moved, m)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(staticPodStopWait):
+	}
+	return nil
+}
+
+// waitControlPlaneReady waits for the restarted apiserver ready and the local etcd member healthy,
+// etcd is skipped when kubernetes uses an external etcd cluster.
+func (stepper *Certification) waitControlPlaneReady(ctx context.Context, timeout time.Duration) error {
+	manifestsDir := strutil.StringDefaultIfEmpty(KubeManifestsDir, stepper.ManifestsDir)
+	if _, err := os.Stat(filepath.Join(manifestsDir, "etcd.yaml")); err == nil {
+		etcdURL := strutil.StringDefaultIfEmpty(localEtcdHealthURL, stepper.EtcdHealthURL)
+		cli := &http.Client{Timeout: 3 * time.Second}
+		var lastErr error
+		err = wait.PollImmediateWithContext(ctx, controlPlaneReadyInterval, timeout, func(ctx context.Context) (bool, error) {
+			lastErr = etcdHealthy(ctx, cli, etcdURL)
+			return lastErr == nil, nil
+		})
+		if err != nil {
+			return fmt.Errorf("local etcd member is not healthy after restarted:%w: %v", err, lastErr)
+		}
+	}
+	var lastErr error
+	err := wait.PollImmediateWithContext(ctx, controlPlaneReadyInterval, timeout, func(ctx context.Context) (bool, error) {
+		_, lastErr = runKubectl(ctx, false, "get", "--raw=/readyz")
+		return lastErr == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("kube-apiserver is not ready after restarted:%w: %v", err, lastErr)
+	}
+	return nil
+}
+
+// etcdHealthy checks the etcd health endpoint responds {"health":"true"}
+func etcdHealthy(ctx context.Context, cli *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	health := struct {
+		Health string `json:"health"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("decode etcd health failed:%w", err)
+	}
+	if resp.StatusCode != http.StatusOK || health.Health != "true" {
+		return fmt.Errorf("etcd is unhealthy, status %s, health %s", resp.Status, health.Health)
+	}
+	return nil
+}
+
+// CertsCmd the kubeadm certs command, it is under the alpha command before kubernetes 1.20
+func CertsCmd(kubeVersion string, args ...string) []string {
+	cmd := []string{"kubeadm", "certs"}
+	if len(kubeVersion) > 1 && kubeVersion[1:] < KubeCertsCluVersion {
+		cmd = []string{"kubeadm", "alpha", "certs"}
+	}
+	return append(cmd, args...)
+}
+
+// ParseCertsExpiration parses the output of 'kubeadm certs check-expiration'. The rows are matched by the
+// expiration time instead of the fixed columns, so the log lines, the missing certificates and the columns
+// added by the newer kubeadm versions are skipped.
+func ParseCertsExpiration(output string) ([]v1.Certification, error) {
+	var (
+		certs  []v1.Certification
+		caRows bool
+	)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "CERTIFICATE") && strings.Contains(line, "EXPIRES") {
+			// the header of the certificate authorities section starts with "CERTIFICATE AUTHORITY"
+			caRows = strings.HasPrefix(line, "CERTIFICATE AUTHORITY")
+			continue
+		}
+		m := certsExpirationRowRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		expire, err := time.Parse("Jan 2, 2006 15:04 MST", m[2])
+		if err != nil {
+			return nil, fmt.Errorf("parse expiration time of certificate %s failed:%w", m[1], err)
+		}
+		cert := v1.Certification{Name: m[1], ExpirationTime: metav1.Time{Time: expire}}
+		// residual time, certificate authority and externally managed
+		if rest := strings.Fields(m[3]); !caRows && len(rest) >= 3 {
+			cert.CAName = rest[1]
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate expiration found in the output: %s", output)
+	}
+	return certs, nil
+}
+
+// InstallSteps renews the certificates master by master, so only one apiserver is restarting at a time.
+func (stepper *Certification) InstallSteps(clu *v1.Cluster, nodes []v1.StepNode) ([]v1.Step, error) {
+	stepper.KubernetesVersion = clu.KubernetesVersion
+	bytes, err := json.Marshal(stepper)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]v1.Step, 0, len(nodes))
+	for _, node := range nodes {
+		steps = append(steps, v1.Step{
+			ID:         strutil.GetUUID(),
+			Name:       "renewCerts",
+			Nodes:      []v1.StepNode{node},
+			Action:     v1.ActionInstall,
+			Timeout:    metav1.Duration{Duration: 5*time.Minute + 2*controlPlaneReadyTimeout},
+			ErrIgnore:  false,
+			RetryTimes: 1,
+			Commands: []v1.Command{
+				{
+					Type:          v1.CommandCustom,
+					Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, certification, version, component.TypeStep),
+					CustomCommand: bytes,
+				},
+			},
+		})
+	}
+	return steps, nil
+}
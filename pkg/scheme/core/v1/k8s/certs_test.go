@@ -0,0 +1,169 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestCertification_InstallSteps(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "m1"}, {ID: "m2"}}
+	steps, err := (&Certification{}).InstallSteps(&v1.Cluster{KubernetesVersion: "v1.23.6"}, nodes)
+	if err != nil {
+		t.Fatalf("InstallSteps() error = %v", err)
+	}
+	if len(steps) != 2 || steps[0].Nodes[0].ID != "m1" || steps[1].Nodes[0].ID != "m2" {
+		t.Fatalf("InstallSteps() want one step per master, got %+v", steps)
+	}
+	got := &Certification{}
+	if err = json.Unmarshal(steps[0].Commands[0].CustomCommand, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.KubernetesVersion != "v1.23.6" {
+		t.Errorf("InstallSteps() KubernetesVersion = %s", got.KubernetesVersion)
+	}
+}
+
+func TestCertsCmd(t *testing.T) {
+	if got := CertsCmd("v1.18.6", "renew", "all"); !reflect.DeepEqual(got, []string{"kubeadm", "alpha", "certs", "renew", "all"}) {
+		t.Errorf("CertsCmd() = %v", got)
+	}
+	if got := CertsCmd("v1.23.6", "check-expiration"); !reflect.DeepEqual(got, []string{"kubeadm", "certs", "check-expiration"}) {
+		t.Errorf("CertsCmd() = %v", got)
+	}
+}
+
+func TestCertification_restartStaticPods_restoreOnCancel(t *testing.T) {
+	manifests, backup := t.TempDir(), t.TempDir()
+	// etcd.yaml is absent when using the external etcd
+	for _, m := range []string{"kube-apiserver.yaml", "kube-controller-manager.yaml", "kube-scheduler.yaml"} {
+		if err := os.WriteFile(filepath.Join(manifests, m), []byte(m), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &Certification{ManifestsDir: manifests, BackupDir: backup}
+	if err := c.restartStaticPods(ctx); err == nil {
+		t.Fatal("restartStaticPods() want the context error")
+	}
+	for _, m := range []string{"kube-apiserver.yaml", "kube-controller-manager.yaml", "kube-scheduler.yaml"} {
+		if _, err := os.Stat(filepath.Join(manifests, m)); err != nil {
+			t.Errorf("restartStaticPods() want %s restored, got %v", m, err)
+		}
+	}
+}
+
+func TestCertification_waitControlPlaneReady(t *testing.T) {
+	origin := controlPlaneReadyInterval
+	controlPlaneReadyInterval = 10 * time.Millisecond
+	t.Cleanup(func() { controlPlaneReadyInterval = origin })
+
+	etcdHealth := `{"health":"false"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(etcdHealth))
+	}))
+	defer srv.Close()
+	manifests := t.TempDir()
+	if err := os.WriteFile(filepath.Join(manifests, "etcd.yaml"), []byte("etcd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	readyz := 0
+	fakeVerifyKubectl(t, func(args []string) (string, error) {
+		if readyz++; readyz < 3 {
+			return "", errors.New("connection refused")
+		}
+		return "ok", nil
+	})
+
+	c := &Certification{ManifestsDir: manifests, EtcdHealthURL: srv.URL}
+	if err := c.waitControlPlaneReady(context.Background(), 100*time.Millisecond); err == nil {
+		t.Fatal("waitControlPlaneReady() want the error of the unhealthy etcd")
+	}
+	if readyz != 0 {
+		t.Errorf("waitControlPlaneReady() want the apiserver checked after etcd healthy, checked %d times", readyz)
+	}
+	etcdHealth = `{"health":"true"}`
+	if err := c.waitControlPlaneReady(context.Background(), time.Second); err != nil {
+		t.Errorf("waitControlPlaneReady() error = %v", err)
+	}
+	if readyz != 3 {
+		t.Errorf("waitControlPlaneReady() want the apiserver polled until ready, checked %d times", readyz)
+	}
+}
+
+func TestParseCertsExpiration(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		wantNames []string
+		wantCA    map[string]string
+	}{
+		{
+			name: "v1.24",
+			output: `[check-expiration] Reading configuration from the cluster...
+[check-expiration] FYI: You can look at this config file with 'kubectl -n kube-system get cm kubeadm-config -o yaml'
+
+CERTIFICATE                EXPIRES                  RESIDUAL TIME   CERTIFICATE AUTHORITY   EXTERNALLY MANAGED
+admin.conf                 Oct 14, 2027 08:00 UTC   364d            ca                      no
+apiserver                  Oct 14, 2027 08:00 UTC   364d            ca                      no
+apiserver-etcd-client      Oct 14, 2027 08:00 UTC   364d            etcd-ca                 no
+
+CERTIFICATE AUTHORITY   EXPIRES                  RESIDUAL TIME   EXTERNALLY MANAGED
+ca                      Oct 12, 2036 08:00 UTC   9y              no
+etcd-ca                 Oct 12, 2036 08:00 UTC   9y              no
+`,
+			wantNames: []string{"admin.conf", "apiserver", "apiserver-etcd-client", "ca", "etcd-ca"},
+			wantCA:    map[string]string{"apiserver-etcd-client": "etcd-ca", "ca": ""},
+		},
+		{
+			name: "v1.30 with warnings and missing certificates",
+			output: `W1014 08:00:00.000000   12345 utils.go:69] The recommended value for "clusterDNS" in "KubeletConfiguration" is: [10.96.0.10]
+[check-expiration] Reading configuration from the cluster...
+
+CERTIFICATE                EXPIRES                  RESIDUAL TIME   CERTIFICATE AUTHORITY   EXTERNALLY MANAGED
+super-admin.conf           Oct 14, 2027 08:00 UTC   364d            ca                      no
+apiserver-etcd-client      Oct 14, 2027 08:00 UTC   364d                                    yes
+!MISSING! front-proxy-client
+
+CERTIFICATE AUTHORITY   EXPIRES                  RESIDUAL TIME   EXTERNALLY MANAGED
+ca                      Oct 12, 2036 08:00 UTC   9y              no
+`,
+			wantNames: []string{"super-admin.conf", "apiserver-etcd-client", "ca"},
+			wantCA:    map[string]string{"super-admin.conf": "ca", "apiserver-etcd-client": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs, err := ParseCertsExpiration(tt.output)
+			if err != nil {
+				t.Fatalf("ParseCertsExpiration() error = %v", err)
+			}
+			var names []string
+			for _, c := range certs {
+				names = append(names, c.Name)
+				if ca, ok := tt.wantCA[c.Name]; ok && ca != c.CAName {
+					t.Errorf("ParseCertsExpiration() %s ca = %q, want %q", c.Name, c.CAName, ca)
+				}
+				if c.ExpirationTime.Year() < 2027 {
+					t.Errorf("ParseCertsExpiration() %s expiration = %v", c.Name, c.ExpirationTime)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("ParseCertsExpiration() names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+	if _, err := ParseCertsExpiration("error: unable to read kubeadm config"); err == nil {
+		t.Error("ParseCertsExpiration() want error of the output without certificates")
+	}
+}
@@ -29,8 +29,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/kubeclipper/kubeclipper/pkg/scheme/common"
-
 	"github.com/kubeclipper/kubeclipper/pkg/agent/config"
 	"github.com/kubeclipper/kubeclipper/pkg/component"
 	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
@@ -41,6 +39,7 @@ import (
 	"github.com/kubeclipper/kubeclipper/pkg/simple/downloader"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/initsystem"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/netutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/sysutil"
@@ -62,15 +61,9 @@ const (
 )
 
 func init() {
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, upgradePackage, version, component.TypeStep), &UpgradePackage{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, actBackup, version, component.TypeStep), &ActBackup{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, recovery, version, component.TypeStep), &Recovery{}); err != nil {
-		panic(err)
-	}
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, upgradePackage, version, component.TypeStep), &UpgradePackage{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, actBackup, version, component.TypeStep), &ActBackup{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, recovery, version, component.TypeStep), &Recovery{})
 }
 
 type Upgrade struct {
@@ -78,6 +71,8 @@ type Upgrade struct {
 	Offline       bool           `json:"offline"`
 	Version       string         `json:"version"`
 	LocalRegistry string         `json:"localRegistry"`
+	CRIVersion    string         `json:"criVersion"`
+	CNIVersion    string         `json:"cniVersion"`
 	installSteps  []v1.Step
 }
 
@@ -128,6 +123,7 @@ type Recovery struct {
 	SSL                bool
 	BackupFileSize     int64
 	BackupFileMD5      string
+	SkipKubeProxy      bool
 	FileDir
 
 	installSteps []v1.Step
@@ -152,11 +148,14 @@ func (stepper *Upgrade) InitStepper(metadata *component.ExtraMetadata, c *v1.Clu
 		CertSANs:                c.GetAllCertSANs(),
 		LocalRegistry:           c.LocalRegistry,
 		FeatureGates:            c.FeatureGates,
-		IgnorePreflightErrors:   parseIgnorePreflightErrors(c.Annotations[common.AnnotationOnlyIgnorePreflightErrors]),
+		IgnorePreflightErrors:   clusterIgnorePreflightErrors(c),
+		CgroupDriver:            c.ResolveCgroupDriver(),
 	}
 	stepper.Offline = metadata.Offline
 	stepper.Version = metadata.KubeVersion
 	stepper.LocalRegistry = metadata.LocalRegistry
+	stepper.CRIVersion = c.ContainerRuntime.Version
+	stepper.CNIVersion = c.CNI.Version
 }
 
 func (stepper *Upgrade) Validate() error {
@@ -256,76 +255,44 @@ func (stepper *Upgrade) InitSteps(ctx context.Context) error {
 			},
 			RetryTimes: 1,
 		},
-		{
-			ID:        strutil.GetUUID(),
-			Name:      fmt.Sprintf("UpgradeControlPlane-%s", extraMetadata.GetMasterHostname(masters[0].ID)),
-			Nodes:     []v1.StepNode{utils.UnwrapNodeList(masters)[0]},
-			Action:    v1.ActionInstall,
-			Timeout:   metav1.Duration{Duration: 10 * time.Minute},
-			ErrIgnore: false,
-			Commands: []v1.Command{
-				{
-					Type: v1.CommandShell,
-					ShellCommand: []string{"/bin/bash", "-c", fmt.Sprintf(`
-kubeadm upgrade apply %s -f --ignore-preflight-errors all --config /tmp/.k8s/kubeadm.yaml
-sleep 10
-kubectl drain %s --ignore-daemonsets || true
-systemctl stop kubelet
-systemctl daemon-reload && systemctl restart kubelet
-kubectl uncordon %s || true`,
-						stepper.Version, extraMetadata.GetMasterHostname(masters[0].ID), extraMetadata.GetMasterHostname(masters[0].ID))},
-				},
-			},
-			RetryTimes: 0,
-		},
 	}...)
 
-	for i := 1; i < len(masters); i++ {
-		stepper.installSteps = append(stepper.installSteps, v1.Step{
-			ID:        strutil.GetUUID(),
-			Name:      fmt.Sprintf("UpgradeControlPlane-%s", extraMetadata.GetMasterHostname(masters[i].ID)),
-			Nodes:     []v1.StepNode{utils.UnwrapNodeList(masters)[i]},
-			Action:    v1.ActionInstall,
-			Timeout:   metav1.Duration{Duration: 10 * time.Minute},
-			ErrIgnore: false,
-			Commands: []v1.Command{
-				{
-					Type: v1.CommandShell,
-					ShellCommand: []string{"/bin/bash", "-c", fmt.Sprintf(`
-kubeadm upgrade node
-sleep 10
-kubectl drain %s --ignore-daemonsets || true
-systemctl stop kubelet
-systemctl daemon-reload && systemctl restart kubelet
-kubectl uncordon %s || true`,
-						extraMetadata.GetMasterHostname(masters[i].ID), extraMetadata.GetMasterHostname(masters[i].ID))},
-				},
-			},
-			RetryTimes: 0,
-		})
-	}
-
-	for i := range workers {
+	masterNodes := utils.UnwrapNodeList(masters)
+	for i := range masters {
+		hostname := extraMetadata.GetMasterHostname(masters[i].ID)
+		// the first master applies the new version, the others upgrade their own control plane
+		upgradeCmd := "kubeadm upgrade node"
+		if i == 0 {
+			upgradeCmd = fmt.Sprintf("kubeadm upgrade apply %s -f --ignore-preflight-errors all --config /tmp/.k8s/kubeadm.yaml", stepper.Version)
+		}
+		// the upgrade goes on even if some pods can not be evicted
+		drainStep := DrainNode(masterNodes, masterNodes[i], hostname, DefaultDrainOptions(stepper.Version))
+		drainStep.ErrIgnore, drainStep.RetryTimes = true, 0
+		uncordonStep := UncordonNode(masterNodes, masterNodes[i], hostname, "")
+		uncordonStep.ErrIgnore, uncordonStep.RetryTimes = true, 0
 		stepper.installSteps = append(stepper.installSteps, []v1.Step{
 			{
 				ID:        strutil.GetUUID(),
-				Name:      fmt.Sprintf("DrainNode-%s", extraMetadata.GetWorkerHostname(workers[i].ID)),
-				Nodes:     []v1.StepNode{utils.UnwrapNodeList(masters)[0]},
+				Name:      fmt.Sprintf("UpgradeControlPlane-%s", hostname),
+				Nodes:     []v1.StepNode{masterNodes[i]},
 				Action:    v1.ActionInstall,
-				Timeout:   metav1.Duration{Duration: 1 * time.Minute},
-				ErrIgnore: true,
+				Timeout:   metav1.Duration{Duration: 10 * time.Minute},
+				ErrIgnore: false,
 				Commands: []v1.Command{
 					{
-						Type:         v1.CommandShell,
-						ShellCommand: []string{"kubectl", "drain", extraMetadata.GetWorkerHostname(workers[i].ID)},
+						Type: v1.CommandShell,
+						ShellCommand: []string{"/bin/bash", "-c", fmt.Sprintf(`
+%s
+sleep 10`, upgradeCmd)},
 					},
 				},
 				RetryTimes: 0,
 			},
+			drainStep,
 			{
 				ID:        strutil.GetUUID(),
-				Name:      fmt.Sprintf("UpgradeWorker-%s", extraMetadata.GetWorkerHostname(workers[i].ID)),
-				Nodes:     []v1.StepNode{utils.UnwrapNodeList(workers)[i]},
+				Name:      fmt.Sprintf("RestartKubelet-%s", hostname),
+				Nodes:     []v1.StepNode{masterNodes[i]},
 				Action:    v1.ActionInstall,
 				Timeout:   metav1.Duration{Duration: 10 * time.Minute},
 				ErrIgnore: false,
@@ -333,29 +300,48 @@ kubectl uncordon %s || true`,
 					{
 						Type: v1.CommandShell,
 						ShellCommand: []string{"/bin/bash", "-c", `
-kubeadm upgrade node
 systemctl stop kubelet
 systemctl daemon-reload && systemctl restart kubelet`},
 					},
 				},
 				RetryTimes: 0,
 			},
+			uncordonStep}...)
+	}
+
+	for i := range workers {
+		worker := utils.UnwrapNodeList(workers)[i]
+		hostname := extraMetadata.GetWorkerHostname(workers[i].ID)
+		// the upgrade goes on even if some pods can not be evicted
+		drainStep := DrainNode(masterNodes, worker, hostname, DefaultDrainOptions(stepper.Version))
+		drainStep.ErrIgnore, drainStep.RetryTimes = true, 0
+		uncordonStep := UncordonNode(masterNodes, worker, hostname, "")
+		uncordonStep.ErrIgnore, uncordonStep.RetryTimes = true, 0
+		stepper.installSteps = append(stepper.installSteps, []v1.Step{
+			drainStep,
 			{
 				ID:        strutil.GetUUID(),
-				Name:      fmt.Sprintf("UncordonNode-%s", extraMetadata.GetWorkerHostname(workers[i].ID)),
-				Nodes:     []v1.StepNode{utils.UnwrapNodeList(masters)[0]},
+				Name:      fmt.Sprintf("UpgradeWorker-%s", hostname),
+				Nodes:     []v1.StepNode{worker},
 				Action:    v1.ActionInstall,
-				Timeout:   metav1.Duration{Duration: 1 * time.Minute},
-				ErrIgnore: true,
+				Timeout:   metav1.Duration{Duration: 10 * time.Minute},
+				ErrIgnore: false,
 				Commands: []v1.Command{
 					{
-						Type:         v1.CommandShell,
-						ShellCommand: []string{"kubectl", "uncordon", extraMetadata.GetWorkerHostname(workers[i].ID)},
+						Type: v1.CommandShell,
+						ShellCommand: []string{"/bin/bash", "-c", `
+kubeadm upgrade node
+systemctl stop kubelet
+systemctl daemon-reload && systemctl restart kubelet`},
 					},
 				},
 				RetryTimes: 0,
-			}}...)
+			},
+			uncordonStep}...)
 	}
+	// refresh the version labels of the nodes, they are only set at install otherwise
+	stepper.installSteps = append(stepper.installSteps, NodeVersionLabelSteps(masterNodes[:1],
+		utils.UnwrapNodeList(extraMetadata.GetAllNodes()), stepper.CRIVersion, stepper.CNIVersion)...)
 	return nil
 }
 
@@ -377,6 +363,9 @@ func (stepper *UpgradePackage) Install(ctx context.Context, opts component.Optio
 		return nil, err
 	}
 	if stepper.DownloadImage {
+		if err = utils.WaitImagePullJitter(ctx, opts.DryRun); err != nil {
+			return nil, err
+		}
 		imageSrc, err := instance.DownloadImages()
 		if err != nil {
 			return nil, err
@@ -747,10 +736,12 @@ func (stepper *Recovery) MakeInstallSteps(ctx context.Context, metadata *compone
 		})
 	}
 
-	restart.Commands = append(restart.Commands, v1.Command{
-		Type:         v1.CommandShell,
-		ShellCommand: []string{"/bin/bash", "-c", "kubectl rollout restart ds kube-proxy -n kube-system"},
-	})
+	if !stepper.SkipKubeProxy {
+		restart.Commands = append(restart.Commands, v1.Command{
+			Type:         v1.CommandShell,
+			ShellCommand: []string{"/bin/bash", "-c", "kubectl rollout restart ds kube-proxy -n kube-system"},
+		})
+	}
 
 	if err == nil {
 		restart.Commands = append(restart.Commands, v1.Command{
@@ -761,11 +752,13 @@ func (stepper *Recovery) MakeInstallSteps(ctx context.Context, metadata *compone
 		})
 	}
 
-	restart.Commands = append(restart.Commands, v1.Command{
-		Type: v1.CommandShell,
-		// Since the daemon-set controller restarts the pods asynchronously, we try to get the pod status running 3 times in a row and the restart is considered complete
-		ShellCommand: []string{"/bin/bash", "-c", "for((i=1;i<=3;i++));do sleep 5;while true; do if [ 0 == $(kubectl get po -n kube-system | grep kube-proxy | grep -v Running | wc -l) ]; then break; else sleep 5 && kubectl get po -n kube-system | grep kube-proxy | grep -v Running ; fi ; done;done;"},
-	})
+	if !stepper.SkipKubeProxy {
+		restart.Commands = append(restart.Commands, v1.Command{
+			Type: v1.CommandShell,
+			// Since the daemon-set controller restarts the pods asynchronously, we try to get the pod status running 3 times in a row and the restart is considered complete
+			ShellCommand: []string{"/bin/bash", "-c", "for((i=1;i<=3;i++));do sleep 5;while true; do if [ 0 == $(kubectl get po -n kube-system | grep kube-proxy | grep -v Running | wc -l) ]; then break; else sleep 5 && kubectl get po -n kube-system | grep kube-proxy | grep -v Running ; fi ; done;done;"},
+		})
+	}
 
 	if err != nil {
 		note := fmt.Sprintf("===== WARNING: The daemon-set of this cni-%s cannot be restarted, please use kubectl to restart the daemon-set service of this cni-%s- =====", metadata.CNI, metadata.CNI)
@@ -1005,16 +998,11 @@ func (stepper *Recovery) Recovering(ctx context.Context, opts component.Options)
 		return nil, err
 	}
 
-	err = retryFunc(ctx, 5*time.Second, "check kubelet status", func(ctx context.Context) error {
-		ec, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "bash", "-c", "systemctl status kubelet")
-		if ec != nil && !strings.Contains(ec.StdOut(), "active (running)") {
-			return nil
+	if !opts.DryRun {
+		if err = initsystem.WaitServiceActive("kubelet", kubeletActiveTimeout); err != nil {
+			logger.Errorf("check kubelet status failed: %s", err.Error())
+			return nil, err
 		}
-		return err
-	})
-	if err != nil {
-		logger.Errorf("check kubelet status cmd failed: %s", err.Error())
-		return nil, err
 	}
 
 	logger.Info("recovering successfully")
@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cni"
+)
+
+// SwitchCNISteps switch the cluster cni from c.CNI to target.
+// 1. delete the old cni resources from kubernetes
+// 2. drain nodes one by one and clean the old cni NICs and config files on it
+// 3. install the new cni
+// 4. uncordon all nodes, the evicted pods will be recreated with the new cni network
+func SwitchCNISteps(metadata *component.ExtraMetadata, c *v1.Cluster, target *v1.CNI) ([]v1.Step, error) {
+	if c.CNI.Type == target.Type {
+		return nil, fmt.Errorf("cluster cni is already %s", target.Type)
+	}
+	of, err := cni.Load(c.CNI.Type)
+	if err != nil {
+		return nil, err
+	}
+	nf, err := cni.Load(target.Type)
+	if err != nil {
+		return nil, err
+	}
+	oldStepper := of.Create().InitStep(metadata, &c.CNI, &c.Networking)
+	newStepper := nf.Create().InitStep(metadata, target, &c.Networking)
+
+	avaMasters := metadata.Masters
+	if len(metadata.Masters) > 1 {
+		avaMasters, err = metadata.Masters.AvailableKubeMasters()
+		if err != nil {
+			return nil, err
+		}
+	}
+	master := utils.UnwrapNodeList(avaMasters)[0:1]
+
+	var switchSteps []v1.Step
+	// the custom cni manifest is checked before the old cni is deleted
+	if target.Type == cni.CustomCNIType {
+		step, err := CheckCustomCNIManifest(metadata, target, &c.Networking, master)
+		if err != nil {
+			return nil, err
+		}
+		switchSteps = append(switchSteps, step)
+	}
+	steps, err := oldStepper.DeleteSteps(master, c.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	switchSteps = append(switchSteps, steps...)
+
+	nodes := metadata.GetAllNodes()
+	for _, node := range utils.UnwrapNodeList(nodes) {
+		// the pods are evicted to be recreated with the new cni network, the unmanaged pods as well
+		opts := DefaultDrainOptions(c.KubernetesVersion)
+		opts.Force = true
+		drainStep := DrainNode(master, node, node.Hostname, opts)
+		drainStep.ErrIgnore = true
+		switchSteps = append(switchSteps, drainStep)
+		// per cni NICs and config files clean up, must be done before the new cni applied
+		steps, err = oldStepper.UninstallSteps([]v1.StepNode{node})
+		if err != nil {
+			return nil, err
+		}
+		switchSteps = append(switchSteps, steps...)
+	}
+
+	if cni.NeedNetworkManagerConfig(target) {
+		step, err := cni.ConfigNetworkManager(utils.UnwrapNodeList(nodes), v1.ActionInstall)
+		if err != nil {
+			return nil, err
+		}
+		switchSteps = append(switchSteps, step)
+	}
+	if metadata.Offline {
+		steps, err = newStepper.LoadImage(utils.UnwrapNodeList(nodes))
+		if err != nil {
+			return nil, err
+		}
+		switchSteps = append(switchSteps, steps...)
+	}
+	steps, err = newStepper.InstallSteps(master, c.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	switchSteps = append(switchSteps, steps...)
+	steps, err = newStepper.HealthCheckSteps(master)
+	if err != nil {
+		return nil, err
+	}
+	switchSteps = append(switchSteps, steps...)
+	for _, node := range utils.UnwrapNodeList(nodes) {
+		switchSteps = append(switchSteps, UncordonNode(master, node, node.Hostname, ""))
+	}
+	switchSteps = append(switchSteps, NodeVersionLabelSteps(master, utils.UnwrapNodeList(nodes), "", target.Version)...)
+
+	return switchSteps, nil
+}
@@ -0,0 +1,141 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/constatns"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestSwitchCNISteps(t *testing.T) {
+	metadata := &component.ExtraMetadata{
+		Masters: component.NodeList{{ID: "m1", IPv4: "10.0.0.1", Hostname: "master-1"}},
+		Workers: component.NodeList{{ID: "w1", IPv4: "10.0.0.2", Hostname: "worker-1"}},
+	}
+	c := &v1.Cluster{
+		KubernetesVersion: "v1.23.6",
+		Networking: v1.Networking{
+			IPFamily: v1.IPFamilyIPv4,
+			Pods:     v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterPodSubnet}},
+		},
+		CNI: v1.CNI{
+			Type:    "calico",
+			Version: "v3.22.4",
+			Calico:  &v1.Calico{Mode: "Overlay-Vxlan-All", IPv4AutoDetection: "first-found"},
+		},
+	}
+	target := &v1.CNI{
+		Type:      "flannel",
+		Version:   "v0.22.0",
+		Namespace: "kube-flannel",
+		Flannel:   &v1.Flannel{Backend: "vxlan"},
+	}
+	steps, err := SwitchCNISteps(metadata, c, target)
+	if err != nil {
+		t.Fatalf("SwitchCNISteps() error = %v", err)
+	}
+
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	got := strings.Join(names, ",")
+	want := strings.Join([]string{
+		"renderCniYaml", "deleteCniYaml",
+		"DrainNode-master-1", "removeVtep", "removeCali", "configNetworkManager", "removeCniConfig",
+		"DrainNode-worker-1", "removeVtep", "removeCali", "configNetworkManager", "removeCniConfig",
+		"renderCniYaml", "applyCniYaml", "waitCniReady",
+		"UncordonNode-master-1", "UncordonNode-worker-1", "labelNodeVersion",
+	}, ",")
+	if got != want {
+		t.Errorf("SwitchCNISteps() steps = %s, want %s", got, want)
+	}
+	// the unmanaged pods are evicted as well
+	if drain := strings.Join(steps[2].Commands[0].ShellCommand, " "); !strings.Contains(drain, "--force") || !steps[2].ErrIgnore {
+		t.Errorf("SwitchCNISteps() drain = %s, ErrIgnore %v", drain, steps[2].ErrIgnore)
+	}
+	// the old calico vxlan device must be removed from each node before the new cni applied
+	for i, step := range steps {
+		if step.Name == "removeVtep" && step.Commands[0].ShellCommand[3] != "vxlan.calico" {
+			t.Errorf("step %d want remove vxlan.calico, got %v", i, step.Commands[0].ShellCommand)
+		}
+	}
+
+	if _, err = SwitchCNISteps(metadata, c, &c.CNI); err == nil {
+		t.Errorf("SwitchCNISteps() want error when switch to the same cni")
+	}
+}
+
+func TestSwitchCNISteps_fromCustom(t *testing.T) {
+	metadata := &component.ExtraMetadata{
+		Masters: component.NodeList{{ID: "m1", IPv4: "10.0.0.1", Hostname: "master-1"}},
+	}
+	c := &v1.Cluster{
+		KubernetesVersion: "v1.23.6",
+		Networking: v1.Networking{
+			IPFamily: v1.IPFamilyIPv4,
+			Pods:     v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterPodSubnet}},
+		},
+		CNI: v1.CNI{
+			Type:   "custom",
+			Custom: &v1.CustomCNI{Manifest: "https://example.com/cni.yaml", ConfigPrefixes: []string{"05-cilium"}},
+		},
+	}
+	target := &v1.CNI{
+		Type:    "flannel",
+		Version: "v0.22.0",
+		Flannel: &v1.Flannel{Backend: "vxlan"},
+	}
+	steps, err := SwitchCNISteps(metadata, c, target)
+	if err != nil {
+		t.Fatalf("SwitchCNISteps() error = %v", err)
+	}
+	if len(steps) < 4 {
+		t.Fatalf("SwitchCNISteps() got %d steps", len(steps))
+	}
+	// the applied custom manifest is deleted from kubernetes first
+	if steps[0].Name != "renderCniYaml" || steps[1].Name != "deleteCniYaml" ||
+		strings.Join(steps[1].Commands[0].ShellCommand, " ") != "kubectl delete -f /tmp/.cni/custom.yaml --ignore-not-found" {
+		t.Errorf("SwitchCNISteps() want the custom manifest deleted, got %s %v", steps[0].Name, steps[1].Commands)
+	}
+	if steps[3].Name != "removeCniConfig" {
+		t.Errorf("SwitchCNISteps() want the custom cni config files removed from the node, got %s", steps[3].Name)
+	}
+}
+
+func TestSwitchCNISteps_toCustom(t *testing.T) {
+	metadata := &component.ExtraMetadata{
+		Masters: component.NodeList{{ID: "m1", IPv4: "10.0.0.1", Hostname: "master-1"}},
+	}
+	c := &v1.Cluster{
+		KubernetesVersion: "v1.23.6",
+		Networking: v1.Networking{
+			IPFamily: v1.IPFamilyIPv4,
+			Pods:     v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterPodSubnet}},
+		},
+		CNI: v1.CNI{Type: "flannel", Version: "v0.22.0", Flannel: &v1.Flannel{Backend: "vxlan"}},
+	}
+	target := &v1.CNI{
+		Type:   "custom",
+		Custom: &v1.CustomCNI{Manifest: "https://example.com/cni.yaml"},
+	}
+	steps, err := SwitchCNISteps(metadata, c, target)
+	if err != nil {
+		t.Fatalf("SwitchCNISteps() error = %v", err)
+	}
+	// the custom manifest is checked before the old cni is deleted
+	if steps[0].Name != "checkCustomCniManifest" || steps[0].Nodes[0].ID != "m1" {
+		t.Errorf("SwitchCNISteps() want the custom manifest checked first, got %s", steps[0].Name)
+	}
+
+	// the manifest is deleted on uninstalling the cluster even if kubernetes is not healthy
+	steps, err = DeleteCustomCNI(metadata, target, &c.Networking, []v1.StepNode{{ID: "m1"}}, c.KubernetesVersion)
+	if err != nil {
+		t.Fatalf("DeleteCustomCNI() error = %v", err)
+	}
+	if len(steps) != 2 || steps[1].Name != "deleteCniYaml" || !steps[0].ErrIgnore || !steps[1].ErrIgnore {
+		t.Errorf("DeleteCustomCNI() = %+v", steps)
+	}
+}
@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+// deleteEmptyDirDataMinVersion the first kubectl version renames --delete-local-data to --delete-emptydir-data
+var deleteEmptyDirDataMinVersion = utilversion.MustParseGeneric("1.20.0")
+
+// DrainOptions the options of the kubectl drain step
+type DrainOptions struct {
+	// KubeVersion the kubectl version, it decides the flag of deleting the emptyDir data
+	KubeVersion string
+	// GracePeriod the seconds given to each pod to terminate, negative uses the grace period of the pod
+	GracePeriod        int
+	IgnoreDaemonSets   bool
+	DeleteEmptyDirData bool
+	// Force evicts the pods not managed by a controller as well, they are not recreated
+	Force   bool
+	Timeout time.Duration
+	// Server the remote apiserver endpoint, it is used when kubectl has to run on the node being drained
+	Server string
+}
+
+// DefaultDrainOptions the drain options of the operations mutating a live node,
+// the daemonset pods are kept and the emptyDir data is deleted.
+func DefaultDrainOptions(kubeVersion string) DrainOptions {
+	return DrainOptions{
+		KubeVersion:        kubeVersion,
+		GracePeriod:        -1,
+		IgnoreDaemonSets:   true,
+		DeleteEmptyDirData: true,
+		Timeout:            5 * time.Minute,
+	}
+}
+
+func (o DrainOptions) args(nodeName string) []string {
+	args := []string{"kubectl", "drain", nodeName}
+	if o.IgnoreDaemonSets {
+		args = append(args, "--ignore-daemonsets")
+	}
+	if o.Force {
+		args = append(args, "--force")
+	}
+	if o.DeleteEmptyDirData {
+		flag := "--delete-emptydir-data"
+		if v, err := utilversion.ParseGeneric(o.KubeVersion); err == nil && v.LessThan(deleteEmptyDirDataMinVersion) {
+			flag = "--delete-local-data"
+		}
+		args = append(args, flag)
+	}
+	if o.GracePeriod >= 0 {
+		args = append(args, fmt.Sprintf("--grace-period=%d", o.GracePeriod))
+	}
+	if o.Timeout > 0 {
+		args = append(args, fmt.Sprintf("--timeout=%s", o.Timeout))
+	}
+	return args
+}
+
+// CordonNode the step of marking the node unschedulable, kubectl runs on a master other than the node if possible
+func CordonNode(masters []v1.StepNode, node v1.StepNode, nodeName, server string) v1.Step {
+	return kubectlNodeStep(fmt.Sprintf("CordonNode-%s", nodeName), masters, node, server, time.Minute,
+		[]string{"kubectl", "cordon", nodeName})
+}
+
+// DrainNode the step of evicting the pods of the node, kubectl runs on a master other than the node if possible
+func DrainNode(masters []v1.StepNode, node v1.StepNode, nodeName string, opts DrainOptions) v1.Step {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+	// leave the time to kubectl to report the pods failed to evict
+	return kubectlNodeStep(fmt.Sprintf("DrainNode-%s", nodeName), masters, node, opts.Server, timeout+time.Minute,
+		opts.args(nodeName))
+}
+
+// UncordonNode the step of marking the node schedulable, kubectl runs on a master other than the node if possible
+func UncordonNode(masters []v1.StepNode, node v1.StepNode, nodeName, server string) v1.Step {
+	return kubectlNodeStep(fmt.Sprintf("UncordonNode-%s", nodeName), masters, node, server, time.Minute,
+		[]string{"kubectl", "uncordon", nodeName})
+}
+
+// kubectlNodeStep the kubectl step targeting the node. The step runs on the first master other than the node,
+// the node itself is used only when it is the only master, kubectl connects to the remote server if it is set then.
+func kubectlNodeStep(name string, masters []v1.StepNode, node v1.StepNode, server string, timeout time.Duration, args []string) v1.Step {
+	runOn := node
+	for _, m := range masters {
+		if m.ID != node.ID {
+			runOn = m
+			break
+		}
+	}
+	if runOn.ID == node.ID && server != "" {
+		args = append(args, "--server", server)
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       name,
+		Nodes:      []v1.StepNode{runOn},
+		Action:     v1.ActionInstall,
+		Timeout:    metav1.Duration{Duration: timeout},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Commands: []v1.Command{
+			{
+				Type:         v1.CommandShell,
+				ShellCommand: args,
+			},
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestDrainNode(t *testing.T) {
+	masters := []v1.StepNode{{ID: "m1"}, {ID: "m2"}}
+	opts := DefaultDrainOptions("v1.23.6")
+	opts.GracePeriod = 30
+
+	step := DrainNode(masters, v1.StepNode{ID: "m1"}, "master-1", opts)
+	if step.Nodes[0].ID != "m2" {
+		t.Errorf("DrainNode() want kubectl run on the other master, got %s", step.Nodes[0].ID)
+	}
+	want := []string{"kubectl", "drain", "master-1", "--ignore-daemonsets", "--delete-emptydir-data", "--grace-period=30", "--timeout=5m0s"}
+	if !reflect.DeepEqual(step.Commands[0].ShellCommand, want) {
+		t.Errorf("DrainNode() command = %v, want %v", step.Commands[0].ShellCommand, want)
+	}
+
+	opts = DrainOptions{KubeVersion: "v1.18.6", DeleteEmptyDirData: true, GracePeriod: -1, Timeout: time.Minute, Server: "https://10.0.0.10:6443"}
+	step = DrainNode([]v1.StepNode{{ID: "m1"}}, v1.StepNode{ID: "m1"}, "master-1", opts)
+	want = []string{"kubectl", "drain", "master-1", "--delete-local-data", "--timeout=1m0s", "--server", "https://10.0.0.10:6443"}
+	if step.Nodes[0].ID != "m1" || !reflect.DeepEqual(step.Commands[0].ShellCommand, want) {
+		t.Errorf("DrainNode() of the only master = %v on %s, want %v", step.Commands[0].ShellCommand, step.Nodes[0].ID, want)
+	}
+}
+
+func TestCordonNode(t *testing.T) {
+	masters := []v1.StepNode{{ID: "m1"}}
+	step := CordonNode(masters, v1.StepNode{ID: "w1"}, "worker-1", "https://10.0.0.10:6443")
+	if step.Nodes[0].ID != "m1" || !reflect.DeepEqual(step.Commands[0].ShellCommand, []string{"kubectl", "cordon", "worker-1"}) {
+		t.Errorf("CordonNode() = %v on %s", step.Commands[0].ShellCommand, step.Nodes[0].ID)
+	}
+	step = UncordonNode(masters, v1.StepNode{ID: "w1"}, "worker-1", "")
+	if !reflect.DeepEqual(step.Commands[0].ShellCommand, []string{"kubectl", "uncordon", "worker-1"}) {
+		t.Errorf("UncordonNode() = %v", step.Commands[0].ShellCommand)
+	}
+}
+
+func TestUpgrade_InitSteps_drain(t *testing.T) {
+	ctx := component.WithExtraMetadata(context.TODO(), component.ExtraMetadata{
+		Masters: component.NodeList{{ID: "m1", Hostname: "master-1"}, {ID: "m2", Hostname: "master-2"}},
+		Workers: component.NodeList{{ID: "w1", Hostname: "worker-1"}},
+	})
+	stepper := &Upgrade{Version: "v1.23.6", Kubeadm: &KubeadmConfig{KubernetesVersion: "v1.23.6"}, CRIVersion: "1.6.4"}
+	if err := stepper.InitSteps(ctx); err != nil {
+		t.Fatalf("InitSteps() error = %v", err)
+	}
+	var names []string
+	for _, step := range stepper.GetInstallSteps() {
+		names = append(names, step.Name)
+		for _, cmd := range step.Commands {
+			if script := strings.Join(cmd.ShellCommand, " "); strings.Contains(script, "\n") &&
+				(strings.Contains(script, "kubectl drain") || strings.Contains(script, "kubectl uncordon")) {
+				t.Errorf("step %s drains or uncordons in the script: %s", step.Name, script)
+			}
+		}
+	}
+	want := []string{
+		"DownloadUpgradePackage", "RenderUpgradeKubeadm",
+		"UpgradeControlPlane-master-1", "DrainNode-master-1", "RestartKubelet-master-1", "UncordonNode-master-1",
+		"UpgradeControlPlane-master-2", "DrainNode-master-2", "RestartKubelet-master-2", "UncordonNode-master-2",
+		"DrainNode-worker-1", "UpgradeWorker-worker-1", "UncordonNode-worker-1",
+		"labelNodeVersion",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("InitSteps() steps = %v, want %v", names, want)
+	}
+	// the master is drained by kubectl on the other master
+	if drain := stepper.GetInstallSteps()[3]; drain.Nodes[0].ID != "m2" || !drain.ErrIgnore {
+		t.Errorf("InitSteps() drain of master-1 on %s, ErrIgnore %v", drain.Nodes[0].ID, drain.ErrIgnore)
+	}
+}
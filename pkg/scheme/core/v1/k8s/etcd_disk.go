@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+)
+
+const (
+	etcdDiskChecker = "etcdDiskChecker"
+	// etcdFsyncThreshold the 99th percentile of the wal fdatasync latency recommended by etcd
+	// https://etcd.io/docs/v3.5/faq/#what-does-the-etcd-warning-apply-entries-took-too-long-mean
+	etcdFsyncThreshold = 10 * time.Millisecond
+	// etcdFsyncSamples and etcdFsyncBlockSize the benchmark writes, the block size is about the size of an etcd wal entry
+	etcdFsyncSamples   = 100
+	etcdFsyncBlockSize = 2300
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, etcdDiskChecker, version, component.TypeStep), &EtcdDiskChecker{})
+}
+
+var _ component.StepRunnable = (*EtcdDiskChecker)(nil)
+
+// EtcdDiskChecker warns the masters which filesystem of the etcd data dir is too slow for etcd,
+// it writes and syncs small blocks like the etcd wal and checks the 99th percentile of the sync latency.
+type EtcdDiskChecker struct {
+	DataDir string `json:"dataDir"`
+}
+
+func (c *EtcdDiskChecker) NewInstance() component.ObjectMeta {
+	return &EtcdDiskChecker{}
+}
+
+func (c *EtcdDiskChecker) Install(_ context.Context, opts component.Options) ([]byte, error) {
+	if opts.DryRun {
+		return nil, nil
+	}
+	dir, err := existingDir(strutil.StringDefaultIfEmpty(EtcdDefaultDataDir, c.DataDir))
+	if err != nil {
+		return nil, err
+	}
+	latency, err := FsyncLatency(dir, etcdFsyncSamples)
+	if err != nil {
+		return nil, err
+	}
+	if latency > etcdFsyncThreshold {
+		warning := fmt.Sprintf("the 99th percentile of fsync latency of %s is %s, exceeds %s recommended by etcd, "+
+			"consider placing the etcd data dir on a faster disk", dir, latency, etcdFsyncThreshold)
+		logger.Warn(warning)
+		opts.ReportProgress(warning)
+		return nil, nil
+	}
+	logger.Infof("the 99th percentile of fsync latency of %s is %s", dir, latency)
+	return nil, nil
+}
+
+func (c *EtcdDiskChecker) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("EtcdDiskChecker dose not support uninstall")
+}
+
+// existingDir returns the dir or its nearest existing parent, the etcd data dir is created by kubeadm later.
+func existingDir(dir string) (string, error) {
+	for {
+		_, err := os.Stat(dir)
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || dir == filepath.Dir(dir) {
+			return "", err
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// FsyncLatency writes and syncs samples blocks to a temp file in dir, returns the 99th percentile of the sync latency.
+func FsyncLatency(dir string, samples int) (time.Duration, error) {
+	f, err := os.CreateTemp(dir, ".kc-fsync-*")
+	if err != nil {
+		return 0, fmt.Errorf("create fsync benchmark file in %s failed:%w", dir, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	block := make([]byte, etcdFsyncBlockSize)
+	latencies := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		if _, err = f.Write(block); err != nil {
+			return 0, fmt.Errorf("write fsync benchmark file %s failed:%w", f.Name(), err)
+		}
+		start := time.Now()
+		if err = f.Sync(); err != nil {
+			return 0, fmt.Errorf("sync fsync benchmark file %s failed:%w", f.Name(), err)
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[(len(latencies)*99-1)/100], nil
+}
+
+// CheckEtcdDisk the preflight step of warning the masters with a slow etcd data dir disk
+func CheckEtcdDisk(nodes []v1.StepNode, dataDir string) (v1.Step, error) {
+	bytes, err := json.Marshal(&EtcdDiskChecker{
+		DataDir: strutil.StringDefaultIfEmpty(EtcdDefaultDataDir, dataDir),
+	})
+	if err != nil {
+		return v1.Step{}, err
+	}
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "checkEtcdDisk",
+		Timeout:    metav1.Duration{Duration: 30 * time.Second},
+		ErrIgnore:  true,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:          v1.CommandCustom,
+				Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, etcdDiskChecker, version, component.TypeStep),
+				CustomCommand: bytes,
+			},
+		},
+	}, nil
+}
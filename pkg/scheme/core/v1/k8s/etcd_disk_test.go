@@ -0,0 +1,30 @@
+package k8s
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFsyncLatency(t *testing.T) {
+	latency, err := FsyncLatency(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("FsyncLatency() error = %v", err)
+	}
+	if latency <= 0 {
+		t.Errorf("FsyncLatency() = %s, want a positive latency", latency)
+	}
+	if _, err = FsyncLatency(filepath.Join(t.TempDir(), "not-exist"), 1); err == nil {
+		t.Error("FsyncLatency() want error of the missing dir")
+	}
+}
+
+func TestExistingDir(t *testing.T) {
+	dir := t.TempDir()
+	got, err := existingDir(filepath.Join(dir, "etcd", "data"))
+	if err != nil {
+		t.Fatalf("existingDir() error = %v", err)
+	}
+	if got != dir {
+		t.Errorf("existingDir() = %s, want %s", got, dir)
+	}
+}
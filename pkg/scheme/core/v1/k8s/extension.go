@@ -18,9 +18,7 @@ import (
 )
 
 func init() {
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, extension, extensionVersion, component.TypeStep), &Extension{}); err != nil {
-		panic(err)
-	}
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, extension, extensionVersion, component.TypeStep), &Extension{})
 }
 
 var (
@@ -56,6 +54,9 @@ func (stepper *Extension) Install(ctx context.Context, opts component.Options) (
 	}
 	// local registry not filled and is in offline mode, download images.tar.gz file from tarballs
 	if stepper.Offline && stepper.LocalRegistry == "" {
+		if err = utils.WaitImagePullJitter(ctx, opts.DryRun); err != nil {
+			return nil, err
+		}
 		imageSrc, err := instance.DownloadImages()
 		if err != nil {
 			return nil, err
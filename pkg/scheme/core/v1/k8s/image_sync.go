@@ -0,0 +1,51 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cni"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
+)
+
+// lvscareImage the image of the lvscare static pod on the workers, see lvscareV111
+const lvscareImage = "fanux/lvscare:v1.1.1"
+
+// SyncImagesSteps the step of syncing the images required by the cluster into its local registry, run on an
+// available master: the kubernetes images listed by kubeadm, the cni images, the lvscare image and the image
+// of the cluster verification. The images are pulled from the source, or imported from the tarball on the master.
+func SyncImagesSteps(metadata *component.ExtraMetadata, c *v1.Cluster, source, registry v1.RegistrySpec, tarball string) ([]v1.Step, error) {
+	if c.LocalRegistry == "" {
+		return nil, fmt.Errorf("cluster %s has no local registry to sync images to", c.Name)
+	}
+	if c.ContainerRuntime.Type != v1.CRIContainerd {
+		return nil, fmt.Errorf("container runtime %s dose not support syncing images", c.ContainerRuntime.Type)
+	}
+	images, err := cni.Images(metadata, &c.CNI, &c.Networking)
+	if err != nil {
+		return nil, err
+	}
+	images = append(images, lvscareImage, verifyImage)
+
+	avaMasters := metadata.Masters
+	if len(metadata.Masters) > 1 {
+		avaMasters, err = metadata.Masters.AvailableKubeMasters()
+		if err != nil {
+			return nil, err
+		}
+	}
+	step, err := cri.SyncImagesStep(&cri.ContainerdImageSync{
+		KubernetesVersion: c.KubernetesVersion,
+		Images:            images,
+		Source:            source,
+		Tarball:           tarball,
+		Registry:          c.LocalRegistry,
+		RegistrySpec:      registry,
+	}, utils.UnwrapNodeList(avaMasters)[0])
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{step}, nil
+}
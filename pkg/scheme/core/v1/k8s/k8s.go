@@ -19,12 +19,19 @@
 package k8s
 
 const (
-	K8s       = "k8s"
-	CniCalico = "calico"
+	K8s        = "k8s"
+	CniCalico  = "calico"
+	CniFlannel = "flannel"
 
 	NodeRoleMaster = "master"
 	NodeRoleWorker = "worker"
 
+	ProxyModeIPVS = "ipvs"
+	// ipvsModulesLoadFile the modules-load.d config to load the ipvs kernel modules on boot
+	ipvsModulesLoadFile = "/etc/modules-load.d/kube-proxy-ipvs.conf"
+	// kubeProxyPhase the kubeadm init phase of deploying the kube-proxy addon
+	kubeProxyPhase = "addon/kube-proxy"
+
 	APIServerDomainPrefix = "apiserver."
 
 	KubeConfigDir            = ".kube"
@@ -42,3 +49,6 @@ const (
 	KubeletSystemdResolverConfig = "/run/systemd/resolve/resolv.conf"
 	KubeletDefaultResolvConf     = "/etc/resolv.conf"
 )
+
+// ipvsKernelModules the kernel modules required by kube-proxy ipvs mode
+var ipvsKernelModules = []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
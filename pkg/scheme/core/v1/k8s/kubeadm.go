@@ -39,9 +39,11 @@ import (
 	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
 	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
 	"github.com/kubeclipper/kubeclipper/pkg/simple/downloader"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/initsystem"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/ipvsutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/netutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
@@ -49,36 +51,16 @@ import (
 )
 
 func init() {
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, packages, version, component.TypeStep), &Package{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat, kubeadmConfig, version, component.TypeTemplate), &KubeadmConfig{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, kubeadmConfig, version, component.TypeStep), &KubeadmConfig{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, controlPlane, version, component.TypeStep), &ControlPlane{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, clusterNode, version, component.TypeStep), &ClusterNode{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat, kubectlTerminal, version, component.TypeTemplate), &KubectlTerminal{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, health, version, component.TypeStep), &Health{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, container, version, component.TypeStep), &Container{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, kubectl, version, component.TypeStep), &Kubectl{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, kubeadmConfigUpdaterName, kubeadmConfigUpdaterVersion, component.TypeStep), &KubeadmConfigUpdater{}); err != nil {
-		panic(err)
-	}
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, packages, version, component.TypeStep), &Package{})
+	component.AddTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat, kubeadmConfig, version, component.TypeTemplate), &KubeadmConfig{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, kubeadmConfig, version, component.TypeStep), &KubeadmConfig{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, controlPlane, version, component.TypeStep), &ControlPlane{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, clusterNode, version, component.TypeStep), &ClusterNode{})
+	component.AddTemplate(fmt.Sprintf(component.RegisterTemplateKeyFormat, kubectlTerminal, version, component.TypeTemplate), &KubectlTerminal{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, health, version, component.TypeStep), &Health{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, container, version, component.TypeStep), &Container{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, kubectl, version, component.TypeStep), &Kubectl{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, kubeadmConfigUpdaterName, kubeadmConfigUpdaterVersion, component.TypeStep), &KubeadmConfigUpdater{})
 }
 
 var (
@@ -123,16 +105,27 @@ type KubeadmConfig struct {
 	AdvertiseAddress      string          `json:"advertiseAddress,omitempty"`
 	FeatureGates          map[string]bool `json:"featureGates,omitempty"`
 	IgnorePreflightErrors []string        `json:"ignorePreflightErrors,omitempty"`
+	// NodeRegistrations the labels and taints of the joining worker nodes keyed by node id
+	NodeRegistrations map[string]JoinNodeRegistration `json:"nodeRegistrations,omitempty"`
+	// CgroupDriver the cgroup driver of kubelet, auto detected on each node rendering its init or join config
+	// when it is auto
+	CgroupDriver string `json:"cgroupDriver,omitempty"`
+	// NodeLabels and NodeTaints the registration of the current node rendered into the join configuration
+	NodeLabels string     `json:"-"`
+	NodeTaints []v1.Taint `json:"-"`
 }
 
 type ControlPlane struct {
 	// KubeConfig file
 	APIServerDomainName   string
 	EtcdDataPath          string
+	ExternalEtcd          bool
 	ContainerRuntime      string
 	ExternalCaCert        string
 	ExternalCaKey         string
 	IgnorePreflightErrors string
+	SkipKubeProxy         bool
+	KubeConfig            KubeConfigOptions
 }
 
 type ClusterNode struct {
@@ -145,18 +138,24 @@ type ClusterNode struct {
 	APIServerDomainName string
 	JoinMasterIP        string
 	EtcdDataPath        string
+	ExternalEtcd        bool
 }
 
 type Health struct {
 	KubernetesVersion string
 }
 
-type Certification struct{}
-
 type SAN struct{}
 
 type Container struct {
 	CriType string
+	// AllNamespaces clean the containers of all containerd namespaces when resetting node,
+	// not only the k8s.io namespace of kubernetes.
+	AllNamespaces bool `json:"allNamespaces,omitempty"`
+	// Socket the containerd socket the containers are cleaned through, it is read from the grpc address
+	// of ConfigFile on the node if it is empty.
+	Socket     string `json:"socket,omitempty"`
+	ConfigFile string `json:"configFile,omitempty"`
 }
 
 type Kubectl struct{}
@@ -172,6 +171,9 @@ func (stepper *Package) Install(ctx context.Context, opts component.Options) ([]
 	}
 	// local registry not filled and is in offline mode, download images.tar.gz file from tarballs
 	if stepper.Offline && stepper.LocalRegistry == "" {
+		if err = utils.WaitImagePullJitter(ctx, opts.DryRun); err != nil {
+			return nil, err
+		}
 		imageSrc, err := instance.DownloadImages()
 		if err != nil {
 			return nil, err
@@ -227,6 +229,9 @@ func (stepper *Package) Uninstall(ctx context.Context, opts component.Options) (
 	return nil, nil
 }
 
+// kubeletActiveTimeout the max time to wait for the kubelet service active after it is started
+const kubeletActiveTimeout = time.Minute
+
 func (stepper *Package) enableKubeletService(ctx context.Context, dryRun bool) error {
 	// chmod 711
 	files := []string{"kubelet-pre-start.sh", "kubelet", "kubeadm", "kubectl", "conntrack"}
@@ -245,6 +250,11 @@ func (stepper *Package) enableKubeletService(ctx context.Context, dryRun bool) e
 	if err != nil {
 		return err
 	}
+	if !dryRun {
+		if err = initsystem.WaitServiceActive("kubelet", kubeletActiveTimeout); err != nil {
+			return err
+		}
+	}
 	logger.Debug("enable kubelet systemd service successfully")
 	return nil
 }
@@ -292,24 +302,35 @@ func (stepper KubeadmConfig) Install(ctx context.Context, opts component.Options
 	}
 	// NodeIP is used for kubelet communication and api-server host ip
 	stepper.Kubelet.NodeIP = agentIP
+	// the kubelet config downloaded by kubeadm join carries the cgroup driver resolved on the first master,
+	// the joining node resolves its own so kubelet matches the local containerd
+	if stepper.CgroupDriver, err = resolveCgroupDriver(ctx, stepper.CgroupDriver, opts.DryRun); err != nil {
+		return nil, err
+	}
 	// kubeadm join apiserver.cluster.local:6443 --token s9afr8.tsibqbmgddqku6xu --discovery-token-ca-cert-hash sha256:e34ec831f206237b38a1b29d46b5df599018c178959b874f6b14fe2438194f9d --control-plane --certificate-key 46518267766fc19772ecc334c13190f8131f1bf48a213538879f6427f74fe8e2
 	// kubeadm join apiserver.cluster.local:6443 --token s9afr8.tsibqbmgddqku6xu --discovery-token-ca-cert-hash sha256:e34ec831f206237b38a1b29d46b5df599018c178959b874f6b14fe2438194f9d
 	if stepper.IsControlPlane {
-		masterJoinCmd := strings.Split(cmds[0], " ")
-		if len(masterJoinCmd) < 10 {
-			return nil, fmt.Errorf("master join command invalid")
+		info, err := parseJoinCommand(cmds[0])
+		if err != nil {
+			return nil, fmt.Errorf("master join command invalid: %w", err)
+		}
+		if info.CertificateKey == "" {
+			return nil, fmt.Errorf("master join command invalid: certificate key not found")
 		}
-		stepper.BootstrapToken = masterJoinCmd[4]
-		stepper.CACertHashes = masterJoinCmd[6]
-		stepper.CertificateKey = masterJoinCmd[9]
+		stepper.BootstrapToken = info.Token
+		stepper.CACertHashes = info.CACertHash
+		stepper.CertificateKey = info.CertificateKey
 		stepper.AdvertiseAddress = agentIP
 	} else {
-		workerJoinCmd := strings.Split(cmds[1], " ")
-		if len(workerJoinCmd) < 6 {
-			return nil, fmt.Errorf("worker join command invalid")
+		info, err := parseJoinCommand(cmds[1])
+		if err != nil {
+			return nil, fmt.Errorf("worker join command invalid: %w", err)
+		}
+		stepper.BootstrapToken = info.Token
+		stepper.CACertHashes = info.CACertHash
+		if err = stepper.setNodeRegistration(); err != nil {
+			return nil, err
 		}
-		stepper.BootstrapToken = workerJoinCmd[4]
-		stepper.CACertHashes = workerJoinCmd[6]
 	}
 	// check resolv-conf
 	ok, err := isServiceActive("systemd-resolved")
@@ -357,6 +378,9 @@ func (stepper KubeadmConfig) Render(ctx context.Context, opts component.Options)
 		return err
 	}
 	stepper.Kubelet.NodeIP = agentIP
+	if stepper.CgroupDriver, err = resolveCgroupDriver(ctx, stepper.CgroupDriver, opts.DryRun); err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(ManifestDir, 0755); err != nil {
 		return err
@@ -366,12 +390,41 @@ func (stepper KubeadmConfig) Render(ctx context.Context, opts component.Options)
 		stepper.renderTo, opts.DryRun)
 }
 
+// resolveCgroupDriver detect the kubelet cgroup driver the same way as containerd when it is auto,
+// so both use the systemd cgroup driver on cgroup v2 nodes.
+func resolveCgroupDriver(ctx context.Context, cgroupDriver string, dryRun bool) (string, error) {
+	switch cgroupDriver {
+	case v1.CgroupDriverSystemd, v1.CgroupDriverCgroupfs:
+		return cgroupDriver, nil
+	}
+	v2, err := cri.IsCgroupV2(ctx, dryRun)
+	if err != nil {
+		return "", err
+	}
+	if v2 {
+		return v1.CgroupDriverSystemd, nil
+	}
+	return v1.CgroupDriverCgroupfs, nil
+}
+
 func (stepper *KubeadmConfig) renderTo(w io.Writer) error {
 	at := tmplutil.New()
 	_, err := at.RenderTo(w, kubeadmTemplate, stepper)
 	return err
 }
 
+// ImageGCHighThresholdPercent the image gc high threshold rendered into the kubelet configuration
+func (stepper *KubeadmConfig) ImageGCHighThresholdPercent() int {
+	high, _ := stepper.Kubelet.ImageGCThresholds()
+	return high
+}
+
+// ImageGCLowThresholdPercent the image gc low threshold rendered into the kubelet configuration
+func (stepper *KubeadmConfig) ImageGCLowThresholdPercent() int {
+	_, low := stepper.Kubelet.ImageGCThresholds()
+	return low
+}
+
 func (stepper *KubeadmConfig) renderJoin(w io.Writer) error {
 	at := tmplutil.New()
 	_, err := at.RenderTo(w, KubeadmJoinTemplate, stepper)
@@ -402,6 +455,24 @@ func (stepper *KubeadmConfig) matchClusterConfigAPIVersion() (string, error) {
 	return "v1beta3", nil
 }
 
+// setNodeRegistration pick the registration of the current node by the agent id
+func (stepper *KubeadmConfig) setNodeRegistration() error {
+	if len(stepper.NodeRegistrations) == 0 {
+		return nil
+	}
+	agentConfig, err := config.TryLoadFromDisk()
+	if err != nil {
+		return errors.WithMessage(err, "load agent config")
+	}
+	registration, ok := stepper.NodeRegistrations[agentConfig.AgentID]
+	if !ok {
+		return nil
+	}
+	stepper.NodeLabels = kubeletNodeLabels(registration.Labels)
+	stepper.NodeTaints = registration.Taints
+	return nil
+}
+
 func (stepper *KubeadmConfig) getAgentNodeIP() (string, error) {
 	agentConfig, err := config.TryLoadFromDisk()
 	if err != nil {
@@ -421,6 +492,15 @@ func (stepper *ControlPlane) NewInstance() component.ObjectMeta {
 	return &ControlPlane{}
 }
 
+// resetCmd the command of cleaning the node before kubeadm init or join, the etcd data dir
+// is kept when kubernetes uses an external etcd cluster, it may be colocated with the masters.
+func resetCmd(etcdDataPath string, externalEtcd bool) string {
+	if externalEtcd {
+		return "kubeadm reset -f"
+	}
+	return fmt.Sprintf("kubeadm reset -f && rm -rf %s", strutil.StringDefaultIfEmpty(EtcdDefaultDataDir, etcdDataPath))
+}
+
 func (stepper *ControlPlane) Install(ctx context.Context, opts component.Options) ([]byte, error) {
 	// 1. add kubeadm config render
 	// 2. systemctl enable kubelet --now
@@ -428,7 +508,7 @@ func (stepper *ControlPlane) Install(ctx context.Context, opts component.Options
 	// 4. remove kubeconfig to $HOME/.kube
 	// 5. return kubeadm join command
 
-	clearCmd := fmt.Sprintf("kubeadm reset -f && rm -rf %s", strutil.StringDefaultIfEmpty(EtcdDefaultDataDir, stepper.EtcdDataPath))
+	clearCmd := resetCmd(stepper.EtcdDataPath, stepper.ExternalEtcd)
 	_, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "bash", "-c", clearCmd)
 	if err != nil {
 		logger.Warnf("clean init node env error: %s", err.Error())
@@ -472,7 +552,11 @@ func (stepper *ControlPlane) Install(ctx context.Context, opts component.Options
 		}
 	}
 
-	ec, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "kubeadm", "init", "--config", "/tmp/.k8s/kubeadm.yaml", "--upload-certs")
+	args := []string{"init", "--config", "/tmp/.k8s/kubeadm.yaml", "--upload-certs"}
+	if stepper.SkipKubeProxy {
+		args = append(args, "--skip-phases="+kubeProxyPhase)
+	}
+	ec, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "kubeadm", args...)
 	if err != nil {
 		logger.Error("run kubeadm init error", zap.Error(err))
 		return nil, err
@@ -481,11 +565,18 @@ func (stepper *ControlPlane) Install(ctx context.Context, opts component.Options
 	joinControlPlaneCMD := "dry run join control plane"
 	joinWorkerCMD := "dry run join worker"
 	if !opts.DryRun {
-		joinControlPlaneCMD = getJoinCmdFromStdOut(ec.StdOut(), "You can now join any number of the control-plane node running the following command on each as root:")
-		joinWorkerCMD = getJoinCmdFromStdOut(ec.StdOut(), "Then you can join any number of worker nodes by running the following on each as root:")
-		if err := generateKubeConfig(ctx); err != nil {
+		info, err := parseInitOutput(ec.StdOut())
+		if err != nil {
+			logger.Error("extract kubeadm join command error", zap.Error(err))
 			return nil, err
 		}
+		// rebuild the join commands from the parsed parameters so the joining nodes read them in a fixed layout
+		join := KubeadmJoinUtil{ControlPlaneEndpoint: info.ControlPlaneEndpoint, Token: info.Token, DiscoveryHash: info.CACertHash}
+		joinControlPlaneCMD, joinWorkerCMD = join.GetControlPlaneCmd(info.CertificateKey), strings.Join(join.GetCmd(), " ")
+		if err := generateKubeConfigs(ctx, stepper.KubeConfig); err != nil {
+			return nil, err
+		}
+		logger.Infof("the uploaded certificates expire after %s, they are re-uploaded when a control plane joins later", uploadCertsTTL)
 	}
 	return []byte(fmt.Sprintf("%s,%s", joinControlPlaneCMD, joinWorkerCMD)), nil
 }
@@ -712,8 +803,7 @@ func (stepper *ClusterNode) Install(ctx context.Context, opts component.Options)
 		return nil, err
 	}
 	if stepper.NodeRole == NodeRoleMaster {
-		clearCmd := fmt.Sprintf("kubeadm reset -f && rm -rf %s && rm -rf %s",
-			strutil.StringDefaultIfEmpty(EtcdDefaultDataDir, stepper.EtcdDataPath), K8SDefaultConfigDir)
+		clearCmd := fmt.Sprintf("%s && rm -rf %s", resetCmd(stepper.EtcdDataPath, stepper.ExternalEtcd), K8SDefaultConfigDir)
 		_, err := cmdutil.RunCmdWithContext(ctx, opts.DryRun, "bash", "-c", clearCmd)
 		if err != nil {
 			logger.Warnf("clean init node env error: %s", err.Error())
@@ -907,18 +997,6 @@ func (stepper *Health) getRegisterServiceAccountCommands() ([]v1.Command, error)
 	return commands, nil
 }
 
-func (stepper *Certification) NewInstance() component.ObjectMeta {
-	return &Certification{}
-}
-
-func (stepper *Certification) Install(ctx context.Context, opts component.Options) ([]byte, error) {
-	return nil, nil
-}
-
-func (stepper *Certification) Uninstall(ctx context.Context, opts component.Options) ([]byte, error) {
-	return nil, nil
-}
-
 func (stepper *Container) NewInstance() component.ObjectMeta {
 	return &Container{}
 }
@@ -929,9 +1007,19 @@ func (stepper *Container) Install(ctx context.Context, opts component.Options) (
 
 func (stepper *Container) Uninstall(ctx context.Context, opts component.Options) ([]byte, error) {
 	var err error
+	if stepper.AllNamespaces {
+		if opts.DryRun {
+			return nil, nil
+		}
+		// docker uses the moby namespace of containerd, so it does not depend on the cri type
+		if err = deleteAllContainers(stepper.socket()); err != nil {
+			logger.Warnf("delete containerd containers of all namespaces error: %s", err.Error())
+		}
+		return nil, err
+	}
 	switch stepper.CriType {
 	case "containerd":
-		err = deleteContainer("k8s.io")
+		err = deleteContainer(stepper.socket(), "k8s.io")
 		if err != nil {
 			logger.Warnf("delete containerd container error: %s", err.Error())
 		}
@@ -943,6 +1031,13 @@ func (stepper *Container) Uninstall(ctx context.Context, opts component.Options)
 	return nil, err
 }
 
+func (stepper *Container) socket() string {
+	if stepper.Socket != "" {
+		return stepper.Socket
+	}
+	return cri.ContainerdSocketOf(strutil.StringDefaultIfEmpty(cri.ContainerdConfigFile, stepper.ConfigFile))
+}
+
 func (stepper *Kubectl) NewInstance() component.ObjectMeta {
 	return &Kubectl{}
 }
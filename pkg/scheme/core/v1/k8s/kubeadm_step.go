@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -34,6 +35,7 @@ import (
 	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	"github.com/kubeclipper/kubeclipper/pkg/scheme/common"
 	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cni"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/kubeclipper/kubeclipper/pkg/component"
@@ -44,6 +46,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// sha256Regexp the hex encoded sha256 digest with an optional "sha256:" prefix
+var sha256Regexp = regexp.MustCompile(`^(sha256:)?[a-fA-F0-9]{64}$`)
+
 const (
 	version         = "v1"
 	packages        = "packages"
@@ -68,6 +73,10 @@ func (runnable *Runnable) GetStep(ctx context.Context, action v1.StepAction) ([]
 	}
 	switch action {
 	case v1.ActionInstall:
+		metadata := component.GetExtraMetadata(ctx)
+		if err = runnable.Networking.ValidateCIDROverlap(metadata.GetAllNodes().GetNodeIPs()...); err != nil {
+			return nil, err
+		}
 		return runnable.GetInstallSteps(ctx)
 	case v1.ActionUninstall:
 		return runnable.GetUninstallSteps(ctx)
@@ -87,6 +96,101 @@ func (runnable *Runnable) Validate() error {
 		return fmt.Errorf("init step error, cluster contains at least one master node")
 	}
 
+	for _, node := range append(runnable.Masters, runnable.Workers...) {
+		if err := ValidateNodeRegistration(node.Labels, node.Taints); err != nil {
+			return fmt.Errorf("node %s: %w", node.ID, err)
+		}
+	}
+	if err := ValidateIgnorePreflightErrors(runnable.IgnorePreflightErrors); err != nil {
+		return err
+	}
+	if err := (*v1.Cluster)(runnable).ValidateCgroupDriver(); err != nil {
+		return err
+	}
+	if runnable.ContainerRuntime.MaxConcurrentDownloads < 0 {
+		return fmt.Errorf("containerd max concurrent downloads must not be negative, 0 uses the containerd default")
+	}
+	if runnable.ContainerRuntime.DownloadRetries < 0 || runnable.ContainerRuntime.DownloadRetryBackoff.Duration < 0 {
+		return fmt.Errorf("containerd download retries and retry backoff must not be negative")
+	}
+	if runnable.ContainerRuntime.EnableTLSStreaming && (runnable.ContainerRuntime.TLSStreamingCertFile == "" ||
+		runnable.ContainerRuntime.TLSStreamingKeyFile == "") {
+		return fmt.Errorf("containerd tls streaming requires the cert file and key file")
+	}
+	if runnable.ContainerRuntime.Proxy != nil && runnable.ContainerRuntime.Type != "containerd" {
+		return fmt.Errorf("%s dose not support proxy configuration", runnable.ContainerRuntime.Type)
+	}
+	if err := runnable.ContainerRuntime.ValidateRuntimeGroups(); err != nil {
+		return err
+	}
+	if err := runnable.ContainerRuntime.ValidateLog(); err != nil {
+		return err
+	}
+	if err := runnable.ContainerRuntime.ValidateDefaultMirror(); err != nil {
+		return err
+	}
+	if runnable.ContainerRuntime.PreloadImageDir != "" && runnable.ContainerRuntime.Type != "containerd" {
+		return fmt.Errorf("%s dose not support preloading images", runnable.ContainerRuntime.Type)
+	}
+	if digest := runnable.ContainerRuntime.BundleSHA256; digest != "" {
+		if runnable.ContainerRuntime.Type != "containerd" {
+			return fmt.Errorf("%s dose not support bundle checksum", runnable.ContainerRuntime.Type)
+		}
+		if !sha256Regexp.MatchString(digest) {
+			return fmt.Errorf("invalid containerd bundle sha256 digest: %s", digest)
+		}
+	}
+	if runnable.ContainerRuntime.EnableNRI && runnable.ContainerRuntime.Type != "containerd" {
+		return fmt.Errorf("%s dose not support nri", runnable.ContainerRuntime.Type)
+	}
+	if p := runnable.ContainerRuntime.NRISocketPath; p != "" && !filepath.IsAbs(p) {
+		return fmt.Errorf("nri socket path %s must be absolute", p)
+	}
+	switch runnable.ContainerRuntime.SystemdCgroup {
+	case "", v1.SystemdCgroupAuto, v1.SystemdCgroupTrue, v1.SystemdCgroupFalse:
+	default:
+		return fmt.Errorf("unsupported containerd systemd cgroup setting: %s", runnable.ContainerRuntime.SystemdCgroup)
+	}
+
+	if p := runnable.Etcd.DataDir; p != "" && !filepath.IsAbs(p) {
+		return fmt.Errorf("etcd data dir %s must be absolute", p)
+	}
+	if err := ValidateExternalEtcd(runnable.Etcd.External); err != nil {
+		return err
+	}
+	if p := runnable.Kubelet.RootDir; p != "" && !filepath.IsAbs(p) {
+		return fmt.Errorf("kubelet root dir %s must be absolute", p)
+	}
+	if err := runnable.Kubelet.ValidateImageGCThresholds(); err != nil {
+		return err
+	}
+
+	if sa := runnable.ServiceAccountKubeConfig; sa != nil {
+		if sa.Namespace == "" || sa.Name == "" || sa.ClusterRole == "" || sa.Path == "" {
+			return fmt.Errorf("service account kubeconfig requires the namespace, name, clusterRole and path")
+		}
+		if !filepath.IsAbs(sa.Path) {
+			return fmt.Errorf("service account kubeconfig path %s must be absolute", sa.Path)
+		}
+	}
+
+	// calico and flannel rely on kube-proxy for the service load balancing
+	if runnable.Networking.SkipKubeProxy && (runnable.CNI.Type == "calico" || runnable.CNI.Type == "flannel") {
+		return fmt.Errorf("cni %s dose not support running without kube-proxy", runnable.CNI.Type)
+	}
+
+	if err := runnable.Networking.ValidateIPFamily(); err != nil {
+		return err
+	}
+	if err := cni.ValidateNamespace(runnable.CNI.Type, runnable.CNI.Namespace, runnable.KubernetesVersion); err != nil {
+		return err
+	}
+	if runnable.CNI.ImageLoadConcurrency < 0 {
+		return fmt.Errorf("invalid cni image load concurrency %d, must not be negative", runnable.CNI.ImageLoadConcurrency)
+	}
+	if err := cni.ValidateImageSource(&runnable.CNI); err != nil {
+		return err
+	}
 	// check dualStack and ipv4
 	switch runnable.CNI.Type {
 	case "calico":
@@ -98,6 +202,62 @@ func (runnable *Runnable) Validate() error {
 			len(runnable.Networking.Pods.CIDRBlocks) == 0 {
 			return fmt.Errorf("calico ipv4 and ipv6 must have at least one")
 		}
+		if runnable.CNI.Calico != nil {
+			if _, err := cni.ParseNodeAddressDetection(runnable.CNI.Calico.IPv4AutoDetection); err != nil {
+				return fmt.Errorf("invalid calico IPv4AutoDetection:%w", err)
+			}
+			if runnable.Networking.IPFamily == v1.IPFamilyDualStack || runnable.Networking.IPFamily == v1.IPFamilyIPv6 {
+				if _, err := cni.ParseNodeAddressDetection(runnable.CNI.Calico.IPv6AutoDetection); err != nil {
+					return fmt.Errorf("invalid calico IPv6AutoDetection:%w", err)
+				}
+			}
+		}
+		if runnable.CNI.Calico != nil && runnable.CNI.Calico.Mode == cni.CalicoNetworkBGP {
+			if err := cni.ValidateBGPPeers(runnable.CNI.Calico.BGPPeers); err != nil {
+				return err
+			}
+		}
+		if runnable.CNI.Calico != nil {
+			if err := cni.ValidateEnabledControllers(runnable.CNI.Calico.EnabledControllers); err != nil {
+				return err
+			}
+			if err := cni.ValidateIPAM(runnable.CNI.Calico); err != nil {
+				return err
+			}
+		}
+		if runnable.CNI.Calico != nil && runnable.Networking.IPFamily != v1.IPFamilyIPv6 {
+			if err := cni.ValidateBlockSize(runnable.CNI.Calico.BlockSize, runnable.Networking.Pods.CIDRBlocks[0]); err != nil {
+				return err
+			}
+		}
+		if cni.NeedWireGuardCheck(&runnable.CNI) {
+			ipv6 := runnable.Networking.IPFamily == v1.IPFamilyDualStack || runnable.Networking.IPFamily == v1.IPFamilyIPv6
+			if err := cni.ValidateEncryptTraffic(runnable.CNI.Version, ipv6); err != nil {
+				return err
+			}
+		}
+	case "flannel":
+		if len(runnable.Networking.Pods.CIDRBlocks) == 0 {
+			return fmt.Errorf("flannel requires the ipv4 pod cidr")
+		}
+		if runnable.Networking.IPFamily == v1.IPFamilyIPv6 {
+			return fmt.Errorf("flannel dose not support ipv6-only networking")
+		}
+		if runnable.Networking.IPFamily == v1.IPFamilyDualStack &&
+			len(runnable.Networking.Pods.CIDRBlocks) <= 1 {
+			return fmt.Errorf("ipv4 and ipv6 cidr are both required when flannel dual-stack is on")
+		}
+		if runnable.CNI.Flannel != nil && runnable.CNI.Flannel.Backend != "" &&
+			runnable.CNI.Flannel.Backend != cni.FlannelBackendVXLAN && runnable.CNI.Flannel.Backend != cni.FlannelBackendHostGW {
+			return fmt.Errorf("unsupported flannel backend: %s", runnable.CNI.Flannel.Backend)
+		}
+	case cni.CustomCNIType:
+		if len(runnable.Networking.Pods.CIDRBlocks) == 0 {
+			return fmt.Errorf("custom cni requires the ipv4 pod cidr")
+		}
+		if runnable.CNI.Custom == nil || runnable.CNI.Custom.Manifest == "" {
+			return fmt.Errorf("custom cni requires the manifest url or file path")
+		}
 	}
 
 	return nil
@@ -143,12 +303,28 @@ func (runnable *Runnable) makeInstallSteps(metadata *component.ExtraMetadata) ([
 	masters := utils.UnwrapNodeList(metadata.Masters)
 
 	var installSteps []v1.Step
-	steps, err := EnvSetupSteps(nodes)
+	// the custom cni manifest is checked on the master rendering it before any node is changed
+	if c.CNI.Type == cni.CustomCNIType && !metadata.OnlyInstallKubernetesComp {
+		step, err := CheckCustomCNIManifest(metadata, &c.CNI, &c.Networking, []v1.StepNode{masters[0]})
+		if err != nil {
+			return nil, err
+		}
+		installSteps = append(installSteps, step)
+	}
+	steps, err := EnvSetupSteps(nodes, KubeProxyMode(&c.Networking))
 	if err != nil {
 		return nil, err
 	}
 	installSteps = append(installSteps, steps...)
 
+	if !c.Etcd.IsExternal() {
+		step, err := CheckEtcdDisk(masters, c.Etcd.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		installSteps = append(installSteps, step)
+	}
+
 	ext := Extension{}
 	steps, err = ext.InitStepper(&c).InstallSteps(nodes)
 	if err != nil {
@@ -212,6 +388,10 @@ func (runnable *Runnable) makeInstallSteps(metadata *component.ExtraMetadata) ([
 		installSteps = append(installSteps, steps...)
 	}
 
+	if step := cri.GPURuntimeClassStep(c.ContainerRuntime.RuntimeGroups, masters[0]); step != nil {
+		installSteps = append(installSteps, *step)
+	}
+
 	// when disable cni, only install k8s control plane and kubelet
 	// user can install other cni and other plugin manually
 	if metadata.OnlyInstallKubernetesComp {
@@ -220,6 +400,7 @@ func (runnable *Runnable) makeInstallSteps(metadata *component.ExtraMetadata) ([
 			return nil, err
 		}
 		installSteps = append(installSteps, steps...)
+		installSteps = append(installSteps, NodeVersionLabelSteps([]v1.StepNode{masters[0]}, nodes, c.ContainerRuntime.Version, "")...)
 		return installSteps, nil
 	}
 
@@ -229,6 +410,27 @@ func (runnable *Runnable) makeInstallSteps(metadata *component.ExtraMetadata) ([
 		return nil, err
 	}
 	cniStepper := cf.Create().InitStep(metadata, &c.CNI, &c.Networking)
+	if cni.NeedRPFilterCheck(&c.CNI) {
+		step, err := cni.CheckRPFilter(nodes)
+		if err != nil {
+			return nil, err
+		}
+		installSteps = append(installSteps, step)
+	}
+	if cni.NeedWireGuardCheck(&c.CNI) {
+		step, err := cni.CheckWireGuard(nodes)
+		if err != nil {
+			return nil, err
+		}
+		installSteps = append(installSteps, step)
+	}
+	if cni.NeedNetworkManagerConfig(&c.CNI) {
+		step, err := cni.ConfigNetworkManager(nodes, v1.ActionInstall)
+		if err != nil {
+			return nil, err
+		}
+		installSteps = append(installSteps, step)
+	}
 	if metadata.Offline {
 		steps, err = cniStepper.LoadImage(nodes)
 		if err != nil {
@@ -241,12 +443,18 @@ func (runnable *Runnable) makeInstallSteps(metadata *component.ExtraMetadata) ([
 		return nil, err
 	}
 	installSteps = append(installSteps, steps...)
+	steps, err = cniStepper.HealthCheckSteps([]v1.StepNode{masters[0]})
+	if err != nil {
+		return nil, err
+	}
+	installSteps = append(installSteps, steps...)
 
 	steps, err = PatchTaintAndLabelStep(runnable.Masters, runnable.Workers, metadata)
 	if err != nil {
 		return nil, err
 	}
 	installSteps = append(installSteps, steps...)
+	installSteps = append(installSteps, NodeVersionLabelSteps([]v1.StepNode{masters[0]}, nodes, c.ContainerRuntime.Version, c.CNI.Version)...)
 
 	heal := Health{}
 	steps, err = heal.InitStepper(c.KubernetesVersion).InstallSteps([]v1.StepNode{masters[0]})
@@ -281,6 +489,15 @@ func (runnable *Runnable) makeUninstallSteps(metadata *component.ExtraMetadata)
 	}
 	uninstallSteps = append(uninstallSteps, steps...)
 
+	// the resources created by the custom cni are unknown, its manifest is deleted while kubernetes is up
+	if c.CNI.Type == cni.CustomCNIType {
+		steps, err = DeleteCustomCNI(metadata, &c.CNI, &c.Networking, []v1.StepNode{masters[0]}, c.KubernetesVersion)
+		if err != nil {
+			return nil, err
+		}
+		uninstallSteps = append(uninstallSteps, steps...)
+	}
+
 	// exec kubeadm reset
 	steps, err = KubeadmReset(nodes)
 	if err != nil {
@@ -434,7 +651,9 @@ func (stepper *KubeadmConfig) InitStepper(c *v1.Cluster, metadata *component.Ext
 	stepper.FeatureGates = c.FeatureGates
 	// TODO: No vip is currently introduced as controlPlaneEndpoint
 	stepper.AdvertiseAddress = metadata.Masters[0].NodeIPv4
-	stepper.IgnorePreflightErrors = parseIgnorePreflightErrors(c.Annotations[common.AnnotationOnlyIgnorePreflightErrors])
+	stepper.IgnorePreflightErrors = clusterIgnorePreflightErrors(c)
+	stepper.CgroupDriver = c.ResolveCgroupDriver()
+	stepper.NodeRegistrations = joinNodeRegistrations(c.Workers)
 
 	return stepper
 }
@@ -446,6 +665,16 @@ func parseIgnorePreflightErrors(errStr string) []string {
 	return strings.Split(errStr, ",")
 }
 
+// clusterIgnorePreflightErrors the preflight errors ignored by the cluster spec and the legacy annotation
+func clusterIgnorePreflightErrors(c *v1.Cluster) []string {
+	checks := sets.NewString(c.IgnorePreflightErrors...)
+	checks.Insert(parseIgnorePreflightErrors(c.Annotations[common.AnnotationOnlyIgnorePreflightErrors])...)
+	if checks.Len() == 0 {
+		return nil
+	}
+	return checks.List()
+}
+
 func (stepper *KubeadmConfig) InstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 	kubeadmBytes, err := json.Marshal(stepper)
 	if err != nil {
@@ -474,6 +703,11 @@ func (stepper *KubeadmConfig) InstallSteps(nodes []v1.StepNode) ([]v1.Step, erro
 
 func (stepper *KubeadmConfig) JoinSteps(isControlPlane bool, nodes []v1.StepNode) ([]v1.Step, error) {
 	stepper.IsControlPlane = isControlPlane
+	for id, registration := range stepper.NodeRegistrations {
+		if err := ValidateNodeRegistration(registration.Labels, registration.Taints); err != nil {
+			return nil, fmt.Errorf("node %s: %w", id, err)
+		}
+	}
 	kubeadmBytes, err := json.Marshal(stepper)
 	if err != nil {
 		return nil, err
@@ -512,10 +746,16 @@ func (stepper *ControlPlane) InitStepper(c *v1.Cluster) *ControlPlane {
 
 	stepper.APIServerDomainName = apiServerDomain
 	stepper.EtcdDataPath = c.Etcd.DataDir
+	stepper.ExternalEtcd = c.Etcd.IsExternal()
 	stepper.ContainerRuntime = c.ContainerRuntime.Type
 	stepper.ExternalCaCert = c.ExternalCaCert
 	stepper.ExternalCaKey = c.ExternalCaKey
-	stepper.IgnorePreflightErrors = c.Annotations[common.AnnotationOnlyIgnorePreflightErrors]
+	stepper.IgnorePreflightErrors = strings.Join(clusterIgnorePreflightErrors(c), ",")
+	stepper.SkipKubeProxy = c.Networking.SkipKubeProxy
+	stepper.KubeConfig = KubeConfigOptions{
+		CopyAdmin:      c.ServiceAccountKubeConfig == nil || !c.ServiceAccountKubeConfig.SkipAdminCopy,
+		ServiceAccount: c.ServiceAccountKubeConfig,
+	}
 
 	return stepper
 }
@@ -583,6 +823,7 @@ func (stepper *ClusterNode) InitStepper(c *v1.Cluster, metadata *component.Extra
 	// TODO: No vip is currently introduced as controlPlaneEndpoint
 	stepper.JoinMasterIP = metadata.Masters[0].NodeIPv4
 	stepper.EtcdDataPath = c.Etcd.DataDir
+	stepper.ExternalEtcd = c.Etcd.IsExternal()
 
 	return stepper
 }
@@ -692,7 +933,7 @@ func (stepper *Health) InstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 }
 
 func (stepper *Health) UninstallSteps(network *v1.Networking, nodes ...v1.StepNode) ([]v1.Step, error) {
-	if network.ProxyMode == "ipvs" {
+	if KubeProxyMode(network) == ProxyModeIPVS {
 		// ipvs mode
 		var bytes []byte
 		bytes, err := json.Marshal(stepper)
@@ -754,76 +995,10 @@ func (stepper *Health) UninstallSteps(network *v1.Networking, nodes ...v1.StepNo
 	}, nil
 }
 
-func (stepper *Certification) InitStepper() *Certification {
-	return stepper
-}
-
-func (stepper *Certification) InstallSteps(clu *v1.Cluster, nodes []v1.StepNode) ([]v1.Step, error) {
-	var cmd []string
-	if clu.KubernetesVersion[1:] < KubeCertsCluVersion {
-		cmd = []string{"kubeadm", "alpha", "certs", "renew", "all"}
-	} else {
-		cmd = []string{"kubeadm", "certs", "renew", "all"}
-	}
-
-	step := []v1.Step{
-		{
-			ID:         strutil.GetUUID(),
-			Name:       "updateCerts",
-			Nodes:      nodes,
-			Action:     v1.ActionInstall,
-			Timeout:    metav1.Duration{Duration: 3 * time.Minute},
-			ErrIgnore:  false,
-			RetryTimes: 1,
-			Commands: []v1.Command{
-				{
-					Type:         v1.CommandShell,
-					ShellCommand: cmd,
-				},
-			},
-		},
-		{
-			ID:         strutil.GetUUID(),
-			Name:       "restartPods",
-			Nodes:      nodes,
-			Action:     v1.ActionInstall,
-			Timeout:    metav1.Duration{Duration: 3 * time.Minute},
-			ErrIgnore:  false,
-			RetryTimes: 1,
-			// TODO: can use configMap get path
-			BeforeRunCommands: []v1.Command{
-				{
-					Type:         v1.CommandShell,
-					ShellCommand: []string{"mkdir", "-pv", "/tmp/.k8s/config"},
-				},
-			},
-			Commands: []v1.Command{
-				{
-					Type:         v1.CommandShell,
-					ShellCommand: []string{"bash", "-c", "mv /etc/kubernetes/manifests/etcd.yaml /etc/kubernetes/manifests/kube-apiserver.yaml /etc/kubernetes/manifests/kube-controller-manager.yaml /etc/kubernetes/manifests/kube-scheduler.yaml /tmp/.k8s/config && sleep 20"},
-				},
-			},
-			AfterRunCommands: []v1.Command{
-				{
-					Type: v1.CommandShell,
-					ShellCommand: []string{
-						"mv",
-						"/tmp/.k8s/config/etcd.yaml",
-						"/tmp/.k8s/config/kube-apiserver.yaml",
-						"/tmp/.k8s/config/kube-controller-manager.yaml",
-						"/tmp/.k8s/config/kube-scheduler.yaml",
-						"/etc/kubernetes/manifests",
-					},
-				},
-			},
-		},
-	}
-
-	return step, nil
-}
-
 func (stepper *Container) InitStepper(criType string) *Container {
 	stepper.CriType = criType
+	// docker runs the containers by containerd as well, with the same config file
+	stepper.ConfigFile = cri.ContainerdConfigFile
 	return stepper
 }
 
@@ -890,7 +1065,7 @@ func (stepper *Kubectl) UninstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 	}, nil
 }
 
-func EnvSetupSteps(nodes []v1.StepNode) ([]v1.Step, error) {
+func EnvSetupSteps(nodes []v1.StepNode, proxyMode string) ([]v1.Step, error) {
 	var steps []v1.Step
 	steps = append(steps, v1.Step{
 		ID:         strutil.GetUUID(),
@@ -907,10 +1082,43 @@ func EnvSetupSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 			},
 		},
 	})
+	if proxyMode == ProxyModeIPVS {
+		steps = append(steps, IPVSModulesStep(nodes))
+	}
 
 	return steps, nil
 }
 
+// KubeProxyMode returns the kube-proxy mode of the cluster, empty if kube-proxy is not deployed.
+func KubeProxyMode(network *v1.Networking) string {
+	if network.SkipKubeProxy {
+		return ""
+	}
+	return network.ProxyMode
+}
+
+// IPVSModulesStep load the kernel modules required by kube-proxy ipvs mode,
+// and persist them to be loaded on boot.
+func IPVSModulesStep(nodes []v1.StepNode) v1.Step {
+	script := fmt.Sprintf("for m in %[1]s; do modprobe $m || exit 1; done && printf '%%s\\n' %[1]s > %[2]s",
+		strings.Join(ipvsKernelModules, " "), ipvsModulesLoadFile)
+	return v1.Step{
+		ID:         strutil.GetUUID(),
+		Name:       "loadIPVSModules",
+		Timeout:    metav1.Duration{Duration: 10 * time.Second},
+		ErrIgnore:  false,
+		RetryTimes: 1,
+		Nodes:      nodes,
+		Action:     v1.ActionInstall,
+		Commands: []v1.Command{
+			{
+				Type:         v1.CommandShell,
+				ShellCommand: []string{"/bin/bash", "-c", script},
+			},
+		},
+	}
+}
+
 func PatchTaintAndLabelStep(master, workers v1.WorkerNodeList, metadata *component.ExtraMetadata) ([]v1.Step, error) {
 	var shellCommand []v1.Command
 
@@ -986,6 +1194,67 @@ func PatchTaintAndLabelStep(master, workers v1.WorkerNodeList, metadata *compone
 	return nil, nil
 }
 
+// NodeVersionLabelSteps label the kubernetes nodes with the cri and cni versions installed by kubeclipper,
+// the labels are overwritten when the versions change. The empty version is not labeled.
+func NodeVersionLabelSteps(master []v1.StepNode, nodes []v1.StepNode, criVersion, cniVersion string) []v1.Step {
+	var labels []string
+	if criVersion != "" {
+		labels = append(labels, fmt.Sprintf("%s=%s", common.LabelCRIVersion, criVersion))
+	}
+	if cniVersion != "" {
+		labels = append(labels, fmt.Sprintf("%s=%s", common.LabelCNIVersion, cniVersion))
+	}
+	if len(labels) == 0 || len(nodes) == 0 {
+		return nil
+	}
+	cmds := make([]v1.Command, 0, len(nodes))
+	for _, node := range nodes {
+		cmds = append(cmds, v1.Command{
+			Type:         v1.CommandShell,
+			ShellCommand: append([]string{"kubectl", "label", "node", node.Hostname, "--overwrite"}, labels...),
+		})
+	}
+	return []v1.Step{
+		{
+			ID:         strutil.GetUUID(),
+			Name:       "labelNodeVersion",
+			Timeout:    metav1.Duration{Duration: 1 * time.Minute},
+			ErrIgnore:  true,
+			RetryTimes: 1,
+			Nodes:      master,
+			Action:     v1.ActionInstall,
+			Commands:   cmds,
+		},
+	}
+}
+
+// ResetSteps clean the containers of all containerd namespaces on the reset nodes
+func (stepper *Container) ResetSteps(nodes []v1.StepNode) ([]v1.Step, error) {
+	stepper.AllNamespaces = true
+	b, err := json.Marshal(stepper)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{
+		{
+			ID:         strutil.GetUUID(),
+			Name:       "resetContainers",
+			Timeout:    metav1.Duration{Duration: 10 * time.Minute},
+			ErrIgnore:  true,
+			RetryTimes: 0,
+			Nodes:      nodes,
+			Action:     v1.ActionUninstall,
+			Commands: []v1.Command{
+				{
+					Type:          v1.CommandCustom,
+					Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, container, version, component.TypeStep),
+					CustomCommand: b,
+				},
+			},
+		},
+	}, nil
+}
+
 func KubeadmReset(nodes []v1.StepNode) ([]v1.Step, error) {
 	return []v1.Step{
 		{
@@ -1011,10 +1280,12 @@ func Clear(c *v1.Cluster, metadata *component.ExtraMetadata) ([]v1.Step, error)
 	nodes := utils.UnwrapNodeList(metadata.GetAllNodes())
 	masters := utils.UnwrapNodeList(metadata.Masters)
 	workers := utils.UnwrapNodeList(metadata.Workers)
-	// remove etcd data dir
-	steps = append(steps,
-		doCommandRemoveStep("clearDatabase", masters,
-			c.Etcd.DataDir))
+	// remove etcd data dir, the data of the external etcd cluster is not managed by kubeclipper
+	if !c.Etcd.IsExternal() {
+		steps = append(steps,
+			doCommandRemoveStep("clearDatabase", masters,
+				c.Etcd.DataDir))
+	}
 	kubeletDataDir := KubeletDefaultDataDir
 	if c.Kubelet.RootDir != "" {
 		kubeletDataDir = c.Kubelet.RootDir
@@ -1070,6 +1341,26 @@ func CleanCNI(metadata *component.ExtraMetadata, c *v1.CNI, networking *v1.Netwo
 	return cf.Create().InitStep(metadata, c, networking).UninstallSteps(nodes)
 }
 
+// CheckCustomCNIManifest the step of checking the custom cni manifest loads and renders to valid objects
+func CheckCustomCNIManifest(metadata *component.ExtraMetadata, c *v1.CNI, networking *v1.Networking, nodes []v1.StepNode) (v1.Step, error) {
+	stepper := (&cni.CustomCNIRunnable{}).InitStep(metadata, c, networking).(*cni.CustomCNIRunnable)
+	return stepper.CheckManifestStep(nodes)
+}
+
+// DeleteCustomCNI delete the applied manifest of the custom cni from kubernetes on uninstalling the cluster,
+// the failure is ignored since the cluster being uninstalled may not be healthy.
+func DeleteCustomCNI(metadata *component.ExtraMetadata, c *v1.CNI, networking *v1.Networking, nodes []v1.StepNode, kubeVersion string) ([]v1.Step, error) {
+	stepper := (&cni.CustomCNIRunnable{}).InitStep(metadata, c, networking)
+	steps, err := stepper.DeleteSteps(nodes, kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	for i := range steps {
+		steps[i].ErrIgnore = true
+	}
+	return steps, nil
+}
+
 func RemoveHostname(c *v1.Cluster, nodes []v1.StepNode) ([]v1.Step, error) {
 	var steps []v1.Step
 	apiServerDomain := APIServerDomainPrefix +
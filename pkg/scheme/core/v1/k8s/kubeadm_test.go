@@ -20,10 +20,17 @@ package k8s
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/kubeclipper/kubeclipper/pkg/component"
 	"github.com/kubeclipper/kubeclipper/pkg/constatns"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cri"
 )
 
 func Test_kubectlTerminal_renderTo(t *testing.T) {
@@ -331,3 +338,369 @@ func TestKubeadmConfig_renderJoin(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvSetupSteps(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "1", IPv4: "127.0.0.1", Hostname: "node1"}}
+	tests := []struct {
+		name     string
+		network  v1.Networking
+		wantIPVS bool
+	}{
+		{name: "ipvs", network: v1.Networking{ProxyMode: ProxyModeIPVS}, wantIPVS: true},
+		{name: "iptables", network: v1.Networking{ProxyMode: "iptables"}},
+		{name: "skip kube-proxy", network: v1.Networking{ProxyMode: ProxyModeIPVS, SkipKubeProxy: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := EnvSetupSteps(nodes, KubeProxyMode(&tt.network))
+			if err != nil {
+				t.Fatalf("EnvSetupSteps() error = %v", err)
+			}
+			var script string
+			for _, step := range steps {
+				if step.Name == "loadIPVSModules" {
+					script = step.Commands[0].ShellCommand[2]
+				}
+			}
+			if (script != "") != tt.wantIPVS {
+				t.Fatalf("EnvSetupSteps() has loadIPVSModules step = %v, want %v", script != "", tt.wantIPVS)
+			}
+			for _, m := range ipvsKernelModules {
+				if tt.wantIPVS && !strings.Contains(script, m) {
+					t.Errorf("loadIPVSModules step should load module %s", m)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeadmConfig_renderTo_skipKubeProxy(t *testing.T) {
+	stepper := &KubeadmConfig{
+		ClusterConfigAPIVersion: "v1beta3",
+		ContainerRuntime:        "containerd",
+		Etcd:                    v1.Etcd{DataDir: "/var/lib/etcd"},
+		Networking: v1.Networking{
+			IPFamily:      v1.IPFamilyIPv4,
+			Services:      v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterServiceSubnet}},
+			Pods:          v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterPodSubnet}},
+			DNSDomain:     "cluster.local",
+			ProxyMode:     "ipvs",
+			SkipKubeProxy: true,
+		},
+		Kubelet:              v1.Kubelet{RootDir: "/var/lib/kubelet"},
+		ClusterName:          "test-cluster",
+		KubernetesVersion:    "v1.23.6",
+		ControlPlaneEndpoint: "apiserver.cluster.local:6443",
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderTo(w); err != nil {
+		t.Fatalf("renderTo() error = %v", err)
+	}
+	if strings.Contains(w.String(), "KubeProxyConfiguration") {
+		t.Errorf("renderTo() should not render KubeProxyConfiguration when kube-proxy is skipped")
+	}
+	if strings.Contains(w.String(), "---\n---") {
+		t.Errorf("renderTo() renders an empty yaml doc:\n%s", w.String())
+	}
+}
+
+func TestHealth_UninstallSteps_skipKubeProxy(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "1", IPv4: "127.0.0.1", Hostname: "node1"}}
+	steps, err := (&Health{}).UninstallSteps(&v1.Networking{ProxyMode: ProxyModeIPVS, SkipKubeProxy: true}, nodes...)
+	if err != nil {
+		t.Fatalf("UninstallSteps() error = %v", err)
+	}
+	for _, step := range steps {
+		if step.Name == "clearIPVS" || step.Name == "removeDummyInterface" {
+			t.Errorf("UninstallSteps() should not clean up the ipvs of kube-proxy which is never installed, got step %s", step.Name)
+		}
+	}
+}
+
+func TestNodeVersionLabelSteps(t *testing.T) {
+	master := []v1.StepNode{{ID: "1", IPv4: "10.0.0.1", Hostname: "master-1"}}
+	nodes := []v1.StepNode{
+		{ID: "1", IPv4: "10.0.0.1", Hostname: "master-1"},
+		{ID: "2", IPv4: "10.0.0.2", Hostname: "worker-1"},
+	}
+	tests := []struct {
+		name       string
+		criVersion string
+		cniVersion string
+		wantLabels []string
+	}{
+		{
+			name:       "cri and cni",
+			criVersion: "1.6.4",
+			cniVersion: "v3.22.4",
+			wantLabels: []string{"kubeclipper.io/cri-version=1.6.4", "kubeclipper.io/cni-version=v3.22.4"},
+		},
+		{
+			name:       "cri only",
+			criVersion: "1.6.4",
+			wantLabels: []string{"kubeclipper.io/cri-version=1.6.4"},
+		},
+		{
+			name: "nothing to label",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := NodeVersionLabelSteps(master, nodes, tt.criVersion, tt.cniVersion)
+			if len(tt.wantLabels) == 0 {
+				if len(steps) != 0 {
+					t.Fatalf("NodeVersionLabelSteps() got %d steps, want none", len(steps))
+				}
+				return
+			}
+			if len(steps) != 1 {
+				t.Fatalf("NodeVersionLabelSteps() got %d steps, want 1", len(steps))
+			}
+			step := steps[0]
+			if len(step.Nodes) != 1 || step.Nodes[0].ID != master[0].ID {
+				t.Errorf("NodeVersionLabelSteps() should run on the master, got %v", step.Nodes)
+			}
+			if len(step.Commands) != len(nodes) {
+				t.Fatalf("NodeVersionLabelSteps() got %d commands, want %d", len(step.Commands), len(nodes))
+			}
+			for i, cmd := range step.Commands {
+				want := append([]string{"kubectl", "label", "node", nodes[i].Hostname, "--overwrite"}, tt.wantLabels...)
+				if strings.Join(cmd.ShellCommand, " ") != strings.Join(want, " ") {
+					t.Errorf("NodeVersionLabelSteps() command = %v, want %v", cmd.ShellCommand, want)
+				}
+			}
+		})
+	}
+}
+
+func TestContainer_ResetSteps(t *testing.T) {
+	nodes := []v1.StepNode{{ID: "1", IPv4: "10.0.0.1", Hostname: "node1"}}
+	steps, err := (&Container{Socket: "/run/containerd-2/containerd.sock"}).InitStepper("docker").ResetSteps(nodes)
+	if err != nil {
+		t.Fatalf("ResetSteps() error = %v", err)
+	}
+	if len(steps) != 1 || len(steps[0].Commands) != 1 {
+		t.Fatalf("ResetSteps() want 1 step with 1 command, got %v", steps)
+	}
+	if steps[0].Action != v1.ActionUninstall {
+		t.Errorf("ResetSteps() action = %s, want %s", steps[0].Action, v1.ActionUninstall)
+	}
+	c := &Container{}
+	if err = json.Unmarshal(steps[0].Commands[0].CustomCommand, c); err != nil {
+		t.Fatalf("unmarshal reset command error = %v", err)
+	}
+	if !c.AllNamespaces {
+		t.Errorf("ResetSteps() should clean the containers of all namespaces")
+	}
+	if c.socket() != "/run/containerd-2/containerd.sock" {
+		t.Errorf("ResetSteps() socket = %s, want the socket of the stepper", c.socket())
+	}
+	if c.ConfigFile != cri.ContainerdConfigFile {
+		t.Errorf("ResetSteps() config file = %s, want %s", c.ConfigFile, cri.ContainerdConfigFile)
+	}
+
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	if socket := (&Container{ConfigFile: configFile}).socket(); socket != cri.ContainerdSocket {
+		t.Errorf("socket() = %s, want the default %s without the config file", socket, cri.ContainerdSocket)
+	}
+	if err = os.WriteFile(configFile, []byte("version = 2\n[grpc]\n  address = \"/run/k8s-containerd/containerd.sock\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if socket := (&Container{ConfigFile: configFile}).socket(); socket != "/run/k8s-containerd/containerd.sock" {
+		t.Errorf("socket() = %s, want the grpc address of the config file", socket)
+	}
+}
+
+func TestKubeadmConfig_renderTo_externalEtcd(t *testing.T) {
+	stepper := &KubeadmConfig{
+		ClusterConfigAPIVersion: "v1beta3",
+		ContainerRuntime:        "containerd",
+		Etcd: v1.Etcd{DataDir: "/var/lib/etcd", External: &v1.ExternalEtcd{
+			Endpoints: []string{"https://10.0.0.11:2379", "https://10.0.0.12:2379"},
+			CAFile:    "/etc/etcd/pki/ca.crt",
+			CertFile:  "/etc/etcd/pki/client.crt",
+			KeyFile:   "/etc/etcd/pki/client.key",
+		}},
+		Networking: v1.Networking{
+			IPFamily:  v1.IPFamilyIPv4,
+			Services:  v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterServiceSubnet}},
+			Pods:      v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterPodSubnet}},
+			DNSDomain: "cluster.local",
+			ProxyMode: "ipvs",
+		},
+		Kubelet:              v1.Kubelet{RootDir: "/var/lib/kubelet"},
+		ClusterName:          "test-cluster",
+		KubernetesVersion:    "v1.23.6",
+		ControlPlaneEndpoint: "apiserver.cluster.local:6443",
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderTo(w); err != nil {
+		t.Fatalf("renderTo() error = %v", err)
+	}
+	want := `etcd:
+  external:
+    endpoints:
+    - https://10.0.0.11:2379
+    - https://10.0.0.12:2379
+    caFile: "/etc/etcd/pki/ca.crt"
+    certFile: "/etc/etcd/pki/client.crt"
+    keyFile: "/etc/etcd/pki/client.key"
+networking:`
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("renderTo() want the external etcd config, got:\n%s", w.String())
+	}
+	if strings.Contains(w.String(), "\n  local:\n") {
+		t.Errorf("renderTo() should not render the local etcd when external etcd is set")
+	}
+}
+
+func TestClear_externalEtcd(t *testing.T) {
+	metadata := &component.ExtraMetadata{Masters: component.NodeList{{ID: "m1"}}}
+	c := &v1.Cluster{Etcd: v1.Etcd{DataDir: "/var/lib/etcd", External: &v1.ExternalEtcd{Endpoints: []string{"https://10.0.0.11:2379"}}}}
+	steps, err := Clear(c, metadata)
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	for _, s := range steps {
+		if s.Name == "clearDatabase" {
+			t.Errorf("Clear() should not remove the etcd data dir of the external etcd")
+		}
+	}
+	if got := resetCmd("/var/lib/etcd", true); got != "kubeadm reset -f" {
+		t.Errorf("resetCmd() = %s, want the etcd data dir kept", got)
+	}
+}
+
+func TestKubeadmConfig_renderTo_imageGCThresholds(t *testing.T) {
+	stepper := &KubeadmConfig{
+		ClusterConfigAPIVersion: "v1beta3",
+		ContainerRuntime:        "containerd",
+		Etcd:                    v1.Etcd{DataDir: "/var/lib/etcd"},
+		Networking: v1.Networking{
+			IPFamily:  v1.IPFamilyIPv4,
+			Services:  v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterServiceSubnet}},
+			Pods:      v1.NetworkRanges{CIDRBlocks: []string{constatns.ClusterPodSubnet}},
+			DNSDomain: "cluster.local",
+			ProxyMode: "ipvs",
+		},
+		Kubelet:              v1.Kubelet{RootDir: "/var/lib/kubelet"},
+		ClusterName:          "test-cluster",
+		KubernetesVersion:    "v1.23.6",
+		ControlPlaneEndpoint: "apiserver.cluster.local:6443",
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderTo(w); err != nil {
+		t.Fatalf("renderTo() error = %v", err)
+	}
+	for _, want := range []string{"imageGCHighThresholdPercent: 85\n", "imageGCLowThresholdPercent: 80\n"} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("renderTo() should render the default %q", want)
+		}
+	}
+
+	tests := []struct {
+		high, low int
+		want      []string
+	}{
+		{high: 70, low: 50, want: []string{"imageGCHighThresholdPercent: 70\n", "imageGCLowThresholdPercent: 50\n"}},
+		// the unset one is defaulted
+		{high: 90, want: []string{"imageGCHighThresholdPercent: 90\n", "imageGCLowThresholdPercent: 80\n"}},
+	}
+	for _, tt := range tests {
+		stepper.Kubelet.ImageGCHighThreshold, stepper.Kubelet.ImageGCLowThreshold = tt.high, tt.low
+		w.Reset()
+		if err := stepper.renderTo(w); err != nil {
+			t.Fatalf("renderTo() error = %v", err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(w.String(), want) {
+				t.Errorf("renderTo() should render %q", want)
+			}
+		}
+	}
+}
+
+func TestKubeadmConfig_renderJoin_nodeRegistration(t *testing.T) {
+	stepper := &KubeadmConfig{
+		ClusterConfigAPIVersion: "v1beta3",
+		ContainerRuntime:        "containerd",
+		Kubelet:                 v1.Kubelet{RootDir: "/var/lib/kubelet", NodeIP: "10.0.0.2"},
+		ControlPlaneEndpoint:    "apiserver.cluster.local:6443",
+		CACertHashes:            "hash1",
+		BootstrapToken:          "BootstrapToken",
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderJoin(w); err != nil {
+		t.Fatalf("renderJoin() error = %v", err)
+	}
+	for _, unwanted := range []string{"taints:", "node-labels:"} {
+		if strings.Contains(w.String(), unwanted) {
+			t.Errorf("renderJoin() should not render %q without node registration", unwanted)
+		}
+	}
+
+	stepper.NodeLabels = kubeletNodeLabels(map[string]string{"role": "gpu", "zone": "a"})
+	stepper.NodeTaints = []v1.Taint{{Key: "gpu", Value: "true", Effect: v1.TaintEffectNoSchedule}}
+	w.Reset()
+	if err := stepper.renderJoin(w); err != nil {
+		t.Fatalf("renderJoin() error = %v", err)
+	}
+	for _, want := range []string{
+		"  taints:\n    - key: \"gpu\"\n      value: \"true\"\n      effect: \"NoSchedule\"\n",
+		"    node-labels: \"role=gpu,zone=a\"\n",
+	} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("renderJoin() should render %q, got:\n%s", want, w.String())
+		}
+	}
+}
+
+func TestKubeadmConfig_renderJoin_ignorePreflightErrors(t *testing.T) {
+	stepper := &KubeadmConfig{
+		ClusterConfigAPIVersion: "v1beta3",
+		ContainerRuntime:        "containerd",
+		Kubelet:                 v1.Kubelet{RootDir: "/var/lib/kubelet", NodeIP: "10.0.0.2"},
+		ControlPlaneEndpoint:    "apiserver.cluster.local:6443",
+		IgnorePreflightErrors:   []string{"Swap", "SystemVerification"},
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderJoin(w); err != nil {
+		t.Fatalf("renderJoin() error = %v", err)
+	}
+	want := "  ignorePreflightErrors:\n    - Swap\n    - SystemVerification\n"
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("renderJoin() should render %q, got:\n%s", want, w.String())
+	}
+}
+
+func TestKubeadmConfig_renderTo_cgroupDriver(t *testing.T) {
+	stepper := &KubeadmConfig{
+		ClusterConfigAPIVersion: "v1beta3",
+		ContainerRuntime:        "containerd",
+		Kubelet:                 v1.Kubelet{RootDir: "/var/lib/kubelet"},
+		KubernetesVersion:       "v1.23.6",
+		ControlPlaneEndpoint:    "apiserver.cluster.local:6443",
+		CgroupDriver:            v1.CgroupDriverCgroupfs,
+	}
+	w := &bytes.Buffer{}
+	if err := stepper.renderTo(w); err != nil {
+		t.Fatalf("renderTo() error = %v", err)
+	}
+	if !strings.Contains(w.String(), "\ncgroupDriver: cgroupfs\n") {
+		t.Errorf("renderTo() should render the cgroupfs cgroup driver, got:\n%s", w.String())
+	}
+
+	// the join config overrides the cgroup driver of the kubelet config shared by the first master
+	w.Reset()
+	if err := stepper.renderJoin(w); err != nil {
+		t.Fatalf("renderJoin() error = %v", err)
+	}
+	if !strings.Contains(w.String(), "\n    cgroup-driver: cgroupfs\n") {
+		t.Errorf("renderJoin() should render the cgroupfs cgroup driver flag, got:\n%s", w.String())
+	}
+
+	got, err := resolveCgroupDriver(context.TODO(), v1.CgroupDriverSystemd, true)
+	if err != nil || got != v1.CgroupDriverSystemd {
+		t.Errorf("resolveCgroupDriver() = %v, %v, want the explicit systemd driver", got, err)
+	}
+}
@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+const (
+	adminKubeConfigFile = "/etc/kubernetes/admin.conf"
+	// serviceAccountTokenTimeout the max time to wait for the token controller populating the service account token
+	serviceAccountTokenTimeout = time.Minute
+)
+
+// KubeConfigOptions the kubeconfig files generated after 'kubeadm init'
+type KubeConfigOptions struct {
+	// CopyAdmin copy the admin kubeconfig to /root/.kube/config, which is used by the kubectl steps.
+	CopyAdmin bool `json:"copyAdmin"`
+	// ServiceAccount generate the least-privilege kubeconfig of the service account
+	ServiceAccount *v1.ServiceAccountKubeConfig `json:"serviceAccount,omitempty"`
+}
+
+func generateKubeConfigs(ctx context.Context, opts KubeConfigOptions) error {
+	if opts.CopyAdmin {
+		if err := generateKubeConfig(ctx); err != nil {
+			return err
+		}
+	}
+	if opts.ServiceAccount != nil {
+		return generateServiceAccountKubeConfig(ctx, adminKubeConfigFile, opts.ServiceAccount)
+	}
+	return nil
+}
+
+// generateServiceAccountKubeConfig create the service account bound to the cluster role by the admin kubeconfig,
+// and write the kubeconfig with the service account token to sa.Path.
+func generateServiceAccountKubeConfig(ctx context.Context, adminKubeConfig string, sa *v1.ServiceAccountKubeConfig) error {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", adminKubeConfig)
+	if err != nil {
+		return fmt.Errorf("load admin kubeconfig %s failed:%w", adminKubeConfig, err)
+	}
+	cli, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	token, err := ensureServiceAccountToken(ctx, cli, sa, time.Second, serviceAccountTokenTimeout)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(sa.Path), 0755); err != nil {
+		return err
+	}
+	cfg := buildTokenKubeConfig(restConfig.Host, restConfig.CAData, sa, token)
+	if err = clientcmd.WriteToFile(*cfg, sa.Path); err != nil {
+		return fmt.Errorf("write service account kubeconfig %s failed:%w", sa.Path, err)
+	}
+	logger.Infof("generate kubeconfig of service account %s/%s to %s successfully", sa.Namespace, sa.Name, sa.Path)
+	return nil
+}
+
+// ensureServiceAccountToken create the service account, cluster role binding and token secret if they are not exist,
+// and returns the token populated by the token controller.
+func ensureServiceAccountToken(ctx context.Context, cli kubernetes.Interface, sa *v1.ServiceAccountKubeConfig,
+	interval, timeout time.Duration) (string, error) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: sa.Namespace}}
+	if _, err := cli.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("create namespace %s failed:%w", sa.Namespace, err)
+	}
+	account := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: sa.Name, Namespace: sa.Namespace}}
+	if _, err := cli.CoreV1().ServiceAccounts(sa.Namespace).Create(ctx, account, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("create service account %s/%s failed:%w", sa.Namespace, sa.Name, err)
+	}
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceAccountBindingName(sa)},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     sa.ClusterRole,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      sa.Name,
+				Namespace: sa.Namespace,
+			},
+		},
+	}
+	if _, err := cli.RbacV1().ClusterRoleBindings().Create(ctx, binding, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("create cluster role binding %s failed:%w", binding.Name, err)
+	}
+	// the token secret is no longer created automatically since kubernetes v1.24
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        sa.Name + "-token",
+			Namespace:   sa.Namespace,
+			Annotations: map[string]string{corev1.ServiceAccountNameKey: sa.Name},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
+	}
+	if _, err := cli.CoreV1().Secrets(sa.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("create service account token secret %s/%s failed:%w", sa.Namespace, secret.Name, err)
+	}
+	var token string
+	err := wait.PollImmediateWithContext(ctx, interval, timeout, func(ctx context.Context) (bool, error) {
+		s, err := cli.CoreV1().Secrets(sa.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		token = string(s.Data[corev1.ServiceAccountTokenKey])
+		return token != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("wait service account token secret %s/%s populated failed:%w", sa.Namespace, secret.Name, err)
+	}
+	return token, nil
+}
+
+func serviceAccountBindingName(sa *v1.ServiceAccountKubeConfig) string {
+	return fmt.Sprintf("kc-%s-%s", sa.Namespace, sa.Name)
+}
+
+func buildTokenKubeConfig(server string, caData []byte, sa *v1.ServiceAccountKubeConfig, token string) *clientcmdapi.Config {
+	contextName := fmt.Sprintf("%s@kubernetes", sa.Name)
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters["kubernetes"] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: caData,
+	}
+	cfg.AuthInfos[sa.Name] = &clientcmdapi.AuthInfo{Token: token}
+	cfg.Contexts[contextName] = &clientcmdapi.Context{
+		Cluster:   "kubernetes",
+		AuthInfo:  sa.Name,
+		Namespace: sa.Namespace,
+	}
+	cfg.CurrentContext = contextName
+	return cfg
+}
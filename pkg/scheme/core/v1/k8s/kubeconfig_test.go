@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func Test_ensureServiceAccountToken(t *testing.T) {
+	sa := &v1.ServiceAccountKubeConfig{
+		Namespace:   "ops",
+		Name:        "viewer",
+		ClusterRole: "view",
+		Path:        "/root/.kube/viewer.conf",
+	}
+	// the token controller is not running in the fake clientset, populate the token secret in advance
+	cli := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "viewer-token", Namespace: "ops"},
+		Type:       corev1.SecretTypeServiceAccountToken,
+		Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte("abc")},
+	})
+	ctx := context.TODO()
+	token, err := ensureServiceAccountToken(ctx, cli, sa, 10*time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("ensureServiceAccountToken() error = %v", err)
+	}
+	if token != "abc" {
+		t.Errorf("ensureServiceAccountToken() token = %s, want abc", token)
+	}
+	if _, err = cli.CoreV1().ServiceAccounts("ops").Get(ctx, "viewer", metav1.GetOptions{}); err != nil {
+		t.Errorf("get service account error = %v", err)
+	}
+	binding, err := cli.RbacV1().ClusterRoleBindings().Get(ctx, serviceAccountBindingName(sa), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get cluster role binding error = %v", err)
+	}
+	if binding.RoleRef.Name != "view" || len(binding.Subjects) != 1 || binding.Subjects[0].Namespace != "ops" {
+		t.Errorf("unexpected cluster role binding %+v", binding)
+	}
+
+	// rerun must be idempotent
+	if _, err = ensureServiceAccountToken(ctx, cli, sa, 10*time.Millisecond, time.Second); err != nil {
+		t.Errorf("rerun ensureServiceAccountToken() error = %v", err)
+	}
+}
+
+func Test_ensureServiceAccountToken_timeout(t *testing.T) {
+	sa := &v1.ServiceAccountKubeConfig{Namespace: "ops", Name: "viewer", ClusterRole: "view"}
+	_, err := ensureServiceAccountToken(context.TODO(), fake.NewSimpleClientset(), sa, 10*time.Millisecond, 50*time.Millisecond)
+	if err == nil {
+		t.Errorf("ensureServiceAccountToken() expect timeout error when the token is not populated")
+	}
+}
+
+func Test_buildTokenKubeConfig(t *testing.T) {
+	sa := &v1.ServiceAccountKubeConfig{Namespace: "ops", Name: "viewer"}
+	cfg := buildTokenKubeConfig("https://10.0.0.1:6443", []byte("ca"), sa, "abc")
+	ctx, ok := cfg.Contexts[cfg.CurrentContext]
+	if !ok {
+		t.Fatalf("current context %s not found", cfg.CurrentContext)
+	}
+	if ctx.Namespace != "ops" || cfg.Clusters[ctx.Cluster].Server != "https://10.0.0.1:6443" ||
+		string(cfg.Clusters[ctx.Cluster].CertificateAuthorityData) != "ca" {
+		t.Errorf("unexpected cluster of context %+v", ctx)
+	}
+	if cfg.AuthInfos[ctx.AuthInfo].Token != "abc" {
+		t.Errorf("unexpected token of auth info %s", ctx.AuthInfo)
+	}
+}
+
+func TestControlPlane_InitStepper_kubeConfig(t *testing.T) {
+	sa := &v1.ServiceAccountKubeConfig{Namespace: "ops", Name: "viewer", ClusterRole: "view", Path: "/home/ops/.kube/config"}
+	tests := []struct {
+		name          string
+		sa            *v1.ServiceAccountKubeConfig
+		skipAdminCopy bool
+		wantCopyAdmin bool
+	}{
+		{name: "admin only", wantCopyAdmin: true},
+		{name: "admin and service account", sa: sa, wantCopyAdmin: true},
+		{name: "service account only", sa: sa, skipAdminCopy: true, wantCopyAdmin: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &v1.Cluster{}
+			if tt.sa != nil {
+				saCopy := *tt.sa
+				saCopy.SkipAdminCopy = tt.skipAdminCopy
+				c.ServiceAccountKubeConfig = &saCopy
+			}
+			stepper := (&ControlPlane{}).InitStepper(c)
+			if stepper.KubeConfig.CopyAdmin != tt.wantCopyAdmin {
+				t.Errorf("InitStepper() CopyAdmin = %v, want %v", stepper.KubeConfig.CopyAdmin, tt.wantCopyAdmin)
+			}
+		})
+	}
+}
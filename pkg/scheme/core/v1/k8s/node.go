@@ -47,12 +47,8 @@ const (
 )
 
 func init() {
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, joinNodeCmd, version, component.TypeStep), &JoinCmd{}); err != nil {
-		panic(err)
-	}
-	if err := component.RegisterAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, drain, version, component.TypeStep), &Drain{}); err != nil {
-		panic(err)
-	}
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, joinNodeCmd, version, component.TypeStep), &JoinCmd{})
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, drain, version, component.TypeStep), &Drain{})
 }
 
 type GenNode struct {
@@ -64,6 +60,10 @@ type GenNode struct {
 
 type JoinCmd struct {
 	ContainerRuntime string `json:"containerRuntime"`
+	// ControlPlane whether to print the control plane join command as well. The certificates uploaded by
+	// 'kubeadm init --upload-certs' are deleted after uploadCertsTTL, so the certificates are always
+	// re-uploaded with a fresh certificate key before a control plane joins.
+	ControlPlane bool `json:"controlPlane,omitempty"`
 }
 
 type KubeadmJoinUtil struct {
@@ -115,12 +115,34 @@ func (stepper *GenNode) MakeInstallSteps(metadata *component.ExtraMetadata, patc
 	// add node to cluster
 	if len(stepper.installSteps) == 0 {
 		// We should use kubeadm to create join token on the first control plane node.
-		steps, err := EnvSetupSteps(patchNodes)
+		steps, err := EnvSetupSteps(patchNodes, KubeProxyMode(&stepper.Cluster.Networking))
 		if err != nil {
 			return err
 		}
 		stepper.installSteps = append(stepper.installSteps, steps...)
 
+		if cni.NeedRPFilterCheck(&stepper.Cluster.CNI) {
+			step, err := cni.CheckRPFilter(patchNodes)
+			if err != nil {
+				return err
+			}
+			stepper.installSteps = append(stepper.installSteps, step)
+		}
+		if cni.NeedWireGuardCheck(&stepper.Cluster.CNI) {
+			step, err := cni.CheckWireGuard(patchNodes)
+			if err != nil {
+				return err
+			}
+			stepper.installSteps = append(stepper.installSteps, step)
+		}
+		if cni.NeedNetworkManagerConfig(&stepper.Cluster.CNI) {
+			step, err := cni.ConfigNetworkManager(patchNodes, v1.ActionInstall)
+			if err != nil {
+				return err
+			}
+			stepper.installSteps = append(stepper.installSteps, step)
+		}
+
 		if metadata.Offline {
 			cf, err := cni.Load(stepper.Cluster.CNI.Type)
 			if err != nil {
@@ -158,30 +180,42 @@ func (stepper *GenNode) MakeInstallSteps(metadata *component.ExtraMetadata, patc
 			}
 		}
 
-		joinCmd := JoinCmd{}
-		steps, err = joinCmd.InitStepper(stepper.Cluster.ContainerRuntime.Type).InstallSteps([]v1.StepNode{masters[0]})
+		steps, err = stepper.joinSteps(metadata, masters[0], patchNodes, role)
 		if err != nil {
 			return err
 		}
 		stepper.installSteps = append(stepper.installSteps, steps...)
+		stepper.installSteps = append(stepper.installSteps, NodeVersionLabelSteps([]v1.StepNode{masters[0]}, patchNodes,
+			stepper.Cluster.ContainerRuntime.Version, stepper.Cluster.CNI.Version)...)
+	}
 
-		// Notice: only support join worker node now.
-		kubeadmConf := KubeadmConfig{}
-		steps, err = kubeadmConf.InitStepper(stepper.Cluster, metadata).JoinSteps(false, patchNodes)
-		if err != nil {
-			return err
-		}
-		stepper.installSteps = append(stepper.installSteps, steps...)
+	return nil
+}
 
-		join := ClusterNode{}
-		steps, err = join.InitStepper(stepper.Cluster, metadata).InstallSteps(role, patchNodes)
-		if err != nil {
-			return err
-		}
-		stepper.installSteps = append(stepper.installSteps, steps...)
+// joinSteps the steps of joining the nodes, the join command is generated on the master. The certificates
+// are re-uploaded with a fresh certificate key when the nodes join as the control plane, and the key is
+// passed to the join config by the step response.
+func (stepper *GenNode) joinSteps(metadata *component.ExtraMetadata, master v1.StepNode, patchNodes []v1.StepNode, role string) ([]v1.Step, error) {
+	isControlPlane := role == NodeRoleMaster
+	joinCmd := JoinCmd{ControlPlane: isControlPlane}
+	steps, err := joinCmd.InitStepper(stepper.Cluster.ContainerRuntime.Type).InstallSteps([]v1.StepNode{master})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	kubeadmConf := KubeadmConfig{}
+	joinConfSteps, err := kubeadmConf.InitStepper(stepper.Cluster, metadata).JoinSteps(isControlPlane, patchNodes)
+	if err != nil {
+		return nil, err
+	}
+	steps = append(steps, joinConfSteps...)
+
+	join := ClusterNode{}
+	joinNodeSteps, err := join.InitStepper(stepper.Cluster, metadata).InstallSteps(role, patchNodes)
+	if err != nil {
+		return nil, err
+	}
+	return append(steps, joinNodeSteps...), nil
 }
 
 // MakeUninstallSteps make uninstall-steps
@@ -211,9 +245,16 @@ func (stepper *GenNode) MakeUninstallSteps(metadata *component.ExtraMetadata, pa
 			return err
 		}
 		stepper.uninstallSteps = append(stepper.uninstallSteps, steps...)
+		// clean container must after kubeadm reset
+		container := Container{}
+		steps, err = container.InitStepper(stepper.Cluster.ContainerRuntime.Type).ResetSteps(patchNodes)
+		if err != nil {
+			return err
+		}
+		stepper.uninstallSteps = append(stepper.uninstallSteps, steps...)
 		// worker nodes don't need to remove etcd data dir
 		stepper.uninstallSteps = append(stepper.uninstallSteps,
-			doCommandRemoveStep("removeKubeletDataDir", patchNodes, KubeletDefaultDataDir),
+			doCommandRemoveStep("removeKubeletDataDir", patchNodes, strutil.StringDefaultIfEmpty(KubeletDefaultDataDir, stepper.Cluster.Kubelet.RootDir)),
 			doCommandRemoveStep("removeDockershimDataDir", patchNodes, DockershimDefaultDataDir),
 		)
 		heal := Health{}
@@ -278,12 +319,17 @@ func (stepper *JoinCmd) InstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 	if err != nil {
 		return nil, err
 	}
+	timeout := 10 * time.Second
+	if stepper.ControlPlane {
+		// uploading the certificates waits for the apiserver to store the kubeadm-certs secret
+		timeout = time.Minute
+	}
 
 	return []v1.Step{
 		{
 			ID:         strutil.GetUUID(),
 			Name:       "getJoinCommand",
-			Timeout:    metav1.Duration{Duration: 10 * time.Second},
+			Timeout:    metav1.Duration{Duration: timeout},
 			ErrIgnore:  false,
 			RetryTimes: 1,
 			Nodes:      nodes,
@@ -338,20 +384,11 @@ func (stepper *Drain) UninstallSteps(nodes []v1.StepNode) ([]v1.Step, error) {
 	}, nil
 }
 
-func (stepper *KubeadmJoinUtil) InitStepper(line, cri string) *KubeadmJoinUtil {
-	line = strings.TrimLeft(line, " ")
-	line = strings.TrimRight(line, " ")
-	for _, str := range []string{"  ", "   ", "    ", "     "} {
-		line = strings.ReplaceAll(line, str, " ")
-	}
-	strs := strings.Split(line, " ")
-	if len(strs) < 6 {
-		stepper = &KubeadmJoinUtil{}
-	}
+func (stepper *KubeadmJoinUtil) InitStepper(info *KubeadmJoinInfo, cri string) *KubeadmJoinUtil {
 	stepper.ContainerRuntime = cri
-	stepper.ControlPlaneEndpoint = strs[2]
-	stepper.Token = strs[4]
-	stepper.DiscoveryHash = strs[6]
+	stepper.ControlPlaneEndpoint = info.ControlPlaneEndpoint
+	stepper.Token = info.Token
+	stepper.DiscoveryHash = info.CACertHash
 	return stepper
 }
 
@@ -370,12 +407,32 @@ func (stepper JoinCmd) Install(ctx context.Context, opts component.Options) ([]b
 		logger.Error("run kubeadm token create error", zap.Error(err))
 		return nil, err
 	}
+	info, err := parseJoinCommand(ec.StdOut())
+	if err != nil {
+		logger.Error("parse kubeadm join command error", zap.Error(err))
+		return nil, err
+	}
 	cmd := KubeadmJoinUtil{}
-	cmd.InitStepper(ec.StdOut(), stepper.ContainerRuntime)
+	cmd.InitStepper(info, stepper.ContainerRuntime)
 	// bytes, err = json.Marshal(cmd)
 	// format: ${master node join command};${worker node join command}
 	// Work around to split out the worker node join command.
-	return []byte("," + strings.Join(cmd.GetCmd(), " ")), nil
+	if !stepper.ControlPlane {
+		return []byte("," + strings.Join(cmd.GetCmd(), " ")), nil
+	}
+
+	// the certificate key of 'kubeadm init' may have expired, re-upload the certificates with a fresh key
+	ec, err = cmdutil.RunCmdWithContext(ctx, opts.DryRun, "kubeadm", "init", "phase", "upload-certs", "--upload-certs")
+	if err != nil {
+		logger.Error("run kubeadm init phase upload-certs error", zap.Error(err))
+		return nil, err
+	}
+	key, err := extractCertificateKey(ec.StdOut())
+	if err != nil {
+		logger.Error("extract certificate key error", zap.Error(err))
+		return nil, err
+	}
+	return []byte(cmd.GetControlPlaneCmd(key) + "," + strings.Join(cmd.GetCmd(), " ")), nil
 }
 
 func (stepper JoinCmd) Uninstall(ctx context.Context, opts component.Options) ([]byte, error) {
@@ -445,3 +502,10 @@ func (stepper *KubeadmJoinUtil) GetCmd() []string {
 	}
 	return strings.Split(cmd, " ")
 }
+
+// GetControlPlaneCmd the control plane join command in the layout of the 'kubeadm init' output,
+// which KubeadmConfig reads the certificate key from.
+func (stepper *KubeadmJoinUtil) GetControlPlaneCmd(certificateKey string) string {
+	return fmt.Sprintf("kubeadm join %s --token %s --discovery-token-ca-cert-hash %s --control-plane --certificate-key %s",
+		stepper.ControlPlaneEndpoint, stepper.Token, stepper.DiscoveryHash, certificateKey)
+}
@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+// JoinNodeRegistration the labels and taints of a node registered by kubeadm join,
+// so the node is labeled and tainted before any pod is scheduled to it.
+type JoinNodeRegistration struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Taints []v1.Taint        `json:"taints,omitempty"`
+}
+
+// joinNodeRegistrations the registrations of the worker nodes keyed by node id, the nodes without
+// labels and taints are skipped.
+func joinNodeRegistrations(workers v1.WorkerNodeList) map[string]JoinNodeRegistration {
+	var registrations map[string]JoinNodeRegistration
+	for _, node := range workers {
+		if len(node.Labels) == 0 && len(node.Taints) == 0 {
+			continue
+		}
+		if registrations == nil {
+			registrations = make(map[string]JoinNodeRegistration)
+		}
+		registrations[node.ID] = JoinNodeRegistration{Labels: node.Labels, Taints: node.Taints}
+	}
+	return registrations
+}
+
+// ValidateNodeRegistration check the label keys and values are valid kubernetes labels
+// and the taint keys and effects are valid kubernetes taints.
+func ValidateNodeRegistration(labels map[string]string, taints []v1.Taint) error {
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid node label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid node label value %q of %s: %s", value, key, strings.Join(errs, "; "))
+		}
+	}
+	for _, taint := range taints {
+		if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid node taint key %q: %s", taint.Key, strings.Join(errs, "; "))
+		}
+		if taint.Value != "" {
+			if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+				return fmt.Errorf("invalid node taint value %q of %s: %s", taint.Value, taint.Key, strings.Join(errs, "; "))
+			}
+		}
+		switch taint.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("invalid node taint effect %q of %s, must be one of %s, %s, %s", taint.Effect, taint.Key,
+				v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute)
+		}
+	}
+	return nil
+}
+
+// kubeletLabelNamespaces the kubernetes label namespaces that kubelet is allowed to set on its own node
+var kubeletLabelNamespaces = []string{"kubelet.kubernetes.io", "node.kubernetes.io"}
+
+// kubeletLabels the kubernetes labels that kubelet is allowed to set on its own node
+var kubeletLabels = []string{
+	"kubernetes.io/hostname",
+	"kubernetes.io/arch",
+	"kubernetes.io/os",
+	"beta.kubernetes.io/arch",
+	"beta.kubernetes.io/os",
+	"beta.kubernetes.io/instance-type",
+	"failure-domain.beta.kubernetes.io/region",
+	"failure-domain.beta.kubernetes.io/zone",
+	"topology.kubernetes.io/region",
+	"topology.kubernetes.io/zone",
+}
+
+// isKubeletLabel whether kubelet is allowed to set the label by --node-labels, the other labels
+// of the kubernetes.io and k8s.io namespaces make kubelet fail to start.
+func isKubeletLabel(key string) bool {
+	namespace, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return true
+	}
+	if !isDomainOf(namespace, "kubernetes.io") && !isDomainOf(namespace, "k8s.io") {
+		return true
+	}
+	for _, allowed := range kubeletLabelNamespaces {
+		if isDomainOf(namespace, allowed) {
+			return true
+		}
+	}
+	for _, allowed := range kubeletLabels {
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func isDomainOf(namespace, domain string) bool {
+	return namespace == domain || strings.HasSuffix(namespace, "."+domain)
+}
+
+// kubeletNodeLabels the --node-labels of kubelet in key order, the labels kubelet is not allowed to set
+// are left to the node metadata patch after the node joined.
+func kubeletNodeLabels(labels map[string]string) string {
+	items := make([]string, 0, len(labels))
+	for key, value := range labels {
+		if isKubeletLabel(key) {
+			items = append(items, key+"="+value)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
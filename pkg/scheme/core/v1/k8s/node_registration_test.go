@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"testing"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestValidateNodeRegistration(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		taints  []v1.Taint
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			labels: map[string]string{"role": "gpu", "example.com/zone": "a"},
+			taints: []v1.Taint{{Key: "gpu", Value: "true", Effect: v1.TaintEffectNoSchedule}, {Key: "dedicated", Effect: v1.TaintEffectNoExecute}},
+		},
+		{name: "invalid label key", labels: map[string]string{"bad key": "a"}, wantErr: true},
+		{name: "invalid label value", labels: map[string]string{"role": "a b"}, wantErr: true},
+		{name: "invalid taint key", taints: []v1.Taint{{Key: "-gpu", Effect: v1.TaintEffectNoSchedule}}, wantErr: true},
+		{name: "invalid taint value", taints: []v1.Taint{{Key: "gpu", Value: "a/b", Effect: v1.TaintEffectNoSchedule}}, wantErr: true},
+		{name: "invalid taint effect", taints: []v1.Taint{{Key: "gpu", Effect: "NoWhere"}}, wantErr: true},
+		{name: "empty taint effect", taints: []v1.Taint{{Key: "gpu"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateNodeRegistration(tt.labels, tt.taints); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNodeRegistration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKubeletNodeLabels(t *testing.T) {
+	got := kubeletNodeLabels(map[string]string{
+		"zone":                           "a",
+		"role":                           "gpu",
+		"node.kubernetes.io/instance":    "large",
+		"topology.kubernetes.io/zone":    "z1",
+		"node-role.kubernetes.io/worker": "",
+		"example.k8s.io/custom":          "x",
+	})
+	want := "node.kubernetes.io/instance=large,role=gpu,topology.kubernetes.io/zone=z1,zone=a"
+	if got != want {
+		t.Errorf("kubeletNodeLabels() = %q, want %q", got, want)
+	}
+	if got := kubeletNodeLabels(nil); got != "" {
+		t.Errorf("kubeletNodeLabels(nil) = %q, want empty", got)
+	}
+}
+
+func TestJoinNodeRegistrations(t *testing.T) {
+	got := joinNodeRegistrations(v1.WorkerNodeList{
+		{ID: "n1", Labels: map[string]string{"role": "gpu"}},
+		{ID: "n2"},
+		{ID: "n3", Taints: []v1.Taint{{Key: "gpu", Effect: v1.TaintEffectNoSchedule}}},
+	})
+	if len(got) != 2 {
+		t.Fatalf("joinNodeRegistrations() = %v, want n1 and n3", got)
+	}
+	if got["n1"].Labels["role"] != "gpu" || len(got["n3"].Taints) != 1 {
+		t.Errorf("joinNodeRegistrations() = %v", got)
+	}
+	if got := joinNodeRegistrations(v1.WorkerNodeList{{ID: "n2"}}); got != nil {
+		t.Errorf("joinNodeRegistrations() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+func TestGenNode_joinSteps_master(t *testing.T) {
+	metadata := &component.ExtraMetadata{
+		ClusterName: "test",
+		Masters:     component.NodeList{{ID: "m1", IPv4: "10.0.0.10", NodeIPv4: "10.0.0.10", Hostname: "master-1"}},
+	}
+	cluster := &v1.Cluster{KubernetesVersion: "v1.23.6"}
+	cluster.ContainerRuntime.Type = "containerd"
+	cluster.Masters = v1.WorkerNodeList{{ID: "m1"}, {ID: "m2"}}
+
+	gen := &GenNode{Cluster: cluster}
+	steps, err := gen.joinSteps(metadata, v1.StepNode{ID: "m1"}, []v1.StepNode{{ID: "m2"}}, NodeRoleMaster)
+	if err != nil {
+		t.Fatalf("joinSteps() error = %v", err)
+	}
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	if want := []string{"getJoinCommand", "renderMasterJoinConfig", "joinNode"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("joinSteps() steps = %v, want %v", names, want)
+	}
+
+	joinCmd := &JoinCmd{}
+	if err = json.Unmarshal(steps[0].Commands[0].CustomCommand, joinCmd); err != nil {
+		t.Fatal(err)
+	}
+	if !joinCmd.ControlPlane || steps[0].Nodes[0].ID != "m1" {
+		t.Errorf("joinSteps() want the certificates re-uploaded on m1, got %+v on %s", joinCmd, steps[0].Nodes[0].ID)
+	}
+	kubeadmConf := &KubeadmConfig{}
+	if err = json.Unmarshal(steps[1].Commands[0].CustomCommand, kubeadmConf); err != nil {
+		t.Fatal(err)
+	}
+	if !kubeadmConf.IsControlPlane {
+		t.Errorf("joinSteps() want the control plane join config")
+	}
+	node := &ClusterNode{}
+	if err = json.Unmarshal(steps[2].Commands[0].CustomCommand, node); err != nil {
+		t.Fatal(err)
+	}
+	if node.NodeRole != NodeRoleMaster {
+		t.Errorf("joinSteps() node role = %s", node.NodeRole)
+	}
+}
+
+func TestGenNode_joinSteps_worker(t *testing.T) {
+	metadata := &component.ExtraMetadata{
+		Masters: component.NodeList{{ID: "m1", NodeIPv4: "10.0.0.10"}},
+	}
+	gen := &GenNode{Cluster: &v1.Cluster{KubernetesVersion: "v1.23.6"}}
+	steps, err := gen.joinSteps(metadata, v1.StepNode{ID: "m1"}, []v1.StepNode{{ID: "w1"}}, NodeRoleWorker)
+	if err != nil {
+		t.Fatalf("joinSteps() error = %v", err)
+	}
+	joinCmd := &JoinCmd{}
+	if err = json.Unmarshal(steps[0].Commands[0].CustomCommand, joinCmd); err != nil {
+		t.Fatal(err)
+	}
+	if joinCmd.ControlPlane || steps[1].Name != "renderWorkerJoinConfig" {
+		t.Errorf("joinSteps() of the workers want no certificates uploaded, got %+v, %s", joinCmd, steps[1].Name)
+	}
+}
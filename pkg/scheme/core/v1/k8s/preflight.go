@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+)
+
+// preflightChecks the names of the kubeadm preflight checks, lowercased as kubeadm matches them case-insensitively
+var preflightChecks = []string{
+	"all",
+	"containerruntimeversion",
+	"controlplanenodesready",
+	"cri",
+	"externaletcdversion",
+	"firewalld",
+	"hostname",
+	"httpproxy",
+	"httpproxycidr",
+	"imagepull",
+	"isdockersystemdcheck",
+	"isprivilegeduser",
+	"kubeletversion",
+	"kubernetesversion",
+	"mem",
+	"numcpu",
+	"swap",
+	"systemverification",
+}
+
+// preflightCheckPrefixes the kubeadm preflight checks named after a port, a path or a service,
+// e.g. Port-6443, FileContent--proc-sys-net-ipv4-ip_forward or Service-Kubelet
+var preflightCheckPrefixes = []string{
+	"port-",
+	"diravailable--",
+	"fileavailable--",
+	"filecontent--",
+	"fileexisting-",
+	"service-",
+}
+
+// ValidateIgnorePreflightErrors check the preflight errors to ignore are known kubeadm preflight checks.
+func ValidateIgnorePreflightErrors(checks []string) error {
+	for _, check := range checks {
+		if !isPreflightCheck(check) {
+			return fmt.Errorf("unknown kubeadm preflight check %q", check)
+		}
+	}
+	return nil
+}
+
+func isPreflightCheck(check string) bool {
+	check = strings.ToLower(check)
+	for _, known := range preflightChecks {
+		if check == known {
+			return true
+		}
+	}
+	for _, prefix := range preflightCheckPrefixes {
+		if strings.HasPrefix(check, prefix) && len(check) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
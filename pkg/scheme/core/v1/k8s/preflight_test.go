@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/common"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateIgnorePreflightErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		checks  []string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "named checks", checks: []string{"Swap", "SystemVerification", "all", "NumCPU"}},
+		{name: "path and port checks", checks: []string{"Port-6443", "FileContent--proc-sys-net-ipv4-ip_forward", "DirAvailable--var-lib-etcd", "Service-Kubelet"}},
+		{name: "unknown check", checks: []string{"Swap", "NoSuchCheck"}, wantErr: true},
+		{name: "bare prefix", checks: []string{"Port-"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateIgnorePreflightErrors(tt.checks); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIgnorePreflightErrors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClusterIgnorePreflightErrors(t *testing.T) {
+	c := &v1.Cluster{
+		ObjectMeta:            metav1.ObjectMeta{Annotations: map[string]string{common.AnnotationOnlyIgnorePreflightErrors: "Swap,NumCPU"}},
+		IgnorePreflightErrors: []string{"SystemVerification", "Swap"},
+	}
+	got := clusterIgnorePreflightErrors(c)
+	want := []string{"NumCPU", "Swap", "SystemVerification"}
+	if len(got) != len(want) {
+		t.Fatalf("clusterIgnorePreflightErrors() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("clusterIgnorePreflightErrors() = %v, want %v", got, want)
+		}
+	}
+	if got := clusterIgnorePreflightErrors(&v1.Cluster{}); got != nil {
+		t.Errorf("clusterIgnorePreflightErrors() = %v, want nil", got)
+	}
+}
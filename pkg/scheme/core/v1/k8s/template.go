@@ -22,6 +22,17 @@ const kubeadmTemplate = `
 kind: ClusterConfiguration
 apiVersion: kubeadm.k8s.io/{{.ClusterConfigAPIVersion}}
 etcd:
+{{- if .Etcd.External}}
+  external:
+    endpoints:{{range .Etcd.External.Endpoints}}
+    - {{.}}{{end}}
+{{- with .Etcd.External.CAFile}}
+    caFile: "{{.}}"{{end}}
+{{- with .Etcd.External.CertFile}}
+    certFile: "{{.}}"{{end}}
+{{- with .Etcd.External.KeyFile}}
+    keyFile: "{{.}}"{{end}}
+{{- else}}
   local:
 {{with .Etcd.DataDir}}    dataDir: "{{.}}"{{end}}
     extraArgs:
@@ -30,6 +41,7 @@ etcd:
       heartbeat-interval: '300'
       quota-backend-bytes: '8589934592'
       snapshot-count: '5000'
+{{- end}}
 networking:
   serviceSubnet: {{ range .Networking.Services.CIDRBlocks }}{{ . }}{{- end }}
   podSubnet: {{ range .Networking.Pods.CIDRBlocks }}{{ . }}{{- end }}
@@ -65,13 +77,15 @@ scheduler:
 featureGates:{{range $key,$value := .FeatureGates}}
   {{$key}}: {{$value}}{{end}}{{end}}
 ---
+{{- if not .Networking.SkipKubeProxy}}
 kind: KubeProxyConfiguration
 apiVersion: kubeproxy.config.k8s.io/v1alpha1
 mode: {{if eq .Networking.ProxyMode "ipvs"}}ipvs{{else}}iptables{{end}}
 {{if eq .Networking.ProxyMode "ipvs"}}{{if .Networking.WorkerNodeVip}}ipvs:
   excludeCIDRs:
-  - "{{.Networking.WorkerNodeVip}}/32"{{end}}{{end}}
+  - "{{.Networking.WorkerNodeVip}}/{{if contains ":" .Networking.WorkerNodeVip}}128{{else}}32{{end}}"{{end}}{{end}}
 ---
+{{- end}}
 apiVersion: kubelet.config.k8s.io/v1beta1
 authentication:
   anonymous:
@@ -79,11 +93,11 @@ authentication:
   x509:
     clientCAFile: /etc/kubernetes/pki/ca.crt
 kind: KubeletConfiguration
-cgroupDriver: systemd
+cgroupDriver: {{with .CgroupDriver}}{{.}}{{else}}systemd{{end}}
 healthzBindAddress: 127.0.0.1
 healthzPort: 10248
-imageGCHighThresholdPercent: 85
-imageGCLowThresholdPercent: 80
+imageGCHighThresholdPercent: {{.ImageGCHighThresholdPercent}}
+imageGCLowThresholdPercent: {{.ImageGCLowThresholdPercent}}
 imageMinimumGCAge: 2m0s
 memorySwap: {}
 staticPodPath: /etc/kubernetes/manifests
@@ -131,13 +145,29 @@ nodeRegistration:
 {{- if .Kubelet.IPAsName }}
   name: "{{.Kubelet.NodeIP}}"
 {{- end}}
+{{- with .IgnorePreflightErrors}}
+  ignorePreflightErrors:{{range .}}
+    - {{.}}{{end}}
+{{- end}}
 {{- if eq .ContainerRuntime  "containerd"}}
   criSocket: /run/containerd/containerd.sock
 {{end}}
+{{- with .NodeTaints}}
+  taints:{{range .}}
+    - key: "{{.Key}}"
+      value: "{{.Value}}"
+      effect: "{{.Effect}}"{{end}}
+{{- end}}
   kubeletExtraArgs:
     root-dir: {{.Kubelet.RootDir}}
     node-ip: {{.Kubelet.NodeIP}}
     resolv-conf: {{.Kubelet.ResolvConf}}
+{{- with .CgroupDriver}}
+    cgroup-driver: {{.}}
+{{- end}}
+{{- with .NodeLabels}}
+    node-labels: "{{.}}"
+{{- end}}
 `
 
 const lvscareV111 = `
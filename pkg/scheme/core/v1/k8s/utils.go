@@ -20,7 +20,12 @@ package k8s
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -30,24 +35,142 @@ import (
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/namespaces"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/fileutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/netutil"
 	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
 )
 
-func getJoinCmdFromStdOut(output string, cutBegin string) string {
-	outputSlice := strings.Split(output, "\n")
-	controlPlaneJoinStartIndex := 0
-	for index, val := range outputSlice {
-		if val == cutBegin {
-			controlPlaneJoinStartIndex = index
+var (
+	// lineContinuationRe the shell line continuation of the multi-line join command
+	lineContinuationRe = regexp.MustCompile(`\\[ \t]*\r?\n`)
+	// joinCmdRe the kubeadm join command, the endpoint is host:port or bracketed [ipv6]:port
+	joinCmdRe = regexp.MustCompile(`^kubeadm join (\[[0-9A-Fa-f:.]+\]|[^\s\[\]:]+):\d+(\s|$)`)
+	// certificateKeyRe the hex encoded AES-256 certificate key printed by 'kubeadm init phase upload-certs'
+	certificateKeyRe = regexp.MustCompile(`(?m)^\s*([0-9a-f]{64})\s*$`)
+)
+
+// uploadCertsTTL the lifetime of the certificates uploaded by kubeadm to the kubeadm-certs secret,
+// kubeadm deletes the secret together with its token after the TTL and it is not configurable.
+const uploadCertsTTL = 2 * time.Hour
+
+// extractCertificateKey extract the certificate key from the 'kubeadm init phase upload-certs --upload-certs' output.
+func extractCertificateKey(output string) (string, error) {
+	m := certificateKeyRe.FindStringSubmatch(output)
+	if m == nil {
+		return "", fmt.Errorf("certificate key not found in kubeadm upload-certs output")
+	}
+	return m[1], nil
+}
+
+// extractJoinCommands extract the control plane and worker join commands from the 'kubeadm init' output.
+// The flags of the join command can appear in any order, e.g. --certificate-key before or after --control-plane.
+func extractJoinCommands(output string) (controlPlane, worker string, err error) {
+	output = lineContinuationRe.ReplaceAllString(output, " ")
+	for _, line := range strings.Split(output, "\n") {
+		cmd := strings.Join(strings.Fields(line), " ")
+		if !joinCmdRe.MatchString(cmd) {
+			continue
+		}
+		fields := strings.Fields(cmd)
+		if !hasFlag(fields, "--token") || !hasFlag(fields, "--discovery-token-ca-cert-hash") {
+			continue
+		}
+		if hasFlag(fields, "--control-plane") {
+			if controlPlane == "" {
+				controlPlane = cmd
+			}
+			continue
 		}
+		if worker == "" {
+			worker = cmd
+		}
+	}
+	if worker == "" {
+		return "", "", fmt.Errorf("worker join command not found in kubeadm init output")
+	}
+	if controlPlane == "" {
+		return "", "", fmt.Errorf("control plane join command not found in kubeadm init output")
 	}
-	result := strings.Join([]string{strings.TrimSpace(outputSlice[controlPlaneJoinStartIndex+2]), strings.TrimSpace(outputSlice[controlPlaneJoinStartIndex+3]), strings.TrimSpace(outputSlice[controlPlaneJoinStartIndex+4])}, "\n")
-	return strings.Replace(result, "\\\n", "", -1)
+	return controlPlane, worker, nil
+}
+
+// KubeadmJoinInfo the join parameters of a cluster printed by kubeadm, which are enough to build
+// the join command of a node added at any later time.
+type KubeadmJoinInfo struct {
+	ControlPlaneEndpoint string `json:"controlPlaneEndpoint"`
+	Token                string `json:"token"`
+	CACertHash           string `json:"caCertHash"`
+	// CertificateKey only present in the control plane join command
+	CertificateKey string `json:"certificateKey,omitempty"`
+}
+
+// parseInitOutput parse the join parameters out of the 'kubeadm init --upload-certs' output.
+func parseInitOutput(output string) (*KubeadmJoinInfo, error) {
+	controlPlane, worker, err := extractJoinCommands(output)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseJoinCommand(controlPlane)
+	if err != nil {
+		return nil, err
+	}
+	if info.CertificateKey == "" {
+		return nil, fmt.Errorf("certificate key not found in control plane join command")
+	}
+	workerInfo, err := parseJoinCommand(worker)
+	if err != nil {
+		return nil, err
+	}
+	if workerInfo.ControlPlaneEndpoint != info.ControlPlaneEndpoint || workerInfo.Token != info.Token || workerInfo.CACertHash != info.CACertHash {
+		return nil, fmt.Errorf("control plane and worker join commands mismatch")
+	}
+	return info, nil
+}
+
+// parseJoinCommand parse the join parameters out of a single 'kubeadm join' command, e.g. printed by
+// 'kubeadm token create --print-join-command'. The flags can be in any order and in the --flag=value form.
+func parseJoinCommand(cmd string) (*KubeadmJoinInfo, error) {
+	cmd = lineContinuationRe.ReplaceAllString(cmd, " ")
+	fields := strings.Fields(cmd)
+	if !joinCmdRe.MatchString(strings.Join(fields, " ")) {
+		return nil, fmt.Errorf("invalid kubeadm join command %q", cmd)
+	}
+	info := &KubeadmJoinInfo{ControlPlaneEndpoint: fields[2]}
+	for i := 3; i < len(fields); i++ {
+		flag, value, ok := strings.Cut(fields[i], "=")
+		if !ok && i+1 < len(fields) && !strings.HasPrefix(fields[i+1], "--") {
+			value = fields[i+1]
+		}
+		switch flag {
+		case "--token":
+			info.Token = value
+		case "--discovery-token-ca-cert-hash":
+			info.CACertHash = value
+		case "--certificate-key":
+			info.CertificateKey = value
+		}
+	}
+	if info.Token == "" {
+		return nil, fmt.Errorf("token not found in kubeadm join command")
+	}
+	if info.CACertHash == "" {
+		return nil, fmt.Errorf("discovery token ca cert hash not found in kubeadm join command")
+	}
+	return info, nil
+}
+
+func hasFlag(fields []string, flag string) bool {
+	for _, f := range fields {
+		if f == flag || strings.HasPrefix(f, flag+"=") {
+			return true
+		}
+	}
+	return false
 }
 
 func generateKubeConfig(ctx context.Context) error {
@@ -79,13 +202,63 @@ func doCommandRemoveStep(name string, nodes []v1.StepNode, dirs ...string) v1.St
 	}
 }
 
-func deleteContainer(namespace string) error {
-	client, err := containerd.New("/run/containerd/containerd.sock")
+// deleteContainerWorkers the max number of containers deleted concurrently
+const deleteContainerWorkers = 8
+
+// containerdRunning whether the containerd socket accepts connections
+func containerdRunning(socket string) bool {
+	if err := netutil.Reachable("unix", socket, time.Second); err != nil {
+		logger.Infof("containerd socket %s is not reachable, skip deleting containers: %s", socket, err)
+		return false
+	}
+	return true
+}
+
+// deleteContainer kill and delete all containers of the containerd namespace.
+// The per container errors do not abort the cleanup, they are aggregated and returned at the end.
+// It is a no-op when containerd is not running.
+func deleteContainer(socket, namespace string) error {
+	if !containerdRunning(socket) {
+		return nil
+	}
+	client, err := containerd.New(socket)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
+	return deleteNamespaceContainers(client, namespace)
+}
 
+// deleteAllContainers kill and delete the containers of all containerd namespaces, e.g. k8s.io and moby.
+// The namespace deleted during the cleanup is skipped. It is a no-op when containerd is not running.
+func deleteAllContainers(socket string) error {
+	if !containerdRunning(socket) {
+		return nil
+	}
+	client, err := containerd.New(socket)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	nsList, err := client.NamespaceService().List(context.Background())
+	if err != nil {
+		return fmt.Errorf("list containerd namespaces failed:%w", err)
+	}
+	var errs []error
+	for _, ns := range nsList {
+		if err = deleteNamespaceContainers(client, ns); err != nil {
+			if errdefs.IsNotFound(err) {
+				logger.Infof("containerd namespace %s is already deleted, skip it", ns)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("delete containers of namespace %s failed:%w", ns, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func deleteNamespaceContainers(client *containerd.Client, namespace string) error {
 	ctx := namespaces.WithNamespace(context.Background(), namespace)
 
 	ctrs, err := client.Containers(ctx)
@@ -95,25 +268,52 @@ func deleteContainer(namespace string) error {
 
 	logger.Infof("current namespace task num is %d. task %v", len(ctrs), ctrs)
 
-	for _, ctr := range ctrs {
-		logger.Debugf("Attempt to kill and delete task belong to container %s", ctr.ID())
-		if task, err := ctr.Task(ctx, nil); err != nil {
-			logger.Warnf("Failed to get task of container %s , it may has not task at all, let move on", ctr.ID())
-		} else {
-			logger.Debugf("Attempt to kill task %s", task.ID())
-			exitStatusC, err := task.Wait(ctx)
-			if err != nil {
-				logger.Errorf("Failed to get status chan due to error %s", err)
-				return err
-			}
-			if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
-				if errdefs.IsNotFound(err) {
-					logger.Errorf("Task kill %s error: %s", task.ID(), err.Error())
-					continue
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	ch := make(chan containerd.Container)
+	for i := 0; i < deleteContainerWorkers && i < len(ctrs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctr := range ch {
+				if err := deleteContainerAndTask(ctx, ctr); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("delete container %s failed:%w", ctr.ID(), err))
+					mu.Unlock()
 				}
-				logger.Errorf("Failed to kill task due to error %s", err)
-				return err
 			}
+		}()
+	}
+	for _, ctr := range ctrs {
+		ch <- ctr
+	}
+	close(ch)
+	wg.Wait()
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func deleteContainerAndTask(ctx context.Context, ctr containerd.Container) error {
+	logger.Debugf("Attempt to kill and delete task belong to container %s", ctr.ID())
+	if task, err := ctr.Task(ctx, nil); err != nil {
+		logger.Warnf("Failed to get task of container %s , it may has not task at all, let move on", ctr.ID())
+	} else {
+		logger.Debugf("Attempt to kill task %s", task.ID())
+		exitStatusC, err := task.Wait(ctx)
+		if err != nil {
+			logger.Errorf("Failed to get status chan due to error %s", err)
+			return err
+		}
+		if err := task.Kill(ctx, syscall.SIGKILL); err != nil && !errdefs.IsNotFound(err) {
+			logger.Errorf("Failed to kill task due to error %s", err)
+			return err
+		} else if err != nil {
+			// the task has already exited, there is no exit signal to wait for, the task and container are still deleted
+			logger.Debugf("Task %s is not found on kill, it has exited: %s", task.ID(), err.Error())
+		} else {
 			logger.Debugf("Containerd task %s killed", task.ID())
 			logger.Debugf("Wait for task %s exit signal", task.ID())
 			status := <-exitStatusC
@@ -124,20 +324,18 @@ func deleteContainer(namespace string) error {
 				return err
 			}
 			logger.Debugf("Got task exit signal %v", code)
-			logger.Debugf("Attempt to delete task %s", task.ID())
-			if statusCode, err := task.Delete(ctx); err != nil {
-				logger.Errorf("(ignore) Failed to delete task %s due to error: %s since task already been killed it`s ok to leave it alone", task.ID(), err)
-			} else {
-				logger.Debugf("Task %s deleted and got exit code %v", task.ID(), statusCode.ExitCode())
-			}
 		}
-		logger.Debugf("Attempt to delete container %s", ctr.ID())
-		if err := ctr.Delete(ctx); err != nil {
-			logger.Errorf("(ignored) Failed to delete container %s due to error: %s but container without task can be consider harmless let`s move on", ctr.ID(), err.Error())
-			continue
+		logger.Debugf("Attempt to delete task %s", task.ID())
+		if statusCode, err := task.Delete(ctx); err != nil {
+			logger.Errorf("(ignore) Failed to delete task %s due to error: %s since task already been killed it`s ok to leave it alone", task.ID(), err)
+		} else {
+			logger.Debugf("Task %s deleted and got exit code %v", task.ID(), statusCode.ExitCode())
 		}
 	}
-
+	logger.Debugf("Attempt to delete container %s", ctr.ID())
+	if err := ctr.Delete(ctx); err != nil {
+		logger.Errorf("(ignored) Failed to delete container %s due to error: %s but container without task can be consider harmless let`s move on", ctr.ID(), err.Error())
+	}
 	return nil
 }
 
@@ -149,3 +347,35 @@ func isServiceActive(name string) (bool, error) {
 	}
 	return initSystem.ServiceIsActive(name), nil
 }
+
+// ValidateExternalEtcd validates the external etcd endpoints, and the ca, cert and key files
+// are set together since the etcd client certificate is useless without any of them.
+func ValidateExternalEtcd(e *v1.ExternalEtcd) error {
+	if e == nil {
+		return nil
+	}
+	if len(e.Endpoints) == 0 {
+		return fmt.Errorf("external etcd requires at least one endpoint")
+	}
+	for _, endpoint := range e.Endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid external etcd endpoint %s, must be http(s)://host:port", endpoint)
+		}
+	}
+	files := []string{e.CAFile, e.CertFile, e.KeyFile}
+	set := 0
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		set++
+		if !filepath.IsAbs(f) {
+			return fmt.Errorf("external etcd certificate file %s must be absolute", f)
+		}
+	}
+	if set != 0 && set != len(files) {
+		return fmt.Errorf("external etcd caFile, certFile and keyFile must be set together")
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package k8s
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+)
+
+const joinOutputFormat = `Your Kubernetes control-plane has initialized successfully!
+
+To start using your cluster, you need to run the following as a regular user:
+
+  mkdir -p $HOME/.kube
+  sudo cp -i /etc/kubernetes/admin.conf $HOME/.kube/config
+  sudo chown $(id -u):$(id -g) $HOME/.kube/config
+
+You can now join any number of the control-plane node running the following command on each as root:
+
+  kubeadm join %[1]s --token abcdef.0123456789abcdef \
+	--discovery-token-ca-cert-hash sha256:1234 \
+	%[2]s
+
+Please note that the certificate-key gives access to cluster sensitive data, keep it secret!
+
+Then you can join any number of worker nodes by running the following on each as root:
+
+kubeadm join %[1]s --token abcdef.0123456789abcdef \
+	--discovery-token-ca-cert-hash sha256:1234 
+`
+
+func Test_extractJoinCommands(t *testing.T) {
+	tests := []struct {
+		name             string
+		output           string
+		wantControlPlane string
+		wantWorker       string
+		wantErr          bool
+	}{
+		{
+			name:             "ipv4",
+			output:           fmt.Sprintf(joinOutputFormat, "10.0.0.1:6443", "--control-plane --certificate-key c0ffee"),
+			wantControlPlane: "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 --control-plane --certificate-key c0ffee",
+			wantWorker:       "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234",
+		},
+		{
+			name:             "domain endpoint",
+			output:           fmt.Sprintf(joinOutputFormat, "apiserver.cluster.local:6443", "--control-plane --certificate-key c0ffee"),
+			wantControlPlane: "kubeadm join apiserver.cluster.local:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 --control-plane --certificate-key c0ffee",
+			wantWorker:       "kubeadm join apiserver.cluster.local:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234",
+		},
+		{
+			name:             "ipv6",
+			output:           fmt.Sprintf(joinOutputFormat, "[fd00::1]:6443", "--control-plane --certificate-key c0ffee"),
+			wantControlPlane: "kubeadm join [fd00::1]:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 --control-plane --certificate-key c0ffee",
+			wantWorker:       "kubeadm join [fd00::1]:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234",
+		},
+		{
+			name:             "dual-stack certificate-key before control-plane",
+			output:           fmt.Sprintf(joinOutputFormat, "[fd00:10:96::a]:6443", "--certificate-key c0ffee --control-plane"),
+			wantControlPlane: "kubeadm join [fd00:10:96::a]:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 --certificate-key c0ffee --control-plane",
+			wantWorker:       "kubeadm join [fd00:10:96::a]:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234",
+		},
+		{
+			name:    "no join command",
+			output:  "[init] Using Kubernetes version: v1.23.6\nerror execution phase preflight",
+			wantErr: true,
+		},
+		{
+			name:    "no worker join command",
+			output:  "kubeadm join 10.0.0.1:6443 --token abc --discovery-token-ca-cert-hash sha256:1234 --control-plane --certificate-key c0ffee",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controlPlane, worker, err := extractJoinCommands(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractJoinCommands() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if controlPlane != tt.wantControlPlane {
+				t.Errorf("extractJoinCommands() controlPlane = %q, want %q", controlPlane, tt.wantControlPlane)
+			}
+			if worker != tt.wantWorker {
+				t.Errorf("extractJoinCommands() worker = %q, want %q", worker, tt.wantWorker)
+			}
+		})
+	}
+}
+
+func Test_deleteContainer_containerdNotRunning(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	if err := deleteContainer(socket, "k8s.io"); err != nil {
+		t.Errorf("deleteContainer() should be a no-op when containerd is not running, got error = %v", err)
+	}
+}
+
+func Test_deleteAllContainers_containerdNotRunning(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	if err := deleteAllContainers(socket); err != nil {
+		t.Errorf("deleteAllContainers() should be a no-op when containerd is not running, got error = %v", err)
+	}
+}
+
+func TestValidateExternalEtcd(t *testing.T) {
+	tests := []struct {
+		name    string
+		etcd    *v1.ExternalEtcd
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "no tls", etcd: &v1.ExternalEtcd{Endpoints: []string{"http://10.0.0.11:2379"}}},
+		{name: "tls", etcd: &v1.ExternalEtcd{Endpoints: []string{"https://10.0.0.11:2379"},
+			CAFile: "/etc/etcd/ca.crt", CertFile: "/etc/etcd/client.crt", KeyFile: "/etc/etcd/client.key"}},
+		{name: "no endpoints", etcd: &v1.ExternalEtcd{}, wantErr: true},
+		{name: "invalid endpoint", etcd: &v1.ExternalEtcd{Endpoints: []string{"10.0.0.11:2379"}}, wantErr: true},
+		{name: "missing key", etcd: &v1.ExternalEtcd{Endpoints: []string{"https://10.0.0.11:2379"},
+			CAFile: "/etc/etcd/ca.crt", CertFile: "/etc/etcd/client.crt"}, wantErr: true},
+		{name: "relative file", etcd: &v1.ExternalEtcd{Endpoints: []string{"https://10.0.0.11:2379"},
+			CAFile: "ca.crt", CertFile: "/etc/etcd/client.crt", KeyFile: "/etc/etcd/client.key"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateExternalEtcd(tt.etcd); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateExternalEtcd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_extractCertificateKey(t *testing.T) {
+	const key = "e6a2eb8581237ab72a4f494f30285ec12a9694d750b9785706a83bfcbbbd2204"
+	output := `[upload-certs] Storing the certificates in Secret "kubeadm-certs" in the "kube-system" Namespace
+[upload-certs] Using certificate key:
+` + key + "\n"
+	got, err := extractCertificateKey(output)
+	if err != nil {
+		t.Fatalf("extractCertificateKey() error = %v", err)
+	}
+	if got != key {
+		t.Errorf("extractCertificateKey() = %q, want %q", got, key)
+	}
+	if _, err := extractCertificateKey("[upload-certs] Skipping phase"); err == nil {
+		t.Errorf("extractCertificateKey() should fail without a certificate key")
+	}
+}
+
+func TestKubeadmJoinUtil_GetControlPlaneCmd(t *testing.T) {
+	info, err := parseJoinCommand("kubeadm join apiserver.cluster.local:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 \n")
+	if err != nil {
+		t.Fatalf("parseJoinCommand() error = %v", err)
+	}
+	util := (&KubeadmJoinUtil{}).InitStepper(info, "containerd")
+	cmd := strings.Split(util.GetControlPlaneCmd("key"), " ")
+	// KubeadmConfig reads the token, the CA cert hash and the certificate key by position
+	if len(cmd) < 10 || cmd[4] != "abcdef.0123456789abcdef" || cmd[6] != "sha256:1234" || cmd[7] != "--control-plane" || cmd[9] != "key" {
+		t.Errorf("GetControlPlaneCmd() = %v", cmd)
+	}
+}
+
+// kubeadmInitOutput the init output of kubeadm v1.27 with the uploaded certificates
+const kubeadmInitOutput = `[addons] Applied essential addon: kube-proxy
+
+Your Kubernetes control-plane has initialized successfully!
+
+To start using your cluster, you need to run the following as a regular user:
+
+  mkdir -p $HOME/.kube
+  sudo cp -i /etc/kubernetes/admin.conf $HOME/.kube/config
+  sudo chown $(id -u):$(id -g) $HOME/.kube/config
+
+Alternatively, if you are the root user, you can run:
+
+  export KUBECONFIG=/etc/kubernetes/admin.conf
+
+You should now deploy a pod network to the cluster.
+Run "kubectl apply -f [podnetwork].yaml" with one of the options listed at:
+  https://kubernetes.io/docs/concepts/cluster-administration/addons/
+
+You can now join any number of the control-plane node running the following command on each as root:
+
+  kubeadm join apiserver.cluster.local:6443 --token s9afr8.tsibqbmgddqku6xu \
+	--discovery-token-ca-cert-hash sha256:e34ec831f206237b38a1b29d46b5df599018c178959b874f6b14fe2438194f9d \
+	--control-plane --certificate-key 46518267766fc19772ecc334c13190f8131f1bf48a213538879f6427f74fe8e2
+
+Please note that the certificate-key gives access to cluster sensitive data, keep it secret!
+As a safeguard, uploaded-certs will be deleted in two hours; If necessary, you can use
+"kubeadm init phase upload-certs --upload-certs" to reload certs afterward.
+
+Then you can join any number of worker nodes by running the following on each as root:
+
+kubeadm join apiserver.cluster.local:6443 --token s9afr8.tsibqbmgddqku6xu \
+	--discovery-token-ca-cert-hash sha256:e34ec831f206237b38a1b29d46b5df599018c178959b874f6b14fe2438194f9d 
+`
+
+func Test_parseInitOutput(t *testing.T) {
+	want := KubeadmJoinInfo{
+		ControlPlaneEndpoint: "apiserver.cluster.local:6443",
+		Token:                "s9afr8.tsibqbmgddqku6xu",
+		CACertHash:           "sha256:e34ec831f206237b38a1b29d46b5df599018c178959b874f6b14fe2438194f9d",
+		CertificateKey:       "46518267766fc19772ecc334c13190f8131f1bf48a213538879f6427f74fe8e2",
+	}
+	got, err := parseInitOutput(kubeadmInitOutput)
+	if err != nil {
+		t.Fatalf("parseInitOutput() error = %v", err)
+	}
+	if *got != want {
+		t.Errorf("parseInitOutput() = %+v, want %+v", *got, want)
+	}
+
+	got, err = parseInitOutput(fmt.Sprintf(joinOutputFormat, "[fd00::1]:6443", "--certificate-key c0ffee --control-plane"))
+	if err != nil {
+		t.Fatalf("parseInitOutput() error = %v", err)
+	}
+	if got.ControlPlaneEndpoint != "[fd00::1]:6443" || got.CertificateKey != "c0ffee" {
+		t.Errorf("parseInitOutput() = %+v", *got)
+	}
+
+	if _, err = parseInitOutput(fmt.Sprintf(joinOutputFormat, "10.0.0.1:6443", "--control-plane")); err == nil {
+		t.Errorf("parseInitOutput() should fail without a certificate key")
+	}
+}
+
+func Test_parseJoinCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		want    KubeadmJoinInfo
+		wantErr bool
+	}{
+		{
+			name: "token create print join command",
+			cmd:  "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 \n",
+			want: KubeadmJoinInfo{ControlPlaneEndpoint: "10.0.0.1:6443", Token: "abcdef.0123456789abcdef", CACertHash: "sha256:1234"},
+		},
+		{
+			name: "flags with equal sign",
+			cmd:  "kubeadm join [fd00::1]:6443 --control-plane --certificate-key=c0ffee --token=abc --discovery-token-ca-cert-hash=sha256:1234",
+			want: KubeadmJoinInfo{ControlPlaneEndpoint: "[fd00::1]:6443", Token: "abc", CACertHash: "sha256:1234", CertificateKey: "c0ffee"},
+		},
+		{
+			name:    "not a join command",
+			cmd:     "kubeadm token create --print-join-command",
+			wantErr: true,
+		},
+		{
+			name:    "no token",
+			cmd:     "kubeadm join 10.0.0.1:6443 --discovery-token-ca-cert-hash sha256:1234",
+			wantErr: true,
+		},
+		{
+			name:    "no ca cert hash",
+			cmd:     "kubeadm join 10.0.0.1:6443 --token abc --discovery-token-unsafe-skip-ca-verification",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJoinCommand(tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJoinCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("parseJoinCommand() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
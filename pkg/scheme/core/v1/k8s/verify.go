@@ -0,0 +1,308 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
+	"github.com/kubeclipper/kubeclipper/pkg/logger"
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1/cni"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/cmdutil"
+	"github.com/kubeclipper/kubeclipper/pkg/utils/strutil"
+	tmplutil "github.com/kubeclipper/kubeclipper/pkg/utils/template"
+)
+
+const (
+	clusterVerifier = "clusterVerifier"
+	// verifyNamespace the namespace of the smoke test resources, it is deleted after the verification
+	verifyNamespace = "kc-verify"
+	// verifyImage the image of the smoke test pods, it provides ping and httpd
+	verifyImage = "busybox:1.36"
+	// verifyTimeout the default timeout of waiting for the smoke test pods ready
+	verifyTimeout = 3 * time.Minute
+	// verifyCleanupTimeout the timeout of deleting the smoke test resources
+	verifyCleanupTimeout = 2 * time.Minute
+	// verifyNodePortTimeout the timeout of the node port reachable, the proxy rules may be synced with a delay
+	verifyNodePortTimeout = 30 * time.Second
+)
+
+func init() {
+	component.AddAgentStep(fmt.Sprintf(component.RegisterStepKeyFormat, clusterVerifier, version, component.TypeStep), &ClusterVerifier{})
+}
+
+var _ component.StepRunnable = (*ClusterVerifier)(nil)
+
+// runKubectl run kubectl, replaced in tests
+var runKubectl = cmdutil.RunKubectlWithContext
+
+// ClusterVerifier the smoke test of the cluster networking, it deploys a client and a server pod
+// on different nodes, checks the client can ping the server pod across nodes and the server is
+// reachable by the node port service, and deletes the test resources even if the test fails.
+type ClusterVerifier struct {
+	Image string `json:"image"`
+	// ServerNode and ClientNode the hostname of the nodes the test pods are scheduled to
+	ServerNode string `json:"serverNode"`
+	ClientNode string `json:"clientNode"`
+	// NodeIP the ip of the client node, the node port is checked through it
+	NodeIP string `json:"nodeIP"`
+	// CNIStatusCmd the command of showing the cni pods, it is reported when the test fails
+	CNIStatusCmd string        `json:"cniStatusCmd"`
+	Timeout      time.Duration `json:"timeout"`
+}
+
+func (v *ClusterVerifier) NewInstance() component.ObjectMeta {
+	return &ClusterVerifier{}
+}
+
+func (v *ClusterVerifier) Install(ctx context.Context, opts component.Options) ([]byte, error) {
+	if opts.DryRun {
+		return nil, nil
+	}
+	// clean up the resources left by the last interrupted verification
+	v.cleanup(ctx)
+	defer v.cleanup(context.Background())
+
+	if err := v.apply(ctx); err != nil {
+		return nil, err
+	}
+	if err := v.verify(ctx); err != nil {
+		return nil, v.failedError(ctx, err)
+	}
+	logger.Info("cluster verification passed")
+	return nil, nil
+}
+
+func (v *ClusterVerifier) Uninstall(_ context.Context, _ component.Options) ([]byte, error) {
+	return nil, fmt.Errorf("ClusterVerifier dose not support uninstall")
+}
+
+func (v *ClusterVerifier) apply(ctx context.Context) error {
+	manifest, err := tmplutil.New().Render(verifyTemplate, v)
+	if err != nil {
+		return fmt.Errorf("render cluster verification manifest failed:%w", err)
+	}
+	f, err := os.CreateTemp("", "kc-verify-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(manifest); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if _, err = runKubectl(ctx, false, "apply", "-f", f.Name()); err != nil {
+		return fmt.Errorf("create cluster verification resources failed:%w", err)
+	}
+	return nil
+}
+
+func (v *ClusterVerifier) verify(ctx context.Context) error {
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = verifyTimeout
+	}
+	if _, err := runKubectl(ctx, false, "wait", "--for=condition=Ready", "pod", "-l", "app=kc-verify",
+		"-n", verifyNamespace, fmt.Sprintf("--timeout=%s", timeout)); err != nil {
+		return fmt.Errorf("verification pods are not ready:%w", err)
+	}
+	serverIP, err := runKubectl(ctx, false, "get", "po", "kc-verify-server", "-n", verifyNamespace, "-o", "jsonpath={.status.podIP}")
+	if err != nil {
+		return fmt.Errorf("get the ip of the server pod failed:%w", err)
+	}
+	serverIP = strings.TrimSpace(serverIP)
+	if _, err = runKubectl(ctx, false, "exec", "kc-verify-client", "-n", verifyNamespace, "--",
+		"ping", "-c", "3", "-W", "2", serverIP); err != nil {
+		return fmt.Errorf("pod %s on node %s can not ping pod %s on node %s:%w", "kc-verify-client", v.ClientNode,
+			serverIP, v.ServerNode, err)
+	}
+	logger.Infof("pod on node %s can ping the pod %s on node %s", v.ClientNode, serverIP, v.ServerNode)
+
+	nodePort, err := runKubectl(ctx, false, "get", "svc", "kc-verify", "-n", verifyNamespace, "-o", "jsonpath={.spec.ports[0].nodePort}")
+	if err != nil {
+		return fmt.Errorf("get the node port of the verification service failed:%w", err)
+	}
+	addr := "http://" + net.JoinHostPort(v.NodeIP, strings.TrimSpace(nodePort))
+	if err = waitHTTPReachable(ctx, addr, verifyNodePortTimeout); err != nil {
+		return fmt.Errorf("node port service %s is not reachable:%w", addr, err)
+	}
+	logger.Infof("node port service %s is reachable", addr)
+	return nil
+}
+
+// waitHTTPReachable wait for the http server responds ok in timeout
+func waitHTTPReachable(ctx context.Context, addr string, timeout time.Duration) error {
+	cli := &http.Client{Timeout: 3 * time.Second}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := cli.Get(addr)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// failedError wrap the cause with the status of the verification pods and the cni pods
+func (v *ClusterVerifier) failedError(ctx context.Context, cause error) error {
+	pods, err := runKubectl(ctx, false, "get", "po", "-n", verifyNamespace, "-o", "wide")
+	if err != nil {
+		pods = fmt.Sprintf("get pods failed: %v", err)
+	}
+	if v.CNIStatusCmd != "" {
+		if ec, err := cmdutil.RunCmdWithContext(ctx, false, "bash", "-c", v.CNIStatusCmd); err == nil {
+			pods += "\n" + ec.StdOut()
+		}
+	}
+	return fmt.Errorf("cluster verification failed:%w\n%s", cause, pods)
+}
+
+// cleanup delete the verification resources, the errors are only logged
+func (v *ClusterVerifier) cleanup(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, verifyCleanupTimeout)
+	defer cancel()
+	if _, err := runKubectl(ctx, false, "delete", "ns", verifyNamespace, "--ignore-not-found",
+		fmt.Sprintf("--timeout=%s", verifyCleanupTimeout)); err != nil {
+		logger.Warnf("delete cluster verification namespace %s failed: %v", verifyNamespace, err)
+	}
+}
+
+// VerifyClusterSteps the smoke test steps of the cluster networking, run on an available master.
+// The test pods are deployed on two different nodes, workers are preferred.
+func VerifyClusterSteps(metadata *component.ExtraMetadata) ([]v1.Step, error) {
+	avaMasters := metadata.Masters
+	if len(metadata.Masters) > 1 {
+		var err error
+		avaMasters, err = metadata.Masters.AvailableKubeMasters()
+		if err != nil {
+			return nil, err
+		}
+	}
+	master := utils.UnwrapNodeList(avaMasters)[0:1]
+
+	nodes := append(append(component.NodeList{}, metadata.Workers...), metadata.Masters...)
+	server, client := nodes[0], nodes[0]
+	if len(nodes) > 1 {
+		client = nodes[1]
+	}
+	verifier := &ClusterVerifier{
+		Image:      verifyImage,
+		ServerNode: server.Hostname,
+		ClientNode: client.Hostname,
+		NodeIP:     strutil.StringDefaultIfEmpty(client.IPv4, client.NodeIPv4),
+		Timeout:    verifyTimeout,
+	}
+	if metadata.LocalRegistry != "" {
+		verifier.Image = metadata.LocalRegistry + "/" + verifyImage
+	}
+	if cmds, err := cni.RecoveryCNICmd(metadata); err == nil {
+		verifier.CNIStatusCmd = cmds["get"]
+	}
+	bytes, err := json.Marshal(verifier)
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Step{
+		{
+			ID:         strutil.GetUUID(),
+			Name:       "verifyCluster",
+			Timeout:    metav1.Duration{Duration: verifyTimeout + verifyNodePortTimeout + 2*verifyCleanupTimeout},
+			ErrIgnore:  false,
+			RetryTimes: 1,
+			Nodes:      master,
+			Action:     v1.ActionInstall,
+			Commands: []v1.Command{
+				{
+					Type:          v1.CommandCustom,
+					Identity:      fmt.Sprintf(component.RegisterStepKeyFormat, clusterVerifier, version, component.TypeStep),
+					CustomCommand: bytes,
+				},
+			},
+		},
+	}, nil
+}
+
+// verifyTemplate the smoke test pods and the node port service, the pods tolerate all taints
+// so they can run on the masters of the clusters without workers.
+const verifyTemplate = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: kc-verify
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: kc-verify-server
+  namespace: kc-verify
+  labels:
+    app: kc-verify
+    role: server
+spec:
+  nodeName: {{.ServerNode}}
+  tolerations:
+    - operator: Exists
+  containers:
+    - name: server
+      image: {{.Image}}
+      command: ["sh", "-c", "mkdir -p /www && echo ok > /www/index.html && httpd -f -p 8080 -h /www"]
+      ports:
+        - containerPort: 8080
+      readinessProbe:
+        tcpSocket:
+          port: 8080
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: kc-verify-client
+  namespace: kc-verify
+  labels:
+    app: kc-verify
+    role: client
+spec:
+  nodeName: {{.ClientNode}}
+  tolerations:
+    - operator: Exists
+  containers:
+    - name: client
+      image: {{.Image}}
+      command: ["sleep", "3600"]
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: kc-verify
+  namespace: kc-verify
+spec:
+  type: NodePort
+  selector:
+    app: kc-verify
+    role: server
+  ports:
+    - port: 8080
+      targetPort: 8080
+`
@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+)
+
+func fakeVerifyKubectl(t *testing.T, fn func(args []string) (string, error)) *[]string {
+	var calls []string
+	origin := runKubectl
+	runKubectl = func(_ context.Context, _ bool, args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return fn(args)
+	}
+	t.Cleanup(func() { runKubectl = origin })
+	return &calls
+}
+
+func TestClusterVerifier_Install(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	calls := fakeVerifyKubectl(t, func(args []string) (string, error) {
+		if args[0] == "get" && args[1] == "po" {
+			return "172.25.0.10", nil
+		}
+		if args[0] == "get" && args[1] == "svc" {
+			return port, nil
+		}
+		return "", nil
+	})
+	v := &ClusterVerifier{Image: verifyImage, ServerNode: "node-1", ClientNode: "node-2", NodeIP: host}
+	if _, err := v.Install(context.TODO(), component.Options{}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	last := (*calls)[len(*calls)-1]
+	if !strings.HasPrefix(last, "delete ns kc-verify") {
+		t.Errorf("Install() want the resources deleted at last, got %s", last)
+	}
+	if !containsCall(*calls, "exec kc-verify-client -n kc-verify -- ping -c 3 -W 2 172.25.0.10") {
+		t.Errorf("Install() want the client ping the server pod, calls %v", *calls)
+	}
+}
+
+func TestClusterVerifier_Install_cleanupOnFailure(t *testing.T) {
+	calls := fakeVerifyKubectl(t, func(args []string) (string, error) {
+		switch args[0] {
+		case "exec":
+			return "", errors.New("100% packet loss")
+		case "get":
+			if args[1] == "po" && len(args) > 2 && args[2] == "-n" {
+				return "kc-verify-client   1/1   Running   0   node-2", nil
+			}
+			return "172.25.0.10", nil
+		}
+		return "", nil
+	})
+	v := &ClusterVerifier{Image: verifyImage, ServerNode: "node-1", ClientNode: "node-2", NodeIP: "127.0.0.1"}
+	_, err := v.Install(context.TODO(), component.Options{})
+	if err == nil || !strings.Contains(err.Error(), "100% packet loss") || !strings.Contains(err.Error(), "kc-verify-client   1/1") {
+		t.Fatalf("Install() want the ping error with the pods status, got %v", err)
+	}
+	last := (*calls)[len(*calls)-1]
+	if !strings.HasPrefix(last, "delete ns kc-verify") {
+		t.Errorf("Install() want the resources deleted even if failed, got %s", last)
+	}
+}
+
+func TestVerifyClusterSteps(t *testing.T) {
+	metadata := &component.ExtraMetadata{
+		Masters:       component.NodeList{{ID: "m1", IPv4: "10.0.0.1", Hostname: "master-1"}},
+		Workers:       component.NodeList{{ID: "w1", IPv4: "10.0.0.2", Hostname: "worker-1"}},
+		LocalRegistry: "10.0.0.1:5000",
+		CNI:           "calico",
+		CNINamespace:  "kube-system",
+	}
+	steps, err := VerifyClusterSteps(metadata)
+	if err != nil {
+		t.Fatalf("VerifyClusterSteps() error = %v", err)
+	}
+	if len(steps) != 1 || steps[0].Nodes[0].ID != "m1" {
+		t.Fatalf("VerifyClusterSteps() want one step on the master, got %+v", steps)
+	}
+	v := &ClusterVerifier{}
+	if err = json.Unmarshal(steps[0].Commands[0].CustomCommand, v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ServerNode != "worker-1" || v.ClientNode != "master-1" || v.NodeIP != "10.0.0.1" {
+		t.Errorf("VerifyClusterSteps() want the pods on different nodes, got %+v", v)
+	}
+	if v.Image != "10.0.0.1:5000/busybox:1.36" {
+		t.Errorf("VerifyClusterSteps() image = %s", v.Image)
+	}
+	if !strings.Contains(v.CNIStatusCmd, "kubectl get po -n kube-system") {
+		t.Errorf("VerifyClusterSteps() cni status cmd = %s", v.CNIStatusCmd)
+	}
+}
+
+func containsCall(calls []string, call string) bool {
+	for _, c := range calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
@@ -201,6 +201,17 @@ type NodeStatus struct {
 	NodeInfo NodeSystemInfo `json:"nodeInfo,omitempty"`
 	// List of volumes that are attached to the node.
 	// +optional
-	VolumesAttached      []AttachedVolume `json:"volumesAttached,omitempty"`
-	ContainerRuntimeInfo ContainerRuntime `json:"containerRuntime"`
+	VolumesAttached      []AttachedVolume     `json:"volumesAttached,omitempty"`
+	ContainerRuntimeInfo ContainerRuntimeInfo `json:"containerRuntime"`
+}
+
+// ContainerRuntimeInfo the container runtime actually running on the node, reported by the agent
+// to detect the drift from the container runtime configured for the cluster.
+type ContainerRuntimeInfo struct {
+	Type         string `json:"type,omitempty"`
+	Version      string `json:"version,omitempty"`
+	CgroupDriver string `json:"cgroupDriver,omitempty"`
+	SandboxImage string `json:"sandboxImage,omitempty"`
+	// Mirrors the hosts of each configured registry server, in the order they are tried
+	Mirrors map[string][]string `json:"mirrors,omitempty"`
 }
@@ -100,6 +100,10 @@ const (
 	OperationUninstallComponents          = "UninstallComponents"
 	OperationUpdateCertification          = "UpdateCertifications"
 	OperationUpdateAPIServerCertification = "UpdateAPIServerCertifications"
+	OperationSwitchCNI                    = "SwitchCNI"
+	OperationVerifyCluster                = "VerifyCluster"
+	OperationSyncImages                   = "SyncImages"
+	OperationRotateRegistryCredentials    = "RotateRegistryCredentials"
 )
 
 // Step TODO: add commands struct instead of string
@@ -115,6 +119,9 @@ type Step struct {
 	AfterRunCommands  []Command       `json:"afterRunCommands,omitempty"`
 	RetryTimes        int32           `json:"retryTimes,omitempty"`
 	AutomaticRetry    bool            `json:"automaticRetry"`
+	// Concurrency the max number of nodes run the step at the same time, 0 means no limit.
+	// The status of each node is reported once it is done when the concurrency is limited.
+	Concurrency int32 `json:"concurrency,omitempty"`
 }
 
 type StepNode struct {
@@ -170,6 +177,9 @@ type StepStatus struct {
 	// +optional
 	Message  string `json:"message,omitempty"`
 	Response []byte `json:"response,omitempty"`
+	// Progress the phases reported by the step on the node, e.g. "containerd config rendered"
+	// +optional
+	Progress []string `json:"progress,omitempty"`
 }
 
 type PendingOperation struct {
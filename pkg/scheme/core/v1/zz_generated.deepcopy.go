@@ -59,6 +59,22 @@ func (in *AttachedVolume) DeepCopy() *AttachedVolume {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPPeer) DeepCopyInto(out *BGPPeer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPPeer.
+func (in *BGPPeer) DeepCopy() *BGPPeer {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPPeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Backup) DeepCopyInto(out *Backup) {
 	*out = *in
@@ -217,8 +233,18 @@ func (in *CNI) DeepCopyInto(out *CNI) {
 	if in.Calico != nil {
 		in, out := &in.Calico, &out.Calico
 		*out = new(Calico)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Flannel != nil {
+		in, out := &in.Flannel, &out.Flannel
+		*out = new(Flannel)
 		**out = **in
 	}
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		*out = new(CustomCNI)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -232,6 +258,27 @@ func (in *CNI) DeepCopy() *CNI {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CRIProxy) DeepCopyInto(out *CRIProxy) {
+	*out = *in
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CRIProxy.
+func (in *CRIProxy) DeepCopy() *CRIProxy {
+	if in == nil {
+		return nil
+	}
+	out := new(CRIProxy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CRIRegistry) DeepCopyInto(out *CRIRegistry) {
 	*out = *in
@@ -253,9 +300,61 @@ func (in *CRIRegistry) DeepCopy() *CRIRegistry {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CRIRuntimeGroup) DeepCopyInto(out *CRIRuntimeGroup) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Runtimes != nil {
+		in, out := &in.Runtimes, &out.Runtimes
+		*out = make([]CRIRuntimeHandler, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CRIRuntimeGroup.
+func (in *CRIRuntimeGroup) DeepCopy() *CRIRuntimeGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(CRIRuntimeGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CRIRuntimeHandler) DeepCopyInto(out *CRIRuntimeHandler) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CRIRuntimeHandler.
+func (in *CRIRuntimeHandler) DeepCopy() *CRIRuntimeHandler {
+	if in == nil {
+		return nil
+	}
+	out := new(CRIRuntimeHandler)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Calico) DeepCopyInto(out *Calico) {
 	*out = *in
+	if in.BGPPeers != nil {
+		in, out := &in.BGPPeers, &out.BGPPeers
+		*out = make([]BGPPeer, len(*in))
+		copy(*out, *in)
+	}
+	if in.EnabledControllers != nil {
+		in, out := &in.EnabledControllers, &out.EnabledControllers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -414,7 +513,7 @@ func (in *Cluster) DeepCopyInto(out *Cluster) {
 		copy(*out, *in)
 	}
 	out.KubeProxy = in.KubeProxy
-	out.Etcd = in.Etcd
+	in.Etcd.DeepCopyInto(&out.Etcd)
 	out.Kubelet = in.Kubelet
 	in.Networking.DeepCopyInto(&out.Networking)
 	in.ContainerRuntime.DeepCopyInto(&out.ContainerRuntime)
@@ -446,6 +545,16 @@ func (in *Cluster) DeepCopyInto(out *Cluster) {
 			(*out)[key] = val
 		}
 	}
+	if in.ServiceAccountKubeConfig != nil {
+		in, out := &in.ServiceAccountKubeConfig, &out.ServiceAccountKubeConfig
+		*out = new(ServiceAccountKubeConfig)
+		**out = **in
+	}
+	if in.IgnorePreflightErrors != nil {
+		in, out := &in.IgnorePreflightErrors, &out.IgnorePreflightErrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -516,6 +625,10 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.CertificationExpiration != nil {
+		in, out := &in.CertificationExpiration, &out.CertificationExpiration
+		*out = (*in).DeepCopy()
+	}
 	if in.Registries != nil {
 		in, out := &in.Registries, &out.Registries
 		*out = make([]RegistrySpec, len(*in))
@@ -703,6 +816,19 @@ func (in *ContainerRuntime) DeepCopyInto(out *ContainerRuntime) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	out.DownloadRetryBackoff = in.DownloadRetryBackoff
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(CRIProxy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RuntimeGroups != nil {
+		in, out := &in.RuntimeGroups, &out.RuntimeGroups
+		*out = make([]CRIRuntimeGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -716,6 +842,37 @@ func (in *ContainerRuntime) DeepCopy() *ContainerRuntime {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerRuntimeInfo) DeepCopyInto(out *ContainerRuntimeInfo) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerRuntimeInfo.
+func (in *ContainerRuntimeInfo) DeepCopy() *ContainerRuntimeInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerRuntimeInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ControlPlaneHealth) DeepCopyInto(out *ControlPlaneHealth) {
 	*out = *in
@@ -841,6 +998,27 @@ func (in *CronBackupStatus) DeepCopy() *CronBackupStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomCNI) DeepCopyInto(out *CustomCNI) {
+	*out = *in
+	if in.ConfigPrefixes != nil {
+		in, out := &in.ConfigPrefixes, &out.ConfigPrefixes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomCNI.
+func (in *CustomCNI) DeepCopy() *CustomCNI {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomCNI)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DockerRegistry) DeepCopyInto(out *DockerRegistry) {
 	*out = *in
@@ -972,6 +1150,11 @@ func (in *DomainStatus) DeepCopy() *DomainStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Etcd) DeepCopyInto(out *Etcd) {
 	*out = *in
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(ExternalEtcd)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1046,6 +1229,43 @@ func (in *EventList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalEtcd) DeepCopyInto(out *ExternalEtcd) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalEtcd.
+func (in *ExternalEtcd) DeepCopy() *ExternalEtcd {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalEtcd)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Flannel) DeepCopyInto(out *Flannel) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Flannel.
+func (in *Flannel) DeepCopy() *Flannel {
+	if in == nil {
+		return nil
+	}
+	out := new(Flannel)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FsConfig) DeepCopyInto(out *FsConfig) {
 	*out = *in
@@ -1790,6 +2010,22 @@ func (in *SSH) DeepCopy() *SSH {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountKubeConfig) DeepCopyInto(out *ServiceAccountKubeConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountKubeConfig.
+func (in *ServiceAccountKubeConfig) DeepCopy() *ServiceAccountKubeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountKubeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Step) DeepCopyInto(out *Step) {
 	*out = *in
@@ -1859,6 +2095,11 @@ func (in *StepStatus) DeepCopyInto(out *StepStatus) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.Progress != nil {
+		in, out := &in.Progress, &out.Progress
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -88,7 +88,7 @@ func (ClusterStrategy) PrepareForUpdate(ctx context.Context, obj, old runtime.Ob
 }
 
 func (ClusterStrategy) Validate(ctx context.Context, obj runtime.Object) field.ErrorList {
-	return field.ErrorList{}
+	return v1.ValidateRegistrySpecs(obj.(*v1.Cluster).Status.Registries, field.NewPath("status", "registries"))
 }
 
 func (ClusterStrategy) AllowCreateOnUpdate() bool {
@@ -103,5 +103,5 @@ func (ClusterStrategy) Canonicalize(obj runtime.Object) {
 }
 
 func (ClusterStrategy) ValidateUpdate(ctx context.Context, obj, old runtime.Object) field.ErrorList {
-	return field.ErrorList{}
+	return v1.ValidateRegistrySpecs(obj.(*v1.Cluster).Status.Registries, field.NewPath("status", "registries"))
 }
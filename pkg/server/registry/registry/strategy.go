@@ -64,7 +64,7 @@ func (RegistryStrategy) PrepareForUpdate(ctx context.Context, obj, old runtime.O
 }
 
 func (RegistryStrategy) Validate(ctx context.Context, obj runtime.Object) field.ErrorList {
-	return field.ErrorList{}
+	return v1.ValidateRegistrySpec(&obj.(*v1.Registry).RegistrySpec, nil)
 }
 
 func (RegistryStrategy) AllowCreateOnUpdate() bool {
@@ -79,7 +79,7 @@ func (RegistryStrategy) Canonicalize(obj runtime.Object) {
 }
 
 func (RegistryStrategy) ValidateUpdate(ctx context.Context, obj, old runtime.Object) field.ErrorList {
-	return field.ErrorList{}
+	return v1.ValidateRegistrySpec(&obj.(*v1.Registry).RegistrySpec, nil)
 }
 
 func (RegistryStrategy) WarningsOnCreate(ctx context.Context, obj runtime.Object) []string {
@@ -310,6 +310,22 @@ func (s *Service) syncClusterCondition(op *v1.Operation, clu *v1.Cluster) error
 		}
 		_, err := s.clusterOperator.UpdateCluster(context.TODO(), clu)
 		return err
+	case v1.OperationSwitchCNI:
+		if op.Status.Status == v1.OperationStatusSuccessful {
+			clu.Status.Phase = v1.ClusterRunning
+			target := v1.CNI{}
+			if err := json.Unmarshal([]byte(op.Annotations[common.AnnotationSwitchCNI]), &target); err != nil {
+				return err
+			}
+			clu.CNI = target
+		} else {
+			clu.Status.Phase = v1.ClusterUpdateFailed
+		}
+		_, err := s.clusterOperator.UpdateCluster(context.TODO(), clu)
+		return err
+	case v1.OperationVerifyCluster, v1.OperationSyncImages:
+		// the smoke test and the image sync dose not change the cluster
+		return nil
 	case v1.OperationBackupCluster:
 		clu.Status.Phase = v1.ClusterRunning
 		_, err := s.clusterOperator.UpdateCluster(context.TODO(), clu)
@@ -322,7 +338,7 @@ func (s *Service) syncClusterCondition(op *v1.Operation, clu *v1.Cluster) error
 		}
 		_, err := s.clusterOperator.UpdateCluster(context.TODO(), clu)
 		return err
-	case v1.OperationInstallComponents, v1.OperationUninstallComponents:
+	case v1.OperationInstallComponents, v1.OperationUninstallComponents, v1.OperationRotateRegistryCredentials:
 		if op.Status.Status == v1.OperationStatusSuccessful {
 			clu.Status.Phase = v1.ClusterRunning
 		} else {
@@ -335,12 +351,13 @@ func (s *Service) syncClusterCondition(op *v1.Operation, clu *v1.Cluster) error
 	case v1.OperationUpdateCertification:
 		if op.Status.Status == v1.OperationStatusSuccessful {
 			clu.Status.Phase = v1.ClusterRunning
-			var err error
-			clu.Status.Certifications, err = (&controller.ClusterStatusMon{
+			certs, err := (&controller.ClusterStatusMon{
 				CmdDelivery: s,
 			}).GetCertificationFromKC(clu)
 			if err != nil {
 				logger.Errorf("update expiration error after update certs: %s", err.Error())
+			} else {
+				clu.Status.SetCertifications(certs)
 			}
 		} else {
 			clu.Status.Phase = v1.ClusterUpdateFailed
@@ -542,7 +559,10 @@ func (s *Service) DeliverStep(ctx context.Context, step *v1.Step, opts *service.
 
 	for _, node := range step.Nodes {
 		wg.Add(1)
-		go s.deliveryStepToNode(wg, node.ID, payloadBytes, step.Timeout.Duration+2*time.Second, status, errChan)
+		go func(node string) {
+			defer wg.Done()
+			s.deliveryStepToNode(node, payloadBytes, step.Timeout.Duration+2*time.Second, status, errChan)
+		}(node.ID)
 	}
 
 	wg.Wait()
@@ -589,6 +609,7 @@ func (s *Service) deliveryTaskStep(ctx context.Context, opName string, step *v1.
 	status := make([]v1.StepStatus, len(step.Nodes))
 	cond.Status = status
 	cond.StepID = step.ID
+	progress := newStepProgress(len(status))
 	// opCond := v1.OperationCondition{
 	//	StepID: step.ID,
 	//	Status: status,
@@ -600,7 +621,7 @@ func (s *Service) deliveryTaskStep(ctx context.Context, opName string, step *v1.
 				// operation timeout
 				s.sendStepStatusToChannel(stepStatus{
 					OperationIdentity:  op,
-					OperationCondition: *cond,
+					OperationCondition: progress.unreported(cond),
 					DryRun:             dryRun,
 				})
 				return
@@ -609,7 +630,7 @@ func (s *Service) deliveryTaskStep(ctx context.Context, opName string, step *v1.
 				logger.Debug("in step done cond", zap.Any("condition", *cond))
 				s.sendStepStatusToChannel(stepStatus{
 					OperationIdentity:  op,
-					OperationCondition: *cond,
+					OperationCondition: progress.unreported(cond),
 					DryRun:             dryRun,
 				})
 				return
@@ -622,11 +643,46 @@ func (s *Service) deliveryTaskStep(ctx context.Context, opName string, step *v1.
 	errChan := make(chan error, len(step.Nodes))
 	defer close(errChan)
 
+	// limit the nodes run the step at the same time, e.g. loading the large offline images
+	var sem chan struct{}
+	if step.Concurrency > 0 {
+		sem = make(chan struct{}, step.Concurrency)
+	}
 	for i, node := range step.Nodes {
 		wg.Add(1)
-		// notice: make sure step timeout less than operation timeout
-		// TODO: add step retry
-		go s.deliveryStepToNode(&wg, node.ID, payloadBytes, step.Timeout.Duration+2*time.Second, &status[i], errChan)
+		go func(i int, node string) {
+			defer wg.Done()
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx.Done():
+					status[i].Node = node
+					setStepStatus(&status[i], v1.StepStatusFailed, "run step canceled", ctx.Err().Error(), nil)
+					errChan <- ctx.Err()
+					return
+				}
+			}
+			// notice: make sure step timeout less than operation timeout
+			// TODO: add step retry
+			s.deliveryStepToNode(node, payloadBytes, step.Timeout.Duration+2*time.Second, &status[i], errChan)
+			if sem == nil {
+				return
+			}
+			// report the node status once it is done, so the progress of the long-running step is visible
+			done, total := progress.report(i)
+			logger.Info("step progress", zap.String("op", opName), zap.String("step", step.Name),
+				zap.String("node", node), zap.String("status", string(status[i].Status)),
+				zap.Int("done", done), zap.Int("total", total))
+			s.sendStepStatusToChannel(stepStatus{
+				OperationIdentity: opName,
+				OperationCondition: v1.OperationCondition{
+					StepID: step.ID,
+					Status: []v1.StepStatus{status[i]},
+				},
+				DryRun: dryRun,
+			})
+		}(i, node.ID)
 	}
 
 	wg.Wait()
@@ -640,9 +696,7 @@ func (s *Service) deliveryTaskStep(ctx context.Context, opName string, step *v1.
 	return nil
 }
 
-func (s *Service) deliveryStepToNode(wg *sync.WaitGroup, node string, payload []byte, timeout time.Duration, stepStatus *v1.StepStatus, errChan chan error) {
-	defer wg.Done()
-
+func (s *Service) deliveryStepToNode(node string, payload []byte, timeout time.Duration, stepStatus *v1.StepStatus, errChan chan error) {
 	now := time.Now()
 	stepStatus.StartAt = metav1.NewTime(now)
 	stepStatus.Node = node
@@ -671,6 +725,7 @@ func (s *Service) deliveryStepToNode(wg *sync.WaitGroup, node string, payload []
 		errChan <- err
 		return
 	}
+	stepStatus.Progress = resp.Progress
 	if resp.Error != nil {
 		setStepStatus(stepStatus, v1.StepStatusFailed, resp.Error.Message, resp.Error.Error(), nil)
 		errChan <- resp.Error
@@ -679,6 +734,45 @@ func (s *Service) deliveryStepToNode(wg *sync.WaitGroup, node string, payload []
 	setStepStatus(stepStatus, v1.StepStatusSuccessful, "run step successfully", "run step successfully", resp.Data)
 }
 
+// stepProgress tracks the node status already reported of a step,
+// so the status of each node is reported to the operation only once.
+type stepProgress struct {
+	mu       sync.Mutex
+	reported []bool
+	done     int
+}
+
+func newStepProgress(nodes int) *stepProgress {
+	return &stepProgress{reported: make([]bool, nodes)}
+}
+
+// report mark the status of node i reported, returns the number of done nodes and all nodes
+func (p *stepProgress) report(i int) (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.reported[i] {
+		p.reported[i] = true
+		p.done++
+	}
+	return p.done, len(p.reported)
+}
+
+// unreported returns the condition with the node status not reported yet
+func (p *stepProgress) unreported(cond *v1.OperationCondition) v1.OperationCondition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == 0 {
+		return *cond
+	}
+	c := v1.OperationCondition{StepID: cond.StepID}
+	for i, reported := range p.reported {
+		if !reported {
+			c.Status = append(c.Status, cond.Status[i])
+		}
+	}
+	return c
+}
+
 func setStepStatus(status *v1.StepStatus, statusType v1.StepStatusType, message, reason string, response []byte) {
 	status.Status = statusType
 	status.Message = message
@@ -0,0 +1,112 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
+	"github.com/kubeclipper/kubeclipper/pkg/service"
+	"github.com/kubeclipper/kubeclipper/pkg/simple/client/natsio"
+	mock_natsio "github.com/kubeclipper/kubeclipper/pkg/simple/client/natsio/mock"
+)
+
+func TestService_deliveryTaskStep_concurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_natsio.NewMockInterface(ctrl)
+	s := &Service{client: client, subjectSuffix: "agent", stepStatusChan: make(chan stepStatus, 16)}
+
+	var running, maxRunning int32
+	client.EXPECT().Request(gomock.Any(), gomock.Any()).DoAndReturn(func(msg *natsio.Msg, _ natsio.TimeoutHandler) ([]byte, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		node := strings.TrimSuffix(msg.Subject, ".agent")
+		return json.Marshal(service.CommonReply{Progress: []string{"images loaded on " + node}})
+	}).Times(3)
+
+	step := &v1.Step{
+		ID:          "step1",
+		Name:        "loadImage",
+		Nodes:       []v1.StepNode{{ID: "n1"}, {ID: "n2"}, {ID: "n3"}},
+		Timeout:     metav1.Duration{Duration: time.Second},
+		Concurrency: 2,
+	}
+	cond := &v1.OperationCondition{}
+	if err := s.deliveryTaskStep(context.TODO(), "op1", step, nil, cond, false); err != nil {
+		t.Fatalf("deliveryTaskStep() error = %v", err)
+	}
+	if maxRunning > step.Concurrency {
+		t.Errorf("deliveryTaskStep() ran %d nodes at the same time, want at most %d", maxRunning, step.Concurrency)
+	}
+	for i, status := range cond.Status {
+		node := step.Nodes[i].ID
+		if status.Node != node || status.Status != v1.StepStatusSuccessful {
+			t.Errorf("deliveryTaskStep() status of %s = %s %s", node, status.Node, status.Status)
+		}
+		if want := []string{"images loaded on " + node}; fmt.Sprint(status.Progress) != fmt.Sprint(want) {
+			t.Errorf("deliveryTaskStep() progress of %s = %v, want %v", node, status.Progress, want)
+		}
+	}
+
+	// each node is reported once it is done, the final report has no node left
+	reported := map[string]int{}
+	for i := 0; i < len(step.Nodes)+1; i++ {
+		select {
+		case st := <-s.stepStatusChan:
+			for _, status := range st.OperationCondition.Status {
+				reported[status.Node]++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("deliveryTaskStep() got %d status reports, want %d", i, len(step.Nodes)+1)
+		}
+	}
+	for _, node := range step.Nodes {
+		if reported[node.ID] != 1 {
+			t.Errorf("deliveryTaskStep() reported %s %d times, want once", node.ID, reported[node.ID])
+		}
+	}
+}
+
+func TestService_deliveryTaskStep_nodeError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_natsio.NewMockInterface(ctrl)
+	s := &Service{client: client, subjectSuffix: "agent", stepStatusChan: make(chan stepStatus, 16)}
+
+	client.EXPECT().Request(gomock.Any(), gomock.Any()).DoAndReturn(func(msg *natsio.Msg, _ natsio.TimeoutHandler) ([]byte, error) {
+		if msg.Subject == "n2.agent" {
+			return nil, fmt.Errorf("no responders")
+		}
+		return json.Marshal(service.CommonReply{})
+	}).Times(2)
+
+	step := &v1.Step{
+		ID:          "step1",
+		Name:        "loadImage",
+		Nodes:       []v1.StepNode{{ID: "n1"}, {ID: "n2"}},
+		Timeout:     metav1.Duration{Duration: time.Second},
+		Concurrency: 1,
+	}
+	cond := &v1.OperationCondition{}
+	if err := s.deliveryTaskStep(context.TODO(), "op1", step, nil, cond, false); err == nil {
+		t.Fatal("deliveryTaskStep() want the error of node n2")
+	}
+	if cond.Status[0].Status != v1.StepStatusSuccessful || cond.Status[1].Status != v1.StepStatusFailed {
+		t.Errorf("deliveryTaskStep() status = %s, %s, want successful, failed", cond.Status[0].Status, cond.Status[1].Status)
+	}
+}
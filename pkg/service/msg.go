@@ -62,6 +62,8 @@ type NodeStatusPayload struct {
 type CommonReply struct {
 	Error *errors.StatusError `json:"error,omitempty"`
 	Data  []byte              `json:"data,omitempty"`
+	// Progress the phases reported by the custom commands of the step
+	Progress []string `json:"progress,omitempty"`
 }
 
 type MsgPayload struct {
@@ -22,6 +22,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -30,6 +31,7 @@ import (
 	"github.com/kubeclipper/kubeclipper/pkg/oplog"
 
 	"github.com/kubeclipper/kubeclipper/pkg/component"
+	"github.com/kubeclipper/kubeclipper/pkg/component/utils"
 	"github.com/kubeclipper/kubeclipper/pkg/errors"
 	"github.com/kubeclipper/kubeclipper/pkg/logger"
 	v1 "github.com/kubeclipper/kubeclipper/pkg/scheme/core/v1"
@@ -42,8 +44,11 @@ func (s *Service) runTaskStep(ctx context.Context, payload *service.MsgPayload,
 	stepKey := fmt.Sprintf("%s-%s", payload.Step.ID, payload.Step.Name)
 	ctx = component.WithOperationID(ctx, payload.OperationIdentity) // put operation ID into context
 	ctx = component.WithStepID(ctx, stepKey)                        // put step ID into context
+	ctx = component.WithNodeID(ctx, s.AgentID)                      // put node ID into context
 	ctx = component.WithOplog(ctx, s.oplog)                         // put operation log object into context
 	ctx = component.WithRepoMirror(ctx, s.repoMirror)
+	ctx = component.WithPackageMirror(ctx, s.packageMirror)
+	ctx = component.WithImagePullJitter(ctx, utils.NodeJitter(s.AgentID, s.imagePullJitter))
 
 	var entry string
 	// truncate step log file
@@ -105,9 +110,12 @@ func (s *Service) runTaskStep(ctx context.Context, payload *service.MsgPayload,
 func (s *Service) runStep(ctx context.Context, payload *service.MsgPayload, subject string) ([]byte, *errors.StatusError) {
 	// stepKey to distinguish which step the log file belongs to
 	stepKey := fmt.Sprintf("%s-%s", payload.Step.ID, payload.Step.Name)
-	ctx = component.WithStepID(ctx, stepKey) // put step ID into context
-	ctx = component.WithOplog(ctx, s.oplog)  // put operation log object into context
+	ctx = component.WithStepID(ctx, stepKey)   // put step ID into context
+	ctx = component.WithNodeID(ctx, s.AgentID) // put node ID into context
+	ctx = component.WithOplog(ctx, s.oplog)    // put operation log object into context
 	ctx = component.WithRepoMirror(ctx, s.repoMirror)
+	ctx = component.WithPackageMirror(ctx, s.packageMirror)
+	ctx = component.WithImagePullJitter(ctx, utils.NodeJitter(s.AgentID, s.imagePullJitter))
 
 	cmds := make([]v1.Command, len(payload.Step.BeforeRunCommands)+len(payload.Step.Commands)+len(payload.Step.AfterRunCommands))
 	cmds = append(cmds, payload.Step.BeforeRunCommands...)
@@ -200,33 +208,43 @@ func (s *Service) taskHandler(msg *nats.Msg) {
 			return
 		}
 	case service.OperationRunTask:
-		var replyData []byte
+		var (
+			replyData []byte
+			progress  *stepProgress
+		)
 		for i := 0; i <= int(payload.Step.RetryTimes); i++ {
 			// reset retry field
 			if i > 0 {
 				payload.Retry = true
 			}
-			replyData, statusError = s.runTaskStep(ctx, payload, msg.Subject)
+			// only the phases of the last run are replied
+			progress = &stepProgress{}
+			replyData, statusError = s.runTaskStep(withStepProgress(ctx, progress), payload, msg.Subject)
 			if statusError == nil {
 				break
 			}
 			logger.Debug("run task step failed", zap.String("step", payload.Step.Name), zap.Int("retry", i), zap.Int32("maxRetry", payload.Step.RetryTimes))
 		}
-		responseMessage(msg, replyData, statusError)
+		responseMessage(msg, replyData, statusError, progress.list()...)
 	case service.OperationRunStep:
-		var replyData []byte
+		var (
+			replyData []byte
+			progress  *stepProgress
+		)
 		for i := 0; i <= int(payload.Step.RetryTimes); i++ {
 			// reset retry field
 			if i > 0 {
 				payload.Retry = true
 			}
-			replyData, statusError = s.runStep(ctx, payload, msg.Subject)
+			// only the phases of the last run are replied
+			progress = &stepProgress{}
+			replyData, statusError = s.runStep(withStepProgress(ctx, progress), payload, msg.Subject)
 			if statusError == nil {
 				break
 			}
 			logger.Debug("run step failed", zap.String("step", payload.Step.Name), zap.Int("retry", i), zap.Int32("maxRetry", payload.Step.RetryTimes))
 		}
-		responseMessage(msg, replyData, statusError)
+		responseMessage(msg, replyData, statusError, progress.list()...)
 	default:
 		responseMessage(msg, nil, &errors.StatusError{
 			Message: "unknown operation",
@@ -292,15 +310,30 @@ func runCustomCommand(ctx context.Context, step *v1.Step, identity string, custo
 		data   []byte
 		err    error
 		errMsg = "run custom command error"
+		opts   = component.Options{DryRun: dryRun, Progress: progressFunc(ctx)}
 	)
-	if step.Action == v1.ActionInstall {
-		if data, err = newImpl.Install(ctx, component.Options{DryRun: dryRun}); err != nil {
+	switch step.Action {
+	case v1.ActionInstall:
+		if data, err = newImpl.Install(ctx, opts); err != nil {
 			logger.Error("custom step run error", zap.Error(err))
 			return nil, doStatusError(errMsg, "run custom command for installation error",
 				errors.AgentStepInstall, 500, err)
 		}
-	} else {
-		if data, err = newImpl.Uninstall(ctx, component.Options{DryRun: dryRun}); err != nil {
+	case v1.ActionUpgrade:
+		upgrader, ok := agentStepMeta.(component.Upgradable)
+		if !ok {
+			err = fmt.Errorf("custom agent step %s dose not support upgrade", identity)
+			logger.Error("custom step run error", zap.Error(err))
+			return nil, doStatusError(errMsg, "run custom command for upgrade error",
+				errors.AgentStepUpgrade, 500, err)
+		}
+		if data, err = upgrader.Upgrade(ctx, opts); err != nil {
+			logger.Error("custom step run error", zap.Error(err))
+			return nil, doStatusError(errMsg, "run custom command for upgrade error",
+				errors.AgentStepUpgrade, 500, err)
+		}
+	default:
+		if data, err = newImpl.Uninstall(ctx, opts); err != nil {
 			logger.Error("custom step run error", zap.Error(err))
 			return nil, doStatusError(errMsg, "run custom command for uninstallation error",
 				errors.AgentStepUninstall, 500, err)
@@ -309,10 +342,54 @@ func runCustomCommand(ctx context.Context, step *v1.Step, identity string, custo
 	return data, nil
 }
 
-func responseMessage(msg *nats.Msg, data []byte, error *errors.StatusError) {
+// stepProgress the phases reported by the custom commands of a step,
+// they are replied to the server and shown in the step status of the operation.
+type stepProgress struct {
+	mu     sync.Mutex
+	phases []string
+}
+
+func (p *stepProgress) add(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phases = append(p.phases, phase)
+}
+
+func (p *stepProgress) list() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.phases...)
+}
+
+type stepProgressKey struct{}
+
+func withStepProgress(ctx context.Context, p *stepProgress) context.Context {
+	return context.WithValue(ctx, stepProgressKey{}, p)
+}
+
+// progressFunc appends the phases of the custom step to the step log, so they are shown with the step output,
+// and records them for the reply of the step.
+func progressFunc(ctx context.Context) component.ProgressFunc {
+	p, _ := ctx.Value(stepProgressKey{}).(*stepProgress)
+	return func(phase string) {
+		if p != nil {
+			p.add(phase)
+		}
+		ln := fmt.Sprintf("[%s] # %s\n\n", time.Now().Format(time.RFC3339), phase)
+		if _, err := cmdutil.CheckContextAndAppendStepLogFile(ctx, []byte(ln)); err != nil {
+			logger.Debug("append step progress to log failed", zap.String("phase", phase), zap.Error(err))
+		}
+	}
+}
+
+func responseMessage(msg *nats.Msg, data []byte, error *errors.StatusError, progress ...string) {
 	reply := service.CommonReply{
-		Error: error,
-		Data:  data,
+		Error:    error,
+		Data:     data,
+		Progress: progress,
 	}
 	replyBytes, err := json.Marshal(reply)
 	if err != nil {
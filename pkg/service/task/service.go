@@ -100,6 +100,10 @@ type Service struct {
 	oplog       component.OperationLogFile
 	backupStore bs.BackupStore
 	repoMirror  string
+	// packageMirror the base url of the online packages, the cloud static server is used if it is empty.
+	packageMirror string
+	// imagePullJitter the max delay before pulling images, the actual delay is derived from agent id.
+	imagePullJitter time.Duration
 }
 
 type ServiceOption func(*Service)
@@ -128,6 +132,18 @@ func WithRepoMirror(mirror string) ServiceOption {
 	}
 }
 
+func WithPackageMirror(mirror string) ServiceOption {
+	return func(s *Service) {
+		s.packageMirror = mirror
+	}
+}
+
+func WithImagePullJitter(max time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.imagePullJitter = max
+	}
+}
+
 func WithLeaseDurationSeconds(seconds int32) ServiceOption {
 	return func(s *Service) {
 		s.leaseDurationSeconds = seconds
@@ -210,6 +226,7 @@ func (s *Service) defaultNodeStatusFuncs() []func(*v1.Node) error {
 		nodestatus.Metadata(),
 		nodestatus.NodeAddress(s.IPDetect, s.NodeIPDetect),
 		nodestatus.MachineInfo(),
+		nodestatus.ContainerRuntimeInfo(),
 		nodestatus.ReadyCondition(s.clock.Now, TODO, TODO, TODO))
 
 	return setters
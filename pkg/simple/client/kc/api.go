@@ -222,7 +222,11 @@ func (cli *Client) Version(ctx context.Context) (*apimachineryversion.Info, erro
 }
 
 func (cli *Client) CreateCluster(ctx context.Context, cluster *v1.Cluster) (*ClustersList, error) {
-	serverResp, err := cli.post(ctx, clustersPath, nil, cluster, nil)
+	return cli.CreateClusterWithQuery(ctx, cluster, nil)
+}
+
+func (cli *Client) CreateClusterWithQuery(ctx context.Context, cluster *v1.Cluster, queryString url.Values) (*ClustersList, error) {
+	serverResp, err := cli.post(ctx, clustersPath, queryString, cluster, nil)
 	defer ensureReaderClosed(serverResp)
 	if err != nil {
 		return nil, err
@@ -20,6 +20,8 @@ package downloader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -47,6 +49,12 @@ const (
 	ChartFilename    = "charts.tgz"
 )
 
+const (
+	// DefaultRetryBackoff the wait before the first retry of a failed download
+	DefaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
 var options *Options
 
 // SetOptions set downloader options
@@ -63,7 +71,15 @@ type Downloader struct {
 	manifestDir string
 	// the default directory to the config manifest file, e.g. /opt/kc/manifest/k8s/v1.23.3/amd64/config
 	cManifestDir string
-	dryRun       bool
+	// configsSHA256 the expected sha256 digest of configs.tar.gz, the digest of the manifest is used if it is empty
+	configsSHA256 string
+	// retries the times of retrying a failed file download, the wait between the retries starts
+	// from retryBackoff and is doubled after each retry up to maxRetryBackoff.
+	retries      int
+	retryBackoff time.Duration
+	// progress receives the files downloaded without an expected sha256 digest, it may be nil
+	progress component.ProgressFunc
+	dryRun   bool
 	// enable remote download
 	// online bool
 	// inherits the component context
@@ -76,7 +92,7 @@ func NewInstance(ctx context.Context, name, version, arch string, online, dryRun
 	}
 	var baseURI, dstDir, manifestDir, cManifestDir string
 	if online {
-		baseURI = CloudStaticServer
+		baseURI = onlineBaseURI(ctx)
 	} else {
 		baseURI = options.Address
 	}
@@ -99,6 +115,39 @@ func NewInstance(ctx context.Context, name, version, arch string, online, dryRun
 	}, nil
 }
 
+// onlineBaseURI the package mirror of the context is preferred to the cloud static server,
+// so the online downloads can be routed through a proxy.
+func onlineBaseURI(ctx context.Context) string {
+	if mirror := component.GetPackageMirror(ctx); mirror != "" {
+		return strings.TrimRight(mirror, "/")
+	}
+	return CloudStaticServer
+}
+
+// WithConfigsSHA256 verify the sha256 digest of the downloaded config file before it is used,
+// so a bundle corrupted during the offline transfer is caught early.
+func (dl *Downloader) WithConfigsSHA256(digest string) *Downloader {
+	dl.configsSHA256 = digest
+	return dl
+}
+
+// WithProgress report the files which are not verified by sha256 to the progress of the step
+func (dl *Downloader) WithProgress(progress component.ProgressFunc) *Downloader {
+	dl.progress = progress
+	return dl
+}
+
+// WithRetry retry the failed file download at most retries times with exponential backoff,
+// the retry stops once the context is canceled. DefaultRetryBackoff is used if backoff is not positive.
+func (dl *Downloader) WithRetry(retries int, backoff time.Duration) *Downloader {
+	dl.retries = retries
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	dl.retryBackoff = backoff
+	return dl
+}
+
 // DownloadConfigs download config file
 func (dl *Downloader) DownloadConfigs() (string, error) {
 	return filepath.Join(dl.dstDir, ConfigFilename), dl.Download(ConfigFilename)
@@ -248,10 +297,63 @@ func (dl *Downloader) Download(fileList ...string) (err error) {
 		logger.Errorf("check %v digest failed: %v", files, err)
 		return
 	}
+	if err = dl.validateSHA256Digest(mElements, files); err != nil {
+		logger.Errorf("check %v sha256 digest failed: %v", files, err)
+		return
+	}
 	logger.Debugf("download %v package successfully", files)
 	return
 }
 
+// VerifySHA256 check the sha256 digest of file, the expected digest is hex encoded
+// with an optional "sha256:" prefix.
+func VerifySHA256(file, expected string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return fmt.Errorf("compute sha256 of %s failed:%w", file, err)
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if want := strings.ToLower(strings.TrimPrefix(expected, "sha256:")); actual != want {
+		return fmt.Errorf("sha256 of %s mismatch, expect %s but got %s, the file may be corrupted", file, want, actual)
+	}
+	return nil
+}
+
+// validateSHA256Digest validates the sha256 digest of the files, the digest given by WithConfigsSHA256 takes
+// precedence over the one recorded in the per version and arch manifest for the config file. The files without
+// an expected digest are only checked by md5, they are reported by the progress of the step.
+// files param: the value must be an absolute path
+func (dl *Downloader) validateSHA256Digest(manifest []ManifestElement, files []string) error {
+	for _, file := range files {
+		name := filepath.Base(file)
+		expected := ""
+		if name == ConfigFilename {
+			expected = dl.configsSHA256
+		}
+		for _, v := range manifest {
+			if expected == "" && v.Name == name {
+				expected = v.SHA256
+			}
+		}
+		if expected == "" {
+			logger.Warnf("no sha256 digest is provided for %s, it is not verified", file)
+			if dl.progress != nil {
+				dl.progress(fmt.Sprintf("sha256 of %s not verified, no digest provided", name))
+			}
+			continue
+		}
+		if err := VerifySHA256(file, expected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // validateMd5Digest validates md5 digest of file list
 // files param: the value must be an absolute path
 func (dl *Downloader) validateMd5Digest(manifest []ManifestElement, files []string) (err error) {
@@ -302,18 +404,51 @@ func (dl *Downloader) getManifestElements(prefix string) (manifest []ManifestEle
 	return
 }
 
-// DownloadFile download the file to the specified directory
+// DownloadFile download the file from baseURI to dstDir, the failed download is retried as configured by WithRetry.
 func (dl *Downloader) DownloadFile(dstDir, filename string) (err error) {
+	backoff := dl.retryBackoff
+	for attempt := 0; ; attempt++ {
+		if err = dl.downloadFile(dstDir, filename); err == nil || attempt >= dl.retries {
+			return err
+		}
+		logger.Warn("download file failed, retry later",
+			zap.String("file", filename),
+			zap.Int("attempt", attempt+1),
+			zap.Int("retries", dl.retries),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-dl.context().Done():
+			return fmt.Errorf("download %s canceled after %d attempts: %w", filename, attempt+1, err)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+func (dl *Downloader) context() context.Context {
+	if dl.ctx == nil {
+		return context.Background()
+	}
+	return dl.ctx
+}
+
+func (dl *Downloader) downloadFile(dstDir, filename string) (err error) {
 	prefix := fmt.Sprintf("backsource.%d-%.3f.", os.Getpid(), float64(time.Now().UnixNano())/float64(time.Second))
 	dstFile := path.Join(dstDir, filename)
 	file, err := os.CreateTemp(filepath.Dir(dstFile), prefix)
 	if err != nil {
 		return fmt.Errorf("create temp file failed: %v", err)
 	}
+	// the temp file of a failed attempt is removed, so the retries do not leave it behind
+	defer os.Remove(file.Name())
 	defer file.Close()
 	fullURL := fmt.Sprintf("%s/%s", dl.baseURI, filename)
 	logger.Debug("start to download file", zap.String("download from", fullURL))
-	resp, err := httpGet(fullURL, 0)
+	resp, err := httpGet(dl.context(), fullURL, 0)
 	if err != nil {
 		return fmt.Errorf("download failed: %v", err)
 	}
@@ -354,17 +489,40 @@ func (dl *Downloader) DownloadFile(dstDir, filename string) (err error) {
 	return fileutil.MoveFile(file.Name(), dstFile)
 }
 
-func httpGet(url string, timeout time.Duration) (resp *http.Response, err error) {
+// DownloadURL download the file from an arbitrary url to dstFile, e.g. the user supplied manifest
+func DownloadURL(url, dstFile string, timeout time.Duration) error {
+	file, err := os.CreateTemp(filepath.Dir(dstFile), "."+filepath.Base(dstFile)+".download-*")
+	if err != nil {
+		return fmt.Errorf("create temp file failed: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	logger.Debug("start to download file", zap.String("download from", url))
+	resp, err := httpGet(context.Background(), url, timeout)
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("failed to download from %s, response code: %d", url, resp.StatusCode)
+	}
+	if _, err = io.Copy(file, resp.Body); err != nil {
+		return fmt.Errorf("copy download content error: %v", err)
+	}
+	return fileutil.MoveFile(file.Name(), dstFile)
+}
+
+func httpGet(ctx context.Context, url string, timeout time.Duration) (resp *http.Response, err error) {
 	var (
 		cancel func()
 		client = &http.Client{}
 	)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return
 	}
 	if timeout > 0 {
-		timeoutCtx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+		timeoutCtx, cancelFunc := context.WithTimeout(ctx, timeout)
 		req = req.WithContext(timeoutCtx)
 		cancel = cancelFunc
 	}
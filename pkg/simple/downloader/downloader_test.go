@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubeclipper/kubeclipper/pkg/component"
+)
+
+func TestVerifySHA256(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ConfigFilename)
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// sha256 of "hello"
+	digest := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	for _, expected := range []string{digest, "sha256:" + digest, strings.ToUpper(digest)} {
+		if err := VerifySHA256(file, expected); err != nil {
+			t.Errorf("VerifySHA256(%s) unexpected error = %v", expected, err)
+		}
+	}
+
+	err := VerifySHA256(file, strings.Repeat("0", 64))
+	if err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Errorf("VerifySHA256() expect mismatch error, got %v", err)
+	}
+	if err = VerifySHA256(filepath.Join(t.TempDir(), "missing"), digest); err == nil {
+		t.Errorf("VerifySHA256() expect error of missing file")
+	}
+}
+
+func Test_validateSHA256Digest(t *testing.T) {
+	dir := t.TempDir()
+	configs, images := filepath.Join(dir, ConfigFilename), filepath.Join(dir, ImageFilename)
+	for _, f := range []string{configs, images} {
+		if err := os.WriteFile(f, []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// sha256 of "hello", the images have no sha256 in the manifest and are reported unverified
+	hello := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	manifest := []ManifestElement{
+		{Name: ConfigFilename, SHA256: hello},
+		{Name: ImageFilename},
+	}
+	var unverified []string
+	dl := (&Downloader{}).WithProgress(func(phase string) { unverified = append(unverified, phase) })
+	if err := dl.validateSHA256Digest(manifest, []string{configs, images}); err != nil {
+		t.Errorf("validateSHA256Digest() unexpected error = %v", err)
+	}
+	if len(unverified) != 1 || !strings.Contains(unverified[0], ImageFilename) {
+		t.Errorf("validateSHA256Digest() want the images reported unverified, got %v", unverified)
+	}
+	// the digest of the bundle of another arch
+	manifest[0].SHA256 = strings.Repeat("0", 64)
+	if err := dl.validateSHA256Digest(manifest, []string{configs}); err == nil {
+		t.Errorf("validateSHA256Digest() expect mismatch error")
+	}
+	// the digest of the step takes precedence over the manifest
+	if err := dl.WithConfigsSHA256(hello).validateSHA256Digest(manifest, []string{configs}); err != nil {
+		t.Errorf("validateSHA256Digest() unexpected error = %v", err)
+	}
+}
+
+func TestOnlineBaseURI(t *testing.T) {
+	if got := onlineBaseURI(context.TODO()); got != CloudStaticServer {
+		t.Errorf("onlineBaseURI() = %s, want the cloud static server %s", got, CloudStaticServer)
+	}
+	ctx := component.WithPackageMirror(context.TODO(), "http://mirror.example.com/packages/")
+	if got := onlineBaseURI(ctx); got != "http://mirror.example.com/packages" {
+		t.Errorf("onlineBaseURI() = %s, want the package mirror", got)
+	}
+}
+
+func TestDownloader_DownloadFile_retry(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dl := (&Downloader{ctx: context.TODO(), baseURI: srv.URL}).WithRetry(1, time.Millisecond)
+	if err := dl.DownloadFile(dir, ConfigFilename); err == nil {
+		t.Fatalf("DownloadFile() expect error after 2 attempts")
+	}
+	dl.WithRetry(2, time.Millisecond)
+	if err := dl.DownloadFile(dir, ConfigFilename); err != nil {
+		t.Fatalf("DownloadFile() unexpected error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ConfigFilename))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("DownloadFile() got %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("DownloadFile() expect the temp files removed, got %d entries", len(entries))
+	}
+}
+
+func TestDownloader_DownloadFile_canceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	dl := (&Downloader{ctx: ctx, baseURI: srv.URL}).WithRetry(5, time.Hour)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := dl.DownloadFile(t.TempDir(), ConfigFilename)
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("DownloadFile() expect canceled error, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("DownloadFile() expect stop retrying promptly after canceled")
+	}
+}
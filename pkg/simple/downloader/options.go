@@ -36,4 +36,6 @@ type ManifestElement struct {
 	Name   string `json:"name"`
 	Digest string `json:"digest"`
 	Path   string `json:"path"`
+	// SHA256 the optional sha256 digest of the file, it is verified in addition to the md5 digest
+	SHA256 string `json:"sha256,omitempty"`
 }
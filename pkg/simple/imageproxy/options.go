@@ -9,6 +9,8 @@ import (
 
 type Options struct {
 	KcImageRepoMirror string `json:"kcImageRepoMirror" yaml:"kcImageRepoMirror"`
+	// KcPackageMirror the base url which the online packages, e.g. the containerd binary, are downloaded from
+	KcPackageMirror string `json:"kcPackageMirror" yaml:"kcPackageMirror"`
 }
 
 func NewOptions() *Options {
@@ -27,9 +29,18 @@ func (s *Options) Validate() []error {
 	if uri.Scheme != "" {
 		errs = append(errs, fmt.Errorf("kc image repo mirror is not support incoming protcol: %s", uri.Scheme))
 	}
+	if s.KcPackageMirror != "" {
+		pkgURI, err := url.Parse(s.KcPackageMirror)
+		if err != nil {
+			errs = append(errs, err)
+		} else if pkgURI.Scheme != "http" && pkgURI.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("kc package mirror must be a http or https url: %s", s.KcPackageMirror))
+		}
+	}
 	return errs
 }
 
 func (s *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.KcImageRepoMirror, "kc-image-repo-mirror", s.KcImageRepoMirror, "K8s image repository mirror")
+	fs.StringVar(&s.KcPackageMirror, "kc-package-mirror", s.KcPackageMirror, "Online package download mirror base url")
 }
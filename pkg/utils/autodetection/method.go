@@ -35,6 +35,9 @@ const (
 	MethodInterface = "interface="
 	MethodCidr      = "cidr="
 	MethodCanReach  = "can-reach="
+	// MethodSkipInterface and MethodKubernetesIP are supported by calico only
+	MethodSkipInterface = "skip-interface="
+	MethodKubernetesIP  = "kubernetes-internal-ip"
 )
 
 const (
@@ -51,11 +54,12 @@ func CheckMethod(method string) bool {
 }
 
 func CheckCalicoMethod(method string) bool {
-	if method == "" || method == MethodFirst {
+	if method == "" || method == MethodFirst || method == MethodKubernetesIP {
 		return true
 	}
 
-	return strings.HasPrefix(method, MethodInterface) || strings.HasPrefix(method, MethodCanReach)
+	return strings.HasPrefix(method, MethodInterface) || strings.HasPrefix(method, MethodCanReach) ||
+		strings.HasPrefix(method, MethodSkipInterface) || strings.HasPrefix(method, MethodCidr)
 }
 
 // AutoDetectCIDR auto-detects the IP and Network using the requested detection method.
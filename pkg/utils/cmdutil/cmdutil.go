@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -101,6 +102,18 @@ func RunCmd(dryRun bool, command string, args ...string) (*ExecCmd, error) {
 	return RunCmdWithContext(context.TODO(), dryRun, command, args...)
 }
 
+// RunKubectlWithContext run kubectl with args and returns the stdout, the error wraps the stderr of kubectl
+func RunKubectlWithContext(ctx context.Context, dryRun bool, args ...string) (string, error) {
+	ec, err := RunCmdWithContext(ctx, dryRun, "kubectl", args...)
+	if ec == nil {
+		return "", err
+	}
+	if err != nil {
+		return ec.StdOut(), fmt.Errorf("%w: %s", err, strings.TrimSpace(ec.StdErr()))
+	}
+	return ec.StdOut(), nil
+}
+
 // CmdPipeline run pipe command like cat a | grep -i "bla"
 func CmdPipeline(cmds ...*exec.Cmd) (pipeLineOutput, collectedStandardError []byte, pipeLineError error) {
 	// Require at least one command
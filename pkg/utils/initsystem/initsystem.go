@@ -16,6 +16,11 @@ limitations under the License.
 
 package initsystem
 
+import (
+	"fmt"
+	"time"
+)
+
 // InitSystem is the interface that describe behaviors of an init system
 type InitSystem interface {
 	// return a string describing how to enable a service
@@ -39,3 +44,26 @@ type InitSystem interface {
 	// ServiceIsActive ensures the service is running, or attempting to run. (crash looping in the case of kubelet)
 	ServiceIsActive(service string) bool
 }
+
+// serviceActivePollInterval the interval of polling the service status in WaitServiceActive
+const serviceActivePollInterval = time.Second
+
+// WaitServiceActive polls the init system until the service is active, or returns an error after timeout.
+func WaitServiceActive(name string, timeout time.Duration) error {
+	initSystem, err := GetInitSystem()
+	if err != nil {
+		return err
+	}
+	return waitServiceActive(initSystem, name, serviceActivePollInterval, timeout)
+}
+
+func waitServiceActive(initSystem InitSystem, name string, interval, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !initSystem.ServiceIsActive(name) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for service %s to be active after %s", name, timeout)
+		}
+		time.Sleep(interval)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package initsystem
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeInitSystem struct {
+	InitSystem
+	activeAfter int
+	checks      int
+}
+
+func (f *fakeInitSystem) ServiceIsActive(_ string) bool {
+	f.checks++
+	return f.checks > f.activeAfter
+}
+
+func TestWaitServiceActive(t *testing.T) {
+	f := &fakeInitSystem{activeAfter: 2}
+	if err := waitServiceActive(f, "kubelet", time.Millisecond, time.Second); err != nil {
+		t.Fatalf("waitServiceActive() error = %v", err)
+	}
+	if f.checks != 3 {
+		t.Errorf("waitServiceActive() want 3 checks, got %d", f.checks)
+	}
+
+	f = &fakeInitSystem{activeAfter: 1 << 30}
+	if err := waitServiceActive(f, "kubelet", time.Millisecond, 20*time.Millisecond); err == nil {
+		t.Error("waitServiceActive() want the timeout error, got nil")
+	}
+}